@@ -0,0 +1,142 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is sent with every error response
+const ContentType = "application/problem+json"
+
+// TypePrefix is where the catalogue serves each code, which problems link to
+// as their type
+const TypePrefix = "/errors/"
+
+// Error is an error to report to the client, as an RFC 7807 problem
+type Error struct {
+	Code Code
+	// Detail explains this occurrence to the client. It must not carry
+	// internal details such as database errors.
+	Detail string
+	// Extensions are added to the problem as extra members
+	Extensions map[string]any
+	// Err is the cause, for the logs. It's never sent to the client.
+	Err error
+}
+
+// New returns an error with code, described to the client by detail
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Wrap returns an error with code caused by err, described to the client by
+// detail
+func Wrap(code Code, err error, detail string) *Error {
+	return &Error{Code: code, Detail: detail, Err: err}
+}
+
+// FieldError says which field of a request is wrong and why
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Invalid returns a validation error listing the fields at fault, with the
+// first reason as the detail
+func Invalid(fields ...FieldError) *Error {
+	e := New(CodeValidationFailed, "")
+	if len(fields) > 0 {
+		e.Detail = fields[0].Reason
+	}
+	return e.With("errors", fields)
+}
+
+// With adds the member key to the problem
+func (e *Error) With(key string, value any) *Error {
+	if e.Extensions == nil {
+		e.Extensions = map[string]any{}
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+func (e *Error) Error() string {
+	message := string(e.Code)
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status of the error's code
+func (e *Error) Status() int {
+	if entry, ok := Lookup(e.Code); ok {
+		return entry.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Problem returns the problem document reporting the error, for the request
+// to instance
+func (e *Error) Problem(instance string) map[string]any {
+	entry, ok := Lookup(e.Code)
+	if !ok {
+		entry, _ = Lookup(CodeInternal)
+	}
+	problem := map[string]any{}
+	for key, value := range e.Extensions {
+		problem[key] = value
+	}
+	problem["type"] = TypePrefix + string(entry.Code)
+	problem["title"] = entry.Title
+	problem["status"] = entry.Status
+	problem["code"] = entry.Code
+	if e.Detail != "" {
+		problem["detail"] = e.Detail
+	}
+	if instance != "" {
+		problem["instance"] = instance
+	}
+	return problem
+}
+
+// Abort stops the request and responds with err as a problem. Errors other
+// than *Error are reported as internal errors, without their message.
+func Abort(c *gin.Context, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Wrap(CodeInternal, err, "")
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(e.Status(), e.Problem(c.Request.URL.Path))
+}
+
+// FromBinding describes why a request body couldn't be read into a value:
+// a value of the wrong type is a validation error, and anything else is an
+// invalid request
+func FromBinding(err error) *Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return Invalid(FieldError{
+			Field:  typeErr.Field,
+			Reason: fmt.Sprintf("%s must be a %s, not a %s", typeErr.Field, typeErr.Type.Kind(), typeErr.Value),
+		})
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Wrap(CodeInvalidRequest, err, "Request body is not valid JSON")
+	}
+	return Wrap(CodeInvalidRequest, err, "Request body couldn't be read")
+}
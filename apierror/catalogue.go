@@ -0,0 +1,121 @@
+package apierror
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Code identifies a kind of error. Codes are stable: clients may branch on
+// them, so one is never renamed or given another status, only added.
+type Code string
+
+// Request errors
+const (
+	CodeInvalidRequest   Code = "invalid_request"
+	CodeValidationFailed Code = "validation_failed"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+)
+
+// Authentication and authorization errors
+const (
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeInvalidSignature   Code = "invalid_signature"
+	CodeForbidden          Code = "forbidden"
+)
+
+// Errors about the records a request refers to
+const (
+	CodeNotFound          Code = "not_found"
+	CodeConflict          Code = "conflict"
+	CodeInvalidCartItem   Code = "invalid_cart_item"
+	CodeEmptyCart         Code = "empty_cart"
+	CodeInsufficientStock Code = "insufficient_stock"
+	CodeInvalidReturn     Code = "invalid_return"
+	CodeInvalidTransition Code = "invalid_transition"
+	CodePaymentDeclined   Code = "payment_declined"
+)
+
+// Server errors
+const (
+	CodeInternal       Code = "internal"
+	CodeUpstreamFailed Code = "upstream_failed"
+	CodeUnavailable    Code = "unavailable"
+)
+
+// Entry describes an error code in the catalogue
+type Entry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+var catalogue = []Entry{
+	{CodeInvalidRequest, http.StatusBadRequest, "Invalid request",
+		"The request body or parameters couldn't be read, for example JSON that doesn't parse or an unknown format."},
+	{CodeValidationFailed, http.StatusUnprocessableEntity, "Validation failed",
+		"The request was read but some of its values aren't allowed. The errors member lists each field and why."},
+	{CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "Payload too large",
+		"The request body is bigger than the endpoint accepts."},
+	{CodeMethodNotAllowed, http.StatusMethodNotAllowed, "Method not allowed",
+		"The path exists but doesn't take this method."},
+
+	{CodeUnauthorized, http.StatusUnauthorized, "Authentication required",
+		"The request has no bearer token, or its token is invalid or expired. Log in again for a new one."},
+	{CodeInvalidCredentials, http.StatusUnauthorized, "Invalid credentials",
+		"The email or password is wrong. Which one isn't said, so accounts can't be discovered."},
+	{CodeInvalidSignature, http.StatusUnauthorized, "Invalid signature",
+		"A webhook's signature header doesn't match its payload."},
+	{CodeForbidden, http.StatusForbidden, "Forbidden",
+		"The caller is authenticated but isn't allowed to do this."},
+
+	{CodeNotFound, http.StatusNotFound, "Not found",
+		"The record or path the request refers to doesn't exist. The detail says which."},
+	{CodeConflict, http.StatusConflict, "Conflict",
+		"The request clashes with a record that exists, or with the state a record is in, such as a second user with the same email or capturing a payment twice."},
+	{CodeInvalidCartItem, http.StatusUnprocessableEntity, "Invalid cart item",
+		"The product doesn't exist, isn't in stock, or the quantity is out of range."},
+	{CodeEmptyCart, http.StatusUnprocessableEntity, "Cart is empty",
+		"An order can't be placed with nothing in the cart."},
+	{CodeInsufficientStock, http.StatusConflict, "Insufficient stock",
+		"There's less of a product in stock than the order asks for. The detail says which product."},
+	{CodeInvalidReturn, http.StatusUnprocessableEntity, "Invalid return",
+		"The order can't be returned yet, or the items asked for weren't bought or are already being returned."},
+	{CodeInvalidTransition, http.StatusConflict, "Invalid status change",
+		"The order can't move from its current status to the one asked for."},
+	{CodePaymentDeclined, http.StatusPaymentRequired, "Payment declined",
+		"The order's payment was declined or failed, so the order wasn't placed: its stock and coupon were given back and the cart is as it was. The order_id and payment members describe them."},
+
+	{CodeInternal, http.StatusInternalServerError, "Internal server error",
+		"Something went wrong on the server. It has been logged under the X-Request-ID sent back with the response."},
+	{CodeUpstreamFailed, http.StatusBadGateway, "Upstream service failed",
+		"A service the request depends on, such as the payment provider, failed. Retrying later may work."},
+	{CodeUnavailable, http.StatusServiceUnavailable, "Service unavailable",
+		"The server isn't ready for traffic, for example while it's starting or shutting down."},
+}
+
+// Catalogue returns every error code, sorted by status then code
+func Catalogue() []Entry {
+	entries := slices.Clone(catalogue)
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if a.Status != b.Status {
+			return a.Status - b.Status
+		}
+		if a.Code < b.Code {
+			return -1
+		}
+		return 1
+	})
+	return entries
+}
+
+// Lookup returns the catalogue entry of code
+func Lookup(code Code) (Entry, bool) {
+	i := slices.IndexFunc(catalogue, func(entry Entry) bool { return entry.Code == code })
+	if i < 0 {
+		return Entry{}, false
+	}
+	return catalogue[i], true
+}
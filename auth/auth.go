@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -9,18 +10,25 @@ import (
 // Secret key for signing JWT tokens (should be kept safe)
 var jwtKey = []byte("my_secret_key")
 
-// Claims defines the structure of JWT claims
+// SetJWTKey sets the key JWTs and guest cart tokens are signed with. Tokens
+// signed with the previous key stop being valid.
+func SetJWTKey(key []byte) {
+	jwtKey = key
+}
+
+// Claims defines the structure of JWT claims. The user's ID is the subject.
 type Claims struct {
 	Email string `json:"email"`
 	jwt.StandardClaims
 }
 
-// GenerateJWT generates a JWT token for a given username
-func GenerateJWT(email string) (string, error) {
+// GenerateJWT generates a JWT token for the user with the given ID and email
+func GenerateJWT(userID uint, email string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		Email: email,
 		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatUint(uint64(userID), 10),
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
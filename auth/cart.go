@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CartCookie is the cookie holding an anonymous visitor's cart token
+const CartCookie = "cart_token"
+
+// CartHeader carries the cart token for clients that don't keep cookies
+const CartHeader = "X-Cart-Token"
+
+// DefaultCartTokenLifetime is how long a cart token lasts unless configured
+const DefaultCartTokenLifetime = 30 * 24 * time.Hour
+
+var errInvalidCartToken = errors.New("invalid cart token")
+
+// CartTokens says how guest cart tokens, and the cookie holding them, are
+// issued
+type CartTokens struct {
+	Lifetime time.Duration // How long a token lasts once issued
+	Secure   bool          // Only send the cookie over HTTPS
+}
+
+// DefaultCartTokens returns the settings of cart tokens when none are given
+func DefaultCartTokens() CartTokens {
+	return CartTokens{Lifetime: DefaultCartTokenLifetime}
+}
+
+// SetCookie hands token to the client as the cart cookie
+func (t CartTokens) SetCookie(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CartCookie, token, int(t.Lifetime.Seconds()), "/", "", t.Secure, true)
+}
+
+// ClearCookie tells the client to forget its cart cookie
+func (t CartTokens) ClearCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(CartCookie, "", -1, "/", "", t.Secure, true)
+}
+
+// NewCartToken generates a random guest cart ID and returns it along with the
+// signed token handed to the client, which lasts for lifetime.
+func NewCartToken(lifetime time.Duration) (string, string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	id := hex.EncodeToString(raw)
+	return id, cartToken(id, time.Now().Add(lifetime)), nil
+}
+
+// ParseCartToken checks the signature and expiry of a cart token and returns
+// the cart ID
+func ParseCartToken(token string) (string, error) {
+	id, _, err := parseCartToken(token)
+	return id, err
+}
+
+// parseCartToken returns the cart ID of a valid token and when it expires
+func parseCartToken(token string) (string, time.Time, error) {
+	id, rest, _ := strings.Cut(token, ".")
+	expiry, signature, found := strings.Cut(rest, ".")
+	if !found || id == "" {
+		return "", time.Time{}, errInvalidCartToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(signCartToken(id, expiry))) {
+		return "", time.Time{}, errInvalidCartToken
+	}
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", time.Time{}, errInvalidCartToken
+	}
+	expires := time.Unix(seconds, 0)
+	if !time.Now().Before(expires) {
+		return "", time.Time{}, errInvalidCartToken
+	}
+	return id, expires, nil
+}
+
+// cartToken returns the token for cart id, expiring at expires
+func cartToken(id string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return id + "." + expiry + "." + signCartToken(id, expiry)
+}
+
+func signCartToken(id, expiry string) string {
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte("cart:" + id + "." + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
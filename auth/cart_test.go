@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseCartToken(t *testing.T) {
+	id, token, err := NewCartToken(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ParseCartToken(token); err != nil || got != id {
+		t.Fatalf("parsed cart %q (%v), want %q", got, err, id)
+	}
+
+	other, _, err := NewCartToken(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := strings.Cut(token, ".")
+	signature := rest[strings.Index(rest, ".")+1:]
+	extended := id + "." + strconv.FormatInt(time.Now().Add(365*24*time.Hour).Unix(), 10) + "." + signature
+	for name, token := range map[string]string{
+		"empty":          "",
+		"unsigned":       id,
+		"another cart's": other + "." + rest,
+		"expired":        cartToken(id, time.Now().Add(-time.Minute)),
+		"extended":       extended,
+	} {
+		if _, err := ParseCartToken(token); err == nil {
+			t.Errorf("accepted a %s token", name)
+		}
+	}
+}
+
+// serveCart runs CartTokenMiddleware over a request with token, if any,
+// returning the cart ID it found and the token it handed back, if any
+func serveCart(t *testing.T, tokens CartTokens, token string) (string, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var id string
+	engine := gin.New()
+	engine.GET("/cart", CartTokenMiddleware(tokens), func(c *gin.Context) {
+		id = c.GetString("cart_id")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+	if token != "" {
+		req.Header.Set(CartHeader, token)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return id, w.Header().Get(CartHeader)
+}
+
+func TestCartTokenMiddleware(t *testing.T) {
+	tokens := CartTokens{Lifetime: time.Hour}
+
+	id, issued := serveCart(t, tokens, "")
+	if id == "" || issued == "" {
+		t.Fatalf("a new visitor got cart %q and token %q", id, issued)
+	}
+	if got, renewed := serveCart(t, tokens, issued); got != id || renewed != "" {
+		t.Errorf("a fresh token gave cart %q and token %q, want %q kept as it was", got, renewed, id)
+	}
+
+	// Renewed once past half its lifetime, so a cart in use isn't lost
+	aging := cartToken(id, time.Now().Add(20*time.Minute))
+	got, renewed := serveCart(t, tokens, aging)
+	if got != id || renewed == "" {
+		t.Fatalf("an aging token gave cart %q and token %q, want %q renewed", got, renewed, id)
+	}
+	if _, expires, err := parseCartToken(renewed); err != nil || time.Until(expires) < 59*time.Minute {
+		t.Errorf("renewed token expires %v (%v), want in an hour", expires, err)
+	}
+
+	expired := cartToken(id, time.Now().Add(-time.Minute))
+	if got, issued := serveCart(t, tokens, expired); got == id || issued == "" {
+		t.Errorf("an expired token gave cart %q and token %q, want a new cart", got, issued)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/Rohanrevanth/e-store-go/auth
 go 1.23.1
 
 require (
+	github.com/Rohanrevanth/e-store-go/apierror v0.0.0-00010101000000-000000000000
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.10.0
 )
@@ -35,3 +36,5 @@ require (
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/Rohanrevanth/e-store-go/apierror => ../apierror
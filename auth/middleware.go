@@ -1,9 +1,10 @@
 package auth
 
 import (
-	"net/http"
 	"strings"
+	"time"
 
+	"github.com/Rohanrevanth/e-store-go/apierror"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,21 +13,72 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authorizationHeader := c.GetHeader("Authorization")
 		if authorizationHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			apierror.Abort(c, apierror.New(apierror.CodeUnauthorized, "Authorization header is required"))
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authorizationHeader, "Bearer ")
 		claims, err := ValidateJWT(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			apierror.Abort(c, apierror.Wrap(apierror.CodeUnauthorized, err, "Invalid token"))
 			return
 		}
 
 		// Store user information in context
 		c.Set("email", claims.Email)
+		c.Set("user_id", claims.Subject)
 		c.Next()
 	}
 }
+
+// CartTokenMiddleware identifies anonymous shoppers by a signed cart token,
+// issuing a new one as tokens says when the request has none or its token is
+// invalid or expired. A token past half its lifetime is replaced with one for
+// the same cart, so a cart that's in use isn't lost. The guest cart ID is
+// stored in the context as "cart_id".
+func CartTokenMiddleware(tokens CartTokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, expires, err := parseCartToken(requestCartToken(c))
+		if err != nil {
+			var token string
+			id, token, err = NewCartToken(tokens.Lifetime)
+			if err != nil {
+				apierror.Abort(c, apierror.Wrap(apierror.CodeInternal, err, "Failed to create cart token"))
+				return
+			}
+			tokens.SetCookie(c, token)
+			c.Header(CartHeader, token)
+		} else if time.Until(expires) < tokens.Lifetime/2 {
+			token := cartToken(id, time.Now().Add(tokens.Lifetime))
+			tokens.SetCookie(c, token)
+			c.Header(CartHeader, token)
+		}
+
+		c.Set("cart_id", id)
+		c.Next()
+	}
+}
+
+// CartIDFromRequest returns the guest cart ID from the request's cart token,
+// looking at the header first and then the cookie.
+func CartIDFromRequest(c *gin.Context) (string, bool) {
+	token := requestCartToken(c)
+	if token == "" {
+		return "", false
+	}
+	id, err := ParseCartToken(token)
+	if err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// requestCartToken returns the request's cart token from the header, or else
+// the cookie
+func requestCartToken(c *gin.Context) string {
+	if token := c.GetHeader(CartHeader); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(CartCookie)
+	return token
+}
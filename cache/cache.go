@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Cache is a key-value store for data that can be loaded again if it's lost.
+// A TTL of zero keeps a value until it's deleted or evicted.
+type Cache interface {
+	// Get returns ErrMiss if key isn't cached
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+var (
+	// ErrMiss is returned by Get for a key that isn't cached
+	ErrMiss = errors.New("cache miss")
+	// ErrUnavailable is returned while a cache can't be reached
+	ErrUnavailable = errors.New("cache unavailable")
+)
@@ -0,0 +1,50 @@
+module github.com/Rohanrevanth/e-store-go/cache
+
+go 1.23.1
+
+replace github.com/Rohanrevanth/e-store-go/database => ../database
+
+replace github.com/Rohanrevanth/e-store-go/events => ../events
+
+replace github.com/Rohanrevanth/e-store-go/logging => ../logging
+
+replace github.com/Rohanrevanth/e-store-go/models => ../models
+
+replace github.com/Rohanrevanth/e-store-go/notify => ../notify
+
+require (
+	github.com/Rohanrevanth/e-store-go/database v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/events v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/models v0.0.0-00010101000000-000000000000
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/go-redis/redis/v8 v8.11.5
+	golang.org/x/sync v0.8.0
+)
+
+require (
+	github.com/Rohanrevanth/e-store-go/logging v0.0.0-00010101000000-000000000000 // indirect
+	github.com/Rohanrevanth/e-store-go/notify v0.0.0-00010101000000-000000000000 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/go-sql-driver/mysql v1.7.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/pgx/v5 v5.5.5 // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	github.com/mattn/go-sqlite3 v1.14.22 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.opentelemetry.io/otel v1.32.0 // indirect
+	go.opentelemetry.io/otel/metric v1.32.0 // indirect
+	go.opentelemetry.io/otel/trace v1.32.0 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	gorm.io/driver/mysql v1.5.7 // indirect
+	gorm.io/driver/postgres v1.5.9 // indirect
+	gorm.io/driver/sqlite v1.5.6 // indirect
+	gorm.io/gorm v1.25.12 // indirect
+)
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisCache keeps entries in Redis, so they're shared by every server. When
+// a command fails, Redis is treated as down for RetryAfter: every call
+// returns ErrUnavailable straight away instead of waiting on a dead server,
+// and the callers fall back to the database.
+type RedisCache struct {
+	client     redis.UniversalClient
+	prefix     string
+	Timeout    time.Duration // Longest a command may take
+	RetryAfter time.Duration // How long to skip Redis after a failure
+	Logger     *slog.Logger
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewRedisCache returns a cache on client whose keys all start with prefix
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{
+		client:     client,
+		prefix:     prefix,
+		Timeout:    200 * time.Millisecond,
+		RetryAfter: 5 * time.Second,
+		Logger:     slog.Default(),
+	}
+}
+
+// ConnectRedis returns a cache on the Redis server at url (such as
+// redis://:password@localhost:6379/0). It doesn't fail if the server is down,
+// as the cache will keep trying it.
+func ConnectRedis(url string) (*RedisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("ConnectRedis: %v", err)
+	}
+	c := NewRedisCache(redis.NewClient(opts), "e-store:")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		c.failed(err)
+	} else {
+		c.Logger.Info("Connected to Redis")
+	}
+	return c, nil
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel, err := r.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, r.done(err)
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel, err := r.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return r.done(r.client.Set(ctx, r.prefix+key, value, ttl).Err())
+}
+
+func (r *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ctx, cancel, err := r.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	return r.done(r.client.Del(ctx, prefixed...).Err())
+}
+
+// Ping checks Redis can be reached. While Redis is being skipped after a
+// failure, it returns ErrUnavailable without trying.
+func (r *RedisCache) Ping(ctx context.Context) error {
+	ctx, cancel, err := r.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return r.done(r.client.Ping(ctx).Err())
+}
+
+// AddHook adds a hook run around every command, such as for tracing
+func (r *RedisCache) AddHook(hook redis.Hook) {
+	r.client.AddHook(hook)
+}
+
+// Close closes the connection to Redis
+func (r *RedisCache) Close() error {
+	return r.client.Close()
+}
+
+// start returns the context for a command, or ErrUnavailable while Redis is
+// being skipped
+func (r *RedisCache) start(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	r.mu.Lock()
+	down := time.Now().Before(r.downUntil)
+	r.mu.Unlock()
+	if down {
+		return nil, nil, ErrUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	return ctx, cancel, nil
+}
+
+// done notes whether a command worked
+func (r *RedisCache) done(err error) error {
+	if err == nil {
+		r.mu.Lock()
+		if !r.downUntil.IsZero() {
+			r.Logger.Info("Redis is available again")
+			r.downUntil = time.Time{}
+		}
+		r.mu.Unlock()
+		return nil
+	}
+	r.failed(err)
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+func (r *RedisCache) failed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.downUntil.IsZero() {
+		r.Logger.Warn("Redis is unavailable, skipping the cache", "retry_after", r.RetryAfter, "error", err)
+	}
+	r.downUntil = time.Now().Add(r.RetryAfter)
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	categoriesKey = "categories"
+	// productsGenerationKey holds the generation that product list keys
+	// include. Changing it invalidates every list at once, including the
+	// per-category ones, without having to know which are cached.
+	productsGenerationKey = "products:generation"
+)
+
+func userKey(id string) string {
+	return "user:" + id
+}
+
+// Store reads categories, product lists and users by ID through a cache,
+// falling back to the underlying store on a miss or when the cache is
+// unavailable. What the store's changes make stale is invalidated by the
+// handlers Subscribe adds as their events are dispatched; a change whose
+// event a server doesn't dispatch shows up in that server's in-process cache
+// once the entries expire.
+type Store struct {
+	database.Store
+	cache Cache
+	// TTL is how long entries are cached for, give or take 10% so that
+	// entries cached together don't all expire together
+	TTL    time.Duration
+	Logger *slog.Logger // Logs problems with the cache, which reads get past
+
+	group  singleflight.Group
+	writes atomic.Uint64 // Counts invalidations, so a load that raced one isn't cached
+}
+
+var _ database.Store = (*Store)(nil)
+
+// NewStore returns store with reads cached in cache for ttl
+func NewStore(store database.Store, cache Cache, ttl time.Duration) *Store {
+	return &Store{Store: store, cache: cache, TTL: ttl, Logger: slog.Default()}
+}
+
+// Subscribe has the entries that the store's changes make stale invalidated
+// as their events are dispatched on bus
+func Subscribe(bus *events.Bus, store *Store) {
+	events.Subscribe(bus, "invalidate-cache", func(ctx context.Context, event models.CategoryChanged) error {
+		store.invalidate(ctx, categoriesKey)
+		return nil
+	})
+	events.Subscribe(bus, "invalidate-cache", func(ctx context.Context, event models.ProductChanged) error {
+		store.invalidateProducts(ctx)
+		return nil
+	})
+	events.Subscribe(bus, "invalidate-cache", func(ctx context.Context, event models.StockChanged) error {
+		store.invalidateProducts(ctx)
+		return nil
+	})
+	events.Subscribe(bus, "invalidate-cache", func(ctx context.Context, event models.UserChanged) error {
+		store.invalidate(ctx, userKey(strconv.FormatUint(uint64(event.UserID), 10)))
+		return nil
+	})
+}
+
+func (s *Store) GetAllCategories(ctx context.Context) ([]models.Category, error) {
+	return readThrough(ctx, s, categoriesKey, s.Store.GetAllCategories)
+}
+
+func (s *Store) GetBestSellers(ctx context.Context) ([]models.Product, error) {
+	return readThrough(ctx, s, s.productsKey(ctx, "best-sellers"), s.Store.GetBestSellers)
+}
+
+func (s *Store) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	return readThrough(ctx, s, s.productsKey(ctx, "all"), s.Store.GetAllProducts)
+}
+
+func (s *Store) GetProducts(ctx context.Context, category string) ([]models.Product, error) {
+	return readThrough(ctx, s, s.productsKey(ctx, "category:"+category), func(ctx context.Context) ([]models.Product, error) {
+		return s.Store.GetProducts(ctx, category)
+	})
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	return readThrough(ctx, s, userKey(id), func(ctx context.Context) (models.User, error) {
+		return s.Store.GetUserByID(ctx, id)
+	})
+}
+
+// readThrough returns the cached value of key, or loads and caches it. While
+// a key is being loaded, other callers wait for that load rather than all
+// going to the database at once. An empty key skips the cache.
+func readThrough[T any](ctx context.Context, s *Store, key string, load func(context.Context) (T, error)) (T, error) {
+	if key == "" {
+		return load(ctx)
+	}
+	cached, err := s.cache.Get(ctx, key)
+	if err == nil {
+		var value T
+		if err := json.Unmarshal(cached, &value); err == nil {
+			return value, nil
+		}
+		s.Logger.Error("Error decoding cached entry", "key", key, "error", err)
+	} else if !errors.Is(err, ErrMiss) && !errors.Is(err, ErrUnavailable) {
+		s.Logger.Error("Error reading from the cache", "key", key, "error", err)
+	}
+
+	value, err, _ := s.group.Do(key, func() (interface{}, error) {
+		// The load is shared by every caller waiting on it, so one of them
+		// going away mustn't cancel it for the others
+		ctx := context.WithoutCancel(ctx)
+		writes := s.writes.Load()
+		value, err := load(ctx)
+		if err != nil || s.writes.Load() != writes {
+			return value, err
+		}
+		if encoded, err := json.Marshal(value); err != nil {
+			s.Logger.Error("Error encoding entry for the cache", "key", key, "error", err)
+		} else {
+			s.cache.Set(ctx, key, encoded, s.ttl()) // A cache that's down has said so already
+		}
+		return value, nil
+	})
+	return value.(T), err
+}
+
+func (s *Store) ttl() time.Duration {
+	jitter := s.TTL / 5
+	if jitter <= 0 {
+		return s.TTL
+	}
+	return s.TTL - jitter/2 + rand.N(jitter)
+}
+
+// productsKey returns the key of a product list in the current generation,
+// or an empty key if the generation can't be read
+func (s *Store) productsKey(ctx context.Context, name string) string {
+	generation, err := s.cache.Get(ctx, productsGenerationKey)
+	if errors.Is(err, ErrMiss) {
+		generation = newGeneration()
+		err = s.cache.Set(ctx, productsGenerationKey, generation, 0)
+	}
+	if err != nil {
+		return ""
+	}
+	return "products:" + string(generation) + ":" + name
+}
+
+// invalidateProducts and invalidate run after a write, which has happened even
+// if whatever dispatched its event has since been cancelled
+func (s *Store) invalidateProducts(ctx context.Context) {
+	s.writes.Add(1)
+	if err := s.cache.Set(context.WithoutCancel(ctx), productsGenerationKey, newGeneration(), 0); err != nil && !errors.Is(err, ErrUnavailable) {
+		s.Logger.Error("Error invalidating cached products", "error", err)
+	}
+}
+
+func (s *Store) invalidate(ctx context.Context, keys ...string) {
+	s.writes.Add(1)
+	for _, key := range keys {
+		s.group.Forget(key)
+	}
+	if err := s.cache.Delete(context.WithoutCancel(ctx), keys...); err != nil && !errors.Is(err, ErrUnavailable) {
+		s.Logger.Error("Error invalidating cached entries", "keys", keys, "error", err)
+	}
+}
+
+func newGeneration() []byte {
+	return strconv.AppendInt(nil, time.Now().UnixNano(), 36)
+}
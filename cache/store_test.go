@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// TestStore checks reads are served from the cache, and that a change is
+// seen once its event is dispatched, on an LRU cache, on Redis, and on Redis
+// while it's down, when every read goes to the database
+func TestStore(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	redisCache := NewRedisCache(redis.NewClient(&redis.Options{Addr: redisServer.Addr()}), "test:")
+	defer redisCache.Close()
+	stopped := miniredis.NewMiniRedis()
+	if err := stopped.Start(); err != nil {
+		t.Fatal(err)
+	}
+	downAddr := stopped.Addr()
+	stopped.Close()
+	downCache := NewRedisCache(redis.NewClient(&redis.Options{Addr: downAddr}), "test:")
+	defer downCache.Close()
+
+	caches := []struct {
+		name   string
+		cache  Cache
+		cached bool // Whether reads are served from the cache
+	}{
+		{"lru", NewLRUCache(100), true},
+		{"redis", redisCache, true},
+		{"redis down", downCache, false},
+	}
+	for _, tc := range caches {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			// Changes made straight to memory have their events left in the
+			// outbox, standing in for those dispatched by another server
+			memory := database.NewMemoryStore()
+			cached := NewStore(memory, tc.cache, time.Minute)
+			bus := events.NewBus()
+			Subscribe(bus, cached)
+			store := events.NewStore(cached, events.NewDispatcher(memory, bus))
+
+			// stale returns want if the cache serves reads, and fresh if not
+			stale := func(want, fresh int) int {
+				if tc.cached {
+					return want
+				}
+				return fresh
+			}
+
+			if err := store.AddCategory(ctx, models.Category{Name: "Mugs"}); err != nil {
+				t.Fatal(err)
+			}
+			expectCategories(t, cached, 1)
+			if err := memory.AddCategory(ctx, models.Category{Name: "Lamps"}); err != nil {
+				t.Fatal(err)
+			}
+			expectCategories(t, cached, stale(1, 2))
+			if err := store.AddCategory(ctx, models.Category{Name: "Shelves"}); err != nil {
+				t.Fatal(err)
+			}
+			expectCategories(t, cached, 3)
+
+			if err := store.AddProduct(ctx, models.Product{Name: "Mug", Category: "Mugs", Price: 9, Stock: 5}); err != nil {
+				t.Fatal(err)
+			}
+			mug := expectStock(t, cached, 5)
+			if _, err := memory.AdjustStock(ctx, mug.ID, -1); err != nil {
+				t.Fatal(err)
+			}
+			expectStock(t, cached, stale(5, 4))
+			if _, err := store.AdjustStock(ctx, mug.ID, -1); err != nil {
+				t.Fatal(err)
+			}
+			expectStock(t, cached, 3)
+
+			if err := store.AddUser(ctx, models.User{Username: "before", Email: "user@example.com"}); err != nil {
+				t.Fatal(err)
+			}
+			user, err := memory.GetUserByEmail(ctx, "user@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := strconv.FormatUint(uint64(user.ID), 10)
+			expectUsername(t, cached, id, "before")
+			user.Username = "elsewhere"
+			if err := memory.SaveUser(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if tc.cached {
+				expectUsername(t, cached, id, "before")
+			} else {
+				expectUsername(t, cached, id, "elsewhere")
+			}
+			user.Username = "after"
+			if err := store.SaveUser(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			expectUsername(t, cached, id, "after")
+		})
+	}
+}
+
+func expectCategories(t *testing.T, store *Store, want int) {
+	t.Helper()
+	categories, err := store.GetAllCategories(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != want {
+		t.Fatalf("got %d categories, want %d", len(categories), want)
+	}
+}
+
+// expectStock checks the one product, listed in all products and in its
+// category, has want in stock, and returns it
+func expectStock(t *testing.T, store *Store, want int) models.Product {
+	t.Helper()
+	all, err := store.GetAllProducts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mugs, err := store.GetProducts(context.Background(), "Mugs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, products := range [][]models.Product{all, mugs} {
+		if len(products) != 1 || products[0].Stock != want {
+			t.Fatalf("got %v, want one product with %d in stock", products, want)
+		}
+	}
+	return all[0]
+}
+
+func expectUsername(t *testing.T, store *Store, id string, want string) {
+	t.Helper()
+	user, err := store.GetUserByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != want {
+		t.Fatalf("got user %q, want %q", user.Username, want)
+	}
+}
@@ -0,0 +1,196 @@
+package catalog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// ExportKinds are the record kinds Export can write
+var ExportKinds = []string{"products", "categories", "orders", "customers"}
+
+// export is what Export needs to know about one kind of record
+type export struct {
+	columns []string
+	// write loads the records and passes each to emit, as the object written
+	// to JSON Lines along with its CSV rows
+	write func(ctx context.Context, e Exporter, emit emitFunc) error
+}
+
+type emitFunc func(object interface{}, rows ...[]string) error
+
+var exports = map[string]export{
+	"products":   {productColumns, writeProducts},
+	"categories": {[]string{"id", "name", "description", "image"}, writeCategories},
+	"orders": {[]string{"order_id", "created_at", "user_id", "email", "status", "payment_method", "coupon_code",
+		"discount", "total_price", "product_id", "sku", "product_name", "quantity", "price", "returned"}, writeOrders},
+	"customers": {[]string{"id", "username", "email", "orders_count", "saved_address", "created_at"}, writeCustomers},
+}
+
+// Exporter reads the records to export from its stores
+type Exporter struct {
+	Products database.ProductStore
+	Orders   database.OrderStore
+	Users    database.UserStore
+}
+
+// NewExporter returns an exporter reading everything from store
+func NewExporter(store database.Store) Exporter {
+	return Exporter{Products: store, Orders: store, Users: store}
+}
+
+// Export writes every record of kind (one of ExportKinds) to w. In JSON Lines
+// each record is one object, as the API returns it; in CSV orders have a row
+// per item. Products are written with the columns Import reads, so an export
+// can be edited and imported again. Nothing is written if the records can't
+// be loaded.
+func (e Exporter) Export(ctx context.Context, kind string, format Format, w io.Writer) error {
+	exp, ok := exports[kind]
+	if !ok {
+		return fmt.Errorf("Export: unknown kind %q, use one of %s", kind, strings.Join(ExportKinds, ", "))
+	}
+	if format != FormatCSV && format != FormatJSONL {
+		return fmt.Errorf("Export: unknown format %q", format)
+	}
+
+	if format == FormatJSONL {
+		encoder := json.NewEncoder(w)
+		err := exp.write(ctx, e, func(object interface{}, _ ...[]string) error {
+			return encoder.Encode(object)
+		})
+		if err != nil {
+			return fmt.Errorf("Export: %v", err)
+		}
+		return nil
+	}
+
+	// The header waits for the first record so that nothing is written if
+	// loading fails
+	writer := csv.NewWriter(w)
+	header := false
+	writeHeader := func() error {
+		if header {
+			return nil
+		}
+		header = true
+		return writer.Write(exp.columns)
+	}
+	err := exp.write(ctx, e, func(_ interface{}, rows ...[]string) error {
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		return writer.WriteAll(rows)
+	})
+	if err == nil {
+		err = writeHeader()
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("Export: %v", err)
+	}
+	return nil
+}
+
+func writeProducts(ctx context.Context, e Exporter, emit emitFunc) error {
+	products, err := e.Products.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		err := emit(p, []string{formatUint(p.ID), p.SKU, p.Name, p.Description, p.Details, p.Image, p.Category,
+			formatFloat(p.Price), strconv.Itoa(p.Stock), strconv.FormatBool(p.Isbestseller), strconv.FormatBool(p.Disabled)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCategories(ctx context.Context, e Exporter, emit emitFunc) error {
+	categories, err := e.Products.GetAllCategories(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range categories {
+		if err := emit(c, []string{formatUint(c.ID), c.Name, c.Description, c.Image}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeOrders(ctx context.Context, e Exporter, emit emitFunc) error {
+	orders, err := e.Orders.GetAllOrders(ctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		order := []string{formatUint(o.ID), formatTime(o.CreatedAt), o.UserID, o.Email, o.Status, o.PaymentMethod,
+			o.CouponCode, formatFloat(o.Discount), formatFloat(o.TotalPrice)}
+		var rows [][]string
+		for _, item := range o.OrderItems {
+			rows = append(rows, append(slices.Clone(order), formatUint(item.ProductID), item.Product.SKU, item.Product.Name,
+				strconv.Itoa(item.Quantity), formatFloat(item.Price), strconv.Itoa(item.Returned)))
+		}
+		if len(rows) == 0 {
+			rows = append(rows, append(order, make([]string, 6)...))
+		}
+		if err := emit(o, rows...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// customer is a user as exported, without their password hash
+type customer struct {
+	ID           uint             `json:"id"`
+	Username     string           `json:"username"`
+	Email        string           `json:"email"`
+	OrdersCount  int64            `json:"orders_count"`
+	SavedAddress models.Addresses `json:"saved_address,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+func writeCustomers(ctx context.Context, e Exporter, emit emitFunc) error {
+	users, err := e.Users.GetAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.Type != models.UserTypeCustomer {
+			continue
+		}
+		c := customer{u.ID, u.Username, u.Email, u.OrdersCount, u.SavedAddress, u.CreatedAt}
+		err := emit(c, []string{formatUint(c.ID), c.Username, c.Email, strconv.FormatInt(c.OrdersCount, 10),
+			strings.Join(c.SavedAddress, "; "), formatTime(c.CreatedAt)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatUint(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,51 @@
+package catalog
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a file format for imports and exports
+type Format string
+
+const (
+	FormatCSV   Format = "csv"   // A header row naming the columns, then one record per row
+	FormatJSONL Format = "jsonl" // One JSON object per line (JSON Lines / NDJSON)
+)
+
+// ParseFormat returns the format called name, accepting ndjson for jsonl
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "csv":
+		return FormatCSV, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use csv or jsonl", name)
+}
+
+// FormatOf guesses the format of a file from its content type, or failing
+// that its name.
+func FormatOf(contentType, filename string) (Format, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL, nil
+	}
+	if ext := filepath.Ext(filename); ext != "" {
+		return ParseFormat(ext)
+	}
+	return "", fmt.Errorf("can't tell the format of a %q upload, pass format=csv or format=jsonl", mediaType)
+}
+
+// ContentType is the media type to serve a format as
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
@@ -0,0 +1,306 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMaxErrors is how many row errors an import report lists by default
+const DefaultMaxErrors = 100
+
+// maxLineSize is the longest JSON Lines record an import accepts
+const maxLineSize = 1 << 20
+
+// progressEvery is how many rows an import reads between progress reports
+const progressEvery = 1000
+
+// ImportOptions control a product import
+type ImportOptions struct {
+	// DryRun checks every row and counts what would be created and updated
+	// without writing anything
+	DryRun bool
+	// MaxErrors caps the row errors listed in the report; Failed still counts
+	// all of them. Zero means DefaultMaxErrors.
+	MaxErrors int
+	// Progress, if set, is called with the report so far as the import runs
+	Progress func(ImportReport)
+}
+
+// ImportReport is the outcome of an import
+type ImportReport struct {
+	DryRun  bool       `json:"dry_run"`
+	Rows    int        `json:"rows"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors,omitempty"`
+}
+
+// RowError is a record that couldn't be imported. Row is the line it starts
+// on, counting a CSV header as line 1.
+type RowError struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku,omitempty"`
+	Error string `json:"error"`
+}
+
+// productReader yields the products in an import one at a time. A record
+// that can't be decoded is returned as rowErr so the import can carry on;
+// err ends the import and is io.EOF once every record has been read.
+type productReader interface {
+	next() (row int, product models.Product, rowErr error, err error)
+}
+
+// Import streams products from r and upserts each one by SKU, so a product is
+// only ever held in memory one row at a time. Rows that fail validation are
+// listed in the report and skipped. As with every upsert, stock is only set
+// on products the import creates. The returned error is for problems with the
+// file as a whole, such as a bad CSV header.
+func Import(ctx context.Context, store database.ProductStore, r io.Reader, format Format, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun}
+	if opts.MaxErrors == 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+
+	var reader productReader
+	var err error
+	switch format {
+	case FormatCSV:
+		reader, err = newCSVProductReader(r)
+	case FormatJSONL:
+		reader = newJSONLProductReader(r)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return report, fmt.Errorf("Import: %v", err)
+	}
+
+	fail := func(row int, sku string, err error) {
+		report.Failed++
+		if len(report.Errors) < opts.MaxErrors {
+			report.Errors = append(report.Errors, RowError{Row: row, SKU: sku, Error: err.Error()})
+		}
+	}
+
+	seen := make(map[string]int) // Row each SKU was first seen on
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, fmt.Errorf("Import: %v", err)
+		}
+		row, product, rowErr, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("Import: line %d: %v", row, err)
+		}
+		report.Rows++
+		if opts.Progress != nil && report.Rows%progressEvery == 0 {
+			opts.Progress(report)
+		}
+
+		if rowErr == nil {
+			rowErr = validateProduct(&product)
+		}
+		if rowErr == nil {
+			if first, ok := seen[product.SKU]; ok {
+				rowErr = fmt.Errorf("SKU already imported from row %d", first)
+			}
+		}
+		if rowErr != nil {
+			fail(row, product.SKU, rowErr)
+			continue
+		}
+		seen[product.SKU] = row
+
+		var created bool
+		if opts.DryRun {
+			var found bool
+			_, found, err = store.MatchProduct(ctx, product)
+			created = !found
+		} else {
+			created, err = store.UpsertProduct(ctx, product)
+		}
+		if err != nil {
+			fail(row, product.SKU, err)
+			continue
+		}
+		if created {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+	}
+	return report, nil
+}
+
+// validateProduct tidies an imported product and checks it can be stored
+func validateProduct(product *models.Product) error {
+	product.Model = gorm.Model{} // IDs and timestamps in an export aren't imported
+	product.SKU = strings.TrimSpace(product.SKU)
+	product.Name = strings.TrimSpace(product.Name)
+	switch {
+	case product.SKU == "":
+		return errors.New("sku is required")
+	case len(product.SKU) > 64:
+		return errors.New("sku is longer than 64 characters")
+	case product.Name == "":
+		return errors.New("name is required")
+	case product.Price < 0:
+		return errors.New("price can't be negative")
+	case product.Stock < 0:
+		return errors.New("stock can't be negative")
+	}
+	return nil
+}
+
+// productColumns are the CSV columns of a product, in export order. Import
+// ignores id.
+var productColumns = []string{"id", "sku", "name", "description", "details", "image", "category", "price", "stock", "isbestseller", "disabled"}
+
+// setProductColumn sets the field of product for a CSV column
+func setProductColumn(product *models.Product, column, value string) error {
+	var err error
+	switch column {
+	case "sku":
+		product.SKU = value
+	case "name":
+		product.Name = value
+	case "description":
+		product.Description = value
+	case "details":
+		product.Details = value
+	case "image":
+		product.Image = value
+	case "category":
+		product.Category = value
+	case "price":
+		product.Price, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "stock":
+		if value = strings.TrimSpace(value); value != "" {
+			product.Stock, err = strconv.Atoi(value)
+		}
+	case "isbestseller":
+		product.Isbestseller, err = parseBool(value)
+	case "disabled":
+		product.Disabled, err = parseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %q isn't valid", column, value)
+	}
+	return nil
+}
+
+// parseBool reads a boolean column, where empty means false
+func parseBool(value string) (bool, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+type csvProductReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVProductReader(r io.Reader) (*csvProductReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, column := range productColumns {
+		known[column] = true
+	}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff") // Spreadsheets like to add a byte order mark
+		}
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !known[column] {
+			return nil, fmt.Errorf("unknown column %q, expected some of %s", column, strings.Join(productColumns, ", "))
+		}
+		columns[i] = column
+	}
+	for _, required := range []string{"sku", "name"} {
+		if !slices.Contains(columns, required) {
+			return nil, fmt.Errorf("the header has no %s column", required)
+		}
+	}
+	return &csvProductReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvProductReader) next() (int, models.Product, error, error) {
+	var product models.Product
+	record, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		if errors.Is(err, csv.ErrFieldCount) {
+			return parseErr.StartLine, product, fmt.Errorf("has %d columns, the header has %d", len(record), len(c.columns)), nil
+		}
+		return parseErr.StartLine, product, nil, parseErr.Err
+	}
+	if err != nil {
+		return 0, product, nil, err
+	}
+	row, _ := c.reader.FieldPos(0)
+	for i, value := range record {
+		if err := setProductColumn(&product, c.columns[i], value); err != nil {
+			return row, product, err, nil
+		}
+	}
+	return row, product, nil, nil
+}
+
+type jsonlProductReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLProductReader(r io.Reader) *jsonlProductReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &jsonlProductReader{scanner: scanner}
+}
+
+func (j *jsonlProductReader) next() (int, models.Product, error, error) {
+	var product models.Product
+	for j.scanner.Scan() {
+		j.line++
+		line := bytes.TrimSpace(j.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &product); err != nil {
+			return j.line, product, fmt.Errorf("invalid JSON: %v", err), nil
+		}
+		return j.line, product, nil, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return j.line + 1, product, nil, err
+	}
+	return j.line, product, nil, io.EOF
+}
@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+)
+
+// Import job statuses
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// maxFinishedJobs is how many finished jobs are remembered
+const maxFinishedJobs = 100
+
+// Job is an import running in the background
+type Job struct {
+	ID         string       `json:"id"`
+	Status     string       `json:"status"`
+	Format     Format       `json:"format"`
+	Report     ImportReport `json:"report"` // Progress so far while running
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+// Jobs runs imports in the background and keeps track of them. Jobs are only
+// kept in memory, so they're forgotten when the server restarts.
+type Jobs struct {
+	Logger *slog.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	next int
+}
+
+// NewJobs returns an empty job list
+func NewJobs() *Jobs {
+	return &Jobs{Logger: slog.Default(), jobs: make(map[string]*Job)}
+}
+
+// Start imports the file at path in the background, removing the file once
+// it's done, and returns the job tracking it. The import keeps ctx's values,
+// such as the request's logger, but isn't cancelled with it.
+func (j *Jobs) Start(ctx context.Context, store database.ProductStore, path string, format Format, opts ImportOptions) Job {
+	j.mu.Lock()
+	j.next++
+	job := &Job{
+		ID:        fmt.Sprintf("import-%d", j.next),
+		Status:    JobRunning,
+		Format:    format,
+		Report:    ImportReport{DryRun: opts.DryRun},
+		StartedAt: time.Now(),
+	}
+	j.jobs[job.ID] = job
+	j.prune()
+	started := *job
+	j.mu.Unlock()
+
+	opts.Progress = func(report ImportReport) {
+		j.mu.Lock()
+		job.Report = report
+		j.mu.Unlock()
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer os.Remove(path)
+		report, err := importFile(ctx, store, path, format, opts)
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		now := time.Now()
+		job.Report, job.Status, job.FinishedAt = report, JobDone, &now
+		if err != nil {
+			job.Status, job.Error = JobFailed, err.Error()
+			j.Logger.Error("Import failed", "job", job.ID, "error", err)
+		} else {
+			j.Logger.Info("Import done", "job", job.ID, "rows", report.Rows, "created", report.Created, "updated", report.Updated, "failed", report.Failed)
+		}
+	}()
+	return started
+}
+
+func importFile(ctx context.Context, store database.ProductStore, path string, format Format, opts ImportOptions) (ImportReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ImportReport{DryRun: opts.DryRun}, err
+	}
+	defer file.Close()
+	return Import(ctx, store, file, format, opts)
+}
+
+// Get returns the job with id
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns every job, newest first
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].StartedAt.After(jobs[b].StartedAt) })
+	return jobs
+}
+
+// prune forgets the oldest finished jobs beyond maxFinishedJobs. The caller
+// holds j.mu.
+func (j *Jobs) prune() {
+	var finished []*Job
+	for _, job := range j.jobs {
+		if job.FinishedAt != nil {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].FinishedAt.Before(*finished[b].FinishedAt) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs] {
+		delete(j.jobs, job.ID)
+	}
+}
@@ -0,0 +1,503 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/graphql"
+	"github.com/Rohanrevanth/e-store-go/jobs"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/webhooks"
+)
+
+// DevJWTKey is the key tokens are signed with when none is configured. It's
+// only accepted in development, as anyone who has read this file can forge
+// tokens.
+const DevJWTKey = "my_secret_key"
+
+// DevPaymentWebhookSecret verifies payment webhooks when no secret is
+// configured. It's only accepted in development, as anyone who has read this
+// file can sign a webhook with it.
+const DevPaymentWebhookSecret = "fake_webhook_secret"
+
+// Environments the server runs in. Development allows the secrets above.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Config holds every setting of the server and the maintenance commands.
+// Settings are read, each overriding the last, from Default, a YAML or TOML
+// file, environment variables and command-line flags (see Load).
+type Config struct {
+	Environment string `yaml:"environment" toml:"environment"` // EnvDevelopment or EnvProduction
+
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Redis    Redis    `yaml:"redis" toml:"redis"`
+	Cache    Cache    `yaml:"cache" toml:"cache"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	Payments Payments `yaml:"payments" toml:"payments"`
+	Log      Log      `yaml:"log" toml:"log"`
+	Metrics  Metrics  `yaml:"metrics" toml:"metrics"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+	GraphQL  GraphQL  `yaml:"graphql" toml:"graphql"`
+	GRPC     GRPC     `yaml:"grpc" toml:"grpc"`
+	Webhooks Webhooks `yaml:"webhooks" toml:"webhooks"`
+	Events   Events   `yaml:"events" toml:"events"`
+
+	Carts          Carts          `yaml:"carts" toml:"carts"`
+	AbandonedCarts AbandonedCarts `yaml:"abandoned_carts" toml:"abandoned_carts"`
+}
+
+type Server struct {
+	Addr        string   `yaml:"addr" toml:"addr"`                 // Address to listen on
+	CORSOrigins []string `yaml:"cors_origins" toml:"cors_origins"` // Origins browsers may call the API from
+
+	// Timeouts, zero meaning none. Imports and exports lift the read and
+	// write timeouts, as large files take longer.
+	ReadTimeout       Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownDelay     Duration `yaml:"shutdown_delay" toml:"shutdown_delay"`     // How long to report not ready before shutting down
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // How long in-flight requests get to finish
+
+	TLS TLS  `yaml:"tls" toml:"tls"`
+	H2C bool `yaml:"h2c" toml:"h2c"` // Serve HTTP/2 without TLS, for behind a proxy that speaks it
+}
+
+// TLS serves HTTPS, and with it HTTP/2, from a certificate and key file or
+// from a self-signed certificate made at startup, which is only fit for
+// development.
+type TLS struct {
+	CertFile   string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile    string `yaml:"key_file" toml:"key_file"`
+	SelfSigned bool   `yaml:"self_signed" toml:"self_signed"`
+}
+
+// Database is database.Config in config file form. URL is a secret, as it
+// usually holds a password.
+type Database struct {
+	URL             string   `yaml:"url" toml:"url"`
+	URLFile         string   `yaml:"url_file" toml:"url_file"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	BusyTimeout     Duration `yaml:"busy_timeout" toml:"busy_timeout"`
+}
+
+// Redis says where the shared cache is. Without a URL each server caches on
+// its own.
+type Redis struct {
+	URL     string `yaml:"url" toml:"url"`
+	URLFile string `yaml:"url_file" toml:"url_file"`
+}
+
+// Cache says how long catalog and user lookups are cached, in Redis or on
+// each server
+type Cache struct {
+	TTL Duration `yaml:"ttl" toml:"ttl"`
+}
+
+type Auth struct {
+	JWTKey     string `yaml:"jwt_key" toml:"jwt_key"` // Signs JWTs and guest cart tokens
+	JWTKeyFile string `yaml:"jwt_key_file" toml:"jwt_key_file"`
+}
+
+// Payments configures the payment provider, which is the fake gateway until
+// a real one is added
+type Payments struct {
+	WebhookSecret     string `yaml:"webhook_secret" toml:"webhook_secret"` // Verifies the provider's webhooks
+	WebhookSecretFile string `yaml:"webhook_secret_file" toml:"webhook_secret_file"`
+}
+
+// Log says which entries are logged and how. Entries go to standard error.
+type Log struct {
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+	Format string `yaml:"format" toml:"format"` // text or json
+}
+
+// Metrics guards GET /metrics. Without a token anyone who can reach the
+// server can scrape it, revenue included.
+type Metrics struct {
+	Token     string `yaml:"token" toml:"token"` // Bearer token Prometheus must send
+	TokenFile string `yaml:"token_file" toml:"token_file"`
+}
+
+// Tracing says where OpenTelemetry spans are sent. The OTEL_* variables, such
+// as OTEL_TRACES_SAMPLER and OTEL_EXPORTER_OTLP_HEADERS, are honoured too.
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"` // none, otlp or stdout
+	Endpoint string `yaml:"endpoint" toml:"endpoint"` // OTLP/HTTP collector URL, such as http://localhost:4318
+}
+
+// GraphQL limits the operations POST /api/v1/graphql runs. Every field costs
+// 1 plus what's selected on it, ten times over for a list.
+type GraphQL struct {
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity"`
+	MaxDepth      int `yaml:"max_depth" toml:"max_depth"` // Fields nested in fields
+}
+
+// GRPC serves the catalog, orders and inventory to internal services, over
+// TLS with the certificate files in server.tls if they're set. Calls in
+// flight get server.shutdown_timeout to finish.
+type GRPC struct {
+	Addr string `yaml:"addr" toml:"addr"` // Address to listen on, empty for no gRPC server
+}
+
+// Webhooks says how queued webhook deliveries are sent. Failed deliveries are
+// retried from 30 seconds up to 6 hours apart.
+type Webhooks struct {
+	Interval    Duration `yaml:"interval" toml:"interval"`         // How often to look for due deliveries
+	Timeout     Duration `yaml:"timeout" toml:"timeout"`           // How long a receiver gets to respond
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts"` // Attempts before a delivery is dead
+	// AllowPrivateNetworks lets subscriptions receive at loopback and private
+	// addresses, which are otherwise refused so that they can't reach the
+	// server's own network
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" toml:"allow_private_networks"`
+}
+
+// Events says how the domain events in the outbox are dispatched to their
+// subscribers once they're not dispatched by the change that raised them.
+// Failed events are retried from 10 seconds up to an hour apart.
+type Events struct {
+	Interval    Duration `yaml:"interval" toml:"interval"`         // How often to look for due events
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts"` // Attempts before an event is given up on
+	Retention   Duration `yaml:"retention" toml:"retention"`       // How long dispatched events are kept, 0 for good
+}
+
+// Carts says how long a guest keeps their cart and how it's combined with
+// their own cart when they log in
+type Carts struct {
+	// MergeRule decides what happens to a product in both carts: sum, max,
+	// keep_user or keep_guest
+	MergeRule string `yaml:"merge_rule" toml:"merge_rule"`
+	// GuestTokenLifetime is how long the token identifying a guest's cart
+	// lasts. It's renewed while the cart is in use.
+	GuestTokenLifetime Duration `yaml:"guest_token_lifetime" toml:"guest_token_lifetime"`
+}
+
+// AbandonedCarts says when a cart counts as abandoned and what its owner is
+// sent to bring them back
+type AbandonedCarts struct {
+	IdleAfter      Duration `yaml:"idle_after" toml:"idle_after"`             // How long a cart must go untouched
+	Interval       Duration `yaml:"interval" toml:"interval"`                 // How often to look for abandoned carts
+	CouponDiscount float64  `yaml:"coupon_discount" toml:"coupon_discount"`   // Percentage off for the reminder coupon, 0 for none
+	CouponValidFor Duration `yaml:"coupon_valid_for" toml:"coupon_valid_for"` // How long the reminder coupon can be used
+}
+
+// Default returns the settings used when nothing else is configured, which
+// suit running the server locally next to the frontend's dev server.
+func Default() Config {
+	db := database.DefaultConfig()
+	return Config{
+		Environment: EnvDevelopment,
+		Server: Server{
+			Addr:              "localhost:8080",
+			CORSOrigins:       []string{"http://localhost:4200"},
+			ReadTimeout:       Duration(30 * time.Second),
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		Database: Database{
+			URL:             db.DSN,
+			MaxOpenConns:    db.MaxOpenConns,
+			MaxIdleConns:    db.MaxIdleConns,
+			ConnMaxLifetime: Duration(db.ConnMaxLifetime),
+			ConnMaxIdleTime: Duration(db.ConnMaxIdleTime),
+			BusyTimeout:     Duration(db.BusyTimeout),
+		},
+		Cache:    Cache{TTL: Duration(5 * time.Minute)},
+		Auth:     Auth{JWTKey: DevJWTKey},
+		Payments: Payments{WebhookSecret: DevPaymentWebhookSecret},
+		Log:      Log{Level: "info", Format: logging.FormatText},
+		Tracing:  Tracing{Exporter: "none"},
+		GraphQL:  GraphQL{MaxComplexity: graphql.DefaultMaxComplexity, MaxDepth: graphql.DefaultMaxDepth},
+		GRPC:     GRPC{Addr: "localhost:9090"},
+		Webhooks: Webhooks{
+			Interval:    Duration(webhooks.DefaultInterval),
+			Timeout:     Duration(webhooks.DefaultTimeout),
+			MaxAttempts: webhooks.DefaultMaxAttempts,
+		},
+		Events: Events{
+			Interval:    Duration(events.DefaultInterval),
+			MaxAttempts: events.DefaultMaxAttempts,
+			Retention:   Duration(events.DefaultRetention),
+		},
+		Carts: Carts{
+			MergeRule:          models.CartMergeSum,
+			GuestTokenLifetime: Duration(auth.DefaultCartTokenLifetime),
+		},
+		AbandonedCarts: AbandonedCarts{
+			IdleAfter:      Duration(jobs.DefaultIdleAfter),
+			Interval:       Duration(jobs.DefaultInterval),
+			CouponDiscount: jobs.DefaultCouponDiscount,
+			CouponValidFor: Duration(jobs.DefaultCouponValidFor),
+		},
+	}
+}
+
+// Config returns the settings to connect to the database with
+func (d Database) Config() database.Config {
+	return database.Config{
+		DSN:             d.URL,
+		MaxOpenConns:    d.MaxOpenConns,
+		MaxIdleConns:    d.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(d.ConnMaxLifetime),
+		ConnMaxIdleTime: time.Duration(d.ConnMaxIdleTime),
+		BusyTimeout:     time.Duration(d.BusyTimeout),
+	}
+}
+
+// Validate reports every setting that's missing or malformed. Settings are
+// named as in the config file.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(setting, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Environment != EnvDevelopment && c.Environment != EnvProduction {
+		invalid("environment", "%q isn't %s or %s", c.Environment, EnvDevelopment, EnvProduction)
+	}
+
+	if err := checkAddr(c.Server.Addr); err != nil {
+		invalid("server.addr", "%v", err)
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		invalid("server.cors_origins", `needs at least one origin, or "*" for any`)
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			invalid("server.cors_origins", "%q isn't an origin such as https://shop.example.com", origin)
+		}
+	}
+	for _, timeout := range []struct {
+		setting string
+		value   Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_delay", c.Server.ShutdownDelay},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	} {
+		if timeout.value < 0 {
+			invalid(timeout.setting, "can't be negative")
+		}
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		invalid("server.tls", "cert_file and key_file go together")
+	} else if c.Server.TLS.CertFile != "" && c.Server.TLS.SelfSigned {
+		invalid("server.tls", "self_signed can't be used with a cert_file")
+	}
+
+	if c.Database.URL == "" {
+		invalid("database.url", "missing")
+	}
+	if c.Database.MaxOpenConns < 0 {
+		invalid("database.max_open_conns", "can't be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		invalid("database.max_idle_conns", "can't be negative")
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		invalid("database.conn_max_lifetime", "can't be negative")
+	}
+	if c.Database.ConnMaxIdleTime < 0 {
+		invalid("database.conn_max_idle_time", "can't be negative")
+	}
+	if c.Database.BusyTimeout < 0 {
+		invalid("database.busy_timeout", "can't be negative")
+	}
+
+	if c.Redis.URL != "" {
+		if u, err := url.Parse(c.Redis.URL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			invalid("redis.url", "must be a redis:// or rediss:// URL")
+		}
+	}
+	if c.Cache.TTL <= 0 {
+		invalid("cache.ttl", "must be positive")
+	}
+
+	if c.Auth.JWTKey == "" {
+		invalid("auth.jwt_key", "missing")
+	} else if c.Auth.JWTKey == DevJWTKey && c.Environment != EnvDevelopment {
+		invalid("auth.jwt_key", "must be set outside development, as anyone can sign tokens with the default")
+	}
+
+	if c.Payments.WebhookSecret == "" {
+		invalid("payments.webhook_secret", "missing")
+	} else if c.Payments.WebhookSecret == DevPaymentWebhookSecret && c.Environment != EnvDevelopment {
+		invalid("payments.webhook_secret", "must be set outside development, as anyone can sign webhooks with the default")
+	}
+
+	if _, err := logging.New(io.Discard, c.Log.Level, c.Log.Format); err != nil {
+		invalid("log", "%v", err)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	default:
+		invalid("tracing.exporter", "%q isn't one of none, otlp or stdout", c.Tracing.Exporter)
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("tracing.endpoint", "must be an http:// or https:// URL")
+		}
+	}
+
+	if c.GraphQL.MaxComplexity < 1 {
+		invalid("graphql.max_complexity", "must be at least 1")
+	}
+	if c.GraphQL.MaxDepth < 1 {
+		invalid("graphql.max_depth", "must be at least 1")
+	}
+	if c.GRPC.Addr != "" {
+		if err := checkAddr(c.GRPC.Addr); err != nil {
+			invalid("grpc.addr", "%v", err)
+		} else if c.GRPC.Addr == c.Server.Addr {
+			invalid("grpc.addr", "can't be the same as server.addr")
+		}
+	}
+
+	if c.Webhooks.Interval <= 0 {
+		invalid("webhooks.interval", "must be positive")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		invalid("webhooks.timeout", "must be positive")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		invalid("webhooks.max_attempts", "must be at least 1")
+	}
+	if c.Events.Interval <= 0 {
+		invalid("events.interval", "must be positive")
+	}
+	if c.Events.MaxAttempts < 1 {
+		invalid("events.max_attempts", "must be at least 1")
+	}
+	if c.Events.Retention < 0 {
+		invalid("events.retention", "can't be negative")
+	}
+	switch c.Carts.MergeRule {
+	case models.CartMergeSum, models.CartMergeMax, models.CartMergeKeepUser, models.CartMergeKeepGuest:
+	default:
+		invalid("carts.merge_rule", "%q isn't one of sum, max, keep_user or keep_guest", c.Carts.MergeRule)
+	}
+	if c.Carts.GuestTokenLifetime <= 0 {
+		invalid("carts.guest_token_lifetime", "must be positive")
+	}
+	if c.AbandonedCarts.IdleAfter <= 0 {
+		invalid("abandoned_carts.idle_after", "must be positive")
+	}
+	if c.AbandonedCarts.Interval <= 0 {
+		invalid("abandoned_carts.interval", "must be positive")
+	}
+	if c.AbandonedCarts.CouponDiscount < 0 || c.AbandonedCarts.CouponDiscount > 100 {
+		invalid("abandoned_carts.coupon_discount", "must be a percentage from 0 to 100")
+	}
+	if c.AbandonedCarts.CouponValidFor <= 0 && c.AbandonedCarts.CouponDiscount > 0 {
+		invalid("abandoned_carts.coupon_valid_for", "must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns c with its secrets hidden, for printing
+func (c Config) Redacted() Config {
+	c.Database.URL = redactURL(c.Database.URL)
+	c.Redis.URL = redactURL(c.Redis.URL)
+	if c.Auth.JWTKey != "" && c.Auth.JWTKey != DevJWTKey {
+		c.Auth.JWTKey = "REDACTED"
+	}
+	if c.Payments.WebhookSecret != "" && c.Payments.WebhookSecret != DevPaymentWebhookSecret {
+		c.Payments.WebhookSecret = "REDACTED"
+	}
+	if c.Metrics.Token != "" {
+		c.Metrics.Token = "REDACTED"
+	}
+	return c
+}
+
+// redactURL hides the password in a URL. DSNs that aren't URLs, such as
+// MySQL's, are hidden entirely if they might hold one.
+func redactURL(dsn string) string {
+	if !strings.Contains(dsn, "@") {
+		return dsn
+	}
+	if u, err := url.Parse(dsn); err == nil {
+		return u.Redacted()
+	}
+	return "REDACTED"
+}
+
+// checkAddr reports what's wrong with a host:port address to listen on
+func checkAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("%q isn't a port", port)
+	}
+	if host != "" && net.ParseIP(host) == nil && !validHostname(host) {
+		return fmt.Errorf("%q isn't a host", host)
+	}
+	return nil
+}
+
+func validHostname(host string) bool {
+	for _, r := range host {
+		if !(r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Duration is a time.Duration written like "90s" or "1h30m" in config files
+// and flags
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
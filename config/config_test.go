@@ -0,0 +1,131 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	production := func(c *Config) {
+		c.Environment = EnvProduction
+		c.Auth.JWTKey = "production-key"
+		c.Payments.WebhookSecret = "production-secret"
+	}
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		invalid string // Setting reported, empty if valid
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"production", production, ""},
+		{"development JWT key in production", func(c *Config) {
+			production(c)
+			c.Auth.JWTKey = DevJWTKey
+		}, "auth.jwt_key"},
+		{"development webhook secret in production", func(c *Config) {
+			production(c)
+			c.Payments.WebhookSecret = DevPaymentWebhookSecret
+		}, "payments.webhook_secret"},
+		{"no JWT key", func(c *Config) { c.Auth.JWTKey = "" }, "auth.jwt_key"},
+		{"unknown environment", func(c *Config) { c.Environment = "staging" }, "environment"},
+		{"CORS origin with a path", func(c *Config) { c.Server.CORSOrigins = []string{"https://shop.example.com/app"} }, "server.cors_origins"},
+		{"half a certificate", func(c *Config) { c.Server.TLS.CertFile = "cert.pem" }, "server.tls"},
+		{"gRPC on the HTTP address", func(c *Config) { c.GRPC.Addr = c.Server.Addr }, "grpc.addr"},
+		{"unknown cart merge rule", func(c *Config) { c.Carts.MergeRule = "newest" }, "carts.merge_rule"},
+		{"guest cart tokens that never last", func(c *Config) { c.Carts.GuestTokenLifetime = 0 }, "carts.guest_token_lifetime"},
+		{"coupon over 100%", func(c *Config) { c.AbandonedCarts.CouponDiscount = 150 }, "abandoned_carts.coupon_discount"},
+		{"no coupon and no validity", func(c *Config) {
+			c.AbandonedCarts.CouponDiscount = 0
+			c.AbandonedCarts.CouponValidFor = 0
+		}, ""},
+		{"nothing cached", func(c *Config) { c.Cache.TTL = 0 }, "cache.ttl"},
+		{"negative event retention", func(c *Config) { c.Events.Retention = Duration(-time.Hour) }, "events.retention"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.change(&cfg)
+			err := cfg.Validate()
+			switch {
+			case tc.invalid == "" && err != nil:
+				t.Fatalf("got %v, want no error", err)
+			case tc.invalid != "" && err == nil:
+				t.Fatalf("got no error, want %s reported", tc.invalid)
+			case tc.invalid != "" && !strings.Contains(err.Error(), tc.invalid+":"):
+				t.Fatalf("got %v, want %s reported", err, tc.invalid)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEverything(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = ""
+	cfg.GraphQL.MaxDepth = 0
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "database.url:") || !strings.Contains(err.Error(), "graphql.max_depth:") {
+		t.Fatalf("got %v, want both settings reported", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	writeFile(t, file, "server:\n  addr: localhost:8000\nlog:\n  level: debug\n  format: json\nwebhooks:\n  max_attempts: 3\n")
+	keyFile := filepath.Join(dir, "jwt-key")
+	writeFile(t, keyFile, "from-a-file\n")
+
+	t.Setenv("ESTORE_CONFIG", file)
+	t.Setenv("ESTORE_LOG_LEVEL", "warn")
+	t.Setenv("ESTORE_WEBHOOK_MAX_ATTEMPTS", "4")
+	t.Setenv("ESTORE_CACHE_TTL", "90s")
+	t.Setenv("ESTORE_JWT_KEY_FILE", keyFile)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg, err := Load(fs, []string{"-webhook-max-attempts", "5", "-cart-merge-rule", "max", "migrate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != "localhost:8000" || cfg.Log.Format != "json" {
+		t.Errorf("file settings weren't applied: %+v", cfg)
+	}
+	if cfg.Log.Level != "warn" {
+		t.Errorf("got log level %q, want the environment's warn", cfg.Log.Level)
+	}
+	if cfg.Webhooks.MaxAttempts != 5 || cfg.Carts.MergeRule != "max" {
+		t.Errorf("flags weren't applied over the file and environment: %+v", cfg)
+	}
+	if cfg.Cache.TTL != Duration(90*time.Second) {
+		t.Errorf("got cache TTL %v, want the environment's 90s", time.Duration(cfg.Cache.TTL))
+	}
+	if cfg.Auth.JWTKey != "from-a-file" {
+		t.Errorf("got JWT key %q, want the file's, without its newline", cfg.Auth.JWTKey)
+	}
+	if args := fs.Args(); len(args) != 1 || args[0] != "migrate" {
+		t.Errorf("got arguments %v, want [migrate]", args)
+	}
+}
+
+func TestLoadRefusesUnknownSettings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	writeFile(t, file, "[server]\nadress = \"localhost:8000\"\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := Load(fs, []string{"-config", file}); err == nil {
+		t.Fatal("got no error for a misspelt setting")
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a setting that can be given as a flag or an environment variable
+type setting struct {
+	flag, env, usage string
+	secret           bool // Not shown as a flag default
+	value            func(*Config) flag.Value
+}
+
+// settings are applied in order, so within one source a *_file setting wins
+// over the setting it holds. Setting either one from a later source clears the
+// other.
+var settings = []setting{
+	{"env", "ESTORE_ENV", "`environment` the server runs in: development or production, which refuses development secrets", false, func(c *Config) flag.Value {
+		return stringValue{&c.Environment, nil}
+	}},
+	{"addr", "ESTORE_ADDR", "`address` to listen on", false, func(c *Config) flag.Value {
+		return stringValue{&c.Server.Addr, nil}
+	}},
+	{"cors-origins", "ESTORE_CORS_ORIGINS", "comma-separated `origins` browsers may call the API from", false, func(c *Config) flag.Value {
+		return listValue{&c.Server.CORSOrigins}
+	}},
+	{"read-timeout", "ESTORE_READ_TIMEOUT", "longest `duration` reading a request may take, 0 for no limit", false, func(c *Config) flag.Value {
+		return &c.Server.ReadTimeout
+	}},
+	{"read-header-timeout", "ESTORE_READ_HEADER_TIMEOUT", "longest `duration` reading request headers may take, 0 for no limit", false, func(c *Config) flag.Value {
+		return &c.Server.ReadHeaderTimeout
+	}},
+	{"write-timeout", "ESTORE_WRITE_TIMEOUT", "longest `duration` writing a response may take, 0 for no limit", false, func(c *Config) flag.Value {
+		return &c.Server.WriteTimeout
+	}},
+	{"idle-timeout", "ESTORE_IDLE_TIMEOUT", "longest `duration` a keep-alive connection stays idle, 0 for no limit", false, func(c *Config) flag.Value {
+		return &c.Server.IdleTimeout
+	}},
+	{"shutdown-delay", "ESTORE_SHUTDOWN_DELAY", "`duration` to report not ready for before shutting down, so load balancers notice", false, func(c *Config) flag.Value {
+		return &c.Server.ShutdownDelay
+	}},
+	{"shutdown-timeout", "ESTORE_SHUTDOWN_TIMEOUT", "longest `duration` in-flight requests get to finish on shutdown", false, func(c *Config) flag.Value {
+		return &c.Server.ShutdownTimeout
+	}},
+	{"tls-cert", "ESTORE_TLS_CERT", "TLS certificate `file`, to serve HTTPS", false, func(c *Config) flag.Value {
+		return stringValue{&c.Server.TLS.CertFile, nil}
+	}},
+	{"tls-key", "ESTORE_TLS_KEY", "TLS private key `file`", false, func(c *Config) flag.Value {
+		return stringValue{&c.Server.TLS.KeyFile, nil}
+	}},
+	{"tls-self-signed", "ESTORE_TLS_SELF_SIGNED", "serve HTTPS with a self-signed certificate, for development", false, func(c *Config) flag.Value {
+		return boolValue{&c.Server.TLS.SelfSigned}
+	}},
+	{"h2c", "ESTORE_H2C", "serve HTTP/2 without TLS, for behind a proxy", false, func(c *Config) flag.Value {
+		return boolValue{&c.Server.H2C}
+	}},
+	{"database-url", "DATABASE_URL", "database `DSN`", false, func(c *Config) flag.Value {
+		return stringValue{&c.Database.URL, &c.Database.URLFile}
+	}},
+	{"database-url-file", "DATABASE_URL_FILE", "`file` holding the database DSN", false, func(c *Config) flag.Value {
+		return stringValue{&c.Database.URLFile, &c.Database.URL}
+	}},
+	{"db-max-open-conns", "ESTORE_DB_MAX_OPEN_CONNS", "`number` of open database connections allowed, 0 for no limit", false, func(c *Config) flag.Value {
+		return intValue{&c.Database.MaxOpenConns}
+	}},
+	{"db-max-idle-conns", "ESTORE_DB_MAX_IDLE_CONNS", "`number` of idle database connections kept", false, func(c *Config) flag.Value {
+		return intValue{&c.Database.MaxIdleConns}
+	}},
+	{"db-conn-max-lifetime", "ESTORE_DB_CONN_MAX_LIFETIME", "longest `duration` a database connection is reused for, 0 for ever", false, func(c *Config) flag.Value {
+		return &c.Database.ConnMaxLifetime
+	}},
+	{"db-conn-max-idle-time", "ESTORE_DB_CONN_MAX_IDLE_TIME", "longest `duration` a database connection stays idle for, 0 for ever", false, func(c *Config) flag.Value {
+		return &c.Database.ConnMaxIdleTime
+	}},
+	{"db-busy-timeout", "ESTORE_DB_BUSY_TIMEOUT", "`duration` SQLite waits on a locked database for", false, func(c *Config) flag.Value {
+		return &c.Database.BusyTimeout
+	}},
+	{"redis-url", "REDIS_URL", "Redis `URL` of the shared cache", false, func(c *Config) flag.Value {
+		return stringValue{&c.Redis.URL, &c.Redis.URLFile}
+	}},
+	{"redis-url-file", "REDIS_URL_FILE", "`file` holding the Redis URL", false, func(c *Config) flag.Value {
+		return stringValue{&c.Redis.URLFile, &c.Redis.URL}
+	}},
+	{"cache-ttl", "ESTORE_CACHE_TTL", "`duration` catalog and user lookups are cached for", false, func(c *Config) flag.Value {
+		return &c.Cache.TTL
+	}},
+	{"jwt-key", "ESTORE_JWT_KEY", "`key` JWTs and cart tokens are signed with", true, func(c *Config) flag.Value {
+		return stringValue{&c.Auth.JWTKey, &c.Auth.JWTKeyFile}
+	}},
+	{"jwt-key-file", "ESTORE_JWT_KEY_FILE", "`file` holding the JWT key", false, func(c *Config) flag.Value {
+		return stringValue{&c.Auth.JWTKeyFile, &c.Auth.JWTKey}
+	}},
+	{"payment-webhook-secret", "ESTORE_PAYMENT_WEBHOOK_SECRET", "`secret` the payment provider's webhooks are verified with", true, func(c *Config) flag.Value {
+		return stringValue{&c.Payments.WebhookSecret, &c.Payments.WebhookSecretFile}
+	}},
+	{"payment-webhook-secret-file", "ESTORE_PAYMENT_WEBHOOK_SECRET_FILE", "`file` holding the payment webhook secret", false, func(c *Config) flag.Value {
+		return stringValue{&c.Payments.WebhookSecretFile, &c.Payments.WebhookSecret}
+	}},
+	{"metrics-token", "ESTORE_METRICS_TOKEN", "bearer `token` Prometheus must send to scrape /metrics", true, func(c *Config) flag.Value {
+		return stringValue{&c.Metrics.Token, &c.Metrics.TokenFile}
+	}},
+	{"metrics-token-file", "ESTORE_METRICS_TOKEN_FILE", "`file` holding the metrics token", false, func(c *Config) flag.Value {
+		return stringValue{&c.Metrics.TokenFile, &c.Metrics.Token}
+	}},
+	{"trace-exporter", "ESTORE_TRACE_EXPORTER", "where to send traces: none, otlp or stdout", false, func(c *Config) flag.Value {
+		return stringValue{&c.Tracing.Exporter, nil}
+	}},
+	{"otlp-endpoint", "ESTORE_OTLP_ENDPOINT", "`URL` of the OTLP/HTTP collector traces are sent to", false, func(c *Config) flag.Value {
+		return stringValue{&c.Tracing.Endpoint, nil}
+	}},
+	{"graphql-max-complexity", "ESTORE_GRAPHQL_MAX_COMPLEXITY", "highest `cost` of a GraphQL operation", false, func(c *Config) flag.Value {
+		return intValue{&c.GraphQL.MaxComplexity}
+	}},
+	{"graphql-max-depth", "ESTORE_GRAPHQL_MAX_DEPTH", "deepest `number` of fields a GraphQL operation may nest", false, func(c *Config) flag.Value {
+		return intValue{&c.GraphQL.MaxDepth}
+	}},
+	{"grpc-addr", "ESTORE_GRPC_ADDR", "`address` to serve gRPC on, empty for none", false, func(c *Config) flag.Value {
+		return stringValue{&c.GRPC.Addr, nil}
+	}},
+	{"webhook-interval", "ESTORE_WEBHOOK_INTERVAL", "how often, as a `duration`, to look for webhook deliveries due", false, func(c *Config) flag.Value {
+		return &c.Webhooks.Interval
+	}},
+	{"webhook-timeout", "ESTORE_WEBHOOK_TIMEOUT", "longest `duration` a webhook receiver gets to respond", false, func(c *Config) flag.Value {
+		return &c.Webhooks.Timeout
+	}},
+	{"webhook-max-attempts", "ESTORE_WEBHOOK_MAX_ATTEMPTS", "`number` of attempts before a webhook delivery is given up on", false, func(c *Config) flag.Value {
+		return intValue{&c.Webhooks.MaxAttempts}
+	}},
+	{"webhook-allow-private-networks", "ESTORE_WEBHOOK_ALLOW_PRIVATE_NETWORKS", "send webhooks to loopback and private addresses too, for receivers on the server's network", false, func(c *Config) flag.Value {
+		return boolValue{&c.Webhooks.AllowPrivateNetworks}
+	}},
+	{"event-interval", "ESTORE_EVENT_INTERVAL", "how often, as a `duration`, to look for domain events due", false, func(c *Config) flag.Value {
+		return &c.Events.Interval
+	}},
+	{"event-max-attempts", "ESTORE_EVENT_MAX_ATTEMPTS", "`number` of attempts before a domain event is given up on", false, func(c *Config) flag.Value {
+		return intValue{&c.Events.MaxAttempts}
+	}},
+	{"event-retention", "ESTORE_EVENT_RETENTION", "`duration` dispatched domain events are kept for, 0 for good", false, func(c *Config) flag.Value {
+		return &c.Events.Retention
+	}},
+	{"cart-merge-rule", "ESTORE_CART_MERGE_RULE", "`rule` for a product in both a guest's cart and theirs when they log in: sum, max, keep_user or keep_guest", false, func(c *Config) flag.Value {
+		return stringValue{&c.Carts.MergeRule, nil}
+	}},
+	{"guest-cart-token-lifetime", "ESTORE_GUEST_CART_TOKEN_LIFETIME", "`duration` a guest's cart token lasts, renewed while the cart is used", false, func(c *Config) flag.Value {
+		return &c.Carts.GuestTokenLifetime
+	}},
+	{"abandoned-cart-idle-after", "ESTORE_ABANDONED_CART_IDLE_AFTER", "`duration` a cart must go untouched to count as abandoned", false, func(c *Config) flag.Value {
+		return &c.AbandonedCarts.IdleAfter
+	}},
+	{"abandoned-cart-interval", "ESTORE_ABANDONED_CART_INTERVAL", "how often, as a `duration`, to look for abandoned carts", false, func(c *Config) flag.Value {
+		return &c.AbandonedCarts.Interval
+	}},
+	{"abandoned-cart-coupon-discount", "ESTORE_ABANDONED_CART_COUPON_DISCOUNT", "`percentage` off for the coupon sent with cart reminders, 0 for none", false, func(c *Config) flag.Value {
+		return floatValue{&c.AbandonedCarts.CouponDiscount}
+	}},
+	{"abandoned-cart-coupon-valid-for", "ESTORE_ABANDONED_CART_COUPON_VALID_FOR", "`duration` the coupon sent with cart reminders can be used for", false, func(c *Config) flag.Value {
+		return &c.AbandonedCarts.CouponValidFor
+	}},
+	{"log-level", "ESTORE_LOG_LEVEL", "lowest `level` logged: debug, info, warn or error", false, func(c *Config) flag.Value {
+		return stringValue{&c.Log.Level, nil}
+	}},
+	{"log-format", "ESTORE_LOG_FORMAT", "log `format`: text or json", false, func(c *Config) flag.Value {
+		return stringValue{&c.Log.Format, nil}
+	}},
+}
+
+// Load defines the settings as flags on fs, parses args with it and returns
+// the configuration, validated. Each source overrides the ones before it:
+//
+//  1. Default
+//  2. the YAML or TOML file named by -config or ESTORE_CONFIG
+//  3. environment variables, which are ignored when empty
+//  4. flags
+//
+// Secrets can be read from files, as container platforms mount them: the
+// database and Redis URLs, the JWT key, the payment webhook secret and the
+// metrics token each have a *_file setting (such as DATABASE_URL_FILE or
+// -jwt-key-file) naming a file to read it from.
+// The arguments after the flags are left in fs.Args().
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	path := fs.String("config", os.Getenv("ESTORE_CONFIG"), "YAML or TOML `file` to read settings from (ESTORE_CONFIG)")
+	// The flags are parsed before the file is read, as they may name it, so
+	// they're noted down and applied once the file and environment have been.
+	var given []flagValue
+	defaults := Default()
+	for _, s := range settings {
+		value := &recorder{Value: s.value(&defaults), name: s.flag, secret: s.secret, given: &given}
+		fs.Var(value, s.flag, fmt.Sprintf("%s (%s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := loadFile(&cfg, *path); err != nil {
+			return Config{}, err
+		}
+	}
+	values := make(map[string]flag.Value, len(settings))
+	for _, s := range settings {
+		values[s.flag] = s.value(&cfg)
+	}
+	for _, s := range settings {
+		if env := os.Getenv(s.env); env != "" {
+			if err := values[s.flag].Set(env); err != nil {
+				return Config{}, fmt.Errorf("invalid %s %q: %v", s.env, env, err)
+			}
+		}
+	}
+	for _, g := range given {
+		values[g.name].Set(g.value) // Already parsed once
+	}
+
+	for _, secret := range []struct {
+		value *string
+		file  string
+		name  string
+	}{
+		{&cfg.Database.URL, cfg.Database.URLFile, "database.url_file"},
+		{&cfg.Redis.URL, cfg.Redis.URLFile, "redis.url_file"},
+		{&cfg.Auth.JWTKey, cfg.Auth.JWTKeyFile, "auth.jwt_key_file"},
+		{&cfg.Payments.WebhookSecret, cfg.Payments.WebhookSecretFile, "payments.webhook_secret_file"},
+		{&cfg.Metrics.Token, cfg.Metrics.TokenFile, "metrics.token_file"},
+	} {
+		if secret.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.file)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading %s: %v", secret.name, err)
+		}
+		*secret.value = strings.TrimRight(string(data), "\r\n")
+	}
+	return cfg, cfg.Validate()
+}
+
+// loadFile reads the settings in the file at path over cfg. Settings the
+// file doesn't mention are left alone, and ones this version doesn't know
+// about are an error, so that typos don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("loadFile: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			var strict *toml.StrictMissingError
+			if errors.As(err, &strict) {
+				return fmt.Errorf("%s: %s", path, strict.String())
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+type flagValue struct {
+	name, value string
+}
+
+// recorder notes down each value given for a flag, in order
+type recorder struct {
+	flag.Value
+	name   string
+	secret bool
+	given  *[]flagValue
+}
+
+func (r *recorder) Set(value string) error {
+	if err := r.Value.Set(value); err != nil {
+		return err
+	}
+	*r.given = append(*r.given, flagValue{r.name, value})
+	return nil
+}
+
+func (r *recorder) IsBoolFlag() bool {
+	_, ok := r.Value.(boolValue)
+	return ok
+}
+
+func (r *recorder) String() string {
+	if r.Value == nil || r.secret {
+		return ""
+	}
+	return r.Value.String()
+}
+
+// stringValue sets a string, clearing the other way of giving the same setting
+type stringValue struct {
+	value, other *string
+}
+
+func (v stringValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return *v.value
+}
+
+func (v stringValue) Set(value string) error {
+	*v.value = value
+	if v.other != nil {
+		*v.other = ""
+	}
+	return nil
+}
+
+type intValue struct {
+	value *int
+}
+
+func (v intValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.Itoa(*v.value)
+}
+
+func (v intValue) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	*v.value = n
+	return nil
+}
+
+type floatValue struct {
+	value *float64
+}
+
+func (v floatValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v.value, 'f', -1, 64)
+}
+
+func (v floatValue) Set(value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	*v.value = f
+	return nil
+}
+
+type boolValue struct {
+	value *bool
+}
+
+func (v boolValue) IsBoolFlag() bool {
+	return true
+}
+
+func (v boolValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.value)
+}
+
+func (v boolValue) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("not true or false")
+	}
+	*v.value = b
+	return nil
+}
+
+// listValue is a comma-separated list
+type listValue struct {
+	value *[]string
+}
+
+func (v listValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return strings.Join(*v.value, ",")
+}
+
+func (v listValue) Set(value string) error {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v.value = list
+	return nil
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin lets through requests from admins only. It goes after
+// auth.JWTAuthMiddleware, which says who the request is from.
+func (h *Handler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := h.currentUser(c)
+		if !ok {
+			return
+		}
+		if user.Type != models.UserTypeAdmin {
+			apierror.Abort(c, apierror.New(apierror.CodeForbidden, "Only admins can do this"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the user the request's token was issued to, responding
+// with a problem if there's no such user. It's looked up once per request.
+func (h *Handler) currentUser(c *gin.Context) (models.User, bool) {
+	if user, ok := c.Get("user"); ok {
+		return user.(models.User), true
+	}
+	id := c.GetString("user_id")
+	if id == "" { // A token from before tokens said who they were issued to
+		apierror.Abort(c, apierror.New(apierror.CodeUnauthorized, "Log in again for a new token"))
+		return models.User{}, false
+	}
+	user, err := h.Users.GetUserByID(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUnauthorized, err, "The token's user no longer exists"))
+		return models.User{}, false
+	} else if err != nil {
+		fail(c, err, "Failed to fetch the user")
+		return models.User{}, false
+	}
+	c.Set("user", user)
+	return user, true
+}
+
+// canAccess reports whether the request's user may see the records of the
+// user or guest ownerID: their own, or anyone's if they're an admin. It
+// responds with a problem if they may not.
+func (h *Handler) canAccess(c *gin.Context, ownerID string) bool {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return false
+	}
+	if user.Type != models.UserTypeAdmin && strconv.FormatUint(uint64(user.ID), 10) != ownerID {
+		apierror.Abort(c, apierror.New(apierror.CodeForbidden, "This belongs to another user"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// expectCart checks the quantity of the mugs in the customer's cart, and the
+// warnings on the cart
+func (a *testAPI) expectCart(mugs int, warnings ...string) {
+	a.t.Helper()
+	var cart models.CartSummary
+	if status := a.call(a.customer, http.MethodGet, "/api/v1/users/"+a.customerID+"/cart", nil, &cart); status != http.StatusOK {
+		a.t.Fatalf("fetching the cart gave %d", status)
+	}
+	var got int
+	for _, line := range cart.Items {
+		if line.ProductID == a.mugID {
+			got = line.Quantity
+		}
+	}
+	if got != mugs || !slices.Equal(cart.Warnings, warnings) {
+		a.t.Errorf("cart holds %d mugs with warnings %v, want %d with %v", got, cart.Warnings, mugs, warnings)
+	}
+}
+
+func TestAddToCartValidatesQuantities(t *testing.T) {
+	a := newTestAPI(t)
+	path := "/api/v1/users/" + a.customerID + "/cart/items"
+	disabled := models.Product{Name: "Old mug", Category: "Kitchen", Price: 5, Disabled: true}
+	if err := a.store.AddProduct(a.ctx, disabled); err != nil {
+		t.Fatal(err)
+	}
+	products, err := a.store.GetAllProducts(a.ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, product := range products {
+		if product.Disabled {
+			disabled = product
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		item map[string]any
+		want int
+	}{
+		{"a mug", map[string]any{"product_id": a.mugID, "quantity": 2}, http.StatusOK},
+		{"no mugs", map[string]any{"product_id": a.mugID, "quantity": 0}, http.StatusUnprocessableEntity},
+		{"fewer than no mugs", map[string]any{"product_id": a.mugID, "quantity": -1}, http.StatusUnprocessableEntity},
+		{"more than a line holds", map[string]any{"product_id": a.mugID, "quantity": models.MaxCartItemQuantity - 1}, http.StatusUnprocessableEntity},
+		{"a missing product", map[string]any{"product_id": 404, "quantity": 1}, http.StatusUnprocessableEntity},
+		{"a disabled product", map[string]any{"product_id": disabled.ID, "quantity": 1}, http.StatusUnprocessableEntity},
+	} {
+		if status := a.call(a.customer, http.MethodPost, path, tc.item, nil); status != tc.want {
+			t.Errorf("adding %s gave %d, want %d", tc.name, status, tc.want)
+		}
+	}
+	a.expectCart(2)
+}
+
+func TestUpdateCartItem(t *testing.T) {
+	a := newTestAPI(t)
+	path := "/api/v1/users/" + a.customerID + "/cart/items/" + strconv.FormatUint(uint64(a.mugID), 10)
+
+	if status := a.call(a.customer, http.MethodPut, path, map[string]any{"quantity": 3}, nil); status != http.StatusOK {
+		t.Fatalf("setting 3 mugs gave %d", status)
+	}
+	a.expectCart(3)
+
+	// More than are in stock can be held, but the cart says so
+	if status := a.call(a.customer, http.MethodPut, path, map[string]any{"quantity": 12}, nil); status != http.StatusOK {
+		t.Fatalf("setting 12 mugs gave %d", status)
+	}
+	a.expectCart(12, models.CartWarningInsufficientStock)
+
+	for _, quantity := range []int{-1, models.MaxCartItemQuantity + 1} {
+		if status := a.call(a.customer, http.MethodPut, path, map[string]any{"quantity": quantity}, nil); status != http.StatusUnprocessableEntity {
+			t.Errorf("setting %d mugs gave %d, want 422", quantity, status)
+		}
+	}
+	if status := a.call(a.customer, http.MethodPut, "/api/v1/users/"+a.customerID+"/cart/items/mug", map[string]any{"quantity": 1}, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("setting a product that isn't an ID gave %d, want 422", status)
+	}
+	a.expectCart(12, models.CartWarningInsufficientStock)
+
+	if status := a.call(a.customer, http.MethodPut, path, map[string]any{"quantity": 0}, nil); status != http.StatusOK {
+		t.Fatalf("setting no mugs gave %d", status)
+	}
+	a.expectCart(0)
+}
+
+func TestDeleteCartItem(t *testing.T) {
+	a := newTestAPI(t)
+	path := "/api/v1/users/" + a.customerID + "/cart/items/" + strconv.FormatUint(uint64(a.mugID), 10)
+	if status := a.call(a.customer, http.MethodPut, path, map[string]any{"quantity": 5}, nil); status != http.StatusOK {
+		t.Fatalf("setting 5 mugs gave %d", status)
+	}
+
+	if status := a.call(a.customer, http.MethodDelete, path+"?quantity=2", nil, nil); status != http.StatusOK {
+		t.Fatalf("removing 2 mugs gave %d", status)
+	}
+	a.expectCart(3)
+	if status := a.call(a.customer, http.MethodDelete, path+"?quantity=0", nil, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("removing no mugs gave %d, want 422", status)
+	}
+	if status := a.call(a.customer, http.MethodDelete, path, nil, nil); status != http.StatusOK {
+		t.Fatalf("removing the mugs gave %d", status)
+	}
+	a.expectCart(0)
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/catalog"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize is the largest file ImportProducts accepts
+const maxImportSize = 512 << 20
+
+// asyncImportSize is the upload size above which an import runs in the
+// background even if it wasn't asked to
+const asyncImportSize = 8 << 20
+
+// ImportProducts upserts products by SKU from a CSV or JSON Lines file, sent
+// as the request body or as the "file" field of a form. The format comes from
+// the format query parameter, the content type or the file name. dry_run=true
+// only reports what would change; async=true, or a large file, runs the
+// import in the background and returns the job to poll.
+func (h *Handler) ImportProducts(c *gin.Context) {
+	liftDeadlines(c)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	var body io.Reader = c.Request.Body
+	size, contentType, filename := c.Request.ContentLength, c.ContentType(), ""
+	if contentType == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidRequest, err, "Missing import file"))
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			fail(c, err, "Failed to read import file")
+			return
+		}
+		defer file.Close()
+		body, size, contentType, filename = file, header.Size, header.Header.Get("Content-Type"), header.Filename
+	}
+
+	format, err := catalog.FormatOf(contentType, filename)
+	if name := c.Query("format"); name != "" {
+		format, err = catalog.ParseFormat(name)
+	}
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidRequest, err, err.Error()))
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	async, _ := strconv.ParseBool(c.Query("async"))
+	opts := catalog.ImportOptions{DryRun: dryRun}
+
+	if async || size > asyncImportSize {
+		path, err := saveImport(body, format)
+		if err != nil {
+			logger(c).Error("Error saving import file", "error", err)
+			importFailed(c, err, nil)
+			return
+		}
+		job := h.Imports.Start(c.Request.Context(), h.Products, path, format, opts)
+		c.Header("Location", "/api/v1/import-jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Import started", "data": job})
+		return
+	}
+
+	report, err := catalog.Import(c.Request.Context(), h.Products, body, format, opts)
+	if err != nil {
+		importFailed(c, err, &report)
+		return
+	}
+	message := "Products imported"
+	if dryRun {
+		message = "Dry run complete, nothing was changed"
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": message, "data": report})
+}
+
+// liftDeadlines lets a request run past the server's read and write timeouts,
+// as big files take longer to send than those allow
+func liftDeadlines(c *gin.Context) {
+	rc := http.NewResponseController(c.Writer)
+	rc.SetReadDeadline(time.Time{}) // Not supported by every writer, such as the ones in tests
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// saveImport copies an upload to a temporary file for a background import
+func saveImport(body io.Reader, format catalog.Format) (string, error) {
+	file, err := os.CreateTemp("", "import-*."+string(format))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// importFailed reports an import that couldn't read its file, along with the
+// rows handled before it stopped
+func importFailed(c *gin.Context, err error, report *catalog.ImportReport) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Abort(c, apierror.Wrap(apierror.CodePayloadTooLarge, err, fmt.Sprintf("Import files are limited to %d MB", maxImportSize>>20)))
+		return
+	}
+	apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidRequest, err, err.Error()).With("report", report))
+}
+
+func (h *Handler) GetImportJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": h.Imports.List()})
+}
+
+func (h *Handler) GetImportJob(c *gin.Context) {
+	job, ok := h.Imports.Get(c.Param("id"))
+	if !ok {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Import job not found"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": job})
+}
+
+// Export downloads every product, category, order or customer (the kind
+// path parameter) as CSV, or JSON Lines with format=jsonl.
+func (h *Handler) Export(c *gin.Context) {
+	kind := c.Param("kind")
+	if !slices.Contains(catalog.ExportKinds, kind) {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Unknown export "+kind))
+		return
+	}
+	format, err := catalog.ParseFormat(c.DefaultQuery("format", string(catalog.FormatCSV)))
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidRequest, err, err.Error()))
+		return
+	}
+
+	liftDeadlines(c)
+	exporter := catalog.Exporter{Products: h.Products, Orders: h.Orders, Users: h.Users}
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, kind, format))
+	if err := exporter.Export(c.Request.Context(), kind, format, c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			fail(c, err, "Failed to export "+kind)
+		} else {
+			logger(c).Error("Error exporting", "kind", kind, "error", err)
+		}
+	}
+}
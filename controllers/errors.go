@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/gin-gonic/gin"
+)
+
+// domainErrors maps the errors the stores wrap to the codes they're reported
+// with
+var domainErrors = []struct {
+	err  error
+	code apierror.Code
+}{
+	{database.ErrNotFound, apierror.CodeNotFound},
+	{database.ErrConflict, apierror.CodeConflict},
+	{database.ErrInvalidCartItem, apierror.CodeInvalidCartItem},
+	{database.ErrEmptyCart, apierror.CodeEmptyCart},
+	{database.ErrInsufficientStock, apierror.CodeInsufficientStock},
+	{database.ErrInvalidReturn, apierror.CodeInvalidReturn},
+	{database.ErrInvalidTransition, apierror.CodeInvalidTransition},
+}
+
+// fail responds with err as a problem. An error wrapping one of domainErrors
+// gets its code, and is described by the detail the store gave with it, such
+// as "quantity must be positive", if any. Any other error is logged and
+// reported as an internal error described by detail.
+func fail(c *gin.Context, err error, detail string) {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		apierror.Abort(c, apiErr)
+		return
+	}
+	for _, domain := range domainErrors {
+		if errors.Is(err, domain.err) {
+			var detailErr *database.DetailError
+			var explanation string
+			if errors.As(err, &detailErr) {
+				explanation = detailErr.Detail
+			}
+			apierror.Abort(c, apierror.Wrap(domain.code, err, explanation))
+			return
+		}
+	}
+	logger(c).Error(detail, "error", err)
+	apierror.Abort(c, apierror.Wrap(apierror.CodeInternal, err, detail))
+}
+
+// lookupFailed responds to a record that couldn't be fetched: with a 404
+// saying notFound if it doesn't exist, and an internal error otherwise
+func lookupFailed(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, database.ErrNotFound) {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeNotFound, err, notFound))
+		return
+	}
+	fail(c, err, "Failed to fetch the record")
+}
+
+// bindJSON reads the request body into v, responding with a problem if it
+// can't
+func bindJSON(c *gin.Context, v any) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		logger(c).Warn("Error binding JSON", "error", err)
+		apierror.Abort(c, apierror.FromBinding(err))
+		return false
+	}
+	return true
+}
+
+// bindOptionalJSON is bindJSON for a body that may be left out, leaving v as
+// it is if there's none
+func bindOptionalJSON(c *gin.Context, v any) bool {
+	if err := c.ShouldBindJSON(v); err != nil && !errors.Is(err, io.EOF) {
+		logger(c).Warn("Error binding JSON", "error", err)
+		apierror.Abort(c, apierror.FromBinding(err))
+		return false
+	}
+	return true
+}
+
+// GetErrors lists the error codes the API responds with
+func (h *Handler) GetErrors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": apierror.Catalogue()})
+}
+
+// GetError describes an error code; problems link here as their type
+func (h *Handler) GetError(c *gin.Context) {
+	entry, ok := apierror.Lookup(apierror.Code(c.Param("code")))
+	if !ok {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Unknown error code "+c.Param("code")))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": entry})
+}
+
+// NoRoute reports a path the API doesn't serve
+func (h *Handler) NoRoute(c *gin.Context) {
+	apierror.Abort(c, apierror.New(apierror.CodeNotFound, "No such endpoint"))
+}
+
+// NoMethod reports a path the API serves, but not for the request's method
+func (h *Handler) NoMethod(c *gin.Context) {
+	apierror.Abort(c, apierror.New(apierror.CodeMethodNotAllowed, c.Request.Method+" isn't allowed here"))
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/gin-gonic/gin"
+)
+
+func TestFail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		err    error
+		code   apierror.Code
+		detail string
+	}{
+		{"store error with a detail",
+			fmt.Errorf("AddItemToCart: %w", &database.DetailError{Err: database.ErrInvalidCartItem, Detail: "quantity must be positive"}),
+			apierror.CodeInvalidCartItem, "quantity must be positive"},
+		{"store error without one", fmt.Errorf("SaveUser: %w", database.ErrConflict), apierror.CodeConflict, ""},
+		{"message that reads like a store error", fmt.Errorf("query: %v", database.ErrNotFound.Error()+": users.password_hash"),
+			apierror.CodeInternal, "Failed to do it"},
+		{"API error", apierror.New(apierror.CodeForbidden, "Not yours"), apierror.CodeForbidden, "Not yours"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+			fail(c, tc.err, "Failed to do it")
+			var problem struct {
+				Code   apierror.Code `json:"code"`
+				Detail string        `json:"detail"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != tc.code || problem.Detail != tc.detail {
+				t.Errorf("got %s %q, want %s %q", problem.Code, problem.Detail, tc.code, tc.detail)
+			}
+		})
+	}
+}
+
+func TestDetailErrorWrapsItsError(t *testing.T) {
+	err := fmt.Errorf("GetProduct: %w", &database.DetailError{Err: database.ErrNotFound, Detail: "no product found for ID 3"})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Error("a detailed error isn't the error it details")
+	}
+	if got, want := err.Error(), "GetProduct: record not found: no product found for ID 3"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
@@ -5,46 +5,76 @@ go 1.23.1
 replace github.com/Rohanrevanth/e-store-go/database => ../database
 
 require (
+	github.com/Rohanrevanth/e-store-go/apierror v0.0.0-00010101000000-000000000000
 	github.com/Rohanrevanth/e-store-go/auth v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/catalog v0.0.0-00010101000000-000000000000
 	github.com/Rohanrevanth/e-store-go/database v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/graphql v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/health v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/logging v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/metrics v0.0.0-00010101000000-000000000000
 	github.com/Rohanrevanth/e-store-go/models v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/payments v0.0.0-00010101000000-000000000000
+	github.com/Rohanrevanth/e-store-go/webhooks v0.0.0-00010101000000-000000000000
 	github.com/gin-gonic/gin v1.10.0
 )
 
 require (
+	github.com/Rohanrevanth/e-store-go/events v0.0.0-00010101000000-000000000000 // indirect
+	github.com/Rohanrevanth/e-store-go/notify v0.0.0-00010101000000-000000000000 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
-	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/cloudwego/base64x v0.1.4 // indirect
 	github.com/cloudwego/iasm v0.2.0 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
-	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.20.0 // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
+	github.com/go-sql-driver/mysql v1.7.0 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
+	github.com/graph-gophers/dataloader/v7 v7.1.0 // indirect
+	github.com/graphql-go/graphql v0.8.1 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/pgx/v5 v5.5.5 // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.7 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-sqlite3 v1.14.22 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
+	github.com/prometheus/client_golang v1.20.5 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
+	go.opentelemetry.io/otel v1.32.0 // indirect
+	go.opentelemetry.io/otel/metric v1.32.0 // indirect
+	go.opentelemetry.io/otel/trace v1.32.0 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.27.0 // indirect
-	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
-	google.golang.org/protobuf v1.34.1 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gorm.io/driver/mysql v1.5.7 // indirect
+	gorm.io/driver/postgres v1.5.9 // indirect
 	gorm.io/driver/sqlite v1.5.6 // indirect
 	gorm.io/gorm v1.25.12 // indirect
 )
@@ -54,3 +84,23 @@ replace github.com/Rohanrevanth/e-store-go/routes => ../routes
 replace github.com/Rohanrevanth/e-store-go/auth => ../auth
 
 replace github.com/Rohanrevanth/e-store-go/models => ../models
+
+replace github.com/Rohanrevanth/e-store-go/payments => ../payments
+
+replace github.com/Rohanrevanth/e-store-go/catalog => ../catalog
+
+replace github.com/Rohanrevanth/e-store-go/health => ../health
+
+replace github.com/Rohanrevanth/e-store-go/logging => ../logging
+
+replace github.com/Rohanrevanth/e-store-go/metrics => ../metrics
+
+replace github.com/Rohanrevanth/e-store-go/apierror => ../apierror
+
+replace github.com/Rohanrevanth/e-store-go/graphql => ../graphql
+
+replace github.com/Rohanrevanth/e-store-go/webhooks => ../webhooks
+
+replace github.com/Rohanrevanth/e-store-go/events => ../events
+
+replace github.com/Rohanrevanth/e-store-go/notify => ../notify
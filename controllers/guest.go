@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/mail"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// guestOwner returns the cart owner for the guest identified by
+// auth.CartTokenMiddleware.
+func guestOwner(c *gin.Context) string {
+	return models.GuestOwner(c.GetString("cart_id"))
+}
+
+func (h *Handler) GetGuestCart(c *gin.Context) {
+	h.getCart(c, guestOwner(c))
+}
+
+func (h *Handler) AddProductToGuestCart(c *gin.Context) {
+	h.addToCart(c, guestOwner(c))
+}
+
+func (h *Handler) UpdateGuestCartItem(c *gin.Context) {
+	h.updateCartItem(c, guestOwner(c))
+}
+
+func (h *Handler) RemoveItemFromGuestCart(c *gin.Context) {
+	h.removeFromCart(c, guestOwner(c))
+}
+
+func (h *Handler) DeleteGuestCartItem(c *gin.Context) {
+	h.deleteCartItem(c, guestOwner(c))
+}
+
+// GuestCheckout places an order for a visitor who hasn't registered. Only an
+// email address is needed to contact them about the order.
+func (h *Handler) GuestCheckout(c *gin.Context) {
+	var item models.Order
+	if !bindJSON(c, &item) {
+		return
+	}
+	address, err := mail.ParseAddress(item.Email)
+	if err != nil {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "email", Reason: "A valid email is required"}))
+		return
+	}
+	if item.ShippingDetails == "" {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "shipping_details", Reason: "Shipping details are required"}))
+		return
+	}
+
+	item.Email = address.Address
+	item.UserID = guestOwner(c)
+	h.placeOrder(c, item)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// guestCart has a visitor put mugs in their cart, returning their cart token
+func (a *testAPI) guestCart(mugs int) string {
+	a.t.Helper()
+	body, err := json.Marshal(map[string]any{"product_id": a.mugID, "quantity": mugs})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/guest/cart/items", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	a.engine.ServeHTTP(w, req)
+	token := w.Header().Get(auth.CartHeader)
+	if w.Code != http.StatusOK || token == "" {
+		a.t.Fatalf("adding to a guest cart gave %d and token %q", w.Code, token)
+	}
+	return token
+}
+
+// login logs in as a user with the password "password" carrying the cart
+// token, returning the response
+func (a *testAPI) login(email, cartToken string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	body, err := json.Marshal(map[string]any{"email": email, "password": "password"})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.CartHeader, cartToken)
+	w := httptest.NewRecorder()
+	a.engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		a.t.Fatalf("logging in gave %d", w.Code)
+	}
+	return w
+}
+
+func TestLoginMergesGuestCart(t *testing.T) {
+	for _, tc := range []struct {
+		rule string
+		want int // Mugs in the cart, from the user's 1 and the guest's 2
+	}{
+		{models.CartMergeSum, 3},
+		{models.CartMergeMax, 2},
+		{models.CartMergeKeepUser, 1},
+		{models.CartMergeKeepGuest, 2},
+	} {
+		t.Run(tc.rule, func(t *testing.T) {
+			a := newTestAPI(t)
+			a.handler.CartMergeRule = tc.rule
+			user := models.User{Username: "shopper", Email: "shopper@example.com"}
+			if err := user.HashPassword("password"); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.store.AddUser(a.ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			user, err := a.store.GetUserByEmail(a.ctx, user.Email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			owner := strconv.FormatUint(uint64(user.ID), 10)
+			if err := a.store.AddItemToCart(a.ctx, owner, a.mugID, 1); err != nil {
+				t.Fatal(err)
+			}
+			token := a.guestCart(2)
+
+			w := a.login(user.Email, token)
+			if cookie := w.Header().Get("Set-Cookie"); !strings.Contains(cookie, auth.CartCookie+"=;") {
+				t.Errorf("logging in set cookie %q, want the cart cookie cleared", cookie)
+			}
+			cart, err := a.store.GetUserCart(a.ctx, owner)
+			if err != nil || len(cart.Items) != 1 || cart.Items[0].Quantity != tc.want {
+				t.Fatalf("cart holds %v (%v), want %d mugs", cart.Items, err, tc.want)
+			}
+			cartID, err := auth.ParseCartToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.store.GetUserCart(a.ctx, models.GuestOwner(cartID)); err == nil {
+				t.Error("the guest cart is still there after merging")
+			}
+		})
+	}
+}
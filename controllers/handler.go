@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"log/slog"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/catalog"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/graphql"
+	"github.com/Rohanrevanth/e-store-go/health"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/Rohanrevanth/e-store-go/metrics"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the API from the stores and payment provider it's given
+type Handler struct {
+	Users    database.UserStore
+	Products database.ProductStore
+	Carts    database.CartStore
+	Orders   database.OrderStore
+	Payments database.PaymentStore
+	Returns  database.ReturnStore
+	Coupons  database.CouponStore
+	Webhooks database.WebhookStore
+
+	// PaymentProvider handles every payment, new and existing
+	PaymentProvider payments.PaymentProvider
+
+	// CartMergeRule decides how a guest cart is combined with the user's cart
+	// on login when both contain the same product (one of models.CartMerge*).
+	CartMergeRule string
+
+	// CartTokens says how guest cart tokens and their cookie are issued
+	CartTokens auth.CartTokens
+
+	// Imports tracks product imports running in the background
+	Imports *catalog.Jobs
+
+	// Health says whether the server is ready for traffic
+	Health *health.Checker
+
+	// Metrics counts requests, queries and business events for Prometheus
+	Metrics *metrics.Metrics
+
+	// GraphQL answers storefront queries from the same stores
+	GraphQL *graphql.Server
+}
+
+// NewHandler returns a handler keeping everything in store and taking
+// payments through provider.
+func NewHandler(store database.Store, provider payments.PaymentProvider) *Handler {
+	h := &Handler{
+		Users:           store,
+		Products:        store,
+		Carts:           store,
+		Orders:          store,
+		Payments:        store,
+		Returns:         store,
+		Coupons:         store,
+		Webhooks:        store,
+		PaymentProvider: provider,
+		CartMergeRule:   models.CartMergeSum,
+		CartTokens:      auth.DefaultCartTokens(),
+		Imports:         catalog.NewJobs(),
+		Health:          health.NewChecker(),
+		Metrics:         metrics.New(),
+	}
+	h.GraphQL = graphql.NewServer(store, h.Metrics)
+	return h
+}
+
+// customer returns how the owner of a cart or order is labelled in metrics
+func customer(ownerID string) string {
+	if models.IsGuestOwner(ownerID) {
+		return metrics.CustomerGuest
+	}
+	return metrics.CustomerUser
+}
+
+// logger returns the request's logger, which tags entries with its ID
+func logger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
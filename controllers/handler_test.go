@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/gin-gonic/gin"
+)
+
+// testAPI serves the handlers under test from a store, in memory unless
+// given another, with payments through the fake provider, to an admin and two
+// customers
+type testAPI struct {
+	t        *testing.T
+	ctx      context.Context
+	store    database.Store
+	provider *payments.FakeProvider
+	handler  *Handler
+	engine   *gin.Engine
+
+	admin      string // Bearer tokens
+	customer   string
+	customerID string
+	other      string // Another customer's token
+	mugID      uint   // A product priced 10 with 10 in stock
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	return newTestAPIWith(t, database.NewMemoryStore())
+}
+
+// newTestAPIWith serves the handlers under test from store, which must be
+// empty
+func newTestAPIWith(t *testing.T, store database.Store) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	a := &testAPI{
+		t:        t,
+		ctx:      context.Background(),
+		store:    store,
+		provider: payments.NewFakeProvider(payments.FakeConfig{WebhookSecret: "test-secret"}),
+	}
+	a.handler = NewHandler(a.store, a.provider)
+	a.engine = gin.New()
+	a.register(a.engine.Group("/api/v1"))
+
+	var customerID uint
+	a.admin, _ = a.addUser("admin@example.com", models.UserTypeAdmin)
+	a.customer, customerID = a.addUser("customer@example.com", "")
+	a.other, _ = a.addUser("other@example.com", "")
+	a.customerID = strconv.FormatUint(uint64(customerID), 10)
+
+	product := models.Product{Name: "Mug", Category: "Kitchen", Price: 10, Stock: 10, StockTracked: true}
+	if err := a.store.AddProduct(a.ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	products, err := a.store.GetAllProducts(a.ctx)
+	if err != nil || len(products) != 1 {
+		t.Fatalf("got products %v (%v), want the mug", products, err)
+	}
+	a.mugID = products[0].ID
+	return a
+}
+
+// register routes the handlers under test as the API does
+func (a *testAPI) register(api *gin.RouterGroup) {
+	h := a.handler
+	api.POST("/auth/login", h.Login)
+	api.POST("/payments/webhook", h.PaymentWebhook)
+	guest := api.Group("/guest").Use(auth.CartTokenMiddleware(h.CartTokens))
+	{
+		guest.POST("/cart/items", h.AddProductToGuestCart)
+	}
+	protected := api.Group("").Use(auth.JWTAuthMiddleware())
+	{
+		protected.GET("/users/:id/cart", h.GetUserCart)
+		protected.POST("/users/:id/cart/items", h.AddProductToCart)
+		protected.PUT("/users/:id/cart/items/:product_id", h.UpdateCartItem)
+		protected.DELETE("/users/:id/cart/items/:product_id", h.DeleteCartItem)
+		protected.POST("/orders", h.PlaceOrder)
+		protected.POST("/returns", h.RequestReturn)
+		protected.GET("/users/:id/returns", h.GetUserReturns)
+	}
+	admin := api.Group("").Use(auth.JWTAuthMiddleware(), h.RequireAdmin())
+	{
+		admin.POST("/orders/:id/payment/capture", h.CapturePayment)
+		admin.POST("/returns/:id/approve", h.ApproveReturn)
+		admin.POST("/returns/:id/reject", h.RejectReturn)
+	}
+}
+
+// addUser adds a user of the given type, returning a token issued to them
+// and their ID
+func (a *testAPI) addUser(email, userType string) (string, uint) {
+	a.t.Helper()
+	if err := a.store.AddUser(a.ctx, models.User{Username: email, Email: email, Type: userType}); err != nil {
+		a.t.Fatal(err)
+	}
+	user, err := a.store.GetUserByEmail(a.ctx, email)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	token, err := auth.GenerateJWT(user.ID, user.Email)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return token, user.ID
+}
+
+// call sends a request with token as its bearer token, if any, decoding the
+// response's data into out, if given, and returns the response's status
+func (a *testAPI) call(token, method, path string, body any, out any) int {
+	a.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.engine.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		response := struct {
+			Data any `json:"data"`
+		}{Data: out}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			a.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return w.Code
+}
+
+// deliveredOrder has the customer buy mugs with a captured payment and the
+// order delivered, ready to be returned. It returns the order's ID and its
+// item's.
+func (a *testAPI) deliveredOrder(mugs int) (string, uint) {
+	a.t.Helper()
+	item := map[string]any{"product_id": a.mugID, "quantity": mugs}
+	if status := a.call(a.customer, http.MethodPost, "/api/v1/users/"+a.customerID+"/cart/items", item, nil); status != http.StatusOK {
+		a.t.Fatalf("adding to the cart gave %d", status)
+	}
+	var placed struct {
+		OrderID uint `json:"order_id"`
+	}
+	order := map[string]any{"user_id": a.customerID, "payment_method": "fake_success", "shipping_details": "1 Main St"}
+	if status := a.call(a.customer, http.MethodPost, "/api/v1/orders", order, &placed); status != http.StatusOK {
+		a.t.Fatalf("placing the order gave %d", status)
+	}
+	orderID := strconv.FormatUint(uint64(placed.OrderID), 10)
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/orders/"+orderID+"/payment/capture", nil, nil); status != http.StatusOK {
+		a.t.Fatalf("capturing the payment gave %d", status)
+	}
+	for _, status := range []string{models.OrderStatusShipped, models.OrderStatusDelivered} {
+		if err := a.store.UpdateOrderStatus(a.ctx, orderID, status); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	stored, err := a.store.GetOrder(a.ctx, orderID)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return orderID, stored.OrderItems[0].ID
+}
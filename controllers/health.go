@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz tells an orchestrator the process is alive. It doesn't look at
+// the database, so an outage there doesn't get every server restarted.
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "ok"})
+}
+
+// Readyz reports whether the server should be sent traffic: it's serving,
+// not shutting down, and its database, schema and cache are all usable.
+func (h *Handler) Readyz(c *gin.Context) {
+	report := h.Health.Check(c.Request.Context())
+	if !report.Ready {
+		apierror.Abort(c, apierror.New(apierror.CodeUnavailable, "Not ready").With("report", report))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": report})
+}
+
+// Version returns the build that's running
+func (h *Handler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": health.Build()})
+}
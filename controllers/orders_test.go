@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/metrics"
+)
+
+// ordersPlaced returns how many orders the metrics have counted as placed by
+// users
+func (a *testAPI) ordersPlaced() float64 {
+	a.t.Helper()
+	families, err := a.handler.Metrics.Registry.Gather()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "estore_orders_placed_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "customer" && label.GetValue() == metrics.CustomerUser {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// placeOrder has the customer order a mug, paying with method, and returns
+// the response's status and the payment's reference
+func (a *testAPI) placeOrder(method string) (int, string) {
+	a.t.Helper()
+	item := map[string]any{"product_id": a.mugID, "quantity": 1}
+	if status := a.call(a.customer, http.MethodPost, "/api/v1/users/"+a.customerID+"/cart/items", item, nil); status != http.StatusOK {
+		a.t.Fatalf("adding to the cart gave %d", status)
+	}
+	var placed struct {
+		Payment struct {
+			ProviderRef string `json:"provider_ref"`
+		} `json:"payment"`
+	}
+	order := map[string]any{"user_id": a.customerID, "payment_method": method, "shipping_details": "1 Main St"}
+	status := a.call(a.customer, http.MethodPost, "/api/v1/orders", order, &placed)
+	return status, placed.Payment.ProviderRef
+}
+
+func TestOrderCountedOnceAuthorized(t *testing.T) {
+	a := newTestAPI(t)
+
+	if status, _ := a.placeOrder("fake_declined"); status != http.StatusPaymentRequired {
+		t.Fatalf("placing a declined order gave %d", status)
+	}
+	if n := a.ordersPlaced(); n != 0 {
+		t.Errorf("counted %v orders placed after a declined payment, want 0", n)
+	}
+
+	if status, _ := a.placeOrder("fake_success"); status != http.StatusOK {
+		t.Fatalf("placing an order gave %d", status)
+	}
+	if n := a.ordersPlaced(); n != 1 {
+		t.Errorf("counted %v orders placed after an authorized payment, want 1", n)
+	}
+
+	status, ref := a.placeOrder("fake_3ds")
+	if status != http.StatusAccepted {
+		t.Fatalf("placing an order needing 3DS gave %d", status)
+	}
+	if n := a.ordersPlaced(); n != 1 {
+		t.Errorf("counted %v orders placed while one waits on 3DS, want 1", n)
+	}
+	payload, signature, err := a.provider.CompleteAction(ref, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 { // Providers may send a webhook twice
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/webhook", bytes.NewReader(payload))
+		req.Header.Set("X-Payment-Signature", signature)
+		w := httptest.NewRecorder()
+		a.engine.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("the 3DS webhook gave %d", w.Code)
+		}
+	}
+	if n := a.ordersPlaced(); n != 2 {
+		t.Errorf("counted %v orders placed once 3DS went through, want 2", n)
+	}
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/gin-gonic/gin"
+)
+
+// Currency charged for all orders
+const currency = "USD"
+
+// refundRequest is the optional body of a refund, which is for the whole
+// refundable balance without an amount
+type refundRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+// authorizeOrder asks the provider to authorize the order total and records
+// the outcome, which moves the order to its next status.
+func (h *Handler) authorizeOrder(ctx context.Context, order models.Order) (models.Payment, error) {
+	payment, err := h.Payments.AddPayment(ctx, models.Payment{
+		OrderID:  order.ID,
+		Provider: h.PaymentProvider.Name(),
+		Method:   order.PaymentMethod,
+		Amount:   order.TotalPrice,
+		Currency: currency,
+		Status:   models.PaymentStatusPending,
+	})
+	if err != nil {
+		return payment, err
+	}
+
+	result, err := h.PaymentProvider.Authorize(ctx, payments.AuthorizeRequest{
+		OrderID:  order.ID,
+		Amount:   order.TotalPrice,
+		Currency: currency,
+		Method:   order.PaymentMethod,
+	})
+	if err != nil {
+		result = payments.Result{Status: models.PaymentStatusFailed, Message: err.Error()}
+	}
+	payment.ProviderRef = result.ProviderRef
+	payment.NextActionURL = result.NextActionURL
+	return h.recordResult(ctx, payment, models.TransactionAuthorize, result)
+}
+
+func (h *Handler) recordResult(ctx context.Context, payment models.Payment, txnType string, result payments.Result) (models.Payment, error) {
+	return h.Payments.RecordPaymentTransaction(ctx, payment, transactionFor(txnType, result))
+}
+
+// transactionFor returns the transaction recording a provider call's result
+func transactionFor(txnType string, result payments.Result) models.Transaction {
+	return models.Transaction{
+		Type:        txnType,
+		Amount:      result.Amount,
+		Status:      result.Status,
+		ProviderRef: result.ProviderRef,
+		Message:     result.Message,
+	}
+}
+
+// GetOrderPayment returns the payment of one of the user's orders, or of any
+// order to an admin
+func (h *Handler) GetOrderPayment(c *gin.Context) {
+	id := c.Param("id")
+	order, err := h.Orders.GetOrder(c.Request.Context(), id)
+	if err != nil {
+		lookupFailed(c, err, "Order not found")
+		return
+	}
+	if !h.canAccess(c, order.UserID) {
+		return
+	}
+	payment, err := h.Payments.GetOrderPayment(c.Request.Context(), id)
+	if err != nil {
+		lookupFailed(c, err, "Payment not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": payment})
+}
+
+func (h *Handler) CapturePayment(c *gin.Context) {
+	id := c.Param("id")
+	payment, err := h.Payments.GetOrderPayment(c.Request.Context(), id)
+	if err != nil {
+		lookupFailed(c, err, "Payment not found")
+		return
+	}
+	if payment.Status != models.PaymentStatusAuthorized {
+		apierror.Abort(c, apierror.New(apierror.CodeConflict, "Payment is not awaiting capture"))
+		return
+	}
+
+	result, err := h.PaymentProvider.Capture(c.Request.Context(), payment.ProviderRef, payment.Amount)
+	if err != nil {
+		logger(c).Error("Error capturing payment", "error", err)
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUpstreamFailed, err, "Failed to capture payment"))
+		return
+	}
+	payment, err = h.recordResult(c.Request.Context(), payment, models.TransactionCapture, result)
+	if err != nil {
+		fail(c, err, "Failed to record capture")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payment captured", "data": payment})
+}
+
+func (h *Handler) VoidPayment(c *gin.Context) {
+	id := c.Param("id")
+	payment, err := h.Payments.GetOrderPayment(c.Request.Context(), id)
+	if err != nil {
+		lookupFailed(c, err, "Payment not found")
+		return
+	}
+	if payment.Status != models.PaymentStatusAuthorized && payment.Status != models.PaymentStatusPending {
+		apierror.Abort(c, apierror.New(apierror.CodeConflict, "Payment can no longer be voided"))
+		return
+	}
+
+	result, err := h.PaymentProvider.Void(c.Request.Context(), payment.ProviderRef)
+	if err != nil {
+		logger(c).Error("Error voiding payment", "error", err)
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUpstreamFailed, err, "Failed to void payment"))
+		return
+	}
+	payment, err = h.recordResult(c.Request.Context(), payment, models.TransactionVoid, result)
+	if err != nil {
+		fail(c, err, "Failed to record void")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payment voided", "data": payment})
+}
+
+func (h *Handler) RefundPayment(c *gin.Context) {
+	id := c.Param("id")
+	var req refundRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	payment, err := h.Payments.GetOrderPayment(c.Request.Context(), id)
+	if err != nil {
+		lookupFailed(c, err, "Payment not found")
+		return
+	}
+	refundable := payment.CapturedAmount - payment.RefundedAmount
+	if req.Amount <= 0 {
+		req.Amount = refundable
+	}
+	if req.Amount <= 0 || req.Amount > refundable {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "amount", Reason: "Refund amount exceeds the refundable balance"}))
+		return
+	}
+
+	result, err := h.PaymentProvider.Refund(c.Request.Context(), payment.ProviderRef, req.Amount)
+	if err != nil {
+		logger(c).Error("Error refunding payment", "error", err)
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUpstreamFailed, err, "Failed to refund payment"))
+		return
+	}
+	payment, err = h.recordResult(c.Request.Context(), payment, models.TransactionRefund, result)
+	if err != nil {
+		fail(c, err, "Failed to record refund")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payment refunded", "data": payment})
+}
+
+// PaymentWebhook receives asynchronous payment updates (e.g. a completed 3DS
+// challenge) from the provider. It is not behind JWT auth; the payload
+// signature is checked instead.
+func (h *Handler) PaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidRequest, err, "Failed to read payload"))
+		return
+	}
+	event, err := h.PaymentProvider.VerifyWebhook(payload, c.GetHeader("X-Payment-Signature"))
+	if err != nil {
+		logger(c).Warn("Rejected payment webhook", "error", err)
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInvalidSignature, err, "Invalid signature"))
+		return
+	}
+
+	payment, err := h.Payments.GetPaymentByRef(c.Request.Context(), event.ProviderRef)
+	if err != nil {
+		lookupFailed(c, err, "Payment not found")
+		return
+	}
+	if event.Status == payment.Status {
+		// Already applied; providers may deliver the same event more than once
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		return
+	}
+
+	_, err = h.recordResult(c.Request.Context(), payment, models.TransactionWebhook, payments.Result{
+		Status:      event.Status,
+		ProviderRef: event.ProviderRef,
+		Amount:      event.Amount,
+		Message:     event.Type,
+	})
+	if err != nil {
+		fail(c, err, "Failed to apply event")
+		return
+	}
+	if payment.Status == models.PaymentStatusPending && event.Status == models.PaymentStatusAuthorized {
+		orderID := strconv.FormatUint(uint64(payment.OrderID), 10)
+		if order, err := h.Orders.GetOrder(c.Request.Context(), orderID); err == nil {
+			h.countOrder(order)
+		} else {
+			logger(c).Warn("Failed to count an order authorized by webhook", "order_id", orderID, "error", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
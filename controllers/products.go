@@ -2,77 +2,76 @@ package controllers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
-	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/catalog"
 	"github.com/Rohanrevanth/e-store-go/models"
 	"github.com/gin-gonic/gin"
 )
 
-func GetAllCategories(c *gin.Context) {
-	categories, err := database.GetAllCategories()
+func (h *Handler) GetAllCategories(c *gin.Context) {
+	categories, err := h.Products.GetAllCategories(c.Request.Context())
 	if err != nil {
-		log.Println("Error fetching categories:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch categories"})
+		fail(c, err, "Failed to fetch categories")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": categories})
 }
 
-func GetBestSellers(c *gin.Context) {
-	bestSellers, err := database.GetBestSellers()
+func (h *Handler) GetBestSellers(c *gin.Context) {
+	bestSellers, err := h.Products.GetBestSellers(c.Request.Context())
 	if err != nil {
-		log.Println("Error fetching best-sellers:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch best-sellers"})
+		fail(c, err, "Failed to fetch best-sellers")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": bestSellers})
 }
 
-func GetProducts(c *gin.Context) {
+func (h *Handler) GetProducts(c *gin.Context) {
 	var product models.Product
-	if err := c.BindJSON(&product); err != nil {
-		log.Println("Error binding body:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request payload"})
+	if !bindJSON(c, &product) {
 		return
 	}
-	products, err := database.GetProducts(product.Category)
+	products, err := h.Products.GetProducts(c.Request.Context(), product.Category)
 	if err != nil {
-		log.Println("Error fetching products:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch products"})
+		fail(c, err, "Failed to fetch products")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": products})
 }
 
-func GetAllProducts(c *gin.Context) {
-	products, err := database.GetAllProducts()
+// GetAllProducts lists the catalog, or the products in the category query
+// parameter if given
+func (h *Handler) GetAllProducts(c *gin.Context) {
+	var products []models.Product
+	var err error
+	if category := c.Query("category"); category != "" {
+		products, err = h.Products.GetProducts(c.Request.Context(), category)
+	} else {
+		products, err = h.Products.GetAllProducts(c.Request.Context())
+	}
 	if err != nil {
-		log.Println("Error fetching products:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch products"})
+		fail(c, err, "Failed to fetch products")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": products})
 }
 
-func AddCategories(c *gin.Context) {
+func (h *Handler) AddCategories(c *gin.Context) {
 	var newCategories []models.Category
-	if err := c.BindJSON(&newCategories); err != nil {
-		log.Println("Error binding categories:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request payload"})
+	if !bindJSON(c, &newCategories) {
 		return
 	}
 
 	// var addedCategories []models.Category
 	for _, category := range newCategories {
-		err := database.AddCategory(category)
+		err := h.Products.AddCategory(c.Request.Context(), category)
 		if err != nil {
-			log.Println("Error adding category:", err)
+			logger(c).Error("Error adding category", "error", err)
 			continue // Skip this category and proceed with the others
 		}
 
-		// savedUser, err := database.GetUserByEmail(user.Email)
+		// savedUser, err := h.Users.GetUserByEmail(c.Request.Context(), user.Email)
 		// if err != nil {
 		// 	log.Println("Error fetching saved user:", err)
 		// 	continue
@@ -84,27 +83,30 @@ func AddCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Categories added"})
 }
 
-func AddProducts(c *gin.Context) {
+// AddProducts adds a JSON array of products, skipping any that can't be
+// added and listing them by position in the response. Use ImportProducts for
+// large catalogs.
+func (h *Handler) AddProducts(c *gin.Context) {
 	var newProducts []models.Product
-	if err := c.BindJSON(&newProducts); err != nil {
-		log.Println("Error binding product:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request payload"})
+	if !bindJSON(c, &newProducts) {
 		return
 	}
 
-	for _, product := range newProducts {
+	added := 0
+	var failed []catalog.RowError
+	for i, product := range newProducts {
 		detailsJSON, err := json.Marshal(product.Details)
-		if err != nil {
-			log.Fatalf("Error marshaling details: %v", err)
+		if err == nil {
+			product.Details = string(detailsJSON)
+			err = h.Products.AddProduct(c.Request.Context(), product)
 		}
-		product.Details = string(detailsJSON)
-
-		err = database.AddProduct(product)
 		if err != nil {
-			log.Println("Error adding product:", err)
+			logger(c).Error("Error adding product", "error", err)
+			failed = append(failed, catalog.RowError{Row: i + 1, SKU: product.SKU, Error: err.Error()})
 			continue // Skip this product and proceed with the others
 		}
+		added++
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Products added"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Products added", "data": gin.H{"added": added, "errors": failed}})
 }
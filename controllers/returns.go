@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+type orderStatusUpdate struct {
+	Status string `json:"status"`
+}
+
+// Order statuses an admin can set by hand; the rest follow from payments
+var fulfilmentStatuses = map[string]bool{
+	models.OrderStatusShipped:   true,
+	models.OrderStatusDelivered: true,
+}
+
+// refundFor works out what to give back for the items in a return. Order
+// discounts are spread over every item, so each unit refunds the share of the
+// total that was actually paid for it.
+func refundFor(order models.Order, request models.ReturnRequest) float64 {
+	var itemsTotal float64
+	for _, item := range request.Items {
+		itemsTotal += float64(item.Quantity) * item.Price
+	}
+	if order.Discount > 0 && order.TotalPrice+order.Discount > 0 {
+		itemsTotal *= order.TotalPrice / (order.TotalPrice + order.Discount)
+	}
+	return math.Round(itemsTotal*100) / 100
+}
+
+func (h *Handler) UpdateOrderStatus(c *gin.Context) {
+	id := c.Param("id")
+	var update orderStatusUpdate
+	if !bindJSON(c, &update) {
+		return
+	}
+	if !fulfilmentStatuses[update.Status] {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "status", Reason: "Status can't be set directly"}))
+		return
+	}
+	err := h.Orders.UpdateOrderStatus(c.Request.Context(), id, update.Status)
+	if err != nil {
+		fail(c, err, "Failed to update order")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Order updated"})
+}
+
+// RequestReturn asks for items of one of the user's orders to be returned.
+// Only the order, reason and the items' quantities are taken from the body;
+// the rest is filled in from the order or decided by an admin.
+func (h *Handler) RequestReturn(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var body models.ReturnRequest
+	if !bindJSON(c, &body) {
+		return
+	}
+	request := models.ReturnRequest{
+		OrderID: body.OrderID,
+		UserID:  strconv.FormatUint(uint64(user.ID), 10),
+		Reason:  body.Reason,
+	}
+	for _, item := range body.Items {
+		request.Items = append(request.Items, models.ReturnItem{OrderItemID: item.OrderItemID, Quantity: item.Quantity, Reason: item.Reason})
+	}
+	request, err := h.Returns.AddReturnRequest(c.Request.Context(), request)
+	if err != nil {
+		fail(c, err, "Failed to request return")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Return requested", "data": request})
+}
+
+func (h *Handler) GetUserReturns(c *gin.Context) {
+	id := c.Param("id")
+	if !h.canAccess(c, id) {
+		return
+	}
+	requests, err := h.Returns.GetUserReturns(c.Request.Context(), id)
+	if err != nil {
+		fail(c, err, "Failed to retrieve returns")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": requests})
+}
+
+func (h *Handler) GetAllReturns(c *gin.Context) {
+	requests, err := h.Returns.GetAllReturns(c.Request.Context())
+	if err != nil {
+		fail(c, err, "Failed to retrieve returns")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": requests})
+}
+
+// ApproveReturn approves a return and refunds it through the payment provider.
+// Only one approval of a return goes ahead: it's claimed by moving it from
+// requested to approved before anything is refunded. If the refund fails the
+// return goes back to requested so it can be approved again to retry it. Once
+// issued, the refund's reference is kept on the return, so if recording it
+// fails, approving the return again records that refund instead of issuing
+// another.
+func (h *Handler) ApproveReturn(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	var decision models.ReturnDecision
+	if !bindJSON(c, &decision) {
+		return
+	}
+	restock := decision.Restock == nil || *decision.Restock
+
+	request, err := h.Returns.DecideReturn(ctx, id, models.ReturnStatusApproved, decision.Note)
+	retry := errors.Is(err, database.ErrConflict) && request.Status == models.ReturnStatusApproved && request.RefundRef != ""
+	switch {
+	case retry:
+	case errors.Is(err, database.ErrConflict) && request.Status == models.ReturnStatusApproved:
+		apierror.Abort(c, apierror.Wrap(apierror.CodeConflict, err, "Return is already being refunded"))
+		return
+	case errors.Is(err, database.ErrConflict):
+		apierror.Abort(c, apierror.Wrap(apierror.CodeConflict, err, "Return has already been decided"))
+		return
+	case err != nil:
+		lookupFailed(c, err, "Return not found")
+		return
+	}
+
+	orderID := strconv.FormatUint(uint64(request.OrderID), 10)
+	payment, err := h.Payments.GetOrderPayment(ctx, orderID)
+	if err != nil {
+		if !retry {
+			h.reopenReturn(c, id)
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			apierror.Abort(c, apierror.Wrap(apierror.CodeConflict, err, "Order has no payment to refund"))
+			return
+		}
+		fail(c, err, "Failed to retrieve payment")
+		return
+	}
+
+	if retry {
+		request, err = h.Returns.CompleteReturn(ctx, request, payment, storedRefund(request, payment), restock)
+		if err != nil {
+			fail(c, err, "Refund issued but the return couldn't be recorded")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Return refunded", "data": request})
+		return
+	}
+
+	order, err := h.Orders.GetOrder(ctx, orderID)
+	if err != nil {
+		h.reopenReturn(c, id)
+		fail(c, err, "Failed to retrieve order")
+		return
+	}
+	amount := refundFor(order, request)
+	if decision.RefundAmount > 0 {
+		amount = decision.RefundAmount
+	}
+	if refundable := payment.CapturedAmount - payment.RefundedAmount; amount > refundable {
+		amount = refundable
+	}
+	if amount <= 0 {
+		h.reopenReturn(c, id)
+		apierror.Abort(c, apierror.New(apierror.CodeConflict, "Nothing left to refund on this order"))
+		return
+	}
+
+	result, err := h.PaymentProvider.Refund(ctx, payment.ProviderRef, amount)
+	if err != nil {
+		logger(c).Error("Error refunding return", "error", err)
+		h.reopenReturn(c, id)
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUpstreamFailed, err, "Return approved but the refund failed"))
+		return
+	}
+	if err := h.Returns.NoteReturnRefund(ctx, id, result.ProviderRef, result.Amount); err != nil {
+		logger(c).Error("Error keeping the refund of a return", "error", err, "return", id, "refund", result.ProviderRef)
+	}
+
+	request, err = h.Returns.CompleteReturn(ctx, request, payment, transactionFor(models.TransactionRefund, result), restock)
+	if err != nil {
+		fail(c, err, "Refund issued but the return couldn't be recorded")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Return refunded", "data": request})
+}
+
+// reopenReturn puts a return claimed by ApproveReturn back to requested when
+// no refund was issued for it
+func (h *Handler) reopenReturn(c *gin.Context, id string) {
+	if err := h.Returns.ReopenReturn(c.Request.Context(), id); err != nil {
+		logger(c).Error("Error reopening return", "error", err, "return", id)
+	}
+}
+
+// storedRefund returns the refund transaction for the refund issued for a
+// return before recording it failed
+func storedRefund(request models.ReturnRequest, payment models.Payment) models.Transaction {
+	status := models.PaymentStatusCaptured
+	if payment.RefundedAmount+request.RefundAmount >= payment.CapturedAmount {
+		status = models.PaymentStatusRefunded
+	}
+	return models.Transaction{
+		Type:        models.TransactionRefund,
+		Amount:      request.RefundAmount,
+		Status:      status,
+		ProviderRef: request.RefundRef,
+	}
+}
+
+func (h *Handler) RejectReturn(c *gin.Context) {
+	id := c.Param("id")
+	var decision models.ReturnDecision
+	if !bindJSON(c, &decision) {
+		return
+	}
+	request, err := h.Returns.DecideReturn(c.Request.Context(), id, models.ReturnStatusRejected, decision.Note)
+	if errors.Is(err, database.ErrConflict) {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeConflict, err, "Return has already been decided"))
+		return
+	} else if err != nil {
+		lookupFailed(c, err, "Return not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Return rejected", "data": request})
+}
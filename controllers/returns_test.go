@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/payments"
+)
+
+// failingRefunds is a gateway that's down for refunds
+type failingRefunds struct {
+	*payments.FakeProvider
+}
+
+func (failingRefunds) Refund(ctx context.Context, providerRef string, amount float64) (payments.Result, error) {
+	return payments.Result{}, errors.New("gateway unavailable")
+}
+
+// failingCompletions fails to record the first few completed returns
+type failingCompletions struct {
+	database.ReturnStore
+	failures int
+}
+
+func (s *failingCompletions) CompleteReturn(ctx context.Context, request models.ReturnRequest, payment models.Payment, refund models.Transaction, restock bool) (models.ReturnRequest, error) {
+	if s.failures > 0 {
+		s.failures--
+		return request, errors.New("database unavailable")
+	}
+	return s.ReturnStore.CompleteReturn(ctx, request, payment, refund, restock)
+}
+
+// requestReturn has the customer ask to return mugs from the order, returning
+// the return's ID
+func (a *testAPI) requestReturn(orderID string, itemID uint, mugs int) string {
+	a.t.Helper()
+	id, err := strconv.ParseUint(orderID, 10, 0)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	body := map[string]any{"order_id": id, "reason": "Chipped",
+		"items": []map[string]any{{"order_item_id": itemID, "quantity": mugs}}}
+	var request models.ReturnRequest
+	if status := a.call(a.customer, http.MethodPost, "/api/v1/returns", body, &request); status != http.StatusOK {
+		a.t.Fatalf("requesting the return gave %d", status)
+	}
+	return strconv.FormatUint(uint64(request.ID), 10)
+}
+
+// expectRefunded checks the order's payment has had amount refunded, over
+// refunds transactions
+func (a *testAPI) expectRefunded(orderID string, amount float64, refunds int) {
+	a.t.Helper()
+	payment, err := a.store.GetOrderPayment(a.ctx, orderID)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var got int
+	for _, txn := range payment.Transactions {
+		if txn.Type == models.TransactionRefund {
+			got++
+		}
+	}
+	if payment.RefundedAmount != amount || got != refunds {
+		a.t.Errorf("payment has %v refunded over %d refunds, want %v over %d", payment.RefundedAmount, got, amount, refunds)
+	}
+}
+
+func TestApproveReturn(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(3)
+	id := a.requestReturn(orderID, itemID, 2)
+
+	if status := a.call(a.customer, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil); status != http.StatusForbidden {
+		t.Errorf("a customer approving a return got %d, want 403", status)
+	}
+	var request models.ReturnRequest
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{"note": "Sorry"}, &request); status != http.StatusOK {
+		t.Fatalf("approving the return gave %d", status)
+	}
+	if request.Status != models.ReturnStatusRefunded || request.RefundAmount != 20 || request.RefundRef == "" || request.AdminNote != "Sorry" {
+		t.Errorf("approved return is %s with refund %q of %v and note %q", request.Status, request.RefundRef, request.RefundAmount, request.AdminNote)
+	}
+	a.expectRefunded(orderID, 20, 1)
+	if product, err := a.store.GetProduct(a.ctx, a.mugID); err != nil || product.Stock != 9 {
+		t.Errorf("got %d mugs in stock (%v), want the 2 returned back", product.Stock, err)
+	}
+
+	for _, decision := range []string{"approve", "reject"} {
+		if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/"+decision, map[string]any{}, nil); status != http.StatusConflict {
+			t.Errorf("trying to %s a refunded return gave %d, want 409", decision, status)
+		}
+	}
+	a.expectRefunded(orderID, 20, 1)
+}
+
+func TestApproveReturnRefundsOnce(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(3)
+	id := a.requestReturn(orderID, itemID, 2)
+
+	const approvals = 8
+	statuses := make(chan int, approvals)
+	var wg sync.WaitGroup
+	for range approvals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != approvals-1 {
+		t.Errorf("approving at once gave %v, want one 200 and the rest 409", counts)
+	}
+	a.expectRefunded(orderID, 20, 1)
+}
+
+func TestApproveReturnAfterFailedRefund(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(3)
+	id := a.requestReturn(orderID, itemID, 2)
+
+	a.handler.PaymentProvider = failingRefunds{a.provider}
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil); status != http.StatusBadGateway {
+		t.Fatalf("approving with the gateway down gave %d, want 502", status)
+	}
+	if request, err := a.store.GetReturnRequest(a.ctx, id); err != nil || request.Status != models.ReturnStatusRequested {
+		t.Fatalf("return is %s after its refund failed (%v), want it requested again", request.Status, err)
+	}
+
+	a.handler.PaymentProvider = a.provider
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil); status != http.StatusOK {
+		t.Fatalf("approving again gave %d", status)
+	}
+	a.expectRefunded(orderID, 20, 1)
+}
+
+func TestApproveReturnAfterFailedRecording(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(3)
+	id := a.requestReturn(orderID, itemID, 2)
+
+	a.handler.Returns = &failingCompletions{ReturnStore: a.store, failures: 1}
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil); status != http.StatusInternalServerError {
+		t.Fatalf("approving when the refund can't be recorded gave %d, want 500", status)
+	}
+	request, err := a.store.GetReturnRequest(a.ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != models.ReturnStatusApproved || request.RefundRef == "" || request.RefundAmount != 20 {
+		t.Fatalf("return is %s with refund %q of %v, want the issued refund kept", request.Status, request.RefundRef, request.RefundAmount)
+	}
+
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, &request); status != http.StatusOK {
+		t.Fatalf("approving again gave %d", status)
+	}
+	if request.Status != models.ReturnStatusRefunded {
+		t.Errorf("return is %s after approving it again", request.Status)
+	}
+	a.expectRefunded(orderID, 20, 1)
+	// The gateway still has the rest of the payment to refund, so it only
+	// refunded the return once
+	if _, err := a.provider.Refund(a.ctx, "fake_pay_1", 10); err != nil {
+		t.Errorf("refunding the rest of the payment: %v", err)
+	}
+}
+
+func TestRejectReturn(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(3)
+	id := a.requestReturn(orderID, itemID, 2)
+
+	var request models.ReturnRequest
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/reject", map[string]any{"note": "Not chipped"}, &request); status != http.StatusOK {
+		t.Fatalf("rejecting the return gave %d", status)
+	}
+	if request.Status != models.ReturnStatusRejected || request.AdminNote != "Not chipped" {
+		t.Errorf("rejected return is %s with note %q", request.Status, request.AdminNote)
+	}
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, nil); status != http.StatusConflict {
+		t.Errorf("approving a rejected return gave %d, want 409", status)
+	}
+	a.expectRefunded(orderID, 0, 0)
+	if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/404/reject", map[string]any{}, nil); status != http.StatusNotFound {
+		t.Errorf("rejecting a missing return gave %d, want 404", status)
+	}
+}
+
+func TestGetUserReturns(t *testing.T) {
+	a := newTestAPI(t)
+	orderID, itemID := a.deliveredOrder(1)
+	a.requestReturn(orderID, itemID, 1)
+
+	path := "/api/v1/users/" + a.customerID + "/returns"
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"owner", a.customer, http.StatusOK},
+		{"admin", a.admin, http.StatusOK},
+		{"another customer", a.other, http.StatusForbidden},
+		{"nobody", "", http.StatusUnauthorized},
+	} {
+		var requests []models.ReturnRequest
+		if status := a.call(tc.token, http.MethodGet, path, nil, &requests); status != tc.want {
+			t.Errorf("%s got %d, want %d", tc.name, status, tc.want)
+		} else if status == http.StatusOK && len(requests) != 1 {
+			t.Errorf("%s got %d returns, want 1", tc.name, len(requests))
+		}
+	}
+}
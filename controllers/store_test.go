@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// TestStores runs an order from cart to refunded return against the
+// in-memory store and a GORM store on SQLite, which the handlers only see
+// through the store interfaces, so the in-memory one can stand in for the
+// database in the other tests.
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) database.Store{
+		"memory": func(t *testing.T) database.Store { return database.NewMemoryStore() },
+		"sqlite": func(t *testing.T) database.Store {
+			config := database.DefaultConfig()
+			config.DSN = ":memory:"
+			db, err := database.ConnectDatabase(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { database.Close(db) })
+			if _, err := database.MigrateUp(db, 0); err != nil {
+				t.Fatal(err)
+			}
+			return database.NewGormStore(db)
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAPIWith(t, newStore(t))
+			orderID, itemID := a.deliveredOrder(3)
+			if product, err := a.store.GetProduct(a.ctx, a.mugID); err != nil || product.Stock != 7 {
+				t.Fatalf("got %d mugs in stock (%v) after the order, want 7", product.Stock, err)
+			}
+
+			id := a.requestReturn(orderID, itemID, 2)
+			var request models.ReturnRequest
+			if status := a.call(a.admin, http.MethodPost, "/api/v1/returns/"+id+"/approve", map[string]any{}, &request); status != http.StatusOK {
+				t.Fatalf("approving the return gave %d", status)
+			}
+			if request.Status != models.ReturnStatusRefunded {
+				t.Errorf("approved return is %s", request.Status)
+			}
+			a.expectRefunded(orderID, 20, 1)
+			if product, err := a.store.GetProduct(a.ctx, a.mugID); err != nil || product.Stock != 9 {
+				t.Errorf("got %d mugs in stock (%v) after the return, want 9", product.Stock, err)
+			}
+		})
+	}
+}
@@ -1,100 +1,88 @@
 package controllers
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 
+	"github.com/Rohanrevanth/e-store-go/apierror"
 	"github.com/Rohanrevanth/e-store-go/auth"
 	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/metrics"
 	"github.com/Rohanrevanth/e-store-go/models"
 	"github.com/gin-gonic/gin"
 )
 
-func GetAllUsers(c *gin.Context) {
-	users, err := database.GetAllUsers()
+func (h *Handler) GetAllUsers(c *gin.Context) {
+	users, err := h.Users.GetAllUsers(c.Request.Context())
 	if err != nil {
-		log.Println("Error fetching users:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch users"})
+		fail(c, err, "Failed to fetch users")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": users})
 }
 
-func GetUserByID(c *gin.Context) {
-	id := c.Param("id")
-	// ctx := context.Background()
-
-	// Attempt to retrieve the user from Redis
-	// cachedUser, err := database.RedisClient.Get(ctx, id).Result()
-	// if err == nil {
-	// 	// Cache hit
-	// 	var user models.User
-	// 	if jsonErr := json.Unmarshal([]byte(cachedUser), &user); jsonErr == nil {
-	// 		c.JSON(http.StatusOK, gin.H{"status": "success", "data": user})
-	// 		return
-	// 	}
-	// }
-
-	// Cache miss: retrieve from database
-	user, err := database.GetUserByID(id)
+func (h *Handler) GetUserByID(c *gin.Context) {
+	user, err := h.Users.GetUserByID(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User not found"})
+		lookupFailed(c, err, "User not found")
 		return
 	}
-
-	// Cache the user in Redis
-	// userJSON, _ := json.Marshal(user)
-	// if err := database.RedisClient.Set(ctx, id, userJSON, 10*time.Minute).Err(); err != nil {
-	// 	log.Println("Failed to cache user:", err)
-	// }
-
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": user})
 }
 
-func DeleteUser(c *gin.Context) {
+func (h *Handler) DeleteUser(c *gin.Context) {
 	var user models.User
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind user"})
+	if !bindJSON(c, &user) {
 		return
 	}
-	err := database.DeleteUser(user)
+	err := h.Users.DeleteUser(c.Request.Context(), user)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		fail(c, err, "Failed to delete user")
 		return
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User deleted"})
 }
 
-func RegisterUsers(c *gin.Context) {
+// DeleteUserByID deletes the user in the path
+func (h *Handler) DeleteUserByID(c *gin.Context) {
+	user, err := h.Users.GetUserByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		lookupFailed(c, err, "User not found")
+		return
+	}
+	if err := h.Users.DeleteUser(c.Request.Context(), user); err != nil {
+		fail(c, err, "Failed to delete user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "User deleted"})
+}
+
+func (h *Handler) RegisterUsers(c *gin.Context) {
 	var newUsers []models.User
-	if err := c.BindJSON(&newUsers); err != nil {
-		log.Println("Error binding users:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "message": "Invalid request payload"})
+	if !bindJSON(c, &newUsers) {
 		return
 	}
 
 	var registeredUsers []models.User
 	for _, user := range newUsers {
 		// Validate user fields here (e.g., Email and Password)
+		user.Type = models.UserTypeCustomer // Admins are made by seeds and imports
 
 		if err := user.HashPassword(user.Password); err != nil {
-			log.Println("Error hashing password:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to hash password"})
+			fail(c, err, "Failed to hash password")
 			return
 		}
 
-		err := database.AddUser(user)
+		err := h.Users.AddUser(c.Request.Context(), user)
 		if err != nil {
-			log.Println("Error registering user:", err)
+			logger(c).Error("Error registering user", "error", err)
 			continue // Skip this user and proceed with the others
 		}
 
-		savedUser, err := database.GetUserByEmail(user.Email)
+		savedUser, err := h.Users.GetUserByEmail(c.Request.Context(), user.Email)
 		if err != nil {
-			log.Println("Error fetching saved user:", err)
+			logger(c).Error("Error fetching saved user", "error", err)
 			continue
 		}
 		registeredUsers = append(registeredUsers, savedUser)
@@ -103,260 +91,393 @@ func RegisterUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Users processed", "data": registeredUsers})
 }
 
-// Login authenticates a user and returns a JWT token
-func Login(c *gin.Context) {
+// Login authenticates a user and returns a JWT token. An unknown email and a
+// wrong password get the same response, so accounts can't be discovered.
+func (h *Handler) Login(c *gin.Context) {
 	var input models.User
-	if err := c.ShouldBindJSON(&input); err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
-	var user models.User
-	user, err := database.GetUserByEmail(input.Email)
-	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	invalid := apierror.New(apierror.CodeInvalidCredentials, "Invalid email or password")
+	user, err := h.Users.GetUserByEmail(c.Request.Context(), input.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		logger(c).Info("Login for an unknown user", "email", input.Email)
+		h.Metrics.LoginFailed(metrics.LoginUnknownUser)
+		apierror.Abort(c, invalid)
+		return
+	} else if err != nil {
+		fail(c, err, "Failed to log in")
+		return
 	}
 
-	input_, _ := json.Marshal(input)
-	fmt.Println(string(input_))
-	user_, _ := json.Marshal(user)
-	fmt.Println(string(user_))
 	// Check if the password is correct
 	if err := user.CheckPassword(input.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		h.Metrics.LoginFailed(metrics.LoginWrongPassword)
+		apierror.Abort(c, invalid)
 		return
 	}
 
 	// Generate JWT token
-	token, err := auth.GenerateJWT(user.Username)
+	token, err := auth.GenerateJWT(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		fail(c, err, "Failed to generate token")
 		return
 	}
 
+	// Bring along anything the visitor put in their cart before logging in
+	if cartID, ok := auth.CartIDFromRequest(c); ok {
+		userID := strconv.FormatUint(uint64(user.ID), 10)
+		if err := h.Carts.MergeCarts(c.Request.Context(), models.GuestOwner(cartID), userID, h.CartMergeRule); err != nil {
+			logger(c).Error("Error merging guest cart", "error", err)
+		} else {
+			h.CartTokens.ClearCookie(c)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
 }
 
-func GetUserCart(c *gin.Context) {
-	id := c.Param("id")
-	cart, err := database.GetUserCart(id)
-	if err != nil {
-		if strings.Contains(err.Error(), "no cart found") {
-			// c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Cart not found for the user"})
-			c.JSON(http.StatusOK, gin.H{"status": "success", "data": "{}"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to retrieve cart"})
-		}
+func (h *Handler) GetUserCart(c *gin.Context) {
+	h.getCart(c, c.Param("id"))
+}
+
+func (h *Handler) getCart(c *gin.Context, id string) {
+	cart, err := h.Carts.GetUserCart(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		cart = models.Cart{UserID: id} // Nothing added yet
+	} else if err != nil {
+		fail(c, err, "Failed to retrieve cart")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "data": cart})
+	couponCode := c.Query("coupon")
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": cart.Summary(couponCode, h.Coupons.CouponDiscountRate(c.Request.Context(), couponCode))})
 }
 
-func AddProductToCart(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) AddProductToCart(c *gin.Context) {
+	h.addToCart(c, c.Param("id"))
+}
+
+func (h *Handler) addToCart(c *gin.Context, id string) {
 	var item models.CartItem
-	if err := c.BindJSON(&item); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind cartitem"})
+	if !bindJSON(c, &item) {
 		return
 	}
-	err := database.AddItemToCart(id, item.ProductID, item.Quantity)
+	err := h.Carts.AddItemToCart(c.Request.Context(), id, item.ProductID, item.Quantity)
 	if err != nil {
-		log.Println("Error adding to cart:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to add to cart"})
+		fail(c, err, "Failed to add to cart")
 		return
 	}
+	h.Metrics.CartAdd(customer(id))
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Products added"})
 }
 
-func RemoveItemFromCart(c *gin.Context) {
-	id := c.Param("id")
+// UpdateCartItem sets the quantity of a product in the cart; zero removes it
+func (h *Handler) UpdateCartItem(c *gin.Context) {
+	h.updateCartItem(c, c.Param("id"))
+}
+
+func (h *Handler) updateCartItem(c *gin.Context, id string) {
 	var item models.CartItem
-	if err := c.BindJSON(&item); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind cartitem"})
+	if !bindJSON(c, &item) {
 		return
 	}
-	err := database.RemoveItemFromCart(id, item.ProductID, item.Quantity)
+	if c.Param("product_id") != "" { // The product is in the path of the v1 routes
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		item.ProductID = productID
+	}
+	err := h.Carts.SetCartItemQuantity(c.Request.Context(), id, item.ProductID, item.Quantity)
 	if err != nil {
-		log.Println("Error removing from cart:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to remove from cart"})
+		fail(c, err, "Failed to update cart")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Cart updated"})
+}
+
+func (h *Handler) RemoveItemFromCart(c *gin.Context) {
+	h.removeFromCart(c, c.Param("id"))
+}
+
+func (h *Handler) removeFromCart(c *gin.Context, id string) {
+	var item models.CartItem
+	if !bindJSON(c, &item) {
+		return
+	}
+	err := h.Carts.RemoveItemFromCart(c.Request.Context(), id, item.ProductID, item.Quantity)
+	if err != nil {
+		fail(c, err, "Failed to remove from cart")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Product(s) removed"})
 }
 
-func PlaceOrder(c *gin.Context) {
+// DeleteCartItem removes the product in the path from the cart: the quantity
+// query parameter if given, otherwise all of it
+func (h *Handler) DeleteCartItem(c *gin.Context) {
+	h.deleteCartItem(c, c.Param("id"))
+}
+
+func (h *Handler) deleteCartItem(c *gin.Context, id string) {
+	productID, ok := productIDParam(c)
+	if !ok {
+		return
+	}
+	var err error
+	if quantity := c.Query("quantity"); quantity != "" {
+		n, convErr := strconv.Atoi(quantity)
+		if convErr != nil {
+			apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "quantity", Reason: "quantity must be a whole number"}))
+			return
+		}
+		err = h.Carts.RemoveItemFromCart(c.Request.Context(), id, productID, n)
+	} else {
+		err = h.Carts.SetCartItemQuantity(c.Request.Context(), id, productID, 0)
+	}
+	if err != nil {
+		fail(c, err, "Failed to remove from cart")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Product(s) removed"})
+}
+
+// productIDParam returns the product_id path parameter, responding with a
+// problem if it isn't an ID
+func productIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("product_id"), 10, 0)
+	if err != nil || id == 0 {
+		apierror.Abort(c, apierror.Invalid(apierror.FieldError{Field: "product_id", Reason: "product_id must be a product ID"}))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) PlaceOrder(c *gin.Context) {
 	// id := c.Param("id")
 	var item models.Order
-	if err := c.BindJSON(&item); err != nil {
-		log.Println("Error binding JSON:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind order json"})
+	if !bindJSON(c, &item) {
 		return
 	}
-	err := database.PlaceOrder(item.UserID, item.PaymentMethod, item.ShippingDetails, item.CouponCode)
+	h.placeOrder(c, item)
+}
+
+func (h *Handler) placeOrder(c *gin.Context, item models.Order) {
+	order, err := h.Orders.PlaceOrder(c.Request.Context(), item)
+	if err != nil {
+		fail(c, err, "Failed to place order")
+		return
+	}
+
+	payment, err := h.authorizeOrder(c.Request.Context(), order)
 	if err != nil {
-		log.Println("Error placing order:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to place order"})
+		fail(c, err, "Failed to process payment")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Order placed"})
+	switch payment.Status {
+	case models.PaymentStatusDeclined, models.PaymentStatusFailed:
+		apierror.Abort(c, apierror.New(apierror.CodePaymentDeclined, "Payment declined").With("order_id", order.ID).With("payment", payment))
+	case models.PaymentStatusPending:
+		c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Payment requires customer action", "data": gin.H{"order_id": order.ID, "payment": payment}})
+	default:
+		h.countOrder(order)
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Order placed", "data": gin.H{"order_id": order.ID, "payment": payment}})
+	}
+}
+
+// countOrder counts an order whose payment has been authorized, as placed and
+// towards the revenue. Orders whose payment is declined or still waiting on
+// the customer aren't counted until it goes through.
+func (h *Handler) countOrder(order models.Order) {
+	h.Metrics.OrderPlaced(customer(order.UserID), order.Discount > 0)
+	h.Metrics.PaymentAuthorized(customer(order.UserID), order.TotalPrice)
 }
 
-func GetUserOders(c *gin.Context) {
+func (h *Handler) GetUserOders(c *gin.Context) {
 	id := c.Param("id")
-	cart, err := database.GetUserOrders(id)
+	cart, err := h.Orders.GetUserOrders(c.Request.Context(), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "no orders found") {
-			// c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Cart not found for the user"})
-			c.JSON(http.StatusOK, gin.H{"status": "success", "data": "{}"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to retrieve orders"})
-		}
+		fail(c, err, "Failed to retrieve orders")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": cart})
 }
 
-func GetAllOders(c *gin.Context) {
-	orders, err := database.GetAllOrders()
+func (h *Handler) GetAllOders(c *gin.Context) {
+	orders, err := h.Orders.GetAllOrders(c.Request.Context())
 	if err != nil {
-		if strings.Contains(err.Error(), "no orders found") {
-			// c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Cart not found for the user"})
-			c.JSON(http.StatusOK, gin.H{"status": "success", "data": "{}"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to retrieve orders"})
-		}
+		fail(c, err, "Failed to retrieve orders")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": orders})
 }
 
-func SaveAddress(c *gin.Context) {
+func (h *Handler) GetAbandonedCarts(c *gin.Context) {
+	events, err := h.Carts.GetCartAbandonments(c.Request.Context())
+	if err != nil {
+		fail(c, err, "Failed to retrieve abandoned carts")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": events})
+}
+
+func (h *Handler) SaveAddress(c *gin.Context) {
 	id := c.Param("id")
-	user, err := database.GetUserByID(id)
+	user, err := h.Users.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User not found"})
+		lookupFailed(c, err, "User not found")
 		return
 	}
 
 	var addressString models.AddressStringObj
-	if err := c.BindJSON(&addressString); err != nil {
-		log.Println("Error binding JSON:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind addressString json"})
+	if !bindJSON(c, &addressString) {
 		return
 	}
 
 	user.SavedAddress = addressString.Address
 
-	err = database.SaveUser(user)
+	err = h.Users.SaveUser(c.Request.Context(), user)
 	if err != nil {
-		log.Println("Error updating user:", err)
+		logger(c).Error("Error updating user", "error", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": user})
 }
 
-func AddCoupon(c *gin.Context) {
+func (h *Handler) AddCoupon(c *gin.Context) {
 	var coupon models.CouponObject
-	if err := c.BindJSON(&coupon); err != nil {
-		log.Println("Error binding JSON:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind coupon json"})
+	if !bindJSON(c, &coupon) {
 		return
 	}
-	err := database.AddCoupon(coupon)
+	err := h.Coupons.AddCoupon(c.Request.Context(), coupon)
 	if err != nil {
-		log.Println("Error adding coupon:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to add coupon"})
+		fail(c, err, "Failed to add coupon")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Coupon added"})
 }
 
-func SaveCoupon(c *gin.Context) {
+func (h *Handler) SaveCoupon(c *gin.Context) {
 	var coupon models.CouponObject
-	if err := c.BindJSON(&coupon); err != nil {
-		log.Println("Error binding JSON:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind coupon json"})
+	if !bindJSON(c, &coupon) {
 		return
 	}
-	err := database.SaveCoupon(coupon)
+	err := h.Coupons.SaveCoupon(c.Request.Context(), coupon)
 	if err != nil {
-		log.Println("Error saving coupon:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to save coupon"})
+		fail(c, err, "Failed to save coupon")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Coupon saved"})
 }
 
-func GetCoupons(c *gin.Context) {
-	coupons, err := database.GetAllCoupons()
+// UpdateCoupon replaces the coupon whose code is in the path. Whether it has
+// been redeemed is kept.
+func (h *Handler) UpdateCoupon(c *gin.Context) {
+	existing, err := h.Coupons.GetCoupon(c.Request.Context(), c.Param("code"))
 	if err != nil {
-		log.Println("Error fetching coupons:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Failed to fetch coupons"})
+		lookupFailed(c, err, "Coupon not found")
+		return
+	}
+	var coupon models.CouponObject
+	if !bindJSON(c, &coupon) {
+		return
+	}
+	coupon.Model = existing.Model
+	coupon.Code = existing.Code
+	coupon.RedeemedAt = existing.RedeemedAt
+	if err := h.Coupons.SaveCoupon(c.Request.Context(), coupon); err != nil {
+		fail(c, err, "Failed to save coupon")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Coupon saved", "data": coupon})
+}
+
+func (h *Handler) GetCoupons(c *gin.Context) {
+	coupons, err := h.Coupons.GetAllCoupons(c.Request.Context())
+	if err != nil {
+		fail(c, err, "Failed to fetch coupons")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "success", "data": coupons})
 }
 
-func DeleteCoupon(c *gin.Context) {
+func (h *Handler) DeleteCoupon(c *gin.Context) {
 	var coupon models.CouponObject
-	if err := c.BindJSON(&coupon); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind coupon"})
+	if !bindJSON(c, &coupon) {
 		return
 	}
-	err := database.DeleteCoupon(coupon)
+	err := h.Coupons.DeleteCoupon(c.Request.Context(), coupon)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete coupon"})
+		fail(c, err, "Failed to delete coupon")
 		return
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "coupon deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Coupon deleted"})
 }
 
-func ApplyCoupon(c *gin.Context) {
-	id := c.Param("id")
-	user, err := database.GetUserByID(id)
+// DeleteCouponByCode deletes the coupon whose code is in the path
+func (h *Handler) DeleteCouponByCode(c *gin.Context) {
+	coupon, err := h.Coupons.GetCoupon(c.Request.Context(), c.Param("code"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "User not found"})
+		lookupFailed(c, err, "Coupon not found")
+		return
+	}
+	if err := h.Coupons.DeleteCoupon(c.Request.Context(), coupon); err != nil {
+		fail(c, err, "Failed to delete coupon")
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Coupon deleted"})
+}
 
+func (h *Handler) ApplyCoupon(c *gin.Context) {
 	var couponCodeObj models.CouponCodeObj
-	if err := c.BindJSON(&couponCodeObj); err != nil {
-		log.Println("Error binding JSON:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to bind couponCodeObj json"})
+	if !bindJSON(c, &couponCodeObj) {
 		return
 	}
+	h.applyCoupon(c, c.Param("id"), couponCodeObj.CouponCode)
+}
 
-	fmt.Println(couponCodeObj)
+// GetUserCoupon returns the coupon whose code is in the path if the user can
+// use it on their next order, and no data if they can't
+func (h *Handler) GetUserCoupon(c *gin.Context) {
+	h.applyCoupon(c, c.Param("id"), c.Param("code"))
+}
 
-	coupon, err := database.GetCoupon(couponCodeObj.CouponCode)
+func (h *Handler) applyCoupon(c *gin.Context, id string, code string) {
+	user, err := h.Users.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "Coupon not found"})
+		lookupFailed(c, err, "User not found")
 		return
 	}
 
-	fmt.Println(coupon)
+	coupon, err := h.Coupons.GetCoupon(c.Request.Context(), code)
+	if err != nil {
+		lookupFailed(c, err, "Coupon not found")
+		return
+	}
 
 	isCouponApplicable := checkForCode(user.OrdersCount, coupon.OrderFrequency)
+	logger(c).Debug("Checked coupon", "user", user, "coupon", coupon.Code, "applicable", isCouponApplicable)
 
 	if isCouponApplicable {
 		c.JSON(http.StatusOK, gin.H{"status": "success", "data": coupon})
 	} else {
-		c.JSON(http.StatusOK, gin.H{"status": "success", "data": ""})
+		c.JSON(http.StatusOK, gin.H{"status": "success", "data": nil})
 	}
 }
 
 func checkForCode(orderCount, frequency int64) bool {
-	fmt.Println(orderCount, frequency)
 	if frequency <= 0 {
 		return false
 	}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+// minSecretLength is the shortest secret an admin may choose for a
+// subscription
+const minSecretLength = 16
+
+// webhookRequest is a subscription as admins create and update it
+type webhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Description string   `json:"description"`
+	Disabled    bool     `json:"disabled"`
+	// Secret signs the payloads. One is made up for a new subscription that
+	// doesn't give one; given on update, it replaces the old one.
+	Secret string `json:"secret"`
+}
+
+// validate reports the fields of the request that aren't allowed
+func (r webhookRequest) validate() *apierror.Error {
+	var fields []apierror.FieldError
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fields = append(fields, apierror.FieldError{Field: "url", Reason: "url must be an http:// or https:// URL"})
+	}
+	if len(r.Events) == 0 {
+		fields = append(fields, apierror.FieldError{Field: "events", Reason: "events must list at least one event"})
+	}
+	for _, event := range r.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			fields = append(fields, apierror.FieldError{Field: "events", Reason: event + " isn't an event; see GET /api/v1/webhooks/events"})
+		}
+	}
+	if r.Secret != "" && len(r.Secret) < minSecretLength {
+		fields = append(fields, apierror.FieldError{Field: "secret", Reason: "secret must be at least 16 characters"})
+	}
+	if len(fields) > 0 {
+		return apierror.Invalid(fields...)
+	}
+	return nil
+}
+
+// apply copies the request onto sub
+func (r webhookRequest) apply(sub *models.WebhookSubscription) {
+	sub.URL = r.URL
+	sub.Events = nil
+	for _, event := range r.Events {
+		if !slices.Contains(sub.Events, event) {
+			sub.Events = append(sub.Events, event)
+		}
+	}
+	sub.Description = r.Description
+	sub.Disabled = r.Disabled
+	if r.Secret != "" {
+		sub.Secret = r.Secret
+	}
+}
+
+// GetWebhookEvents lists the events a subscription can receive
+func (h *Handler) GetWebhookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": models.WebhookEvents})
+}
+
+// GetWebhooks lists the webhook subscriptions, without their secrets
+func (h *Handler) GetWebhooks(c *gin.Context) {
+	subs, err := h.Webhooks.GetWebhookSubscriptions(c.Request.Context())
+	if err != nil {
+		fail(c, err, "Failed to fetch webhooks")
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": subs})
+}
+
+// AddWebhook subscribes a URL to events. The response is the only time the
+// subscription's secret is shown.
+func (h *Handler) AddWebhook(c *gin.Context) {
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	var sub models.WebhookSubscription
+	req.apply(&sub)
+	if sub.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			fail(c, err, "Failed to add webhook")
+			return
+		}
+		sub.Secret = secret
+	}
+
+	sub, err := h.Webhooks.AddWebhookSubscription(c.Request.Context(), sub)
+	if err != nil {
+		fail(c, err, "Failed to add webhook")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Webhook added", "data": sub})
+}
+
+// GetWebhook returns the subscription whose ID is in the path, without its
+// secret
+func (h *Handler) GetWebhook(c *gin.Context) {
+	sub, err := h.Webhooks.GetWebhookSubscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		lookupFailed(c, err, "Webhook not found")
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": sub})
+}
+
+// UpdateWebhook replaces the subscription whose ID is in the path, keeping
+// its secret unless a new one is given
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	sub, err := h.Webhooks.GetWebhookSubscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		lookupFailed(c, err, "Webhook not found")
+		return
+	}
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		apierror.Abort(c, err)
+		return
+	}
+	req.apply(&sub)
+	if err := h.Webhooks.SaveWebhookSubscription(c.Request.Context(), sub); err != nil {
+		fail(c, err, "Failed to save webhook")
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Webhook saved", "data": sub})
+}
+
+// DeleteWebhook deletes the subscription whose ID is in the path. Its
+// delivery log is kept.
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	sub, err := h.Webhooks.GetWebhookSubscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		lookupFailed(c, err, "Webhook not found")
+		return
+	}
+	if err := h.Webhooks.DeleteWebhookSubscription(c.Request.Context(), sub); err != nil {
+		fail(c, err, "Failed to delete webhook")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries lists the deliveries to the subscription whose ID is
+// in the path, newest first
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	deliveries, err := h.Webhooks.GetWebhookDeliveries(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		fail(c, err, "Failed to fetch webhook deliveries")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": deliveries})
+}
+
+// GetWebhookDelivery returns a delivery with a log of its attempts
+func (h *Handler) GetWebhookDelivery(c *gin.Context) {
+	delivery, ok := h.webhookDelivery(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": delivery})
+}
+
+// RetryWebhookDelivery queues a dead delivery again, with a fresh set of
+// attempts
+func (h *Handler) RetryWebhookDelivery(c *gin.Context) {
+	delivery, ok := h.webhookDelivery(c)
+	if !ok {
+		return
+	}
+	if delivery.Status != models.WebhookDeliveryDead {
+		apierror.Abort(c, apierror.New(apierror.CodeConflict, "Only dead deliveries can be retried; this one is "+delivery.Status))
+		return
+	}
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := h.Webhooks.SaveWebhookDelivery(c.Request.Context(), delivery); err != nil {
+		fail(c, err, "Failed to retry webhook delivery")
+		return
+	}
+	delivery.AttemptLog = nil
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Webhook delivery queued", "data": delivery})
+}
+
+// webhookDelivery fetches the delivery whose ID is in the path, responding
+// with a 404 if it isn't one of the subscription's
+func (h *Handler) webhookDelivery(c *gin.Context) (models.WebhookDelivery, bool) {
+	delivery, err := h.Webhooks.GetWebhookDelivery(c.Request.Context(), c.Param("delivery_id"))
+	if err != nil {
+		lookupFailed(c, err, "Webhook delivery not found")
+		return delivery, false
+	}
+	if strconv.FormatUint(uint64(delivery.SubscriptionID), 10) != c.Param("id") {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Webhook delivery not found"))
+		return delivery, false
+	}
+	return delivery, true
+}
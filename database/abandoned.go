@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// FindAbandonedCarts returns carts with items that haven't been touched for
+// idleFor and haven't already been recorded as abandoned since they were last
+// touched.
+func (s *GormStore) FindAbandonedCarts(ctx context.Context, idleFor time.Duration) ([]models.Cart, error) {
+	var carts []models.Cart
+	err := s.db.WithContext(ctx).Preload("Items.Product").
+		Where("carts.updated_at < ?", time.Now().Add(-idleFor)).
+		Where("EXISTS (SELECT 1 FROM cart_items WHERE cart_items.cart_id = carts.id AND cart_items.deleted_at IS NULL)").
+		Where("NOT EXISTS (SELECT 1 FROM cart_abandonments WHERE cart_abandonments.cart_id = carts.id AND cart_abandonments.last_activity >= carts.updated_at)").
+		Find(&carts).Error
+	if err != nil {
+		return nil, fmt.Errorf("FindAbandonedCarts: %v", err)
+	}
+	return carts, nil
+}
+
+func (s *GormStore) AddCartAbandonment(ctx context.Context, event models.CartAbandonment) (models.CartAbandonment, error) {
+	if err := s.db.WithContext(ctx).Create(&event).Error; err != nil {
+		return event, fmt.Errorf("AddCartAbandonment: %v", err)
+	}
+	return event, nil
+}
+
+func (s *GormStore) SaveCartAbandonment(ctx context.Context, event models.CartAbandonment) error {
+	if err := s.db.WithContext(ctx).Save(&event).Error; err != nil {
+		return fmt.Errorf("SaveCartAbandonment: %v", err)
+	}
+	return nil
+}
+
+func (s *GormStore) GetCartAbandonments(ctx context.Context) ([]models.CartAbandonment, error) {
+	var events []models.CartAbandonment
+	if err := s.db.WithContext(ctx).Order("id desc").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("GetCartAbandonments: %v", err)
+	}
+	return events, nil
+}
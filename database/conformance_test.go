@@ -0,0 +1,958 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// TestConformance runs the behaviour every Store implementation has to share
+// against the in-memory store and a GORM store on each database: SQLite in
+// memory, and Postgres and MySQL when ESTORE_TEST_POSTGRES_DSN and
+// ESTORE_TEST_MYSQL_DSN name empty databases to run against. The checks rely
+// on the IDs and totals of the records they create, so each store starts
+// empty.
+func TestConformance(t *testing.T) {
+	stores := []struct {
+		name string
+		dsn  string // Empty for the in-memory store
+		env  string // Where the DSN comes from, if it isn't fixed
+	}{
+		{name: "memory"},
+		{name: "sqlite", dsn: ":memory:"},
+		{name: "postgres", env: "ESTORE_TEST_POSTGRES_DSN"},
+		{name: "mysql", env: "ESTORE_TEST_MYSQL_DSN"},
+	}
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			var store Store = NewMemoryStore()
+			if tc.name != "memory" {
+				dbConfig := DefaultConfig()
+				dbConfig.DSN = tc.dsn
+				if tc.env != "" {
+					dbConfig.DSN = os.Getenv(tc.env)
+				}
+				if dbConfig.DSN == "" {
+					t.Skipf("%s isn't set", tc.env)
+				}
+				db, err := ConnectDatabase(dbConfig)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer Close(db)
+				if _, err := MigrateUp(db, 0); err != nil {
+					t.Fatal(err)
+				}
+				store = NewGormStore(db)
+			}
+			checkConformance(t, context.Background(), store)
+		})
+	}
+}
+
+// checkConformance runs the checks against store in order, each building on
+// the records the ones before it created, so it stops at the first to fail
+func checkConformance(t *testing.T, ctx context.Context, store Store) {
+	checks := []struct {
+		name string
+		run  func(context.Context, Store, *conformanceData) error
+	}{
+		{"users", checkUsers},
+		{"products", checkProducts},
+		{"carts", checkCarts},
+		{"orders", checkOrders},
+		{"outbox", checkOutbox},
+		{"payments", checkPayments},
+		{"returns", checkReturns},
+		{"coupons", checkCoupons},
+		{"declined payments", checkDeclinedPayments},
+		{"abandoned carts", checkAbandonedCarts},
+		{"webhooks", checkWebhooks},
+		{"upserts", checkUpserts},
+	}
+	data := &conformanceData{}
+	for _, check := range checks {
+		if err := check.run(ctx, store, data); err != nil {
+			t.Fatalf("%s: %v", check.name, err)
+		}
+	}
+}
+
+// conformanceData carries the records created by one check into the next
+type conformanceData struct {
+	userID  string
+	mug     models.Product
+	lamp    models.Product
+	orderID string
+}
+
+func checkUsers(ctx context.Context, store Store, data *conformanceData) error {
+	if err := store.AddUser(ctx, models.User{Username: "conformance", Email: "conformance@example.com"}); err != nil {
+		return err
+	}
+	if err := store.AddUser(ctx, models.User{Username: "conformance", Email: "conformance@example.com"}); !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("adding a duplicate user gave %v, not ErrConflict", err)
+	}
+	user, err := store.GetUserByEmail(ctx, "conformance@example.com")
+	if err != nil {
+		return err
+	}
+	data.userID = strconv.FormatUint(uint64(user.ID), 10)
+
+	user.SavedAddress = models.Addresses{"1 Main St"}
+	if err := store.SaveUser(ctx, user); err != nil {
+		return err
+	}
+	user, err = store.GetUserByID(ctx, data.userID)
+	if err != nil {
+		return err
+	}
+	if len(user.SavedAddress) != 1 || user.SavedAddress[0] != "1 Main St" {
+		return fmt.Errorf("saved address is %v", user.SavedAddress)
+	}
+	if _, err := store.GetUserByEmail(ctx, "missing@example.com"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("finding a user that doesn't exist gave %v, not ErrNotFound", err)
+	}
+	if users, err := store.GetUsersByIDs(ctx, []string{data.userID, "999999"}); err != nil || len(users) != 1 || users[0].ID != user.ID {
+		return fmt.Errorf("users by ID are %v (%v)", users, err)
+	}
+	return nil
+}
+
+func checkProducts(ctx context.Context, store Store, data *conformanceData) error {
+	if err := store.AddCategory(ctx, models.Category{Name: "home"}); err != nil {
+		return err
+	}
+	if err := store.AddProduct(ctx, models.Product{Name: "Mug", Category: "home", Price: 10, Stock: 5, Isbestseller: true}); err != nil {
+		return err
+	}
+	if err := store.AddProduct(ctx, models.Product{Name: "Lamp", Category: "lighting", Price: 25, Stock: 1}); err != nil {
+		return err
+	}
+
+	products, err := store.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	if len(products) != 2 {
+		return fmt.Errorf("got %d products, want 2", len(products))
+	}
+	for _, product := range products {
+		switch product.Name {
+		case "Mug":
+			data.mug = product
+		case "Lamp":
+			data.lamp = product
+		}
+	}
+
+	if !data.mug.StockTracked || !data.lamp.StockTracked {
+		return fmt.Errorf("products added with stock aren't tracked: %v, %v", data.mug.StockTracked, data.lamp.StockTracked)
+	}
+
+	if products, err := store.GetProducts(ctx, "home"); err != nil || len(products) != 1 || products[0].Name != "Mug" {
+		return fmt.Errorf("products in home are %v (%v)", products, err)
+	}
+	if products, err := store.GetBestSellers(ctx); err != nil || len(products) != 1 || products[0].Name != "Mug" {
+		return fmt.Errorf("best sellers are %v (%v)", products, err)
+	}
+	if categories, err := store.GetAllCategories(ctx); err != nil || len(categories) != 1 {
+		return fmt.Errorf("categories are %v (%v)", categories, err)
+	}
+
+	if product, err := store.AdjustStock(ctx, data.mug.ID, 3); err != nil || product.Stock != 8 {
+		return fmt.Errorf("adding 3 mugs to stock gave %d (%v), want 8", product.Stock, err)
+	}
+	if _, err := store.AdjustStock(ctx, data.mug.ID, -9); !errors.Is(err, ErrInsufficientStock) {
+		return fmt.Errorf("taking 9 of 8 mugs out of stock gave %v, not ErrInsufficientStock", err)
+	}
+	if product, err := store.AdjustStock(ctx, data.mug.ID, -3); err != nil || product.Stock != 5 {
+		return fmt.Errorf("taking 3 mugs out of stock gave %d (%v), want 5", product.Stock, err)
+	}
+	if _, err := store.AdjustStock(ctx, 999999, 1); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("adjusting the stock of a missing product gave %v, not ErrNotFound", err)
+	}
+	return nil
+}
+
+func checkCarts(ctx context.Context, store Store, data *conformanceData) error {
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 0); !errors.Is(err, ErrInvalidCartItem) {
+		return fmt.Errorf("adding zero items gave %v", err)
+	}
+	if err := store.AddItemToCart(ctx, data.userID, 9999, 1); !errors.Is(err, ErrInvalidCartItem) {
+		return fmt.Errorf("adding a missing product gave %v", err)
+	}
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, models.MaxCartItemQuantity+1); !errors.Is(err, ErrInvalidCartItem) {
+		return fmt.Errorf("adding too many items gave %v", err)
+	}
+	if err := store.RemoveItemFromCart(ctx, "nobody", data.mug.ID, 1); !errors.Is(err, ErrInvalidCartItem) {
+		return fmt.Errorf("removing from a missing cart gave %v", err)
+	}
+
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 1); err != nil {
+		return err
+	}
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 2); err != nil {
+		return err
+	}
+	if err := store.SetCartItemQuantity(ctx, data.userID, data.lamp.ID, 4); err != nil {
+		return err
+	}
+	if err := store.RemoveItemFromCart(ctx, data.userID, data.lamp.ID, 3); err != nil {
+		return err
+	}
+	if err := expectCart(ctx, store, data.userID, map[uint]int{data.mug.ID: 3, data.lamp.ID: 1}); err != nil {
+		return err
+	}
+	if err := store.SetCartItemQuantity(ctx, data.userID, data.lamp.ID, 0); err != nil {
+		return err
+	}
+	if err := expectCart(ctx, store, data.userID, map[uint]int{data.mug.ID: 3}); err != nil {
+		return err
+	}
+
+	guest := models.GuestOwner("conformance")
+	if err := store.AddItemToCart(ctx, guest, data.mug.ID, 2); err != nil {
+		return err
+	}
+	if err := store.AddItemToCart(ctx, guest, data.lamp.ID, 1); err != nil {
+		return err
+	}
+	if err := store.MergeCarts(ctx, guest, data.userID, models.CartMergeMax); err != nil {
+		return err
+	}
+	if err := expectCart(ctx, store, data.userID, map[uint]int{data.mug.ID: 3, data.lamp.ID: 1}); err != nil {
+		return err
+	}
+	if _, err := store.GetUserCart(ctx, guest); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("fetching the guest cart after merging gave %v, not ErrNotFound", err)
+	}
+	return nil
+}
+
+// expectCart checks the quantity of every line in the owner's cart
+func expectCart(ctx context.Context, store Store, owner string, want map[uint]int) error {
+	cart, err := store.GetUserCart(ctx, owner)
+	if err != nil {
+		return err
+	}
+	got := make(map[uint]int)
+	for _, item := range cart.Items {
+		if item.Product.ID != item.ProductID {
+			return fmt.Errorf("cart item for product %d has product %d loaded", item.ProductID, item.Product.ID)
+		}
+		got[item.ProductID] = item.Quantity
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("cart holds %v, want %v", got, want)
+	}
+	return nil
+}
+
+// sameAmount reports whether two amounts are equal to the cent
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// expectStock checks the stock of every product
+func expectStock(ctx context.Context, store Store, want map[uint]int) error {
+	products, err := store.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	got := make(map[uint]int)
+	for _, product := range products {
+		got[product.ID] = product.Stock
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		return fmt.Errorf("stock is %v, want %v", got, want)
+	}
+	return nil
+}
+
+func checkOrders(ctx context.Context, store Store, data *conformanceData) error {
+	// There's only one lamp, so ordering two changes nothing
+	if err := store.SetCartItemQuantity(ctx, data.userID, data.lamp.ID, 2); err != nil {
+		return err
+	}
+	if _, err := store.PlaceOrder(ctx, models.Order{UserID: data.userID, PaymentMethod: "card"}); !errors.Is(err, ErrInsufficientStock) {
+		return fmt.Errorf("ordering more lamps than there are gave %v, not ErrInsufficientStock", err)
+	}
+	if placed, err := dispatchOrders(ctx, store); err != nil || len(placed) != 0 {
+		return fmt.Errorf("an order short of stock recorded %v (%v)", placed, err)
+	}
+	if err := expectStock(ctx, store, map[uint]int{data.mug.ID: 5, data.lamp.ID: 1}); err != nil {
+		return fmt.Errorf("after an order short of stock: %v", err)
+	}
+	if err := store.SetCartItemQuantity(ctx, data.userID, data.lamp.ID, 1); err != nil {
+		return err
+	}
+
+	order, err := store.PlaceOrder(ctx, models.Order{UserID: data.userID, PaymentMethod: "card", CouponCode: "SAVE10"})
+	if err != nil {
+		return err
+	}
+	// 3 mugs at 10 and a lamp at 25, less 10%
+	if !sameAmount(order.TotalPrice, 49.5) || !sameAmount(order.Discount, 5.5) || len(order.OrderItems) != 2 {
+		return fmt.Errorf("order total %v, discount %v, %d items", order.TotalPrice, order.Discount, len(order.OrderItems))
+	}
+	data.orderID = strconv.FormatUint(uint64(order.ID), 10)
+
+	// The order is only placed once its payment is authorized
+	if placed, err := dispatchOrders(ctx, store); err != nil || len(placed) != 0 {
+		return fmt.Errorf("an order without a payment recorded %v (%v)", placed, err)
+	}
+	if _, err := pay(ctx, store, order, "conformance_1", models.PaymentStatusAuthorized); err != nil {
+		return err
+	}
+
+	// Emptying the cart is left to the subscribers of the order's event
+	if err := expectCart(ctx, store, data.userID, map[uint]int{data.mug.ID: 3, data.lamp.ID: 1}); err != nil {
+		return fmt.Errorf("before the order's event was dispatched: %v", err)
+	}
+	placed, err := dispatchOrders(ctx, store)
+	if err != nil {
+		return err
+	}
+	if len(placed) != 1 || placed[0].OrderID != order.ID || placed[0].UserID != data.userID || len(placed[0].CartItemIDs) != 2 {
+		return fmt.Errorf("orders placed in the outbox are %v", placed)
+	}
+
+	if _, err := store.PlaceOrder(ctx, models.Order{UserID: data.userID}); !errors.Is(err, ErrEmptyCart) {
+		return fmt.Errorf("placing an order from an empty cart gave %v, not ErrEmptyCart", err)
+	}
+	if placed, err := dispatchOrders(ctx, store); err != nil || len(placed) != 0 {
+		return fmt.Errorf("an order that failed recorded %v (%v)", placed, err)
+	}
+	if err := expectCart(ctx, store, data.userID, map[uint]int{}); err != nil {
+		return err
+	}
+	if err := expectStock(ctx, store, map[uint]int{data.mug.ID: 2, data.lamp.ID: 0}); err != nil {
+		return err
+	}
+	if user, err := store.GetUserByID(ctx, data.userID); err != nil || user.OrdersCount != 1 {
+		return fmt.Errorf("user has %d orders (%v)", user.OrdersCount, err)
+	}
+	if err := store.IncrementOrdersCount(ctx, data.userID, order.ID); err != nil {
+		return err
+	}
+	if user, err := store.GetUserByID(ctx, data.userID); err != nil || user.OrdersCount != 1 {
+		return fmt.Errorf("user has %d orders after counting the order again (%v)", user.OrdersCount, err)
+	}
+	if orders, err := store.GetUserOrders(ctx, data.userID); err != nil || len(orders) != 1 {
+		return fmt.Errorf("user orders are %v (%v)", orders, err)
+	}
+	if orders, err := store.GetOrdersByUserIDs(ctx, []string{data.userID, "999999"}); err != nil || len(orders) != 1 || len(orders[0].OrderItems) != 2 {
+		return fmt.Errorf("orders by user are %v (%v)", orders, err)
+	}
+	if err := store.UpdateOrderStatus(ctx, data.orderID, models.OrderStatusDelivered); !errors.Is(err, ErrInvalidTransition) {
+		return fmt.Errorf("delivering an unpaid order gave %v", err)
+	}
+	return nil
+}
+
+// pay records a payment of the order's total that the provider gave status
+func pay(ctx context.Context, store Store, order models.Order, ref string, status string) (models.Payment, error) {
+	payment, err := store.AddPayment(ctx, models.Payment{OrderID: order.ID, Provider: "conformance", ProviderRef: ref,
+		Amount: order.TotalPrice, Status: models.PaymentStatusPending})
+	if err != nil {
+		return payment, err
+	}
+	return store.RecordPaymentTransaction(ctx, payment, models.Transaction{Type: models.TransactionAuthorize,
+		Amount: order.TotalPrice, Status: status})
+}
+
+// dispatchOrders stands in for the subscribers in the events package, which
+// this package can't import. It marks every pending event dispatched, first
+// removing the lines each order placed was made from and counting the order
+// against its user, and returns the orders placed.
+func dispatchOrders(ctx context.Context, store Store) ([]models.OrderPlaced, error) {
+	events, err := store.ClaimOutboxEvents(ctx, time.Now(), time.Minute, 1000)
+	if err != nil {
+		return nil, err
+	}
+	var placed []models.OrderPlaced
+	for _, event := range events {
+		if event.Name == models.EventOrderPlaced {
+			var order models.OrderPlaced
+			if err := json.Unmarshal([]byte(event.Payload), &order); err != nil {
+				return placed, err
+			}
+			if err := store.RemoveCartItems(ctx, order.UserID, order.CartItemIDs); err != nil {
+				return placed, err
+			}
+			if !models.IsGuestOwner(order.UserID) {
+				if err := store.IncrementOrdersCount(ctx, order.UserID, order.OrderID); err != nil {
+					return placed, err
+				}
+			}
+			placed = append(placed, order)
+		}
+		now := time.Now()
+		event.Status, event.DispatchedAt = models.OutboxDispatched, &now
+		if err := store.SaveOutboxEvent(ctx, event); err != nil {
+			return placed, err
+		}
+	}
+	return placed, nil
+}
+
+func checkOutbox(ctx context.Context, store Store, data *conformanceData) error {
+	if _, err := dispatchOrders(ctx, store); err != nil {
+		return err
+	}
+	if _, err := store.AdjustStock(ctx, data.mug.ID, -1000); !errors.Is(err, ErrInsufficientStock) {
+		return fmt.Errorf("taking 1000 mugs out of stock gave %v, not ErrInsufficientStock", err)
+	}
+	recordingCtx, recorded := WithRecordedEvents(ctx)
+	if _, err := store.AdjustStock(recordingCtx, data.mug.ID, 0); err != nil {
+		return err
+	}
+	ids := recorded.IDs()
+	if len(ids) != 1 {
+		return fmt.Errorf("recorded %v, want one event", ids)
+	}
+
+	// Only the change that went through is recorded
+	now := time.Now()
+	if claimed, err := store.ClaimOutboxEventsByID(ctx, []uint{ids[0] + 1}, now, time.Minute); err != nil || len(claimed) != 0 {
+		return fmt.Errorf("claiming an event that wasn't recorded gave %v (%v)", claimed, err)
+	}
+	claimed, err := store.ClaimOutboxEvents(ctx, now, time.Minute, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].Name != models.EventProductChanged || claimed[0].ID != ids[0] {
+		return fmt.Errorf("claimed %v (%v), want the one product_changed event recorded", claimed, err)
+	}
+	var changed models.ProductChanged
+	if err := json.Unmarshal([]byte(claimed[0].Payload), &changed); err != nil || changed.ProductID != data.mug.ID || changed.Created {
+		return fmt.Errorf("product changed is %v (%v)", changed, err)
+	}
+	if again, err := store.ClaimOutboxEvents(ctx, now, time.Minute, 10); err != nil || len(again) != 0 {
+		return fmt.Errorf("claiming again during the lease gave %v (%v)", again, err)
+	}
+	if again, err := store.ClaimOutboxEventsByID(ctx, ids, now, time.Minute); err != nil || len(again) != 0 {
+		return fmt.Errorf("claiming again by ID during the lease gave %v (%v)", again, err)
+	}
+	if again, err := store.ClaimOutboxEvents(ctx, now.Add(2*time.Minute), time.Minute, 10); err != nil || len(again) != 1 {
+		return fmt.Errorf("claiming after the lease ran out gave %v (%v)", again, err)
+	}
+	if again, err := store.ClaimOutboxEventsByID(ctx, ids, now.Add(4*time.Minute), time.Minute); err != nil || len(again) != 1 {
+		return fmt.Errorf("claiming by ID after that lease ran out gave %v (%v)", again, err)
+	}
+
+	// A retry keeps track of the subscribers that have succeeded
+	event := claimed[0]
+	event.Attempts, event.LastError, event.Handled = 1, "failed", models.Names{"first"}
+	event.NextAttemptAt = now.Add(time.Hour)
+	if err := store.SaveOutboxEvent(ctx, event); err != nil {
+		return err
+	}
+	if due, err := store.ClaimOutboxEvents(ctx, now.Add(30*time.Minute), time.Minute, 10); err != nil || len(due) != 0 {
+		return fmt.Errorf("claiming before the retry gave %v (%v)", due, err)
+	}
+	due, err := store.ClaimOutboxEvents(ctx, now.Add(time.Hour), time.Minute, 10)
+	if err != nil || len(due) != 1 || due[0].Attempts != 1 || fmt.Sprint(due[0].Handled) != "[first]" {
+		return fmt.Errorf("claiming the retry gave %v (%v)", due, err)
+	}
+
+	dispatched := time.Now()
+	event = due[0]
+	event.Status, event.DispatchedAt = models.OutboxDispatched, &dispatched
+	if err := store.SaveOutboxEvent(ctx, event); err != nil {
+		return err
+	}
+	if due, err := store.ClaimOutboxEvents(ctx, now.Add(48*time.Hour), time.Minute, 10); err != nil || len(due) != 0 {
+		return fmt.Errorf("claiming after dispatching gave %v (%v)", due, err)
+	}
+
+	// A subscriber's events are marked processed once
+	for i, want := range []bool{true, false} {
+		if first, err := store.MarkProcessed(ctx, "test", "1"); err != nil || first != want {
+			return fmt.Errorf("marking an event processed, try %d, gave %v (%v)", i+1, first, err)
+		}
+	}
+	if first, err := store.MarkProcessed(ctx, "other", "1"); err != nil || !first {
+		return fmt.Errorf("marking the event processed for another subscriber gave %v (%v)", first, err)
+	}
+	if err := store.UnmarkProcessed(ctx, "test", "1"); err != nil {
+		return err
+	}
+	if first, err := store.MarkProcessed(ctx, "test", "1"); err != nil || !first {
+		return fmt.Errorf("marking an event processed after unmarking it gave %v (%v)", first, err)
+	}
+
+	// Pruning deletes only the events dispatched before the cutoff
+	if n, err := store.PruneOutboxEvents(ctx, dispatched.Add(-time.Second)); err != nil || n != 0 {
+		return fmt.Errorf("pruning before the event was dispatched deleted %d (%v)", n, err)
+	}
+	if n, err := store.PruneOutboxEvents(ctx, dispatched.Add(time.Second)); err != nil || n < 1 {
+		return fmt.Errorf("pruning after the event was dispatched deleted %d (%v)", n, err)
+	}
+	if n, err := store.PruneOutboxEvents(ctx, dispatched.Add(time.Second)); err != nil || n != 0 {
+		return fmt.Errorf("pruning again deleted %d (%v)", n, err)
+	}
+	if first, err := store.MarkProcessed(ctx, "test", "1"); err != nil || !first {
+		return fmt.Errorf("marking an event processed after pruning gave %v (%v)", first, err)
+	}
+	return nil
+}
+
+func checkPayments(ctx context.Context, store Store, data *conformanceData) error {
+	order, err := store.GetOrder(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderStatusAuthorized {
+		return fmt.Errorf("order is %s after authorization", order.Status)
+	}
+	payment, err := store.GetOrderPayment(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	payment, err = store.RecordPaymentTransaction(ctx, payment, models.Transaction{Type: models.TransactionCapture,
+		Amount: order.TotalPrice, Status: models.PaymentStatusCaptured})
+	if err != nil {
+		return err
+	}
+	if payment.CapturedAmount != order.TotalPrice {
+		return fmt.Errorf("captured %v of %v", payment.CapturedAmount, order.TotalPrice)
+	}
+
+	payment, err = store.GetOrderPayment(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	if len(payment.Transactions) != 2 || payment.Status != models.PaymentStatusCaptured {
+		return fmt.Errorf("payment is %s with %d transactions", payment.Status, len(payment.Transactions))
+	}
+	if byRef, err := store.GetPaymentByRef(ctx, "conformance_1"); err != nil || byRef.ID != payment.ID {
+		return fmt.Errorf("payment by reference is %d (%v)", byRef.ID, err)
+	}
+	stored, err := store.GetProviderPayments(ctx, "conformance")
+	if err != nil || len(stored) != 1 || stored[0].ID != payment.ID || stored[0].CapturedAmount != order.TotalPrice {
+		return fmt.Errorf("provider's payments are %+v (%v), want the captured one", stored, err)
+	}
+	if stored, err := store.GetProviderPayments(ctx, "fake"); err != nil || len(stored) != 0 {
+		return fmt.Errorf("another provider has payments %+v (%v)", stored, err)
+	}
+	if order, err := store.GetOrder(ctx, data.orderID); err != nil || order.Status != models.OrderStatusPaid {
+		return fmt.Errorf("order is %s after capture (%v)", order.Status, err)
+	}
+	return nil
+}
+
+func checkReturns(ctx context.Context, store Store, data *conformanceData) error {
+	for _, status := range []string{models.OrderStatusShipped, models.OrderStatusDelivered} {
+		if err := store.UpdateOrderStatus(ctx, data.orderID, status); err != nil {
+			return err
+		}
+	}
+	order, err := store.GetOrder(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	var mugItem models.OrderItem
+	for _, item := range order.OrderItems {
+		if item.ProductID == data.mug.ID {
+			mugItem = item
+		}
+	}
+
+	tooMany := models.ReturnRequest{OrderID: order.ID, UserID: data.userID,
+		Items: []models.ReturnItem{{OrderItemID: mugItem.ID, Quantity: 4}}}
+	if _, err := store.AddReturnRequest(ctx, tooMany); !errors.Is(err, ErrInvalidReturn) {
+		return fmt.Errorf("returning more than was bought gave %v", err)
+	}
+	request, err := store.AddReturnRequest(ctx, models.ReturnRequest{OrderID: order.ID, UserID: data.userID,
+		Items: []models.ReturnItem{{OrderItemID: mugItem.ID, Quantity: 2}}})
+	if err != nil {
+		return err
+	}
+	if request.Status != models.ReturnStatusRequested || request.Items[0].Price != 10 {
+		return fmt.Errorf("return is %s with item price %v", request.Status, request.Items[0].Price)
+	}
+	oneMore := models.ReturnRequest{OrderID: order.ID, UserID: data.userID,
+		Items: []models.ReturnItem{{OrderItemID: mugItem.ID, Quantity: 2}}}
+	if _, err := store.AddReturnRequest(ctx, oneMore); !errors.Is(err, ErrInvalidReturn) {
+		return fmt.Errorf("returning items claimed by an open return gave %v", err)
+	}
+
+	returnID := strconv.FormatUint(uint64(request.ID), 10)
+	if _, err := store.DecideReturn(ctx, returnID, models.ReturnStatusApproved, "first"); err != nil {
+		return err
+	}
+	if err := store.ReopenReturn(ctx, returnID); err != nil {
+		return err
+	}
+	if _, err := store.DecideReturn(ctx, returnID, models.ReturnStatusApproved, "Damaged"); err != nil {
+		return err
+	}
+	if _, err := store.DecideReturn(ctx, returnID, models.ReturnStatusRejected, ""); !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("deciding an approved return again gave %v", err)
+	}
+	request, err = store.GetReturnRequest(ctx, returnID)
+	if err != nil {
+		return err
+	}
+	if request.Status != models.ReturnStatusApproved || request.AdminNote != "Damaged" || len(request.Items) != 1 {
+		return fmt.Errorf("approved return is %s with note %q and %d items", request.Status, request.AdminNote, len(request.Items))
+	}
+	payment, err := store.GetOrderPayment(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	// A delivered order can't be cancelled, so nothing of this return should be
+	voided := models.Transaction{Type: models.TransactionRefund, Amount: payment.CapturedAmount, Status: models.PaymentStatusVoided}
+	if _, err := store.CompleteReturn(ctx, request, payment, voided, true); err == nil {
+		return errors.New("a return whose refund couldn't be recorded was completed")
+	}
+	if request, err := store.GetReturnRequest(ctx, returnID); err != nil || request.Status != models.ReturnStatusApproved {
+		return fmt.Errorf("return is %s after its refund couldn't be recorded (%v)", request.Status, err)
+	}
+	if payment, err := store.GetOrderPayment(ctx, data.orderID); err != nil || payment.RefundedAmount != 0 || len(payment.Transactions) != 2 {
+		return fmt.Errorf("payment has %v refunded over %d transactions after a failed return (%v)", payment.RefundedAmount, len(payment.Transactions), err)
+	}
+	if err := expectStock(ctx, store, map[uint]int{data.mug.ID: 2, data.lamp.ID: 0}); err != nil {
+		return fmt.Errorf("after a failed return: %v", err)
+	}
+
+	refund := models.Transaction{Type: models.TransactionRefund, Amount: 18, Status: models.PaymentStatusCaptured, ProviderRef: "refund-1"}
+	if err := store.NoteReturnRefund(ctx, returnID, refund.ProviderRef, refund.Amount); err != nil {
+		return err
+	}
+	if err := store.ReopenReturn(ctx, returnID); !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("reopening a refunded return gave %v", err)
+	}
+	if stored, err := store.GetReturnRequest(ctx, returnID); err != nil || stored.RefundRef != "refund-1" || stored.RefundAmount != 18 {
+		return fmt.Errorf("return has refund %q of %v once noted (%v)", stored.RefundRef, stored.RefundAmount, err)
+	}
+	request, err = store.CompleteReturn(ctx, request, payment, refund, true)
+	if err != nil {
+		return err
+	}
+	if request.Status != models.ReturnStatusRefunded || request.RefundAmount != 18 || request.RefundRef != "refund-1" {
+		return fmt.Errorf("completed return is %s with refund %q of %v", request.Status, request.RefundRef, request.RefundAmount)
+	}
+	if _, err := store.CompleteReturn(ctx, request, payment, refund, true); !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("completing a return twice gave %v", err)
+	}
+	payment, err = store.GetOrderPayment(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	if payment.RefundedAmount != 18 || len(payment.Transactions) != 3 {
+		return fmt.Errorf("payment has %v refunded over %d transactions", payment.RefundedAmount, len(payment.Transactions))
+	}
+
+	order, err = store.GetOrder(ctx, data.orderID)
+	if err != nil {
+		return err
+	}
+	for _, item := range order.OrderItems {
+		if item.ID == mugItem.ID && item.Returned != 2 {
+			return fmt.Errorf("%d mugs recorded as returned", item.Returned)
+		}
+	}
+	if len(order.CreditNotes) != 1 {
+		return fmt.Errorf("order has %d credit notes", len(order.CreditNotes))
+	}
+	if err := expectStock(ctx, store, map[uint]int{data.mug.ID: 4, data.lamp.ID: 0}); err != nil {
+		return err
+	}
+	if requests, err := store.GetUserReturns(ctx, data.userID); err != nil || len(requests) != 1 {
+		return fmt.Errorf("user returns are %v (%v)", requests, err)
+	}
+	return nil
+}
+
+func checkCoupons(ctx context.Context, store Store, data *conformanceData) error {
+	if err := store.AddCoupon(ctx, models.CouponObject{Code: "WELCOME", Discount: 5, OrderFrequency: 1}); err != nil {
+		return err
+	}
+	if err := store.AddCoupon(ctx, models.CouponObject{Code: "WELCOME", Discount: 10}); !errors.Is(err, ErrConflict) {
+		return fmt.Errorf("adding a duplicate coupon code gave %v, not ErrConflict", err)
+	}
+	coupon, err := store.GetCoupon(ctx, "WELCOME")
+	if err != nil {
+		return err
+	}
+	coupon.Discount = 7
+	if err := store.SaveCoupon(ctx, coupon); err != nil {
+		return err
+	}
+	if coupon, err := store.GetCoupon(ctx, "WELCOME"); err != nil || coupon.Discount != 7 {
+		return fmt.Errorf("saved coupon is %v (%v)", coupon, err)
+	}
+	if store.CouponDiscountRate(ctx, "WELCOME") != 0 {
+		return errors.New("a coupon that isn't single-use was accepted at checkout")
+	}
+
+	generated, err := store.GenerateCoupon(ctx, 50, time.Hour)
+	if err != nil {
+		return err
+	}
+	if rate := store.CouponDiscountRate(ctx, generated.Code); rate != 0.5 {
+		return fmt.Errorf("generated coupon takes off %v", rate)
+	}
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 1); err != nil {
+		return err
+	}
+	order, err := store.PlaceOrder(ctx, models.Order{UserID: data.userID, CouponCode: generated.Code})
+	if err != nil {
+		return err
+	}
+	if _, err := pay(ctx, store, order, "conformance_2", models.PaymentStatusAuthorized); err != nil {
+		return err
+	}
+	if _, err := dispatchOrders(ctx, store); err != nil {
+		return err
+	}
+	if !sameAmount(order.TotalPrice, 5) {
+		return fmt.Errorf("order with a half-off coupon costs %v", order.TotalPrice)
+	}
+	if rate := store.CouponDiscountRate(ctx, generated.Code); rate != 0 {
+		return errors.New("single-use coupon was accepted after being redeemed")
+	}
+
+	if err := store.DeleteCoupon(ctx, models.CouponObject{Code: "WELCOME"}); err != nil {
+		return err
+	}
+	if _, err := store.GetCoupon(ctx, "WELCOME"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("finding a deleted coupon gave %v, not ErrNotFound", err)
+	}
+	if err := store.AddCoupon(ctx, models.CouponObject{Code: "WELCOME", Discount: 5}); err != nil {
+		return fmt.Errorf("re-adding a deleted coupon code: %v", err)
+	}
+	return nil
+}
+
+// checkDeclinedPayments orders two mugs with a coupon and has the payment
+// declined, which should give back the mugs and the coupon and leave the cart
+func checkDeclinedPayments(ctx context.Context, store Store, data *conformanceData) error {
+	products, err := store.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	stock := make(map[uint]int)
+	for _, product := range products {
+		stock[product.ID] = product.Stock
+	}
+	generated, err := store.GenerateCoupon(ctx, 50, time.Hour)
+	if err != nil {
+		return err
+	}
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 2); err != nil {
+		return err
+	}
+	order, err := store.PlaceOrder(ctx, models.Order{UserID: data.userID, CouponCode: generated.Code})
+	if err != nil {
+		return err
+	}
+	if store.CouponDiscountRate(ctx, generated.Code) != 0 {
+		return errors.New("coupon held by an order was accepted again")
+	}
+
+	if _, err := pay(ctx, store, order, "conformance_3", models.PaymentStatusDeclined); err != nil {
+		return err
+	}
+	if order, err := store.GetOrder(ctx, strconv.FormatUint(uint64(order.ID), 10)); err != nil || order.Status != models.OrderStatusPaymentFailed {
+		return fmt.Errorf("order is %s after its payment was declined (%v)", order.Status, err)
+	}
+	if placed, err := dispatchOrders(ctx, store); err != nil || len(placed) != 0 {
+		return fmt.Errorf("an order whose payment was declined recorded %v (%v)", placed, err)
+	}
+	if err := expectCart(ctx, store, data.userID, map[uint]int{data.mug.ID: 2}); err != nil {
+		return fmt.Errorf("after the payment was declined: %v", err)
+	}
+	if err := expectStock(ctx, store, stock); err != nil {
+		return fmt.Errorf("after the payment was declined: %v", err)
+	}
+	if rate := store.CouponDiscountRate(ctx, generated.Code); rate != 0.5 {
+		return fmt.Errorf("coupon of an order whose payment was declined takes off %v", rate)
+	}
+	if _, err := pay(ctx, store, order, "conformance_4", models.PaymentStatusAuthorized); err == nil {
+		return errors.New("an order whose payment failed was authorized after its stock was given back")
+	}
+
+	if err := store.SetCartItemQuantity(ctx, data.userID, data.mug.ID, 0); err != nil {
+		return err
+	}
+	_, err = dispatchOrders(ctx, store)
+	return err
+}
+
+func checkAbandonedCarts(ctx context.Context, store Store, data *conformanceData) error {
+	if err := store.AddItemToCart(ctx, data.userID, data.mug.ID, 1); err != nil {
+		return err
+	}
+	carts, err := store.FindAbandonedCarts(ctx, -time.Minute)
+	if err != nil {
+		return err
+	}
+	if len(carts) != 1 || carts[0].UserID != data.userID || len(carts[0].Items) != 1 {
+		return fmt.Errorf("abandoned carts are %v", carts)
+	}
+	event, err := store.AddCartAbandonment(ctx, models.CartAbandonment{CartID: carts[0].ID, UserID: data.userID, LastActivity: carts[0].UpdatedAt})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	event.ReminderSentAt = &now
+	if err := store.SaveCartAbandonment(ctx, event); err != nil {
+		return err
+	}
+	if carts, err := store.FindAbandonedCarts(ctx, -time.Minute); err != nil || len(carts) != 0 {
+		return fmt.Errorf("recorded cart was found again: %v (%v)", carts, err)
+	}
+	events, err := store.GetCartAbandonments(ctx)
+	if err != nil {
+		return err
+	}
+	if len(events) != 1 || events[0].ReminderSentAt == nil {
+		return fmt.Errorf("abandonment events are %v", events)
+	}
+	return nil
+}
+
+func checkWebhooks(ctx context.Context, store Store, data *conformanceData) error {
+	sub, err := store.AddWebhookSubscription(ctx, models.WebhookSubscription{
+		URL:    "https://partner.example.com/hooks",
+		Secret: "secret",
+		Events: models.EventTypes{models.WebhookOrderPlaced},
+	})
+	if err != nil {
+		return err
+	}
+	sub.Events = append(sub.Events, models.WebhookProductCreated)
+	if err := store.SaveWebhookSubscription(ctx, sub); err != nil {
+		return err
+	}
+	subID := strconv.FormatUint(uint64(sub.ID), 10)
+	if stored, err := store.GetWebhookSubscription(ctx, subID); err != nil || len(stored.Events) != 2 || stored.Secret != "secret" {
+		return fmt.Errorf("saved subscription is %v (%v)", stored, err)
+	}
+
+	now := time.Now()
+	err = store.EnqueueWebhookDeliveries(ctx, []models.WebhookDelivery{
+		{SubscriptionID: sub.ID, EventID: "evt-1", EventType: models.WebhookOrderPlaced, Payload: "{}", Status: models.WebhookDeliveryPending, NextAttemptAt: now.Add(-time.Second)},
+		{SubscriptionID: sub.ID, EventID: "evt-2", EventType: models.WebhookProductCreated, Payload: "{}", Status: models.WebhookDeliveryPending, NextAttemptAt: now.Add(time.Hour)},
+	})
+	if err != nil {
+		return err
+	}
+	claimed, err := store.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+	if err != nil {
+		return err
+	}
+	if len(claimed) != 1 || claimed[0].EventID != "evt-1" {
+		return fmt.Errorf("claimed deliveries are %v", claimed)
+	}
+	if again, err := store.ClaimWebhookDeliveries(ctx, now, time.Minute, 10); err != nil || len(again) != 0 {
+		return fmt.Errorf("a claimed delivery was claimed again: %v (%v)", again, err)
+	}
+
+	delivery := claimed[0]
+	delivery.Attempts++
+	delivery.Status = models.WebhookDeliveryDelivered
+	delivery.DeliveredAt = &now
+	if _, err := store.RecordWebhookAttempt(ctx, delivery, models.WebhookAttempt{StatusCode: 204, DurationMS: 5}); err != nil {
+		return err
+	}
+	deliveries, err := store.GetWebhookDeliveries(ctx, subID)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) != 2 || deliveries[0].EventID != "evt-2" || deliveries[1].Status != models.WebhookDeliveryDelivered {
+		return fmt.Errorf("deliveries are %v", deliveries)
+	}
+	stored, err := store.GetWebhookDelivery(ctx, strconv.FormatUint(uint64(delivery.ID), 10))
+	if err != nil {
+		return err
+	}
+	if stored.Attempts != 1 || len(stored.AttemptLog) != 1 || stored.AttemptLog[0].StatusCode != 204 {
+		return fmt.Errorf("delivery with its attempts is %v", stored)
+	}
+
+	if err := store.DeleteWebhookSubscription(ctx, sub); err != nil {
+		return err
+	}
+	if _, err := store.GetWebhookSubscription(ctx, subID); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("getting a deleted subscription gave %v, not ErrNotFound", err)
+	}
+	if deliveries, err := store.GetWebhookDeliveries(ctx, subID); err != nil || len(deliveries) != 2 {
+		return fmt.Errorf("deleting a subscription lost its deliveries: %v (%v)", deliveries, err)
+	}
+	return nil
+}
+
+func checkUpserts(ctx context.Context, store Store, data *conformanceData) error {
+	stock := make(map[uint]int)
+	products, err := store.GetAllProducts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		stock[product.ID] = product.Stock
+	}
+
+	if created, err := store.UpsertCategory(ctx, models.Category{Name: "home", Description: "Home goods"}); err != nil || created {
+		return fmt.Errorf("upserting an existing category created it again (%v)", err)
+	}
+	if created, err := store.UpsertCategory(ctx, models.Category{Name: "garden"}); err != nil || !created {
+		return fmt.Errorf("upserting a new category didn't create it (%v)", err)
+	}
+	if categories, err := store.GetAllCategories(ctx); err != nil || len(categories) != 2 {
+		return fmt.Errorf("categories after upserting are %v (%v)", categories, err)
+	}
+
+	if created, err := store.UpsertProduct(ctx, models.Product{Name: "Mug", Category: "home", Price: 12, Stock: 99}); err != nil || created {
+		return fmt.Errorf("upserting an existing product created it again (%v)", err)
+	}
+	if err := expectStock(ctx, store, stock); err != nil {
+		return fmt.Errorf("upserting changed stock: %v", err)
+	}
+	if products, err := store.GetProducts(ctx, "home"); err != nil || len(products) != 1 || products[0].Price != 12 {
+		return fmt.Errorf("upserted product is %v (%v)", products, err)
+	}
+
+	// A SKU adopts the product of the same name, then becomes its key
+	if created, err := store.UpsertProduct(ctx, models.Product{SKU: "MUG-1", Name: "Mug", Category: "home", Price: 12}); err != nil || created {
+		return fmt.Errorf("upserting a SKU for an existing product created it again (%v)", err)
+	}
+	if created, err := store.UpsertProduct(ctx, models.Product{SKU: "MUG-1", Name: "Big mug", Category: "home", Price: 14}); err != nil || created {
+		return fmt.Errorf("upserting a renamed product by SKU created it again (%v)", err)
+	}
+	if product, found, err := store.MatchProduct(ctx, models.Product{Name: "Big mug"}); err != nil || !found || product.SKU != "MUG-1" || product.Price != 14 {
+		return fmt.Errorf("product matched by name is %v, found %v (%v)", product, found, err)
+	}
+	if created, err := store.UpsertProduct(ctx, models.Product{SKU: "MUG-2", Name: "Big mug", Category: "home"}); err != nil || !created {
+		return fmt.Errorf("upserting a new SKU didn't create it (%v)", err)
+	}
+	if products, err := store.GetProducts(ctx, "home"); err != nil || len(products) != 2 {
+		return fmt.Errorf("products after upserting SKUs are %v (%v)", products, err)
+	}
+
+	if created, err := store.UpsertUser(ctx, models.User{Username: "renamed", Email: "conformance@example.com"}); err != nil || created {
+		return fmt.Errorf("upserting an existing user created it again (%v)", err)
+	}
+	if user, err := store.GetUserByID(ctx, data.userID); err != nil || user.Username != "renamed" || user.OrdersCount != 2 {
+		return fmt.Errorf("upserted user is %v (%v)", user, err)
+	}
+
+	for i, want := range []bool{true, false} {
+		if created, err := store.UpsertCoupon(ctx, models.CouponObject{Code: "SEEDED", Discount: float64(i)}); err != nil || created != want {
+			return fmt.Errorf("upsert %d of a coupon reported created %v (%v)", i+1, created, err)
+		}
+	}
+	if coupon, err := store.GetCoupon(ctx, "SEEDED"); err != nil || coupon.Discount != 1 {
+		return fmt.Errorf("upserted coupon is %v (%v)", coupon, err)
+	}
+	return nil
+}
@@ -2,246 +2,476 @@ package database
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base32"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/Rohanrevanth/e-store-go/models"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-
-	"github.com/go-redis/redis/v8"
 )
 
-var db *gorm.DB
-var RedisClient *redis.Client
-
-func ConnectDatabase() {
-	var err error
-	db, err = gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
-	if err != nil {
-		log.Fatal("Failed to connect to the database!", err)
-	}
-
-	// Migrate the schema
-	db.AutoMigrate(&models.User{})
-	db.AutoMigrate(&models.Category{})
-	db.AutoMigrate(&models.Product{})
-	db.AutoMigrate(&models.Cart{})
-	db.AutoMigrate(&models.CartItem{})
-	db.AutoMigrate(&models.Order{})
-	db.AutoMigrate(&models.OrderItem{})
-	db.AutoMigrate(&models.CouponObject{})
-	fmt.Println("Connected to sqlite...")
-
-	// MigrateDB(db)
+// GormStore implements Store on top of a GORM database
+type GormStore struct {
+	db *gorm.DB
 }
 
-func MigrateDB(db *gorm.DB) error {
-	err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.Cart{}, &models.CartItem{}, &models.Order{}, &models.OrderItem{})
-	if err != nil {
-		panic("failed to migrate database")
-	}
-	return err
+// NewGormStore returns a store backed by db
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
 }
 
-func InitializeRedis() {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379", // Redis server address
-		Password: "",               // No password by default
-		DB:       0,                // Default DB
+// ConnectDatabase opens the database cfg points at. The schema is managed
+// separately by the migrations (see MigrateUp).
+func ConnectDatabase(cfg Config) (*gorm.DB, error) {
+	db, err := gorm.Open(cfg.dialector(), &gorm.Config{
+		// Carts are owned by guests as well as users, so carts.user_id can't
+		// reference users. SQLite never enforced these; the other backends would.
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   gormLogger{},
+		// Report unique violations as gorm.ErrDuplicatedKey, for translate
+		TranslateError: true,
 	})
-
-	// Test the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	_, err := RedisClient.Ping(ctx).Result()
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		return nil, fmt.Errorf("failed to connect to the database: %v", err)
+	}
+	if err := cfg.configurePool(db); err != nil {
+		return nil, fmt.Errorf("failed to configure the connection pool: %v", err)
 	}
+	slog.Info("Connected to the database", "backend", cfg.Backend())
+	return db, nil
+}
 
-	log.Println("Connected to Redis successfully")
+// translate replaces GORM's errors for missing and duplicate records with
+// ErrNotFound and ErrConflict
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrConflict
+	}
+	return err
 }
 
-func GetUserByEmail(email string) (models.User, error) {
+func (s *GormStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	var usr models.User
-	if err := db.Where("email = ?", email).First(&usr).Error; err != nil {
-		return usr, fmt.Errorf("GetUserByEmail: %v", err)
+	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&usr).Error; err != nil {
+		return usr, fmt.Errorf("GetUserByEmail: %w", translate(err))
 	}
 	return usr, nil
 }
 
-func GetUserByID(id string) (models.User, error) {
+func (s *GormStore) GetUserByID(ctx context.Context, id string) (models.User, error) {
 	var usr models.User
-	if err := db.Where("ID = ?", id).First(&usr).Error; err != nil {
-		return usr, fmt.Errorf("GetUserByID: %v", err)
+	if err := s.db.WithContext(ctx).Where("ID = ?", id).First(&usr).Error; err != nil {
+		return usr, fmt.Errorf("GetUserByID: %w", translate(err))
 	}
 	return usr, nil
 }
 
-func GetAllUsers() ([]models.User, error) {
+func (s *GormStore) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	if err := db.Find(&users).Error; err != nil {
+	if err := s.db.WithContext(ctx).Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("get all users: %v", err)
 	}
 	return users, nil
 }
 
-func AddUser(user models.User) error {
-	if err := db.Create(&user).Error; err != nil {
+func (s *GormStore) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	var users []models.User
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("GetUsersByIDs: %v", err)
+	}
+	return users, nil
+}
+
+func (s *GormStore) AddUser(ctx context.Context, user models.User) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.UserRegistered{UserID: user.ID, Username: user.Username, Email: user.Email})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("AddUser: %w", detailed(ErrConflict, "user already exists"))
+	} else if err != nil {
 		return fmt.Errorf("AddUser: %v", err)
 	}
 	return nil
 }
 
-func SaveUser(user models.User) error {
-	if err := db.Save(&user).Error; err != nil {
-		return fmt.Errorf("SaveUser: %v", err)
+func (s *GormStore) SaveUser(ctx context.Context, user models.User) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Save(&user).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.UserChanged{UserID: user.ID})
+	})
+	if err != nil {
+		return fmt.Errorf("SaveUser: %w", translate(err))
+	}
+	return nil
+}
+
+// countOrderSubscriber is the subscriber IncrementOrdersCount marks the
+// orders it has counted as processed for
+const countOrderSubscriber = "count-order"
+
+func (s *GormStore) IncrementOrdersCount(ctx context.Context, userID string, orderID uint) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		first, err := tx.MarkProcessed(ctx, countOrderSubscriber, strconv.FormatUint(uint64(orderID), 10))
+		if err != nil || !first {
+			return err
+		}
+		result := tx.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).
+			Update("orders_count", gorm.Expr("orders_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return detailed(ErrNotFound, "no user found for ID %s", userID)
+		}
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.UserChanged{UserID: uint(id)})
+	})
+	if err != nil {
+		return fmt.Errorf("IncrementOrdersCount: %w", err)
 	}
 	return nil
 }
 
-func DeleteUser(user models.User) error {
-	if err := db.Delete(&user).Error; err != nil {
+func (s *GormStore) DeleteUser(ctx context.Context, user models.User) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Delete(&user).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.UserChanged{UserID: user.ID})
+	})
+	if err != nil {
 		return fmt.Errorf("DeleteUser: %v", err)
 	}
 	return nil
 }
 
-func GetAllCategories() ([]models.Category, error) {
+func (s *GormStore) GetAllCategories(ctx context.Context) ([]models.Category, error) {
 	var categories []models.Category
-	if err := db.Find(&categories).Error; err != nil {
+	if err := s.db.WithContext(ctx).Find(&categories).Error; err != nil {
 		return nil, fmt.Errorf("get all categories: %v", err)
 	}
 	return categories, nil
 }
 
-func GetBestSellers() ([]models.Product, error) {
+func (s *GormStore) GetBestSellers(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	if err := db.Where("isbestseller = ?", true).Find(&products).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("isbestseller = ?", true).Find(&products).Error; err != nil {
 		return nil, fmt.Errorf("get all products: %v", err)
 	}
 	return products, nil
 }
 
-func GetAllProducts() ([]models.Product, error) {
+func (s *GormStore) GetAllProducts(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	if err := db.Find(&products).Error; err != nil {
+	if err := s.db.WithContext(ctx).Find(&products).Error; err != nil {
 		return nil, fmt.Errorf("get all products: %v", err)
 	}
 	return products, nil
 }
 
-func GetProducts(category string) ([]models.Product, error) {
+func (s *GormStore) GetProduct(ctx context.Context, id uint) (models.Product, error) {
+	var product models.Product
+	if err := s.db.WithContext(ctx).First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return product, fmt.Errorf("GetProduct: %w", detailed(ErrNotFound, "no product found for ID %d", id))
+		}
+		return product, fmt.Errorf("GetProduct: %v", err)
+	}
+	return product, nil
+}
+
+func (s *GormStore) GetProducts(ctx context.Context, category string) ([]models.Product, error) {
 	var products []models.Product
-	if err := db.Where("category = ?", category).Find(&products).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("category = ?", category).Find(&products).Error; err != nil {
 		return products, fmt.Errorf("GetUserByEmail: %v", err)
 	}
 	return products, nil
 }
 
-func AddCategory(category models.Category) error {
-	if err := db.Create(&category).Error; err != nil {
-		return fmt.Errorf("AddCategory: %v", err)
+func (s *GormStore) AddCategory(ctx context.Context, category models.Category) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Create(&category).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.CategoryChanged{Name: category.Name})
+	})
+	if err != nil {
+		return fmt.Errorf("AddCategory: %w", translate(err))
 	}
 	return nil
 }
 
-func AddProduct(product models.Product) error {
-	if err := db.Create(&product).Error; err != nil {
-		return fmt.Errorf("AddProduct: %v", err)
+func (s *GormStore) AddProduct(ctx context.Context, product models.Product) error {
+	product.TrackNewStock()
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Create(&product).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.ProductChanged{ProductID: product.ID, Created: true})
+	})
+	if err != nil {
+		return fmt.Errorf("AddProduct: %w", translate(err))
 	}
 	return nil
 }
 
-func GetUserCart(id string) (models.Cart, error) {
+// ErrInsufficientStock is wrapped by errors taking more of a product out of
+// stock than there is
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// AdjustStock changes the stock in a single statement, so that it can't race
+// orders taking products out of it. The product's stock is tracked from then
+// on.
+func (s *GormStore) AdjustStock(ctx context.Context, productID uint, delta int) (models.Product, error) {
+	var product models.Product
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		db := tx.db.WithContext(ctx)
+		result := db.Model(&models.Product{}).Where("id = ? AND stock + ? >= 0", productID, delta).
+			Updates(map[string]interface{}{"stock": gorm.Expr("stock + ?", delta), "stock_tracked": true})
+		if result.Error != nil {
+			return result.Error
+		}
+		err := db.Where("id = ?", productID).First(&product).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return detailed(ErrNotFound, "no product found for ID %d", productID)
+		} else if err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return detailed(ErrInsufficientStock, "product %d has %d in stock", productID, product.Stock)
+		}
+		return tx.recordEvent(ctx, models.ProductChanged{ProductID: productID})
+	})
+	if err != nil {
+		return product, fmt.Errorf("AdjustStock: %w", err)
+	}
+	return product, nil
+}
+
+func (s *GormStore) GetUserCart(ctx context.Context, id string) (models.Cart, error) {
 	var cart models.Cart
-	err := db.Preload("Items.Product").Where("user_id = ?", id).First(&cart).Error
+	err := s.db.WithContext(ctx).Preload("Items.Product").Where("user_id = ?", id).First(&cart).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return cart, fmt.Errorf("GetUserCart: no cart found for user ID %s", id)
+			return cart, fmt.Errorf("GetUserCart: %w", detailed(ErrNotFound, "no cart found for user ID %s", id))
 		}
 		return cart, fmt.Errorf("GetUserCart: %v", err)
 	}
 	return cart, nil
 }
 
-func GetUserOrders(id string) ([]models.Order, error) {
+func (s *GormStore) GetUserOrders(ctx context.Context, id string) ([]models.Order, error) {
 	var orders []models.Order
-	err := db.Preload("OrderItems.Product").Where("user_id = ?", id).Find(&orders).Error
+	err := s.db.WithContext(ctx).Preload("OrderItems.Product").Preload("CreditNotes").Where("user_id = ?", id).Find(&orders).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return orders, fmt.Errorf("GetUserOrders: no orders found for user ID %s", id)
-		}
 		return orders, fmt.Errorf("GetUserOrders: %v", err)
 	}
 	return orders, nil
 }
 
-func GetAllOrders() ([]models.Order, error) {
+func (s *GormStore) GetOrdersByUserIDs(ctx context.Context, userIDs []string) ([]models.Order, error) {
 	var orders []models.Order
-	err := db.Preload("OrderItems.Product").Find(&orders).Error
+	err := s.db.WithContext(ctx).Preload("OrderItems.Product").Preload("CreditNotes").Where("user_id IN ?", userIDs).Order("id").Find(&orders).Error
+	if err != nil {
+		return orders, fmt.Errorf("GetOrdersByUserIDs: %v", err)
+	}
+	return orders, nil
+}
+
+func (s *GormStore) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	var orders []models.Order
+	err := s.db.WithContext(ctx).Preload("OrderItems.Product").Preload("CreditNotes").Find(&orders).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return orders, fmt.Errorf("GetAllOrders: no orders found")
-		}
 		return orders, fmt.Errorf("GetAllOrders: %v", err)
 	}
 	return orders, nil
 }
 
-func AddItemToCart(userID string, productID uint, quantity int) error {
+// ErrInvalidCartItem is wrapped by errors caused by a cart change that isn't
+// allowed, as opposed to a database failure.
+var ErrInvalidCartItem = errors.New("invalid cart item")
+
+// ErrEmptyCart is wrapped by errors placing an order with nothing in the cart
+var ErrEmptyCart = errors.New("cart is empty")
+
+// getOrCreateCart returns the user's cart, creating an empty one if needed
+func (s *GormStore) getOrCreateCart(ctx context.Context, userID string) (models.Cart, error) {
 	var cart models.Cart
-	err := db.Where("user_id = ?", userID).First(&cart).Error
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&cart).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return cart, err
+		}
+		// Create a new cart if none exists
+		cart = models.Cart{UserID: userID}
+		if err := s.db.WithContext(ctx).Create(&cart).Error; err != nil {
+			return cart, fmt.Errorf("failed to create new cart: %v", err)
+		}
+	}
+	return cart, nil
+}
+
+// touchCart marks the cart as active, which is what abandoned cart detection
+// goes by, and records that it was updated.
+func (s *GormStore) touchCart(ctx context.Context, cart models.Cart) error {
+	if err := s.db.WithContext(ctx).Model(&models.Cart{}).Where("id = ?", cart.ID).Update("updated_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to touch cart: %v", err)
+	}
+	return s.recordEvent(ctx, models.CartUpdated{OwnerID: cart.UserID, CartID: cart.ID})
+}
+
+// getSellableProduct returns the product if it exists and is on sale
+func (s *GormStore) getSellableProduct(ctx context.Context, productID uint) (models.Product, error) {
+	var product models.Product
+	err := s.db.WithContext(ctx).Where("id = ?", productID).First(&product).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Create a new cart if none exists
-			cart = models.Cart{UserID: userID}
-			if err := db.Create(&cart).Error; err != nil {
-				return fmt.Errorf("AddItemToCart: failed to create new cart: %v", err)
-			}
-		} else {
-			return fmt.Errorf("AddItemToCart: %v", err)
+			return product, detailed(ErrInvalidCartItem, "product ID %d not found", productID)
 		}
+		return product, err
+	}
+	if product.Disabled {
+		return product, detailed(ErrInvalidCartItem, "product ID %d is not available", productID)
+	}
+	return product, nil
+}
+
+func (s *GormStore) AddItemToCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.transaction(ctx, func(tx *GormStore) error {
+		return tx.addItemToCart(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *GormStore) addItemToCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("AddItemToCart: %w", detailed(ErrInvalidCartItem, "quantity must be positive"))
+	}
+	product, err := s.getSellableProduct(ctx, productID)
+	if err != nil {
+		return fmt.Errorf("AddItemToCart: %w", err)
+	}
+	cart, err := s.getOrCreateCart(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("AddItemToCart: %v", err)
 	}
 
 	// Check if the product is already in the cart
 	var item models.CartItem
-	err = db.Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&item).Error
+	err = s.db.WithContext(ctx).Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&item).Error
 	if err == nil {
 		// Update quantity if the item exists
+		if item.Quantity+quantity > models.MaxCartItemQuantity {
+			return fmt.Errorf("AddItemToCart: %w", detailed(ErrInvalidCartItem, "at most %d per item", models.MaxCartItemQuantity))
+		}
 		item.Quantity += quantity
-		return db.Save(&item).Error
+		item.UnitPrice = product.Price
+		if err := s.db.WithContext(ctx).Save(&item).Error; err != nil {
+			return fmt.Errorf("AddItemToCart: %v", err)
+		}
+		return s.touchCart(ctx, cart)
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("AddItemToCart: %v", err)
 	}
 
+	if quantity > models.MaxCartItemQuantity {
+		return fmt.Errorf("AddItemToCart: %w", detailed(ErrInvalidCartItem, "at most %d per item", models.MaxCartItemQuantity))
+	}
+
 	// Add new item to the cart
-	newItem := models.CartItem{CartID: cart.ID, ProductID: productID, Quantity: quantity}
-	return db.Create(&newItem).Error
+	newItem := models.CartItem{CartID: cart.ID, ProductID: productID, Quantity: quantity, UnitPrice: product.Price}
+	if err := s.db.WithContext(ctx).Create(&newItem).Error; err != nil {
+		return fmt.Errorf("AddItemToCart: %v", err)
+	}
+	return s.touchCart(ctx, cart)
 }
 
-func RemoveItemFromCart(userID string, productID uint, quantity int) error {
+// SetCartItemQuantity sets the quantity of a product in the cart, adding the
+// line if it's missing and removing it when quantity is zero.
+func (s *GormStore) SetCartItemQuantity(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.transaction(ctx, func(tx *GormStore) error {
+		return tx.setCartItemQuantity(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *GormStore) setCartItemQuantity(ctx context.Context, userID string, productID uint, quantity int) error {
+	if quantity < 0 || quantity > models.MaxCartItemQuantity {
+		return fmt.Errorf("SetCartItemQuantity: %w", detailed(ErrInvalidCartItem, "quantity must be between 0 and %d", models.MaxCartItemQuantity))
+	}
+	if quantity == 0 {
+		err := s.removeItemFromCart(ctx, userID, productID, models.MaxCartItemQuantity)
+		if err != nil && !errors.Is(err, ErrInvalidCartItem) {
+			return fmt.Errorf("SetCartItemQuantity: %w", err)
+		}
+		return nil
+	}
+
+	product, err := s.getSellableProduct(ctx, productID)
+	if err != nil {
+		return fmt.Errorf("SetCartItemQuantity: %w", err)
+	}
+	cart, err := s.getOrCreateCart(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("SetCartItemQuantity: %v", err)
+	}
+
+	var item models.CartItem
+	err = s.db.WithContext(ctx).Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("SetCartItemQuantity: %v", err)
+	}
+	item.CartID = cart.ID
+	item.ProductID = productID
+	item.Quantity = quantity
+	item.UnitPrice = product.Price
+	if err := s.db.WithContext(ctx).Save(&item).Error; err != nil {
+		return fmt.Errorf("SetCartItemQuantity: %v", err)
+	}
+	return s.touchCart(ctx, cart)
+}
+
+func (s *GormStore) RemoveItemFromCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.transaction(ctx, func(tx *GormStore) error {
+		return tx.removeItemFromCart(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *GormStore) removeItemFromCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "quantity must be positive"))
+	}
 	var cart models.Cart
 
 	// Find the cart for the user
-	err := db.Where("user_id = ?", userID).First(&cart).Error
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&cart).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("RemoveItemFromCart: no cart found for user ID %s", userID)
+			return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "no cart found for user ID %s", userID))
 		}
 		return fmt.Errorf("RemoveItemFromCart: %v", err)
 	}
 
 	// Find the item in the cart
 	var item models.CartItem
-	err = db.Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&item).Error
+	err = s.db.WithContext(ctx).Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&item).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("RemoveItemFromCart: product ID %d not found in cart", productID)
+			return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "product ID %d not found in cart", productID))
 		}
 		return fmt.Errorf("RemoveItemFromCart: %v", err)
 	}
@@ -249,34 +479,56 @@ func RemoveItemFromCart(userID string, productID uint, quantity int) error {
 	// Adjust quantity or remove item
 	if quantity >= item.Quantity {
 		// Remove the item entirely if quantity to remove is greater than or equal to current quantity
-		if err := db.Delete(&item).Error; err != nil {
+		if err := s.db.WithContext(ctx).Delete(&item).Error; err != nil {
 			return fmt.Errorf("RemoveItemFromCart: failed to remove item: %v", err)
 		}
 	} else {
 		// Decrease the quantity
 		item.Quantity -= quantity
-		if err := db.Save(&item).Error; err != nil {
+		if err := s.db.WithContext(ctx).Save(&item).Error; err != nil {
 			return fmt.Errorf("RemoveItemFromCart: failed to update item quantity: %v", err)
 		}
 	}
 
-	return nil
+	return s.touchCart(ctx, cart)
+}
+
+// PlaceOrder turns the cart of details.UserID into a pending order. The
+// payment method, shipping details, coupon code and contact email are taken
+// from details; everything else is computed from the cart. The order, the
+// stock taken for it and the coupon redeemed are written in one transaction.
+// The cart is left as it is until the order's payment is authorized (see
+// RecordPaymentTransaction).
+func (s *GormStore) PlaceOrder(ctx context.Context, details models.Order) (models.Order, error) {
+	var order models.Order
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var err error
+		order, err = tx.placeOrder(ctx, details)
+		return err
+	})
+	return order, err
 }
 
-func PlaceOrder(userID string, paymentMethod string, shippingDetails string, couponCode string) error {
+func (s *GormStore) placeOrder(ctx context.Context, details models.Order) (models.Order, error) {
+	userID := details.UserID
 
 	// Step 1: Retrieve the user's cart
 	var cart models.Cart
-	err := db.Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
+	err := s.db.WithContext(ctx).Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("PlaceOrder: no cart found for user ID %s", userID)
+			return models.Order{}, fmt.Errorf("PlaceOrder: no cart found for user ID %s: %w", userID, ErrEmptyCart)
 		}
-		return fmt.Errorf("PlaceOrder: error fetching cart: %v", err)
+		return models.Order{}, fmt.Errorf("PlaceOrder: error fetching cart: %v", err)
 	}
 
 	if len(cart.Items) == 0 {
-		return fmt.Errorf("PlaceOrder: cart is empty")
+		return models.Order{}, fmt.Errorf("PlaceOrder: %w", ErrEmptyCart)
+	}
+	for _, cartItem := range cart.Items {
+		if cartItem.Product.ID == 0 || cartItem.Product.Disabled {
+			return models.Order{}, fmt.Errorf("PlaceOrder: %w", detailed(ErrInvalidCartItem, "product ID %d is no longer available", cartItem.ProductID))
+		}
 	}
 
 	// Step 2: Calculate total price and apply coupon discount
@@ -286,12 +538,12 @@ func PlaceOrder(userID string, paymentMethod string, shippingDetails string, cou
 	}
 
 	var discount float64 = 0
-	if couponCode != "" {
-		coupons := map[string]float64{
-			"SAVE10": 0.10,
-			"SAVE20": 0.20,
+	if discountRate := s.CouponDiscountRate(ctx, details.CouponCode); discountRate > 0 {
+		redeemed, err := s.redeemCoupon(ctx, details.CouponCode)
+		if err != nil {
+			return models.Order{}, fmt.Errorf("PlaceOrder: error redeeming coupon: %v", err)
 		}
-		if discountRate, exists := coupons[couponCode]; exists {
+		if redeemed {
 			discount = totalPrice * discountRate
 			totalPrice -= discount
 		}
@@ -301,19 +553,18 @@ func PlaceOrder(userID string, paymentMethod string, shippingDetails string, cou
 
 	order := models.Order{
 		UserID:          userID,
-		PaymentMethod:   paymentMethod,
-		Status:          "Pending",
+		PaymentMethod:   details.PaymentMethod,
+		Status:          models.OrderStatusPending,
 		TotalPrice:      totalPrice,
 		Discount:        discount,
-		CouponCode:      couponCode,
-		ShippingDetails: shippingDetails,
+		CouponCode:      details.CouponCode,
+		ShippingDetails: details.ShippingDetails,
+		Email:           details.Email,
 	}
 
-	fmt.Println(order)
-
-	err = db.Create(&order).Error
+	err = s.db.WithContext(ctx).Create(&order).Error
 	if err != nil {
-		return fmt.Errorf("PlaceOrder: error creating order: %v", err)
+		return models.Order{}, fmt.Errorf("PlaceOrder: error creating order: %v", err)
 	}
 
 	// Step 4: Add items from the cart to the order
@@ -330,62 +581,244 @@ func PlaceOrder(userID string, paymentMethod string, shippingDetails string, cou
 		orderItems = append(orderItems, orderItem)
 	}
 
-	err = db.Create(&orderItems).Error
+	err = s.db.WithContext(ctx).Create(&orderItems).Error
 	if err != nil {
-		return fmt.Errorf("PlaceOrder: error adding items to order: %v", err)
+		return models.Order{}, fmt.Errorf("PlaceOrder: error adding items to order: %v", err)
+	}
+	order.OrderItems = orderItems
+
+	// Take the ordered quantities out of stock, failing the order if there
+	// isn't enough of a product
+	var taken []uint
+	for _, item := range orderItems {
+		if !item.Product.StockTracked {
+			continue
+		}
+		result := s.db.WithContext(ctx).Model(&models.Product{}).Where("id = ? AND stock >= ?", item.ProductID, item.Quantity).
+			Update("stock", gorm.Expr("stock - ?", item.Quantity))
+		if result.Error != nil {
+			return models.Order{}, fmt.Errorf("PlaceOrder: error updating stock: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.Order{}, fmt.Errorf("PlaceOrder: %w", detailed(ErrInsufficientStock, "there are fewer than %d of product ID %d", item.Quantity, item.ProductID))
+		}
+		taken = append(taken, item.ProductID)
+	}
+	if len(taken) > 0 {
+		if err := s.recordEvent(ctx, models.StockChanged{ProductIDs: taken}); err != nil {
+			return models.Order{}, fmt.Errorf("PlaceOrder: %v", err)
+		}
 	}
 
-	var user models.User
-	err = db.Where("ID = ?", userID).First(&user).Error
+	return order, nil
+}
+
+// RemoveCartItems doesn't touch the cart, since what's left in it hasn't been
+// changed by its owner
+func (s *GormStore) RemoveCartItems(ctx context.Context, owner string, itemIDs []uint) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var cart models.Cart
+		err := tx.db.WithContext(ctx).Where("user_id = ?", owner).First(&cart).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Merged into another cart since
+		} else if err != nil {
+			return err
+		}
+		result := tx.db.WithContext(ctx).Where("cart_id = ? AND id IN ?", cart.ID, itemIDs).Delete(&models.CartItem{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.recordEvent(ctx, models.CartUpdated{OwnerID: owner, CartID: cart.ID})
+	})
 	if err != nil {
+		return fmt.Errorf("RemoveCartItems: %v", err)
+	}
+	return nil
+}
+
+// MergeCarts moves the items of one cart into another, typically a guest's
+// cart into the cart of the user they logged in as. Lines for a product that
+// is in both carts are combined according to rule (one of models.CartMerge*).
+// The source cart is deleted afterwards.
+func (s *GormStore) MergeCarts(ctx context.Context, fromOwner string, toOwner string, rule string) error {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		db := tx.db.WithContext(ctx)
+		var from models.Cart
+		err := db.Preload("Items").Where("user_id = ?", fromOwner).First(&from).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("PlaceOrder: no record found for user ID %s", userID)
+			return nil // Nothing to merge
+		} else if err != nil {
+			return err
+		}
+		to, err := tx.getOrCreateCart(ctx, toOwner)
+		if err != nil {
+			return err
 		}
+
+		for _, guestItem := range from.Items {
+			var item models.CartItem
+			err := db.Where("cart_id = ? AND product_id = ?", to.ID, guestItem.ProductID).First(&item).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				item = models.CartItem{CartID: to.ID, ProductID: guestItem.ProductID, Quantity: guestItem.Quantity, UnitPrice: guestItem.UnitPrice}
+			} else if err != nil {
+				return err
+			} else if !mergeCartItem(&item, guestItem, rule) {
+				continue
+			}
+			if err := db.Save(&item).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := db.Where("cart_id = ?", from.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		// Hard delete so the unique owner ID can't collide with a new guest cart
+		if err := db.Unscoped().Delete(&from).Error; err != nil {
+			return err
+		}
+		return tx.touchCart(ctx, to)
+	})
+	if err != nil {
+		return fmt.Errorf("MergeCarts: %v", err)
 	}
-	user.OrdersCount++
-	SaveUser(user)
+	return nil
+}
 
-	// Step 5: Clear the user's cart
-	err = db.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error
+// mergeCartItem combines a line from the source cart into the matching line
+// of the destination cart, reporting false if rule keeps the destination line
+// as it was.
+func mergeCartItem(item *models.CartItem, from models.CartItem, rule string) bool {
+	switch rule {
+	case models.CartMergeKeepUser:
+		return false
+	case models.CartMergeKeepGuest:
+		item.Quantity = from.Quantity
+		item.UnitPrice = from.UnitPrice
+	case models.CartMergeMax:
+		item.Quantity = max(item.Quantity, from.Quantity)
+	default:
+		item.Quantity += from.Quantity
+	}
+	item.Quantity = min(item.Quantity, models.MaxCartItemQuantity)
+	return true
+}
+
+// checkoutCoupons are the codes accepted at checkout for everyone, with the
+// percentage they take off
+var checkoutCoupons = map[string]float64{
+	"SAVE10": 10,
+	"SAVE20": 20,
+}
+
+// CouponDiscountRate returns the fraction of the order total a coupon code
+// takes off at checkout, or zero if the code isn't recognised. Besides the
+// fixed checkout codes, unexpired single-use coupons that haven't been
+// redeemed yet are accepted.
+func (s *GormStore) CouponDiscountRate(ctx context.Context, couponCode string) float64 {
+	if percent, ok := checkoutCoupons[couponCode]; ok || couponCode == "" {
+		return discountRate(percent)
+	}
+	var coupon models.CouponObject
+	err := s.db.WithContext(ctx).Where("code = ? AND single_use = ? AND redeemed_at IS NULL", couponCode, true).First(&coupon).Error
 	if err != nil {
-		return fmt.Errorf("PlaceOrder: error clearing cart items: %v", err)
+		return 0
 	}
+	return singleUseRate(coupon)
+}
 
-	return nil
+// singleUseRate returns the discount of an unredeemed single-use coupon as a
+// fraction, or zero once it has expired.
+func singleUseRate(coupon models.CouponObject) float64 {
+	if coupon.ExpiresAt != nil && coupon.ExpiresAt.Before(time.Now()) {
+		return 0
+	}
+	return discountRate(coupon.Discount)
+}
+
+// discountRate turns a coupon's percentage into the fraction it takes off
+func discountRate(percent float64) float64 {
+	return min(max(percent, 0), 100) / 100
+}
+
+// redeemCoupon uses up a single-use coupon, reporting false if it had already
+// been redeemed. Fixed checkout codes can be used any number of times.
+func (s *GormStore) redeemCoupon(ctx context.Context, couponCode string) (bool, error) {
+	if _, ok := checkoutCoupons[couponCode]; ok {
+		return true, nil
+	}
+	result := s.db.WithContext(ctx).Model(&models.CouponObject{}).
+		Where("code = ? AND single_use = ? AND redeemed_at IS NULL", couponCode, true).
+		Update("redeemed_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// GenerateCoupon creates a single-use coupon with a random code, taking the
+// given percentage off an order placed before it expires.
+func (s *GormStore) GenerateCoupon(ctx context.Context, discount float64, validFor time.Duration) (models.CouponObject, error) {
+	coupon, err := newSingleUseCoupon(discount, validFor)
+	if err != nil {
+		return coupon, fmt.Errorf("GenerateCoupon: %v", err)
+	}
+	if err := s.db.WithContext(ctx).Create(&coupon).Error; err != nil {
+		return coupon, fmt.Errorf("GenerateCoupon: %v", err)
+	}
+	return coupon, nil
+}
+
+func newSingleUseCoupon(discount float64, validFor time.Duration) (models.CouponObject, error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return models.CouponObject{}, err
+	}
+	expiresAt := time.Now().Add(validFor)
+	return models.CouponObject{
+		Code:      "CART-" + base32.StdEncoding.EncodeToString(raw),
+		Discount:  discount,
+		SingleUse: true,
+		ExpiresAt: &expiresAt,
+	}, nil
 }
 
-func AddCoupon(coupon models.CouponObject) error {
-	if err := db.Create(&coupon).Error; err != nil {
+func (s *GormStore) AddCoupon(ctx context.Context, coupon models.CouponObject) error {
+	err := s.db.WithContext(ctx).Create(&coupon).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("AddCoupon: %w", detailed(ErrConflict, "coupon %s already exists", coupon.Code))
+	} else if err != nil {
 		return fmt.Errorf("AddCoupon: %v", err)
 	}
 	return nil
 }
 
-func SaveCoupon(coupon models.CouponObject) error {
-	if err := db.Save(&coupon).Error; err != nil {
-		return fmt.Errorf("SaveCoupon: %v", err)
+func (s *GormStore) SaveCoupon(ctx context.Context, coupon models.CouponObject) error {
+	if err := s.db.WithContext(ctx).Save(&coupon).Error; err != nil {
+		return fmt.Errorf("SaveCoupon: %w", translate(err))
 	}
 	return nil
 }
 
-func GetAllCoupons() ([]models.CouponObject, error) {
+func (s *GormStore) GetAllCoupons(ctx context.Context) ([]models.CouponObject, error) {
 	var coupon []models.CouponObject
-	if err := db.Find(&coupon).Error; err != nil {
+	if err := s.db.WithContext(ctx).Find(&coupon).Error; err != nil {
 		return nil, fmt.Errorf("get all coupon: %v", err)
 	}
 	return coupon, nil
 }
 
-func GetCoupon(code string) (models.CouponObject, error) {
+func (s *GormStore) GetCoupon(ctx context.Context, code string) (models.CouponObject, error) {
 	var coupon models.CouponObject
-	if err := db.Where("code = ?", code).First(&coupon).Error; err != nil {
-		return coupon, fmt.Errorf("GetCoupon: %v", err)
+	if err := s.db.WithContext(ctx).Where("code = ?", code).First(&coupon).Error; err != nil {
+		return coupon, fmt.Errorf("GetCoupon: %w", translate(err))
 	}
 	return coupon, nil
 }
 
-func DeleteCoupon(coupon models.CouponObject) error {
-	if err := db.Where("code = ?", coupon.Code).Delete(&coupon).Error; err != nil {
+// DeleteCoupon removes the coupon for good, so its code can be used again
+func (s *GormStore) DeleteCoupon(ctx context.Context, coupon models.CouponObject) error {
+	if err := s.db.WithContext(ctx).Unscoped().Where("code = ?", coupon.Code).Delete(&coupon).Error; err != nil {
 		return fmt.Errorf("DeleteCoupon: %v", err)
 	}
 	return nil
@@ -0,0 +1,1399 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// MemoryStore implements Store in memory. Nothing is persisted; it's meant for
+// tests and for trying the API out without a database.
+type MemoryStore struct {
+	mu           sync.Mutex
+	lastID       uint
+	users        map[uint]models.User
+	categories   map[uint]models.Category
+	products     map[uint]models.Product
+	carts        map[string]models.Cart // By owner ID
+	orders       map[uint]models.Order
+	payments     map[uint]models.Payment
+	returns      map[uint]models.ReturnRequest
+	coupons      map[uint]models.CouponObject
+	abandonments map[uint]models.CartAbandonment
+	webhooks     map[uint]models.WebhookSubscription
+	deliveries   map[uint]models.WebhookDelivery
+	attempts     map[uint]models.WebhookAttempt
+	outbox       map[uint]models.OutboxEvent
+	processed    map[processedKey]time.Time // When each was marked
+}
+
+// processedKey identifies an event a subscriber has processed
+type processedKey struct {
+	subscriber, key string
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:        make(map[uint]models.User),
+		categories:   make(map[uint]models.Category),
+		products:     make(map[uint]models.Product),
+		carts:        make(map[string]models.Cart),
+		orders:       make(map[uint]models.Order),
+		payments:     make(map[uint]models.Payment),
+		returns:      make(map[uint]models.ReturnRequest),
+		coupons:      make(map[uint]models.CouponObject),
+		abandonments: make(map[uint]models.CartAbandonment),
+		webhooks:     make(map[uint]models.WebhookSubscription),
+		deliveries:   make(map[uint]models.WebhookDelivery),
+		attempts:     make(map[uint]models.WebhookAttempt),
+		outbox:       make(map[uint]models.OutboxEvent),
+		processed:    make(map[processedKey]time.Time),
+	}
+}
+
+// newModel returns a fresh ID and creation time for a record. IDs are unique
+// across every kind of record, which is fine since nothing relies on them
+// being sequential.
+func (m *MemoryStore) newModel() (id uint, now time.Time) {
+	m.lastID++
+	return m.lastID, time.Now()
+}
+
+// sortedByID returns the values of records in ID order
+func sortedByID[T any](records map[uint]T) []T {
+	ids := make([]uint, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	values := make([]T, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, records[id])
+	}
+	return values
+}
+
+func parseID(id string) uint {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(n)
+}
+
+func (m *MemoryStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, fmt.Errorf("GetUserByEmail: %w", ErrNotFound)
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id string) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[parseID(id)]
+	if !ok {
+		return user, fmt.Errorf("GetUserByID: %w", ErrNotFound)
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedByID(m.users), nil
+}
+
+func (m *MemoryStore) GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[parseID(id)] = true
+	}
+	users := []models.User{}
+	for _, user := range sortedByID(m.users) {
+		if wanted[user.ID] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) AddUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.users {
+		if existing.Email == user.Email || existing.Username == user.Username {
+			return fmt.Errorf("AddUser: %w", detailed(ErrConflict, "user already exists"))
+		}
+	}
+	user.ID, user.CreatedAt = m.newModel()
+	user.UpdatedAt = user.CreatedAt
+	m.users[user.ID] = user
+	return m.recordEvent(ctx, models.UserRegistered{UserID: user.ID, Username: user.Username, Email: user.Email})
+}
+
+func (m *MemoryStore) SaveUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user.ID == 0 {
+		user.ID, user.CreatedAt = m.newModel()
+	}
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+	return m.recordEvent(ctx, models.UserChanged{UserID: user.ID})
+}
+
+func (m *MemoryStore) IncrementOrdersCount(ctx context.Context, userID string, orderID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := processedKey{countOrderSubscriber, strconv.FormatUint(uint64(orderID), 10)}
+	if _, ok := m.processed[key]; ok {
+		return nil
+	}
+	user, ok := m.users[parseID(userID)]
+	if !ok {
+		return fmt.Errorf("IncrementOrdersCount: %w", detailed(ErrNotFound, "no user found for ID %s", userID))
+	}
+	m.processed[key] = time.Now()
+	user.OrdersCount++
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+	return m.recordEvent(ctx, models.UserChanged{UserID: user.ID})
+}
+
+func (m *MemoryStore) DeleteUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.users, user.ID)
+	return m.recordEvent(ctx, models.UserChanged{UserID: user.ID})
+}
+
+func (m *MemoryStore) GetAllCategories(ctx context.Context) ([]models.Category, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedByID(m.categories), nil
+}
+
+func (m *MemoryStore) GetBestSellers(ctx context.Context) ([]models.Product, error) {
+	return m.filterProducts(func(product models.Product) bool { return product.Isbestseller })
+}
+
+func (m *MemoryStore) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	return m.filterProducts(func(models.Product) bool { return true })
+}
+
+func (m *MemoryStore) GetProducts(ctx context.Context, category string) ([]models.Product, error) {
+	return m.filterProducts(func(product models.Product) bool { return product.Category == category })
+}
+
+func (m *MemoryStore) GetProduct(ctx context.Context, id uint) (models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	product, ok := m.products[id]
+	if !ok {
+		return product, fmt.Errorf("GetProduct: %w", detailed(ErrNotFound, "no product found for ID %d", id))
+	}
+	return product, nil
+}
+
+func (m *MemoryStore) filterProducts(keep func(models.Product) bool) ([]models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	products := []models.Product{}
+	for _, product := range sortedByID(m.products) {
+		if keep(product) {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func (m *MemoryStore) AddCategory(ctx context.Context, category models.Category) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	category.ID, category.CreatedAt = m.newModel()
+	category.UpdatedAt = category.CreatedAt
+	m.categories[category.ID] = category
+	return m.recordEvent(ctx, models.CategoryChanged{Name: category.Name})
+}
+
+func (m *MemoryStore) AddProduct(ctx context.Context, product models.Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	product.TrackNewStock()
+	product.ID, product.CreatedAt = m.newModel()
+	product.UpdatedAt = product.CreatedAt
+	m.products[product.ID] = product
+	return m.recordEvent(ctx, models.ProductChanged{ProductID: product.ID, Created: true})
+}
+
+// withProducts returns a copy of the cart with each item's product loaded
+func (m *MemoryStore) withProducts(cart models.Cart) models.Cart {
+	items := make([]models.CartItem, len(cart.Items))
+	for i, item := range cart.Items {
+		item.Product = m.products[item.ProductID]
+		items[i] = item
+	}
+	cart.Items = items
+	return cart
+}
+
+func (m *MemoryStore) GetUserCart(ctx context.Context, id string) (models.Cart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cart, ok := m.carts[id]
+	if !ok {
+		return cart, fmt.Errorf("GetUserCart: %w", detailed(ErrNotFound, "no cart found for user ID %s", id))
+	}
+	return m.withProducts(cart), nil
+}
+
+func (m *MemoryStore) getOrCreateCart(userID string) models.Cart {
+	cart, ok := m.carts[userID]
+	if !ok {
+		cart = models.Cart{UserID: userID}
+		cart.ID, cart.CreatedAt = m.newModel()
+		cart.UpdatedAt = cart.CreatedAt
+		m.carts[userID] = cart
+	}
+	return cart
+}
+
+func (m *MemoryStore) getSellableProduct(productID uint) (models.Product, error) {
+	product, ok := m.products[productID]
+	if !ok {
+		return product, detailed(ErrInvalidCartItem, "product ID %d not found", productID)
+	}
+	if product.Disabled {
+		return product, detailed(ErrInvalidCartItem, "product ID %d is not available", productID)
+	}
+	return product, nil
+}
+
+// setCartItem stores item in the owner's cart, replacing the line for the same
+// product, and marks the cart as active.
+func (m *MemoryStore) setCartItem(cart models.Cart, item models.CartItem) {
+	item.Product = models.Product{}
+	item.UpdatedAt = time.Now()
+	items := make([]models.CartItem, 0, len(cart.Items)+1)
+	replaced := false
+	for _, existing := range cart.Items {
+		if existing.ProductID == item.ProductID {
+			if item.Quantity > 0 {
+				items = append(items, item)
+			}
+			replaced = true
+			continue
+		}
+		items = append(items, existing)
+	}
+	if !replaced && item.Quantity > 0 {
+		item.ID, item.CreatedAt = m.newModel()
+		item.CartID = cart.ID
+		items = append(items, item)
+	}
+	cart.Items = items
+	cart.UpdatedAt = time.Now()
+	m.carts[cart.UserID] = cart
+}
+
+func findCartItem(cart models.Cart, productID uint) (models.CartItem, bool) {
+	for _, item := range cart.Items {
+		if item.ProductID == productID {
+			return item, true
+		}
+	}
+	return models.CartItem{}, false
+}
+
+func (m *MemoryStore) AddItemToCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if quantity <= 0 {
+		return fmt.Errorf("AddItemToCart: %w", detailed(ErrInvalidCartItem, "quantity must be positive"))
+	}
+	product, err := m.getSellableProduct(productID)
+	if err != nil {
+		return fmt.Errorf("AddItemToCart: %w", err)
+	}
+	cart := m.getOrCreateCart(userID)
+	item, _ := findCartItem(cart, productID)
+	if item.Quantity+quantity > models.MaxCartItemQuantity {
+		return fmt.Errorf("AddItemToCart: %w", detailed(ErrInvalidCartItem, "at most %d per item", models.MaxCartItemQuantity))
+	}
+	item.ProductID = productID
+	item.Quantity += quantity
+	item.UnitPrice = product.Price
+	m.setCartItem(cart, item)
+	return m.recordEvent(ctx, models.CartUpdated{OwnerID: userID, CartID: cart.ID})
+}
+
+func (m *MemoryStore) SetCartItemQuantity(ctx context.Context, userID string, productID uint, quantity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if quantity < 0 || quantity > models.MaxCartItemQuantity {
+		return fmt.Errorf("SetCartItemQuantity: %w", detailed(ErrInvalidCartItem, "quantity must be between 0 and %d", models.MaxCartItemQuantity))
+	}
+	if quantity == 0 {
+		if cart, ok := m.carts[userID]; ok {
+			if _, ok := findCartItem(cart, productID); ok {
+				m.setCartItem(cart, models.CartItem{ProductID: productID})
+				return m.recordEvent(ctx, models.CartUpdated{OwnerID: userID, CartID: cart.ID})
+			}
+		}
+		return nil
+	}
+
+	product, err := m.getSellableProduct(productID)
+	if err != nil {
+		return fmt.Errorf("SetCartItemQuantity: %w", err)
+	}
+	cart := m.getOrCreateCart(userID)
+	item, _ := findCartItem(cart, productID)
+	item.ProductID = productID
+	item.Quantity = quantity
+	item.UnitPrice = product.Price
+	m.setCartItem(cart, item)
+	return m.recordEvent(ctx, models.CartUpdated{OwnerID: userID, CartID: cart.ID})
+}
+
+func (m *MemoryStore) RemoveItemFromCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if quantity <= 0 {
+		return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "quantity must be positive"))
+	}
+	cart, ok := m.carts[userID]
+	if !ok {
+		return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "no cart found for user ID %s", userID))
+	}
+	item, ok := findCartItem(cart, productID)
+	if !ok {
+		return fmt.Errorf("RemoveItemFromCart: %w", detailed(ErrInvalidCartItem, "product ID %d not found in cart", productID))
+	}
+	item.Quantity = max(item.Quantity-quantity, 0)
+	m.setCartItem(cart, item)
+	return m.recordEvent(ctx, models.CartUpdated{OwnerID: userID, CartID: cart.ID})
+}
+
+func (m *MemoryStore) MergeCarts(ctx context.Context, fromOwner string, toOwner string, rule string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, ok := m.carts[fromOwner]
+	if !ok {
+		return nil // Nothing to merge
+	}
+	to := m.getOrCreateCart(toOwner)
+	for _, guestItem := range from.Items {
+		item, ok := findCartItem(to, guestItem.ProductID)
+		if !ok {
+			item = models.CartItem{ProductID: guestItem.ProductID, Quantity: guestItem.Quantity, UnitPrice: guestItem.UnitPrice}
+			item.Quantity = min(item.Quantity, models.MaxCartItemQuantity)
+		} else if !mergeCartItem(&item, guestItem, rule) {
+			continue
+		}
+		m.setCartItem(to, item)
+		to = m.carts[toOwner]
+	}
+	to.UpdatedAt = time.Now()
+	m.carts[toOwner] = to
+	delete(m.carts, fromOwner)
+	return m.recordEvent(ctx, models.CartUpdated{OwnerID: toOwner, CartID: to.ID})
+}
+
+// RemoveCartItems is like GormStore.RemoveCartItems
+func (m *MemoryStore) RemoveCartItems(ctx context.Context, owner string, itemIDs []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cart, ok := m.carts[owner]
+	if !ok {
+		return nil
+	}
+	items := make([]models.CartItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		if !slices.Contains(itemIDs, item.ID) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == len(cart.Items) {
+		return nil
+	}
+	cart.Items = items
+	m.carts[owner] = cart
+	return m.recordEvent(ctx, models.CartUpdated{OwnerID: owner, CartID: cart.ID})
+}
+
+func (m *MemoryStore) FindAbandonedCarts(ctx context.Context, idleFor time.Duration) ([]models.Cart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := time.Now().Add(-idleFor)
+	var carts []models.Cart
+	for _, cart := range m.carts {
+		if len(cart.Items) == 0 || !cart.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		recorded := false
+		for _, event := range m.abandonments {
+			if event.CartID == cart.ID && !event.LastActivity.Before(cart.UpdatedAt) {
+				recorded = true
+			}
+		}
+		if !recorded {
+			carts = append(carts, m.withProducts(cart))
+		}
+	}
+	sort.Slice(carts, func(i, j int) bool { return carts[i].ID < carts[j].ID })
+	return carts, nil
+}
+
+func (m *MemoryStore) AddCartAbandonment(ctx context.Context, event models.CartAbandonment) (models.CartAbandonment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.ID, event.CreatedAt = m.newModel()
+	event.UpdatedAt = event.CreatedAt
+	m.abandonments[event.ID] = event
+	return event, nil
+}
+
+func (m *MemoryStore) SaveCartAbandonment(ctx context.Context, event models.CartAbandonment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if event.ID == 0 {
+		event.ID, event.CreatedAt = m.newModel()
+	}
+	event.UpdatedAt = time.Now()
+	m.abandonments[event.ID] = event
+	return nil
+}
+
+func (m *MemoryStore) GetCartAbandonments(ctx context.Context) ([]models.CartAbandonment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := sortedByID(m.abandonments)
+	// Newest first, as the GORM store returns them
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) PlaceOrder(ctx context.Context, details models.Order) (models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID := details.UserID
+
+	cart, ok := m.carts[userID]
+	if !ok {
+		return models.Order{}, fmt.Errorf("PlaceOrder: no cart found for user ID %s: %w", userID, ErrEmptyCart)
+	}
+	cart = m.withProducts(cart)
+	if len(cart.Items) == 0 {
+		return models.Order{}, fmt.Errorf("PlaceOrder: %w", ErrEmptyCart)
+	}
+	for _, cartItem := range cart.Items {
+		if cartItem.Product.ID == 0 || cartItem.Product.Disabled {
+			return models.Order{}, fmt.Errorf("PlaceOrder: %w", detailed(ErrInvalidCartItem, "product ID %d is no longer available", cartItem.ProductID))
+		}
+		// Checked before anything changes, as there's no transaction to undo it
+		if cartItem.Product.StockTracked && cartItem.Product.Stock < cartItem.Quantity {
+			return models.Order{}, fmt.Errorf("PlaceOrder: %w", detailed(ErrInsufficientStock, "there are fewer than %d of product ID %d", cartItem.Quantity, cartItem.ProductID))
+		}
+	}
+
+	var totalPrice float64 = 0
+	for _, cartItem := range cart.Items {
+		totalPrice += float64(cartItem.Quantity) * cartItem.Product.Price
+	}
+
+	var discount float64 = 0
+	if discountRate := m.couponDiscountRate(details.CouponCode); discountRate > 0 && m.redeemCoupon(details.CouponCode) {
+		discount = totalPrice * discountRate
+		totalPrice -= discount
+	}
+
+	order := models.Order{
+		UserID:          userID,
+		PaymentMethod:   details.PaymentMethod,
+		Status:          models.OrderStatusPending,
+		TotalPrice:      totalPrice,
+		Discount:        discount,
+		CouponCode:      details.CouponCode,
+		ShippingDetails: details.ShippingDetails,
+		Email:           details.Email,
+	}
+	order.ID, order.CreatedAt = m.newModel()
+	order.UpdatedAt = order.CreatedAt
+
+	var taken []uint
+	for _, cartItem := range cart.Items {
+		item := models.OrderItem{
+			OrderID:   order.ID,
+			ProductID: cartItem.ProductID,
+			Product:   cartItem.Product,
+			Quantity:  cartItem.Quantity,
+			Price:     cartItem.Product.Price,
+		}
+		item.ID, item.CreatedAt = m.newModel()
+		item.UpdatedAt = item.CreatedAt
+		order.OrderItems = append(order.OrderItems, item)
+
+		if product := m.products[item.ProductID]; product.StockTracked {
+			product.Stock -= item.Quantity
+			m.products[product.ID] = product
+			taken = append(taken, product.ID)
+		}
+	}
+	m.orders[order.ID] = order
+	if len(taken) > 0 {
+		if err := m.recordEvent(ctx, models.StockChanged{ProductIDs: taken}); err != nil {
+			return order, fmt.Errorf("PlaceOrder: %v", err)
+		}
+	}
+	return order, nil
+}
+
+// withOrderProducts returns a copy of the order with each item's product
+// loaded as it is now
+func (m *MemoryStore) withOrderProducts(order models.Order) models.Order {
+	items := make([]models.OrderItem, len(order.OrderItems))
+	for i, item := range order.OrderItems {
+		item.Product = m.products[item.ProductID]
+		items[i] = item
+	}
+	order.OrderItems = items
+	order.CreditNotes = append([]models.CreditNote(nil), order.CreditNotes...)
+	return order
+}
+
+func (m *MemoryStore) GetOrder(ctx context.Context, id string) (models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, ok := m.orders[parseID(id)]
+	if !ok {
+		return order, fmt.Errorf("GetOrder: %w", detailed(ErrNotFound, "no order found for ID %s", id))
+	}
+	return m.withOrderProducts(order), nil
+}
+
+func (m *MemoryStore) GetUserOrders(ctx context.Context, id string) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orders := []models.Order{}
+	for _, order := range sortedByID(m.orders) {
+		if order.UserID == id {
+			orders = append(orders, m.withOrderProducts(order))
+		}
+	}
+	return orders, nil
+}
+
+func (m *MemoryStore) GetOrdersByUserIDs(ctx context.Context, userIDs []string) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orders := []models.Order{}
+	for _, order := range sortedByID(m.orders) {
+		if slices.Contains(userIDs, order.UserID) {
+			orders = append(orders, m.withOrderProducts(order))
+		}
+	}
+	return orders, nil
+}
+
+func (m *MemoryStore) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orders := []models.Order{}
+	for _, order := range sortedByID(m.orders) {
+		orders = append(orders, m.withOrderProducts(order))
+	}
+	return orders, nil
+}
+
+func (m *MemoryStore) UpdateOrderStatus(ctx context.Context, id string, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, ok := m.orders[parseID(id)]
+	if !ok {
+		return fmt.Errorf("UpdateOrderStatus: %w", detailed(ErrNotFound, "no order found for ID %s", id))
+	}
+	if !models.CanTransition(order.Status, status) {
+		return fmt.Errorf("UpdateOrderStatus: %w", detailed(ErrInvalidTransition, "order %s can't move from %s to %s", id, order.Status, status))
+	}
+	if order.Status == status {
+		return nil
+	}
+	from := order.Status
+	order.Status = status
+	order.UpdatedAt = time.Now()
+	m.orders[order.ID] = order
+	return m.recordEvent(ctx, models.OrderStatusChanged{OrderID: order.ID, UserID: order.UserID, PreviousStatus: from, Status: status})
+}
+
+func (m *MemoryStore) AddPayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment.ID, payment.CreatedAt = m.newModel()
+	payment.UpdatedAt = payment.CreatedAt
+	m.payments[payment.ID] = payment
+	return payment, nil
+}
+
+func (m *MemoryStore) GetOrderPayment(ctx context.Context, orderID string) (models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest models.Payment
+	for _, payment := range m.payments {
+		if strconv.FormatUint(uint64(payment.OrderID), 10) == orderID && payment.ID > latest.ID {
+			latest = payment
+		}
+	}
+	if latest.ID == 0 {
+		return latest, fmt.Errorf("GetOrderPayment: %w", detailed(ErrNotFound, "no payment found for order ID %s", orderID))
+	}
+	latest.Transactions = append([]models.Transaction(nil), latest.Transactions...)
+	return latest, nil
+}
+
+func (m *MemoryStore) GetPaymentByRef(ctx context.Context, providerRef string) (models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, payment := range sortedByID(m.payments) {
+		if payment.ProviderRef == providerRef {
+			payment.Transactions = nil
+			return payment, nil
+		}
+	}
+	return models.Payment{}, fmt.Errorf("GetPaymentByRef: %w", detailed(ErrNotFound, "no payment found for reference %s", providerRef))
+}
+
+func (m *MemoryStore) GetProviderPayments(ctx context.Context, provider string) ([]models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var payments []models.Payment
+	for _, payment := range sortedByID(m.payments) {
+		if payment.Provider == provider {
+			payment.Transactions = nil
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+func (m *MemoryStore) RecordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, err := m.recordPaymentTransaction(ctx, payment, txn)
+	if err != nil {
+		return payment, fmt.Errorf("RecordPaymentTransaction: %v", err)
+	}
+	return payment, nil
+}
+
+// recordPaymentTransaction does the work of RecordPaymentTransaction with the
+// lock held, changing nothing if it fails
+func (m *MemoryStore) recordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error) {
+	stored, ok := m.payments[payment.ID]
+	if !ok {
+		return payment, fmt.Errorf("no payment found for ID %d", payment.ID)
+	}
+
+	applyTransaction(&payment, txn)
+	status, ok := orderStatusAfter(payment, txn)
+	if ok {
+		order, found := m.orders[payment.OrderID]
+		if !found {
+			return payment, fmt.Errorf("error fetching order: record not found")
+		}
+		if !models.CanTransition(order.Status, status) {
+			return payment, fmt.Errorf("order %d can't move from %s to %s", order.ID, order.Status, status)
+		}
+		if order.Status != status {
+			err := m.recordEvent(ctx, models.OrderStatusChanged{OrderID: order.ID, UserID: order.UserID, PreviousStatus: order.Status, Status: status})
+			if err != nil {
+				return payment, err
+			}
+		}
+		switch {
+		case models.PlacesOrder(order.Status, status):
+			if err := m.orderPlaced(ctx, order); err != nil {
+				return payment, err
+			}
+		case models.ReleasesOrder(order.Status, status):
+			if err := m.releaseOrder(ctx, order); err != nil {
+				return payment, err
+			}
+		}
+		order.Status = status
+		m.orders[order.ID] = order
+	}
+
+	txn.PaymentID = payment.ID
+	txn.ID, txn.CreatedAt = m.newModel()
+	txn.UpdatedAt = txn.CreatedAt
+	payment.Transactions = append(stored.Transactions, txn)
+	payment.UpdatedAt = time.Now()
+	m.payments[payment.ID] = payment
+	return payment, nil
+}
+
+// orderPlaced records OrderPlaced like GormStore.orderPlaced
+func (m *MemoryStore) orderPlaced(ctx context.Context, order models.Order) error {
+	event := models.OrderPlaced{OrderID: order.ID, UserID: order.UserID}
+	for _, cartItem := range m.carts[order.UserID].Items {
+		if order.HasProduct(cartItem.ProductID) {
+			event.CartItemIDs = append(event.CartItemIDs, cartItem.ID)
+		}
+	}
+	return m.recordEvent(ctx, event)
+}
+
+// releaseOrder gives back an order's stock and coupon like
+// GormStore.releaseOrder
+func (m *MemoryStore) releaseOrder(ctx context.Context, order models.Order) error {
+	if order.Discount > 0 {
+		for id, coupon := range m.coupons {
+			if coupon.Code == order.CouponCode && coupon.SingleUse {
+				coupon.RedeemedAt = nil
+				m.coupons[id] = coupon
+			}
+		}
+	}
+	return m.restock(ctx, order.OrderItems)
+}
+
+// restock puts items back in stock like GormStore.restock
+func (m *MemoryStore) restock(ctx context.Context, items []models.OrderItem) error {
+	var restocked []uint
+	for _, item := range items {
+		if product, ok := m.products[item.ProductID]; ok && product.StockTracked {
+			product.Stock += item.Quantity
+			m.products[product.ID] = product
+			restocked = append(restocked, product.ID)
+		}
+	}
+	if len(restocked) == 0 {
+		return nil
+	}
+	return m.recordEvent(ctx, models.StockChanged{ProductIDs: restocked})
+}
+
+func (m *MemoryStore) AddReturnRequest(ctx context.Context, request models.ReturnRequest) (models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, ok := m.orders[request.OrderID]
+	if !ok {
+		return request, fmt.Errorf("AddReturnRequest: %w", detailed(ErrInvalidReturn, "no order found for ID %d", request.OrderID))
+	}
+
+	// Quantities already claimed by returns that haven't been decided yet
+	var open []models.ReturnItem
+	for _, existing := range m.returns {
+		if existing.OrderID == order.ID &&
+			(existing.Status == models.ReturnStatusRequested || existing.Status == models.ReturnStatusApproved) {
+			open = append(open, existing.Items...)
+		}
+	}
+	request.Items = append([]models.ReturnItem(nil), request.Items...)
+	if err := checkReturnItems(order, open, &request); err != nil {
+		return request, fmt.Errorf("AddReturnRequest: %w", err)
+	}
+
+	request.Status = models.ReturnStatusRequested
+	request.ID, request.CreatedAt = m.newModel()
+	request.UpdatedAt = request.CreatedAt
+	for i := range request.Items {
+		request.Items[i].ID, request.Items[i].CreatedAt = m.newModel()
+		request.Items[i].ReturnRequestID = request.ID
+	}
+	m.returns[request.ID] = request
+	return request, nil
+}
+
+func (m *MemoryStore) GetReturnRequest(ctx context.Context, id string) (models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.returns[parseID(id)]
+	if !ok {
+		return request, fmt.Errorf("GetReturnRequest: %w", detailed(ErrNotFound, "no return found for ID %s", id))
+	}
+	return request, nil
+}
+
+func (m *MemoryStore) GetUserReturns(ctx context.Context, userID string) ([]models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests := []models.ReturnRequest{}
+	for _, request := range sortedByID(m.returns) {
+		if request.UserID == userID {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+func (m *MemoryStore) GetAllReturns(ctx context.Context) ([]models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedByID(m.returns), nil
+}
+
+func (m *MemoryStore) SaveReturnRequest(ctx context.Context, request models.ReturnRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.returns[request.ID]
+	if !ok {
+		return fmt.Errorf("SaveReturnRequest: %w", detailed(ErrNotFound, "no return found for ID %d", request.ID))
+	}
+	request.Items = stored.Items
+	request.UpdatedAt = time.Now()
+	m.returns[request.ID] = request
+	return nil
+}
+
+func (m *MemoryStore) DecideReturn(ctx context.Context, id string, status string, note string) (models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.returns[parseID(id)]
+	if !ok {
+		return request, fmt.Errorf("DecideReturn: %w", detailed(ErrNotFound, "no return found for ID %s", id))
+	}
+	if request.Status != models.ReturnStatusRequested {
+		return request, fmt.Errorf("DecideReturn: %w", detailed(ErrConflict, "return %s is already %s", id, request.Status))
+	}
+	request.Status, request.AdminNote = status, note
+	request.UpdatedAt = time.Now()
+	m.returns[request.ID] = request
+	return request, nil
+}
+
+func (m *MemoryStore) ReopenReturn(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.returns[parseID(id)]
+	if !ok || request.Status != models.ReturnStatusApproved || request.RefundRef != "" {
+		return fmt.Errorf("ReopenReturn: %w", detailed(ErrConflict, "return %s isn't approved and unrefunded", id))
+	}
+	request.Status = models.ReturnStatusRequested
+	request.UpdatedAt = time.Now()
+	m.returns[request.ID] = request
+	return nil
+}
+
+func (m *MemoryStore) NoteReturnRefund(ctx context.Context, id string, ref string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	request, ok := m.returns[parseID(id)]
+	if !ok || request.Status != models.ReturnStatusApproved || request.RefundRef != "" {
+		return fmt.Errorf("NoteReturnRefund: %w", detailed(ErrConflict, "return %s isn't approved and unrefunded", id))
+	}
+	request.RefundRef, request.RefundAmount = ref, amount
+	request.UpdatedAt = time.Now()
+	m.returns[request.ID] = request
+	return nil
+}
+
+func (m *MemoryStore) CompleteReturn(ctx context.Context, request models.ReturnRequest, payment models.Payment, refund models.Transaction, restock bool) (models.ReturnRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.orders[request.OrderID]; !ok {
+		return request, fmt.Errorf("CompleteReturn: no order found for ID %d", request.OrderID)
+	}
+	if stored, ok := m.returns[request.ID]; !ok || stored.Status != models.ReturnStatusApproved {
+		return request, fmt.Errorf("CompleteReturn: %w", detailed(ErrConflict, "return %d isn't approved", request.ID))
+	}
+	if _, err := m.recordPaymentTransaction(ctx, payment, refund); err != nil {
+		return request, fmt.Errorf("CompleteReturn: %v", err)
+	}
+	order := m.orders[request.OrderID] // With the status the refund moved it to
+
+	order.OrderItems = append([]models.OrderItem(nil), order.OrderItems...)
+	var returned []models.OrderItem
+	for _, item := range request.Items {
+		for i := range order.OrderItems {
+			if order.OrderItems[i].ID == item.OrderItemID {
+				order.OrderItems[i].Returned += item.Quantity
+			}
+		}
+		returned = append(returned, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	if restock {
+		if err := m.restock(ctx, returned); err != nil {
+			return request, fmt.Errorf("CompleteReturn: %v", err)
+		}
+	}
+
+	note := creditNoteFor(request, refund)
+	note.ID, note.CreatedAt = m.newModel()
+	note.UpdatedAt = note.CreatedAt
+	order.CreditNotes = append(append([]models.CreditNote(nil), order.CreditNotes...), note)
+	m.orders[order.ID] = order
+
+	stored := m.returns[request.ID]
+	stored.Status, stored.RefundAmount, stored.RefundRef = models.ReturnStatusRefunded, refund.Amount, refund.ProviderRef
+	stored.UpdatedAt = time.Now()
+	m.returns[request.ID] = stored
+	request.Status, request.RefundAmount, request.RefundRef = stored.Status, stored.RefundAmount, stored.RefundRef
+	request.UpdatedAt = stored.UpdatedAt
+	return request, nil
+}
+
+func (m *MemoryStore) findCoupon(code string) (models.CouponObject, bool) {
+	for _, coupon := range sortedByID(m.coupons) {
+		if coupon.Code == code {
+			return coupon, true
+		}
+	}
+	return models.CouponObject{}, false
+}
+
+func (m *MemoryStore) AddCoupon(ctx context.Context, coupon models.CouponObject) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.findCoupon(coupon.Code); ok {
+		return fmt.Errorf("AddCoupon: %w", detailed(ErrConflict, "coupon %s already exists", coupon.Code))
+	}
+	coupon.ID, coupon.CreatedAt = m.newModel()
+	coupon.UpdatedAt = coupon.CreatedAt
+	m.coupons[coupon.ID] = coupon
+	return nil
+}
+
+func (m *MemoryStore) SaveCoupon(ctx context.Context, coupon models.CouponObject) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if coupon.ID == 0 {
+		coupon.ID, coupon.CreatedAt = m.newModel()
+	}
+	coupon.UpdatedAt = time.Now()
+	m.coupons[coupon.ID] = coupon
+	return nil
+}
+
+func (m *MemoryStore) GetAllCoupons(ctx context.Context) ([]models.CouponObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedByID(m.coupons), nil
+}
+
+func (m *MemoryStore) GetCoupon(ctx context.Context, code string) (models.CouponObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	coupon, ok := m.findCoupon(code)
+	if !ok {
+		return coupon, fmt.Errorf("GetCoupon: %w", ErrNotFound)
+	}
+	return coupon, nil
+}
+
+func (m *MemoryStore) DeleteCoupon(ctx context.Context, coupon models.CouponObject) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, existing := range m.coupons {
+		if existing.Code == coupon.Code {
+			delete(m.coupons, id)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CouponDiscountRate(ctx context.Context, couponCode string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.couponDiscountRate(couponCode)
+}
+
+func (m *MemoryStore) couponDiscountRate(couponCode string) float64 {
+	if percent, ok := checkoutCoupons[couponCode]; ok || couponCode == "" {
+		return discountRate(percent)
+	}
+	for _, coupon := range m.coupons {
+		if coupon.Code == couponCode && coupon.SingleUse && coupon.RedeemedAt == nil {
+			return singleUseRate(coupon)
+		}
+	}
+	return 0
+}
+
+func (m *MemoryStore) redeemCoupon(couponCode string) bool {
+	if _, ok := checkoutCoupons[couponCode]; ok {
+		return true
+	}
+	for id, coupon := range m.coupons {
+		if coupon.Code == couponCode && coupon.SingleUse && coupon.RedeemedAt == nil {
+			now := time.Now()
+			coupon.RedeemedAt = &now
+			m.coupons[id] = coupon
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) GenerateCoupon(ctx context.Context, discount float64, validFor time.Duration) (models.CouponObject, error) {
+	coupon, err := newSingleUseCoupon(discount, validFor)
+	if err != nil {
+		return coupon, fmt.Errorf("GenerateCoupon: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	coupon.ID, coupon.CreatedAt = m.newModel()
+	coupon.UpdatedAt = coupon.CreatedAt
+	m.coupons[coupon.ID] = coupon
+	return coupon, nil
+}
+
+func (m *MemoryStore) UpsertCategory(ctx context.Context, category models.Category) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, existing := range m.categories {
+		if existing.Name == category.Name {
+			existing.Description, existing.Image = category.Description, category.Image
+			existing.UpdatedAt = time.Now()
+			m.categories[id] = existing
+			return false, m.recordEvent(ctx, models.CategoryChanged{Name: category.Name})
+		}
+	}
+	category.ID, category.CreatedAt = m.newModel()
+	category.UpdatedAt = category.CreatedAt
+	m.categories[category.ID] = category
+	return true, m.recordEvent(ctx, models.CategoryChanged{Name: category.Name})
+}
+
+func (m *MemoryStore) UpsertProduct(ctx context.Context, product models.Product) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.matchProduct(product); ok {
+		product.ID, product.CreatedAt = existing.ID, existing.CreatedAt
+		product.Stock, product.StockTracked = existing.Stock, existing.StockTracked
+		if product.SKU == "" {
+			product.SKU = existing.SKU
+		}
+		product.UpdatedAt = time.Now()
+		m.products[existing.ID] = product
+		return false, m.recordEvent(ctx, models.ProductChanged{ProductID: product.ID})
+	}
+	product.TrackNewStock()
+	product.ID, product.CreatedAt = m.newModel()
+	product.UpdatedAt = product.CreatedAt
+	m.products[product.ID] = product
+	return true, m.recordEvent(ctx, models.ProductChanged{ProductID: product.ID, Created: true})
+}
+
+func (m *MemoryStore) AdjustStock(ctx context.Context, productID uint, delta int) (models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	product, ok := m.products[productID]
+	if !ok {
+		return product, fmt.Errorf("AdjustStock: %w", detailed(ErrNotFound, "no product found for ID %d", productID))
+	}
+	if product.Stock+delta < 0 {
+		return product, fmt.Errorf("AdjustStock: %w", detailed(ErrInsufficientStock, "product %d has %d in stock", productID, product.Stock))
+	}
+	product.Stock += delta
+	product.StockTracked = true
+	product.UpdatedAt = time.Now()
+	m.products[productID] = product
+	return product, m.recordEvent(ctx, models.ProductChanged{ProductID: productID})
+}
+
+func (m *MemoryStore) MatchProduct(ctx context.Context, product models.Product) (models.Product, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.matchProduct(product)
+	return existing, ok, nil
+}
+
+// matchProduct finds the product with the same SKU, or failing that the same
+// name and no SKU, like GormStore.MatchProduct
+func (m *MemoryStore) matchProduct(product models.Product) (models.Product, bool) {
+	var byName []models.Product
+	for _, existing := range sortedByID(m.products) {
+		if product.SKU != "" && existing.SKU == product.SKU {
+			return existing, true
+		}
+		if existing.Name == product.Name && (product.SKU == "" || existing.SKU == "") {
+			byName = append(byName, existing)
+		}
+	}
+	if len(byName) == 0 {
+		return models.Product{}, false
+	}
+	return byName[0], true
+}
+
+func (m *MemoryStore) UpsertUser(ctx context.Context, user models.User) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, existing := range m.users {
+		if existing.Email == user.Email {
+			existing.Username, existing.Password, existing.Type = user.Username, user.Password, user.Type
+			existing.UpdatedAt = time.Now()
+			m.users[id] = existing
+			return false, m.recordEvent(ctx, models.UserChanged{UserID: id})
+		}
+	}
+	user.ID, user.CreatedAt = m.newModel()
+	user.UpdatedAt = user.CreatedAt
+	m.users[user.ID] = user
+	return true, nil
+}
+
+func (m *MemoryStore) UpsertCoupon(ctx context.Context, coupon models.CouponObject) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.findCoupon(coupon.Code); ok {
+		existing.Discount, existing.OrderFrequency = coupon.Discount, coupon.OrderFrequency
+		existing.SingleUse, existing.ExpiresAt = coupon.SingleUse, coupon.ExpiresAt
+		existing.UpdatedAt = time.Now()
+		m.coupons[existing.ID] = existing
+		return false, nil
+	}
+	coupon.ID, coupon.CreatedAt = m.newModel()
+	coupon.UpdatedAt = coupon.CreatedAt
+	m.coupons[coupon.ID] = coupon
+	return true, nil
+}
+
+func (m *MemoryStore) AddWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID, sub.CreatedAt = m.newModel()
+	sub.UpdatedAt = sub.CreatedAt
+	m.webhooks[sub.ID] = sub
+	return sub, nil
+}
+
+func (m *MemoryStore) GetWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedByID(m.webhooks), nil
+}
+
+func (m *MemoryStore) GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.webhooks[parseID(id)]
+	if !ok {
+		return sub, fmt.Errorf("GetWebhookSubscription: %w", ErrNotFound)
+	}
+	return sub, nil
+}
+
+func (m *MemoryStore) SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub.ID == 0 {
+		sub.ID, sub.CreatedAt = m.newModel()
+	}
+	sub.UpdatedAt = time.Now()
+	m.webhooks[sub.ID] = sub
+	return nil
+}
+
+func (m *MemoryStore) DeleteWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.webhooks, sub.ID)
+	return nil
+}
+
+func (m *MemoryStore) EnqueueWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, delivery := range deliveries {
+		delivery.ID, delivery.CreatedAt = m.newModel()
+		delivery.UpdatedAt = delivery.CreatedAt
+		if delivery.Status == "" {
+			delivery.Status = models.WebhookDeliveryPending
+		}
+		m.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.WebhookDelivery
+	for _, delivery := range sortedByID(m.deliveries) {
+		if delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b models.WebhookDelivery) int {
+		return a.NextAttemptAt.Compare(b.NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		due[i].UpdatedAt = time.Now()
+		m.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *MemoryStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookAttempt) (models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.AttemptLog = nil
+	delivery.UpdatedAt = time.Now()
+	m.deliveries[delivery.ID] = delivery
+	attempt.ID, attempt.CreatedAt = m.newModel()
+	attempt.UpdatedAt = attempt.CreatedAt
+	attempt.DeliveryID = delivery.ID
+	m.attempts[attempt.ID] = attempt
+	return delivery, nil
+}
+
+func (m *MemoryStore) SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if delivery.ID == 0 {
+		delivery.ID, delivery.CreatedAt = m.newModel()
+	}
+	delivery.AttemptLog = nil
+	delivery.UpdatedAt = time.Now()
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (m *MemoryStore) GetWebhookDeliveries(ctx context.Context, subscriptionID string) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range sortedByID(m.deliveries) {
+		if delivery.SubscriptionID == parseID(subscriptionID) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	slices.Reverse(deliveries)
+	return deliveries, nil
+}
+
+func (m *MemoryStore) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery, ok := m.deliveries[parseID(id)]
+	if !ok {
+		return delivery, fmt.Errorf("GetWebhookDelivery: %w", ErrNotFound)
+	}
+	for _, attempt := range sortedByID(m.attempts) {
+		if attempt.DeliveryID == delivery.ID {
+			delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+		}
+	}
+	return delivery, nil
+}
+
+// recordEvent adds event to the outbox. The caller holds m.mu, so the event is
+// recorded along with its change.
+func (m *MemoryStore) recordEvent(ctx context.Context, event models.DomainEvent) error {
+	row, err := newOutboxEvent(event)
+	if err != nil {
+		return err
+	}
+	row.ID, row.CreatedAt = m.newModel()
+	row.UpdatedAt = row.CreatedAt
+	m.outbox[row.ID] = row
+	noteRecorded(ctx, row.ID)
+	return nil
+}
+
+func (m *MemoryStore) ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.OutboxEvent
+	for _, event := range sortedByID(m.outbox) {
+		if len(due) == limit {
+			break
+		}
+		if event.Status == models.OutboxPending && !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	return m.claimOutboxEvents(due, now, lease), nil
+}
+
+func (m *MemoryStore) ClaimOutboxEventsByID(ctx context.Context, ids []uint, now time.Time, lease time.Duration) ([]models.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.OutboxEvent
+	for _, event := range sortedByID(m.outbox) {
+		if slices.Contains(ids, event.ID) && event.Status == models.OutboxPending && !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	return m.claimOutboxEvents(due, now, lease), nil
+}
+
+// claimOutboxEvents puts each of the due events off by lease. The caller
+// holds m.mu.
+func (m *MemoryStore) claimOutboxEvents(due []models.OutboxEvent, now time.Time, lease time.Duration) []models.OutboxEvent {
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		due[i].UpdatedAt = time.Now()
+		m.outbox[due[i].ID] = due[i]
+	}
+	return due
+}
+
+func (m *MemoryStore) SaveOutboxEvent(ctx context.Context, event models.OutboxEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if event.ID == 0 {
+		event.ID, event.CreatedAt = m.newModel()
+	}
+	event.UpdatedAt = time.Now()
+	m.outbox[event.ID] = event
+	return nil
+}
+
+func (m *MemoryStore) PruneOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pruned int64
+	for id, event := range m.outbox {
+		if event.Status == models.OutboxDispatched && event.DispatchedAt != nil && event.DispatchedAt.Before(before) {
+			delete(m.outbox, id)
+			pruned++
+		}
+	}
+	for key, marked := range m.processed {
+		if marked.Before(before) {
+			delete(m.processed, key)
+		}
+	}
+	return pruned, nil
+}
+
+func (m *MemoryStore) MarkProcessed(ctx context.Context, subscriber string, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.processed[processedKey{subscriber, key}]; ok {
+		return false, nil
+	}
+	m.processed[processedKey{subscriber, key}] = time.Now()
+	return true, nil
+}
+
+func (m *MemoryStore) UnmarkProcessed(ctx context.Context, subscriber string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.processed, processedKey{subscriber, key})
+	return nil
+}
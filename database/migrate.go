@@ -0,0 +1,387 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDirtySchema is returned when a migration failed part way through on a
+// backend that can't roll schema changes back. The schema has to be repaired
+// by hand and the migration marked with ForceMigration before anything else
+// runs against it.
+var ErrDirtySchema = errors.New("database schema is dirty")
+
+// ErrPendingMigrations is returned by CheckSchema when the database is behind
+// the migrations built into the binary.
+var ErrPendingMigrations = errors.New("database schema has pending migrations")
+
+// Migration is one numbered step of the schema. Up and Down run in a
+// transaction on SQLite and PostgreSQL; MySQL commits DDL as it goes, so a
+// failure there leaves the schema dirty.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// MigrationState is a migration and whether it has been applied
+type MigrationState struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty,omitempty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// schemaMigration is a row of schema_migrations, one per applied migration
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrationFiles holds the SQL migrations, named
+// <version>_<name>[.<backend>].(up|down).sql. A file for a specific backend
+// replaces the generic one on that backend.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(?:\.(sqlite|postgres|mysql))?\.(up|down)\.sql$`)
+
+// Migrations returns every migration for the backend db is connected to, in
+// version order.
+func Migrations(db *gorm.DB) ([]Migration, error) {
+	byVersion := make(map[int64]*Migration)
+	for i := range goMigrations {
+		migration := goMigrations[i]
+		byVersion[migration.Version] = &migration
+	}
+
+	backend := db.Dialector.Name()
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	// Generic files first so backend specific ones override them
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.Count(entries[i].Name(), ".") < strings.Count(entries[j].Name(), ".")
+	})
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("badly named migration %s", entry.Name())
+		}
+		if match[3] != "" && match[3] != backend {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		run := sqlMigration("migrations/" + entry.Name())
+		if match[4] == "up" {
+			migration.Up = run
+		} else {
+			migration.Down = run
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration %04d_%s has no up step", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// sqlMigration returns a step running the statements in an embedded file.
+// Statements are separated by semicolons at the end of a line.
+func sqlMigration(path string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		contents, err := migrationFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, statement := range strings.Split(string(contents), ";\n") {
+			statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+			if statement == "" || isComment(statement) {
+				continue
+			}
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// isComment reports whether every line of a statement is an SQL comment
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// appliedMigrations returns the rows of schema_migrations by version,
+// creating the table if needed.
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrationStatus lists every migration and whether it has been applied
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrationStatus: %v", err)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrationStatus: %v", err)
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			state.Applied, state.Dirty, state.AppliedAt = true, row.Dirty, &appliedAt
+			delete(applied, migration.Version)
+		}
+		states = append(states, state)
+	}
+	// Versions applied by a newer binary
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		states = append(states, MigrationState{Version: row.Version, Name: row.Name, Applied: true, Dirty: row.Dirty, AppliedAt: &appliedAt})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// CheckSchema returns ErrDirtySchema if a migration failed part way through,
+// or ErrPendingMigrations if some haven't been applied.
+func CheckSchema(db *gorm.DB) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, state := range states {
+		if state.Dirty {
+			return fmt.Errorf("CheckSchema: %w: migration %04d_%s", ErrDirtySchema, state.Version, state.Name)
+		}
+		if !state.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("CheckSchema: %w: %d to apply", ErrPendingMigrations, pending)
+	}
+	return nil
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them when steps
+// is zero, returning the ones applied.
+func MigrateUp(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateUp: %v", err)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateUp: %v", err)
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, fmt.Errorf("MigrateUp: %w", err)
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		row := schemaMigration{Version: migration.Version, Name: migration.Name, Dirty: true, AppliedAt: time.Now()}
+		err := runMigration(db, migration.Up, func(tx *gorm.DB) error { return tx.Create(&row).Error },
+			func(tx *gorm.DB) error { return tx.Model(&row).Update("dirty", false).Error })
+		if err != nil {
+			return done, fmt.Errorf("MigrateUp: %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the last steps applied migrations (one when steps is
+// zero), returning the ones reverted.
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateDown: %v", err)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateDown: %v", err)
+	}
+	if err := checkClean(applied); err != nil {
+		return nil, fmt.Errorf("MigrateDown: %w", err)
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		row, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("MigrateDown: %04d_%s can't be reverted", migration.Version, migration.Name)
+		}
+		err := runMigration(db, migration.Down, func(tx *gorm.DB) error { return tx.Model(&row).Update("dirty", true).Error },
+			func(tx *gorm.DB) error { return tx.Delete(&row).Error })
+		if err != nil {
+			return done, fmt.Errorf("MigrateDown: %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// ForceMigration records migration version as cleanly applied without running
+// it, for use once a dirty schema has been repaired by hand.
+func ForceMigration(db *gorm.DB, version int64) error {
+	migrations, err := Migrations(db)
+	if err != nil {
+		return fmt.Errorf("ForceMigration: %v", err)
+	}
+	for _, migration := range migrations {
+		if migration.Version != version {
+			continue
+		}
+		if _, err := appliedMigrations(db); err != nil {
+			return fmt.Errorf("ForceMigration: %v", err)
+		}
+		row := schemaMigration{Version: version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := db.Save(&row).Error; err != nil {
+			return fmt.Errorf("ForceMigration: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("ForceMigration: no migration %d", version)
+}
+
+func checkClean(applied map[int64]schemaMigration) error {
+	for _, row := range applied {
+		if row.Dirty {
+			return fmt.Errorf("%w: migration %04d_%s", ErrDirtySchema, row.Version, row.Name)
+		}
+	}
+	return nil
+}
+
+// runMigration runs a step along with its bookkeeping. Where DDL is
+// transactional everything happens in one transaction; otherwise the schema
+// is marked dirty while the step runs and stays that way if it fails.
+func runMigration(db *gorm.DB, step, begin, finish func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != BackendMySQL {
+		return db.Transaction(func(tx *gorm.DB) error {
+			for _, run := range []func(*gorm.DB) error{begin, step, finish} {
+				if err := run(tx); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := begin(db); err != nil {
+		return err
+	}
+	if err := step(db); err != nil {
+		return fmt.Errorf("%v (the schema is now dirty)", err)
+	}
+	return finish(db)
+}
+
+// CreateMigration writes empty up and down SQL files for a new migration
+// numbered after every migration known to db and in dir, returning their
+// paths.
+func CreateMigration(db *gorm.DB, dir string, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return nil, fmt.Errorf("CreateMigration: name %q must be letters, digits and underscores", name)
+	}
+	migrations, err := Migrations(db)
+	if err != nil {
+		return nil, fmt.Errorf("CreateMigration: %v", err)
+	}
+	var last int64
+	for _, migration := range migrations {
+		last = max(last, migration.Version)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("CreateMigration: %v", err)
+	}
+	for _, entry := range entries {
+		if match := migrationFileName.FindStringSubmatch(entry.Name()); match != nil {
+			version, _ := strconv.ParseInt(match[1], 10, 64)
+			last = max(last, version)
+		}
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", last+1, name, direction))
+		contents := fmt.Sprintf("-- %s: %s\n", strings.ToUpper(direction[:1])+direction[1:], name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			return paths, fmt.Errorf("CreateMigration: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
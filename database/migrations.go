@@ -0,0 +1,79 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// goMigrations are the migrations written in Go, for changes that are easier
+// to express through GORM than in SQL for every backend. The rest live in
+// migrations/*.sql.
+//
+// They migrate the frozen copies of the tables in schema.go rather than the
+// models, so that running them makes the schema they made when they were
+// written. AutoMigrate only ever adds, so they're safe to run on a database
+// that already has the change.
+var goMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(tablesV1...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, tablesV1)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_product_sku",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&productV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&productV3{}, "SKU"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&productV3{}, "SKU")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(tablesV4...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, tablesV4)
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_outbox",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&outboxEventV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&outboxEventV5{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_processed_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&processedEventV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&processedEventV8{})
+		},
+	},
+}
+
+// dropTables drops tables in the reverse of the order they were created in
+func dropTables(tx *gorm.DB, tables []interface{}) error {
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
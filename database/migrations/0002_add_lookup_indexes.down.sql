@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_coupon_objects_code;
+DROP INDEX IF EXISTS idx_products_category;
+DROP INDEX IF EXISTS idx_orders_user_id;
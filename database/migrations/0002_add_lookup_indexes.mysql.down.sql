@@ -0,0 +1,3 @@
+DROP INDEX idx_coupon_objects_code ON coupon_objects;
+DROP INDEX idx_products_category ON products;
+DROP INDEX idx_orders_user_id ON orders;
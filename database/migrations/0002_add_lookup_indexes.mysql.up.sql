@@ -0,0 +1,6 @@
+-- MySQL can't index TEXT columns whole and has no CREATE INDEX IF NOT EXISTS
+CREATE INDEX idx_orders_user_id ON orders (user_id(191));
+CREATE INDEX idx_products_category ON products (category(191));
+
+DELETE FROM coupon_objects WHERE deleted_at IS NOT NULL;
+CREATE UNIQUE INDEX idx_coupon_objects_code ON coupon_objects (code(191));
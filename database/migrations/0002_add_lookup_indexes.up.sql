@@ -0,0 +1,7 @@
+-- Orders are listed per user and products per category
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+CREATE INDEX IF NOT EXISTS idx_products_category ON products (category);
+
+-- Deleted coupons used to be kept, which would block reusing their codes
+DELETE FROM coupon_objects WHERE deleted_at IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_coupon_objects_code ON coupon_objects (code);
@@ -0,0 +1,6 @@
+-- Products from before stock was counted have a stock of 0, which would make
+-- them out of stock; they stay untracked until their stock is set
+ALTER TABLE products ADD COLUMN stock_tracked boolean NOT NULL DEFAULT false;
+
+-- Products that have been given stock are tracked
+UPDATE products SET stock_tracked = true WHERE stock > 0;
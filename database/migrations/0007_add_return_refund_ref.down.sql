@@ -0,0 +1 @@
+ALTER TABLE return_requests DROP COLUMN refund_ref;
@@ -0,0 +1 @@
+ALTER TABLE return_requests ADD COLUMN refund_ref varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordedEvents collects the IDs of the events recorded under a context from
+// WithRecordedEvents, so that whoever made the changes can dispatch just those
+type RecordedEvents struct {
+	mu  sync.Mutex
+	ids []uint
+}
+
+type recordedEventsKey struct{}
+
+// WithRecordedEvents returns a context under which the events stores record
+// are added to the returned collection. Events recorded in a transaction that
+// was then rolled back are in it too, but won't be found to claim.
+func WithRecordedEvents(ctx context.Context) (context.Context, *RecordedEvents) {
+	recorded := &RecordedEvents{}
+	return context.WithValue(ctx, recordedEventsKey{}, recorded), recorded
+}
+
+// IDs returns the IDs of the events recorded so far, oldest first
+func (r *RecordedEvents) IDs() []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]uint(nil), r.ids...)
+}
+
+// noteRecorded adds the ID of an event just recorded to ctx's collection, if
+// it has one
+func noteRecorded(ctx context.Context, id uint) {
+	if recorded, ok := ctx.Value(recordedEventsKey{}).(*RecordedEvents); ok {
+		recorded.mu.Lock()
+		recorded.ids = append(recorded.ids, id)
+		recorded.mu.Unlock()
+	}
+}
+
+// newOutboxEvent returns event as a row of the outbox, due now
+func newOutboxEvent(event models.DomainEvent) (models.OutboxEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("failed to record %s: %v", event.EventName(), err)
+	}
+	return models.OutboxEvent{
+		Name:          event.EventName(),
+		Payload:       string(payload),
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// transaction runs fn with a store whose queries all go through one
+// transaction, which is committed if fn returns nil and rolled back otherwise
+func (s *GormStore) transaction(ctx context.Context, fn func(tx *GormStore) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx})
+	})
+}
+
+// recordEvent adds event to the outbox. It's called on a store from
+// transaction, so that the event is only recorded if the change is.
+func (s *GormStore) recordEvent(ctx context.Context, event models.DomainEvent) error {
+	row, err := newOutboxEvent(event)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to record %s: %v", event.EventName(), err)
+	}
+	noteRecorded(ctx, row.ID)
+	return nil
+}
+
+// ClaimOutboxEvents claims events the way ClaimWebhookDeliveries claims
+// deliveries, with an update that only matches while the event is still due
+func (s *GormStore) ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	var due []models.OutboxEvent
+	err := s.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+		Order("id").Limit(limit).
+		Find(&due).Error
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOutboxEvents: %v", err)
+	}
+	claimed, err := s.claimOutboxEvents(ctx, due, now, lease)
+	if err != nil {
+		return claimed, fmt.Errorf("ClaimOutboxEvents: %v", err)
+	}
+	return claimed, nil
+}
+
+func (s *GormStore) ClaimOutboxEventsByID(ctx context.Context, ids []uint, now time.Time, lease time.Duration) ([]models.OutboxEvent, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var due []models.OutboxEvent
+	err := s.db.WithContext(ctx).
+		Where("id IN ? AND status = ? AND next_attempt_at <= ?", ids, models.OutboxPending, now).
+		Order("id").
+		Find(&due).Error
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOutboxEventsByID: %v", err)
+	}
+	claimed, err := s.claimOutboxEvents(ctx, due, now, lease)
+	if err != nil {
+		return claimed, fmt.Errorf("ClaimOutboxEventsByID: %v", err)
+	}
+	return claimed, nil
+}
+
+// claimOutboxEvents puts each of the due events off by lease, returning those
+// no other dispatcher claimed first
+func (s *GormStore) claimOutboxEvents(ctx context.Context, due []models.OutboxEvent, now time.Time, lease time.Duration) ([]models.OutboxEvent, error) {
+	claimed := due[:0]
+	until := now.Add(lease)
+	for _, event := range due {
+		result := s.db.WithContext(ctx).Model(&models.OutboxEvent{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", event.ID, models.OutboxPending, now).
+			Update("next_attempt_at", until)
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 1 {
+			event.NextAttemptAt = until
+			claimed = append(claimed, event)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *GormStore) SaveOutboxEvent(ctx context.Context, event models.OutboxEvent) error {
+	if err := s.db.WithContext(ctx).Save(&event).Error; err != nil {
+		return fmt.Errorf("SaveOutboxEvent: %v", err)
+	}
+	return nil
+}
+
+func (s *GormStore) PruneOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("status = ? AND dispatched_at < ?", models.OutboxDispatched, before).
+		Delete(&models.OutboxEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("PruneOutboxEvents: %v", result.Error)
+	}
+	err := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.ProcessedEvent{}).Error
+	if err != nil {
+		return result.RowsAffected, fmt.Errorf("PruneOutboxEvents: %v", err)
+	}
+	return result.RowsAffected, nil
+}
+
+// MarkProcessed inserts the subscriber's key unless it's already there, so
+// that of two handlers marking the same event at once only one gets true
+func (s *GormStore) MarkProcessed(ctx context.Context, subscriber string, key string) (bool, error) {
+	row := models.ProcessedEvent{Subscriber: subscriber, EventKey: key}
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return false, fmt.Errorf("MarkProcessed: %v", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *GormStore) UnmarkProcessed(ctx context.Context, subscriber string, key string) error {
+	err := s.db.WithContext(ctx).Where("subscriber = ? AND event_key = ?", subscriber, key).
+		Delete(&models.ProcessedEvent{}).Error
+	if err != nil {
+		return fmt.Errorf("UnmarkProcessed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+)
+
+func (s *GormStore) GetOrder(ctx context.Context, id string) (models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).Preload("OrderItems.Product").Preload("CreditNotes").Where("id = ?", id).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return order, fmt.Errorf("GetOrder: %w", detailed(ErrNotFound, "no order found for ID %s", id))
+		}
+		return order, fmt.Errorf("GetOrder: %v", err)
+	}
+	return order, nil
+}
+
+func (s *GormStore) AddPayment(ctx context.Context, payment models.Payment) (models.Payment, error) {
+	if err := s.db.WithContext(ctx).Create(&payment).Error; err != nil {
+		return payment, fmt.Errorf("AddPayment: %v", err)
+	}
+	return payment, nil
+}
+
+func (s *GormStore) GetOrderPayment(ctx context.Context, orderID string) (models.Payment, error) {
+	var payment models.Payment
+	err := s.db.WithContext(ctx).Preload("Transactions").Where("order_id = ?", orderID).Order("id desc").First(&payment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return payment, fmt.Errorf("GetOrderPayment: %w", detailed(ErrNotFound, "no payment found for order ID %s", orderID))
+		}
+		return payment, fmt.Errorf("GetOrderPayment: %v", err)
+	}
+	return payment, nil
+}
+
+func (s *GormStore) GetPaymentByRef(ctx context.Context, providerRef string) (models.Payment, error) {
+	var payment models.Payment
+	err := s.db.WithContext(ctx).Where("provider_ref = ?", providerRef).First(&payment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return payment, fmt.Errorf("GetPaymentByRef: %w", detailed(ErrNotFound, "no payment found for reference %s", providerRef))
+		}
+		return payment, fmt.Errorf("GetPaymentByRef: %v", err)
+	}
+	return payment, nil
+}
+
+func (s *GormStore) GetProviderPayments(ctx context.Context, provider string) ([]models.Payment, error) {
+	var payments []models.Payment
+	if err := s.db.WithContext(ctx).Where("provider = ?", provider).Order("id").Find(&payments).Error; err != nil {
+		return nil, fmt.Errorf("GetProviderPayments: %v", err)
+	}
+	return payments, nil
+}
+
+// RecordPaymentTransaction stores a provider call against the payment, updates
+// the payment's status and amounts, and moves the order to the status the
+// payment result leads to. An order whose payment is authorized is placed,
+// raising OrderPlaced; one whose payment fails, or that's cancelled, gives
+// back its stock and coupon and leaves the cart as it was.
+func (s *GormStore) RecordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error) {
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var err error
+		payment, err = tx.recordPaymentTransaction(ctx, payment, txn)
+		return err
+	})
+	if err != nil {
+		return payment, fmt.Errorf("RecordPaymentTransaction: %v", err)
+	}
+	return payment, nil
+}
+
+// recordPaymentTransaction does the work of RecordPaymentTransaction. It's
+// called on a store from transaction.
+func (s *GormStore) recordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error) {
+	applyTransaction(&payment, txn)
+	if err := s.db.WithContext(ctx).Omit("Transactions").Save(&payment).Error; err != nil {
+		return payment, fmt.Errorf("error saving payment: %v", err)
+	}
+
+	txn.PaymentID = payment.ID
+	if err := s.db.WithContext(ctx).Create(&txn).Error; err != nil {
+		return payment, fmt.Errorf("error adding transaction: %v", err)
+	}
+
+	status, ok := orderStatusAfter(payment, txn)
+	if !ok {
+		return payment, nil
+	}
+	var order models.Order
+	if err := s.db.WithContext(ctx).Preload("OrderItems").Where("id = ?", payment.OrderID).First(&order).Error; err != nil {
+		return payment, fmt.Errorf("error fetching order: %v", err)
+	}
+	if !models.CanTransition(order.Status, status) {
+		return payment, fmt.Errorf("order %d can't move from %s to %s", order.ID, order.Status, status)
+	}
+	from := order.Status
+	if err := s.db.WithContext(ctx).Model(&order).Update("status", status).Error; err != nil {
+		return payment, err
+	}
+	if from != status {
+		err := s.recordEvent(ctx, models.OrderStatusChanged{OrderID: order.ID, UserID: order.UserID, PreviousStatus: from, Status: status})
+		if err != nil {
+			return payment, err
+		}
+	}
+	switch {
+	case models.PlacesOrder(from, status):
+		return payment, s.orderPlaced(ctx, order)
+	case models.ReleasesOrder(from, status):
+		return payment, s.releaseOrder(ctx, order)
+	}
+	return payment, nil
+}
+
+// orderPlaced records OrderPlaced for an order whose payment has been
+// authorized, naming the lines of the owner's cart it was made from
+func (s *GormStore) orderPlaced(ctx context.Context, order models.Order) error {
+	event := models.OrderPlaced{OrderID: order.ID, UserID: order.UserID}
+	var cart models.Cart
+	err := s.db.WithContext(ctx).Preload("Items").Where("user_id = ?", order.UserID).First(&cart).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) { // Without a cart, there's nothing to clear
+		return fmt.Errorf("error fetching cart: %v", err)
+	}
+	for _, cartItem := range cart.Items {
+		if order.HasProduct(cartItem.ProductID) {
+			event.CartItemIDs = append(event.CartItemIDs, cartItem.ID)
+		}
+	}
+	return s.recordEvent(ctx, event)
+}
+
+// releaseOrder puts back the stock an order took and makes the single-use
+// coupon it redeemed usable again
+func (s *GormStore) releaseOrder(ctx context.Context, order models.Order) error {
+	if err := s.restock(ctx, order.OrderItems); err != nil {
+		return err
+	}
+	if order.Discount > 0 {
+		err := s.db.WithContext(ctx).Model(&models.CouponObject{}).Where("code = ? AND single_use = ?", order.CouponCode, true).
+			Update("redeemed_at", nil).Error
+		if err != nil {
+			return fmt.Errorf("error releasing coupon: %v", err)
+		}
+	}
+	return nil
+}
+
+// restock puts items back in stock, those of them whose stock is tracked
+func (s *GormStore) restock(ctx context.Context, items []models.OrderItem) error {
+	var restocked []uint
+	for _, item := range items {
+		result := s.db.WithContext(ctx).Model(&models.Product{}).Where("id = ? AND stock_tracked = ?", item.ProductID, true).
+			Update("stock", gorm.Expr("stock + ?", item.Quantity))
+		if result.Error != nil {
+			return fmt.Errorf("error restocking product: %v", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			restocked = append(restocked, item.ProductID)
+		}
+	}
+	if len(restocked) == 0 {
+		return nil
+	}
+	return s.recordEvent(ctx, models.StockChanged{ProductIDs: restocked})
+}
+
+// applyTransaction updates the payment's amounts and status for a provider call
+func applyTransaction(payment *models.Payment, txn models.Transaction) {
+	switch txn.Type {
+	case models.TransactionCapture:
+		payment.CapturedAmount += txn.Amount
+	case models.TransactionRefund:
+		payment.RefundedAmount += txn.Amount
+	}
+	if txn.Status != "" {
+		payment.Status = txn.Status
+	}
+}
+
+// orderStatusAfter returns the status the payment's order should move to
+// after txn, if any.
+func orderStatusAfter(payment models.Payment, txn models.Transaction) (string, bool) {
+	if txn.Type == models.TransactionRefund && payment.RefundedAmount < payment.CapturedAmount {
+		return models.OrderStatusPartlyRefunded, true
+	}
+	return models.OrderStatusForPayment(payment.Status)
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidReturn is wrapped by errors caused by a return request that can't
+// be accepted, as opposed to a database failure.
+var ErrInvalidReturn = errors.New("invalid return request")
+
+// ErrInvalidTransition is wrapped by errors caused by an order status change
+// the order's current status doesn't allow.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// AddReturnRequest validates a return against the order it refers to and saves it.
+// Only delivered orders can be returned, and an item can't be returned more
+// times than it was bought, counting returns that are still open.
+func (s *GormStore) AddReturnRequest(ctx context.Context, request models.ReturnRequest) (models.ReturnRequest, error) {
+	err := s.transaction(ctx, func(store *GormStore) error {
+		tx := store.db.WithContext(ctx)
+		var order models.Order
+		err := tx.Preload("OrderItems").Where("id = ?", request.OrderID).First(&order).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return detailed(ErrInvalidReturn, "no order found for ID %d", request.OrderID)
+			}
+			return err
+		}
+
+		// Quantities already claimed by returns that haven't been decided yet
+		var open []models.ReturnItem
+		err = tx.Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+			Where("return_requests.order_id = ? AND return_requests.status IN ?", order.ID,
+				[]string{models.ReturnStatusRequested, models.ReturnStatusApproved}).
+			Find(&open).Error
+		if err != nil {
+			return err
+		}
+		if err := checkReturnItems(order, open, &request); err != nil {
+			return err
+		}
+
+		request.Status = models.ReturnStatusRequested
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return request, fmt.Errorf("AddReturnRequest: %w", err)
+	}
+	return request, nil
+}
+
+// checkReturnItems validates a return against its order and the items claimed
+// by the order's open returns, filling in the product and price of each item.
+func checkReturnItems(order models.Order, open []models.ReturnItem, request *models.ReturnRequest) error {
+	if order.UserID != request.UserID {
+		return detailed(ErrInvalidReturn, "order %d doesn't belong to user %s", order.ID, request.UserID)
+	}
+	if order.Status != models.OrderStatusDelivered && order.Status != models.OrderStatusPartlyRefunded {
+		return detailed(ErrInvalidReturn, "order %d is %s", order.ID, order.Status)
+	}
+	if len(request.Items) == 0 {
+		return detailed(ErrInvalidReturn, "no items to return")
+	}
+
+	claimed := make(map[uint]int)
+	for _, item := range open {
+		claimed[item.OrderItemID] += item.Quantity
+	}
+
+	for i, item := range request.Items {
+		var orderItem *models.OrderItem
+		for j := range order.OrderItems {
+			if order.OrderItems[j].ID == item.OrderItemID {
+				orderItem = &order.OrderItems[j]
+			}
+		}
+		if orderItem == nil {
+			return detailed(ErrInvalidReturn, "item %d is not part of order %d", item.OrderItemID, order.ID)
+		}
+		returnable := orderItem.Quantity - orderItem.Returned - claimed[orderItem.ID]
+		if item.Quantity <= 0 || item.Quantity > returnable {
+			return detailed(ErrInvalidReturn, "can't return %d of item %d, %d returnable", item.Quantity, orderItem.ID, returnable)
+		}
+		claimed[orderItem.ID] += item.Quantity
+		request.Items[i].ProductID = orderItem.ProductID
+		request.Items[i].Price = orderItem.Price
+	}
+	return nil
+}
+
+func (s *GormStore) GetReturnRequest(ctx context.Context, id string) (models.ReturnRequest, error) {
+	var request models.ReturnRequest
+	err := s.db.WithContext(ctx).Preload("Items").Where("id = ?", id).First(&request).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return request, fmt.Errorf("GetReturnRequest: %w", detailed(ErrNotFound, "no return found for ID %s", id))
+		}
+		return request, fmt.Errorf("GetReturnRequest: %v", err)
+	}
+	return request, nil
+}
+
+func (s *GormStore) GetUserReturns(ctx context.Context, userID string) ([]models.ReturnRequest, error) {
+	var requests []models.ReturnRequest
+	if err := s.db.WithContext(ctx).Preload("Items").Where("user_id = ?", userID).Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("GetUserReturns: %v", err)
+	}
+	return requests, nil
+}
+
+func (s *GormStore) GetAllReturns(ctx context.Context) ([]models.ReturnRequest, error) {
+	var requests []models.ReturnRequest
+	if err := s.db.WithContext(ctx).Preload("Items").Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("GetAllReturns: %v", err)
+	}
+	return requests, nil
+}
+
+func (s *GormStore) SaveReturnRequest(ctx context.Context, request models.ReturnRequest) error {
+	if err := s.db.WithContext(ctx).Omit("Items").Save(&request).Error; err != nil {
+		return fmt.Errorf("SaveReturnRequest: %v", err)
+	}
+	return nil
+}
+
+// DecideReturn approves or rejects a requested return, with the admin's note.
+// The update only matches while the return is still requested, so of two
+// decisions made at once one gets ErrConflict.
+func (s *GormStore) DecideReturn(ctx context.Context, id string, status string, note string) (models.ReturnRequest, error) {
+	result := s.db.WithContext(ctx).Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ?", id, models.ReturnStatusRequested).
+		Updates(map[string]any{"status": status, "admin_note": note})
+	if result.Error != nil {
+		return models.ReturnRequest{}, fmt.Errorf("DecideReturn: %v", result.Error)
+	}
+	request, err := s.GetReturnRequest(ctx, id)
+	if err != nil {
+		return request, fmt.Errorf("DecideReturn: %w", err)
+	}
+	if result.RowsAffected == 0 {
+		return request, fmt.Errorf("DecideReturn: %w", detailed(ErrConflict, "return %s is already %s", id, request.Status))
+	}
+	return request, nil
+}
+
+// ReopenReturn puts an approved return that wasn't refunded back to
+// requested, so that it can be decided again
+func (s *GormStore) ReopenReturn(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ? AND refund_ref = ?", id, models.ReturnStatusApproved, "").
+		Update("status", models.ReturnStatusRequested)
+	if result.Error != nil {
+		return fmt.Errorf("ReopenReturn: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("ReopenReturn: %w", detailed(ErrConflict, "return %s isn't approved and unrefunded", id))
+	}
+	return nil
+}
+
+// NoteReturnRefund keeps the provider's reference and the amount of the
+// refund issued for an approved return, before CompleteReturn records it, so
+// that if recording it fails the refund isn't issued again.
+func (s *GormStore) NoteReturnRefund(ctx context.Context, id string, ref string, amount float64) error {
+	result := s.db.WithContext(ctx).Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ? AND refund_ref = ?", id, models.ReturnStatusApproved, "").
+		Updates(map[string]any{"refund_ref": ref, "refund_amount": amount})
+	if result.Error != nil {
+		return fmt.Errorf("NoteReturnRefund: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("NoteReturnRefund: %w", detailed(ErrConflict, "return %s isn't approved and unrefunded", id))
+	}
+	return nil
+}
+
+// CompleteReturn marks a refunded return as done: the refund is recorded
+// against the order's payment, the returned quantities on the order items,
+// which are optionally put back in stock, and a credit note for the refund is
+// written against the order, all or none of it. Only an approved return can
+// be completed, so a return completed twice at once gets ErrConflict once.
+func (s *GormStore) CompleteReturn(ctx context.Context, request models.ReturnRequest, payment models.Payment, refund models.Transaction, restock bool) (models.ReturnRequest, error) {
+	err := s.transaction(ctx, func(store *GormStore) error {
+		tx := store.db.WithContext(ctx)
+		result := tx.Model(&models.ReturnRequest{}).
+			Where("id = ? AND status = ?", request.ID, models.ReturnStatusApproved).
+			Updates(map[string]any{"status": models.ReturnStatusRefunded, "refund_amount": refund.Amount, "refund_ref": refund.ProviderRef})
+		if result.Error != nil {
+			return fmt.Errorf("error updating return: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return detailed(ErrConflict, "return %d isn't approved", request.ID)
+		}
+
+		if _, err := store.recordPaymentTransaction(ctx, payment, refund); err != nil {
+			return err
+		}
+
+		var returned []models.OrderItem
+		for _, item := range request.Items {
+			err := tx.Model(&models.OrderItem{}).Where("id = ?", item.OrderItemID).
+				Update("returned", gorm.Expr("returned + ?", item.Quantity)).Error
+			if err != nil {
+				return fmt.Errorf("error updating order item: %v", err)
+			}
+			returned = append(returned, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		if restock {
+			if err := store.restock(ctx, returned); err != nil {
+				return err
+			}
+		}
+
+		note := creditNoteFor(request, refund)
+		if err := tx.Create(&note).Error; err != nil {
+			return fmt.Errorf("error adding credit note: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return request, fmt.Errorf("CompleteReturn: %w", err)
+	}
+	request.Status = models.ReturnStatusRefunded
+	request.RefundAmount = refund.Amount
+	request.RefundRef = refund.ProviderRef
+	return request, nil
+}
+
+// creditNoteFor returns the credit note for a return's refund
+func creditNoteFor(request models.ReturnRequest, refund models.Transaction) models.CreditNote {
+	return models.CreditNote{
+		OrderID:         request.OrderID,
+		ReturnRequestID: request.ID,
+		Amount:          refund.Amount,
+		Reason:          request.Reason,
+		ProviderRef:     refund.ProviderRef,
+	}
+}
+
+// UpdateOrderStatus moves an order along its fulfilment, refusing transitions
+// the order's current status doesn't allow.
+func (s *GormStore) UpdateOrderStatus(ctx context.Context, id string, status string) error {
+	var order models.Order
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("UpdateOrderStatus: %w", detailed(ErrNotFound, "no order found for ID %s", id))
+	} else if err != nil {
+		return fmt.Errorf("UpdateOrderStatus: %v", err)
+	}
+	if !models.CanTransition(order.Status, status) {
+		return fmt.Errorf("UpdateOrderStatus: %w", detailed(ErrInvalidTransition, "order %s can't move from %s to %s", id, order.Status, status))
+	}
+	if order.Status == status {
+		return nil
+	}
+	from := order.Status
+	err = s.transaction(ctx, func(tx *GormStore) error {
+		if err := tx.db.WithContext(ctx).Model(&order).Update("status", status).Error; err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.OrderStatusChanged{OrderID: order.ID, UserID: order.UserID, PreviousStatus: from, Status: status})
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateOrderStatus: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The tables as the Go migrations create them. Each is a copy of its model as
+// it stood when the migration was written, so that a migration makes the same
+// schema however the models change since; a model change comes with a new
+// migration and, if it's written in Go, new copies here.
+
+// Migration 1, create_tables
+
+type userV1 struct {
+	gorm.Model
+	Username     string `gorm:"unique"`
+	Email        string `gorm:"unique"`
+	Password     string
+	OrdersCount  int64
+	SavedAddress string `gorm:"type:json"`
+	Type         string
+}
+
+func (userV1) TableName() string { return "users" }
+
+type categoryV1 struct {
+	gorm.Model
+	Name        string
+	Description string
+	Image       string
+}
+
+func (categoryV1) TableName() string { return "categories" }
+
+type productV1 struct {
+	gorm.Model
+	Name         string
+	Description  string
+	Details      string
+	Image        string
+	Category     string
+	Price        float64
+	Isbestseller bool
+	Stock        int
+	Disabled     bool
+}
+
+func (productV1) TableName() string { return "products" }
+
+type cartV1 struct {
+	gorm.Model
+	UserID string       `gorm:"unique"`
+	User   userV1       `gorm:"foreignKey:UserID"`
+	Items  []cartItemV1 `gorm:"foreignKey:CartID"`
+}
+
+func (cartV1) TableName() string { return "carts" }
+
+type cartItemV1 struct {
+	gorm.Model
+	CartID    uint
+	ProductID uint
+	Product   productV1 `gorm:"foreignKey:ProductID"`
+	Quantity  int
+	UnitPrice float64
+}
+
+func (cartItemV1) TableName() string { return "cart_items" }
+
+type orderV1 struct {
+	gorm.Model
+	UserID          string `gorm:"not null"`
+	PaymentMethod   string
+	Status          string        `gorm:"default:Pending"`
+	OrderItems      []orderItemV1 `gorm:"foreignKey:OrderID"`
+	TotalPrice      float64
+	Discount        float64
+	CouponCode      string
+	ShippingDetails string
+	Email           string
+	CreditNotes     []creditNoteV1 `gorm:"foreignKey:OrderID"`
+}
+
+func (orderV1) TableName() string { return "orders" }
+
+type orderItemV1 struct {
+	gorm.Model
+	OrderID   uint      `gorm:"not null"`
+	ProductID uint      `gorm:"not null"`
+	Product   productV1 `gorm:"foreignKey:ProductID"`
+	Quantity  int       `gorm:"not null"`
+	Price     float64   `gorm:"not null"`
+	Returned  int
+}
+
+func (orderItemV1) TableName() string { return "order_items" }
+
+type couponV1 struct {
+	gorm.Model
+	Code           string
+	Discount       float64
+	OrderFrequency int64
+	SingleUse      bool
+	ExpiresAt      *time.Time
+	RedeemedAt     *time.Time
+}
+
+func (couponV1) TableName() string { return "coupon_objects" }
+
+type paymentV1 struct {
+	gorm.Model
+	OrderID        uint `gorm:"not null;index"`
+	Provider       string
+	ProviderRef    string `gorm:"index"`
+	Method         string
+	Amount         float64
+	CapturedAmount float64
+	RefundedAmount float64
+	Currency       string
+	Status         string
+	NextActionURL  string
+	Transactions   []transactionV1 `gorm:"foreignKey:PaymentID"`
+}
+
+func (paymentV1) TableName() string { return "payments" }
+
+type transactionV1 struct {
+	gorm.Model
+	PaymentID   uint `gorm:"not null;index"`
+	Type        string
+	Amount      float64
+	Status      string
+	ProviderRef string
+	Message     string
+}
+
+func (transactionV1) TableName() string { return "transactions" }
+
+type returnRequestV1 struct {
+	gorm.Model
+	OrderID      uint   `gorm:"not null;index"`
+	UserID       string `gorm:"not null;index"`
+	Status       string `gorm:"default:requested"`
+	Reason       string
+	AdminNote    string
+	RefundAmount float64
+	Items        []returnItemV1 `gorm:"foreignKey:ReturnRequestID"`
+}
+
+func (returnRequestV1) TableName() string { return "return_requests" }
+
+type returnItemV1 struct {
+	gorm.Model
+	ReturnRequestID uint `gorm:"not null;index"`
+	OrderItemID     uint `gorm:"not null"`
+	ProductID       uint
+	Quantity        int
+	Price           float64
+	Reason          string
+}
+
+func (returnItemV1) TableName() string { return "return_items" }
+
+type creditNoteV1 struct {
+	gorm.Model
+	OrderID         uint `gorm:"not null;index"`
+	ReturnRequestID uint
+	Amount          float64
+	Reason          string
+	ProviderRef     string
+}
+
+func (creditNoteV1) TableName() string { return "credit_notes" }
+
+type cartAbandonmentV1 struct {
+	gorm.Model
+	CartID         uint `gorm:"not null;index"`
+	UserID         string
+	Email          string
+	ItemCount      int
+	Subtotal       float64
+	LastActivity   time.Time
+	ReminderSentAt *time.Time
+	CouponCode     string
+}
+
+func (cartAbandonmentV1) TableName() string { return "cart_abandonments" }
+
+// tablesV1 are the tables created by migration 1, in the order they're
+// created; they're dropped in reverse
+var tablesV1 = []interface{}{
+	&userV1{},
+	&categoryV1{},
+	&productV1{},
+	&cartV1{},
+	&cartItemV1{},
+	&orderV1{},
+	&orderItemV1{},
+	&couponV1{},
+	&paymentV1{},
+	&transactionV1{},
+	&returnRequestV1{},
+	&returnItemV1{},
+	&creditNoteV1{},
+	&cartAbandonmentV1{},
+}
+
+// Migration 3, add_product_sku
+
+type productV3 struct {
+	productV1
+	SKU string `gorm:"size:64;index"`
+}
+
+func (productV3) TableName() string { return "products" }
+
+// Migration 4, create_webhooks
+
+type webhookSubscriptionV4 struct {
+	gorm.Model
+	URL         string `gorm:"not null"`
+	Secret      string `gorm:"not null"`
+	Events      string `gorm:"type:json"`
+	Description string
+	Disabled    bool
+}
+
+func (webhookSubscriptionV4) TableName() string { return "webhook_subscriptions" }
+
+type webhookDeliveryV4 struct {
+	gorm.Model
+	SubscriptionID uint   `gorm:"not null;index"`
+	EventID        string `gorm:"not null;index"`
+	EventType      string `gorm:"not null"`
+	Payload        string `gorm:"not null"`
+	Status         string `gorm:"default:pending;index"`
+	Attempts       int
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastError      string
+	DeliveredAt    *time.Time
+
+	AttemptLog []webhookAttemptV4 `gorm:"foreignKey:DeliveryID"`
+}
+
+func (webhookDeliveryV4) TableName() string { return "webhook_deliveries" }
+
+type webhookAttemptV4 struct {
+	gorm.Model
+	DeliveryID uint `gorm:"not null;index"`
+	StatusCode int
+	Error      string
+	Response   string
+	DurationMS int64
+}
+
+func (webhookAttemptV4) TableName() string { return "webhook_attempts" }
+
+// tablesV4 are the tables created by migration 4
+var tablesV4 = []interface{}{
+	&webhookSubscriptionV4{},
+	&webhookDeliveryV4{},
+	&webhookAttemptV4{},
+}
+
+// Migration 5, create_outbox
+
+type outboxEventV5 struct {
+	gorm.Model
+	Name          string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Status        string `gorm:"default:pending;index"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string
+	Handled       string `gorm:"type:json"`
+	DispatchedAt  *time.Time
+}
+
+func (outboxEventV5) TableName() string { return "outbox_events" }
+
+// Migration 8, create_processed_events
+
+type processedEventV8 struct {
+	Subscriber string    `gorm:"primaryKey;size:64"`
+	EventKey   string    `gorm:"primaryKey;size:64"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (processedEventV8) TableName() string { return "processed_events" }
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Errors wrapped by every store, so callers can tell what went wrong without
+// reading the message
+var (
+	// ErrNotFound is wrapped by errors for a record that doesn't exist
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is wrapped by errors for a record that clashes with one
+	// that exists, such as a second user with the same email
+	ErrConflict = errors.New("record already exists")
+)
+
+// DetailError is one of the errors above, or of the rules a store enforces
+// such as ErrInvalidCartItem, with what exactly went wrong, such as "quantity
+// must be positive", for callers to pass on
+type DetailError struct {
+	Err    error
+	Detail string
+}
+
+func (e *DetailError) Error() string {
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *DetailError) Unwrap() error {
+	return e.Err
+}
+
+// detailed returns err with the detail formatted from format and args
+func detailed(err error, format string, args ...any) error {
+	return &DetailError{Err: err, Detail: fmt.Sprintf(format, args...)}
+}
+
+// UserStore persists users
+type UserStore interface {
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	GetUserByID(ctx context.Context, id string) (models.User, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	// GetUsersByIDs returns those of the users that exist, in ID order
+	GetUsersByIDs(ctx context.Context, ids []string) ([]models.User, error)
+	AddUser(ctx context.Context, user models.User) error
+	SaveUser(ctx context.Context, user models.User) error
+	DeleteUser(ctx context.Context, user models.User) error
+	UpsertUser(ctx context.Context, user models.User) (bool, error)
+	// IncrementOrdersCount counts an order against its user, once however
+	// many times it's called for the order
+	IncrementOrdersCount(ctx context.Context, userID string, orderID uint) error
+}
+
+// ProductStore persists the catalog
+type ProductStore interface {
+	GetAllCategories(ctx context.Context) ([]models.Category, error)
+	GetBestSellers(ctx context.Context) ([]models.Product, error)
+	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	GetProducts(ctx context.Context, category string) ([]models.Product, error)
+	GetProduct(ctx context.Context, id uint) (models.Product, error)
+	AddCategory(ctx context.Context, category models.Category) error
+	AddProduct(ctx context.Context, product models.Product) error
+	UpsertCategory(ctx context.Context, category models.Category) (bool, error)
+	UpsertProduct(ctx context.Context, product models.Product) (bool, error)
+	// MatchProduct finds the product UpsertProduct would update, if any
+	MatchProduct(ctx context.Context, product models.Product) (models.Product, bool, error)
+	// AdjustStock adds delta, which may be negative, to a product's stock,
+	// refusing to take it below zero
+	AdjustStock(ctx context.Context, productID uint, delta int) (models.Product, error)
+}
+
+// CartStore persists user and guest carts, and tracks abandoned ones
+type CartStore interface {
+	GetUserCart(ctx context.Context, id string) (models.Cart, error)
+	AddItemToCart(ctx context.Context, userID string, productID uint, quantity int) error
+	SetCartItemQuantity(ctx context.Context, userID string, productID uint, quantity int) error
+	RemoveItemFromCart(ctx context.Context, userID string, productID uint, quantity int) error
+	MergeCarts(ctx context.Context, fromOwner string, toOwner string, rule string) error
+	// RemoveCartItems removes the lines with the given IDs from the owner's
+	// cart, ignoring any that are already gone
+	RemoveCartItems(ctx context.Context, owner string, itemIDs []uint) error
+
+	FindAbandonedCarts(ctx context.Context, idleFor time.Duration) ([]models.Cart, error)
+	AddCartAbandonment(ctx context.Context, event models.CartAbandonment) (models.CartAbandonment, error)
+	SaveCartAbandonment(ctx context.Context, event models.CartAbandonment) error
+	GetCartAbandonments(ctx context.Context) ([]models.CartAbandonment, error)
+}
+
+// OrderStore persists orders
+type OrderStore interface {
+	PlaceOrder(ctx context.Context, details models.Order) (models.Order, error)
+	GetOrder(ctx context.Context, id string) (models.Order, error)
+	GetUserOrders(ctx context.Context, id string) ([]models.Order, error)
+	// GetOrdersByUserIDs returns the orders of any of the users, in ID order
+	GetOrdersByUserIDs(ctx context.Context, userIDs []string) ([]models.Order, error)
+	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	UpdateOrderStatus(ctx context.Context, id string, status string) error
+}
+
+// PaymentStore persists payments and the provider calls made for them
+type PaymentStore interface {
+	AddPayment(ctx context.Context, payment models.Payment) (models.Payment, error)
+	GetOrderPayment(ctx context.Context, orderID string) (models.Payment, error)
+	GetPaymentByRef(ctx context.Context, providerRef string) (models.Payment, error)
+	// GetProviderPayments returns the payments made through a provider, in ID
+	// order
+	GetProviderPayments(ctx context.Context, provider string) ([]models.Payment, error)
+	RecordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error)
+}
+
+// ReturnStore persists return requests and the credit notes they produce
+type ReturnStore interface {
+	AddReturnRequest(ctx context.Context, request models.ReturnRequest) (models.ReturnRequest, error)
+	GetReturnRequest(ctx context.Context, id string) (models.ReturnRequest, error)
+	GetUserReturns(ctx context.Context, userID string) ([]models.ReturnRequest, error)
+	GetAllReturns(ctx context.Context) ([]models.ReturnRequest, error)
+	SaveReturnRequest(ctx context.Context, request models.ReturnRequest) error
+	DecideReturn(ctx context.Context, id string, status string, note string) (models.ReturnRequest, error)
+	ReopenReturn(ctx context.Context, id string) error
+	NoteReturnRefund(ctx context.Context, id string, ref string, amount float64) error
+	CompleteReturn(ctx context.Context, request models.ReturnRequest, payment models.Payment, refund models.Transaction, restock bool) (models.ReturnRequest, error)
+}
+
+// CouponStore persists coupons
+type CouponStore interface {
+	AddCoupon(ctx context.Context, coupon models.CouponObject) error
+	SaveCoupon(ctx context.Context, coupon models.CouponObject) error
+	GetAllCoupons(ctx context.Context) ([]models.CouponObject, error)
+	GetCoupon(ctx context.Context, code string) (models.CouponObject, error)
+	DeleteCoupon(ctx context.Context, coupon models.CouponObject) error
+	CouponDiscountRate(ctx context.Context, couponCode string) float64
+	GenerateCoupon(ctx context.Context, discount float64, validFor time.Duration) (models.CouponObject, error)
+	UpsertCoupon(ctx context.Context, coupon models.CouponObject) (bool, error)
+}
+
+// WebhookStore persists webhook subscriptions and the queue of deliveries
+// to them
+type WebhookStore interface {
+	AddWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error)
+	GetWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error)
+	SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error
+	DeleteWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error
+
+	EnqueueWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due by now,
+	// oldest first, putting each one's next attempt off by lease so that no
+	// other dispatcher claims it while it's being sent
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// RecordWebhookAttempt saves the delivery as it stands after the attempt,
+	// along with the attempt
+	RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookAttempt) (models.WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	// GetWebhookDeliveries returns a subscription's deliveries, newest first
+	GetWebhookDeliveries(ctx context.Context, subscriptionID string) ([]models.WebhookDelivery, error)
+	// GetWebhookDelivery returns a delivery with its attempts, oldest first
+	GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error)
+}
+
+// OutboxStore holds the domain events recorded with the changes that raised
+// them. The write methods of the other stores add to it.
+type OutboxStore interface {
+	// ClaimOutboxEvents returns up to limit pending events due by now, oldest
+	// first, putting each one off by lease so that no other dispatcher claims
+	// it while its subscribers run
+	ClaimOutboxEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error)
+	// ClaimOutboxEventsByID claims the events with the given IDs the same
+	// way, skipping those that aren't pending and due
+	ClaimOutboxEventsByID(ctx context.Context, ids []uint, now time.Time, lease time.Duration) ([]models.OutboxEvent, error)
+	SaveOutboxEvent(ctx context.Context, event models.OutboxEvent) error
+	// PruneOutboxEvents deletes the events dispatched before a time, returning
+	// how many, and the events marked processed before it. Failed events are
+	// kept for someone to look into.
+	PruneOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+	// MarkProcessed records that subscriber has handled the event with key,
+	// reporting false if it already had
+	MarkProcessed(ctx context.Context, subscriber string, key string) (bool, error)
+	// UnmarkProcessed forgets that subscriber handled the event with key, for
+	// a subscriber that couldn't finish handling it
+	UnmarkProcessed(ctx context.Context, subscriber string, key string) error
+}
+
+// Store is everything the application keeps in its database
+type Store interface {
+	UserStore
+	ProductStore
+	CartStore
+	OrderStore
+	PaymentStore
+	ReturnStore
+	CouponStore
+	WebhookStore
+	OutboxStore
+}
+
+var (
+	_ Store = (*GormStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+)
+
+// The Upsert* methods add a record, or update the one with the same natural
+// key (SKU or name, email or code) so that loading the same data twice changes
+// nothing. They report whether the record was created. Data that changes in
+// normal use, such as stock, order counts and saved addresses, is only set on
+// creation. A product created with a stock level has its stock tracked.
+
+func (s *GormStore) UpsertCategory(ctx context.Context, category models.Category) (bool, error) {
+	var created bool
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var err error
+		created, err = tx.upsert(ctx, &models.Category{}, "name = ?", category.Name, &category,
+			"Description", "Image")
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.CategoryChanged{Name: category.Name})
+	})
+	if err != nil {
+		return false, fmt.Errorf("UpsertCategory: %v", err)
+	}
+	return created, nil
+}
+
+func (s *GormStore) UpsertProduct(ctx context.Context, product models.Product) (bool, error) {
+	var created bool
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var err error
+		created, err = tx.upsertProduct(ctx, &product)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.ProductChanged{ProductID: product.ID, Created: created})
+	})
+	if err != nil {
+		return false, fmt.Errorf("UpsertProduct: %v", err)
+	}
+	return created, nil
+}
+
+// upsertProduct leaves the ID of the product it created or updated in product
+func (s *GormStore) upsertProduct(ctx context.Context, product *models.Product) (bool, error) {
+	existing, found, err := s.MatchProduct(ctx, *product)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		product.TrackNewStock()
+		return true, s.db.WithContext(ctx).Create(product).Error
+	}
+	columns := []string{"Name", "Description", "Details", "Image", "Category", "Price", "Isbestseller", "Disabled"}
+	if product.SKU != "" {
+		columns = append(columns, "SKU")
+	}
+	err = s.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", existing.ID).Select(columns).Updates(product).Error
+	product.ID = existing.ID
+	return false, err
+}
+
+// MatchProduct looks products up by SKU, falling back to a product of the same
+// name without one so that a catalog created before SKUs can be adopted by an
+// import. Products without a SKU are matched on name alone.
+func (s *GormStore) MatchProduct(ctx context.Context, product models.Product) (models.Product, bool, error) {
+	if product.SKU != "" {
+		existing, found, err := s.findProduct(ctx, "sku = ?", product.SKU)
+		if found || err != nil {
+			return existing, found, err
+		}
+		return s.findProduct(ctx, "name = ? AND (sku = '' OR sku IS NULL)", product.Name)
+	}
+	return s.findProduct(ctx, "name = ?", product.Name)
+}
+
+func (s *GormStore) findProduct(ctx context.Context, query string, args ...interface{}) (models.Product, bool, error) {
+	var products []models.Product
+	if err := s.db.WithContext(ctx).Where(query, args...).Limit(1).Find(&products).Error; err != nil {
+		return models.Product{}, false, err
+	}
+	if len(products) == 0 {
+		return models.Product{}, false, nil
+	}
+	return products[0], true, nil
+}
+
+// UpsertUser raises UserChanged for a user it updates. A user it creates
+// hasn't signed up, so it doesn't raise UserRegistered.
+func (s *GormStore) UpsertUser(ctx context.Context, user models.User) (bool, error) {
+	var created bool
+	err := s.transaction(ctx, func(tx *GormStore) error {
+		var err error
+		created, err = tx.upsert(ctx, &models.User{}, "email = ?", user.Email, &user,
+			"Username", "Password", "Type")
+		if err != nil || created {
+			return err
+		}
+		updated, err := tx.GetUserByEmail(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		return tx.recordEvent(ctx, models.UserChanged{UserID: updated.ID})
+	})
+	if err != nil {
+		return false, fmt.Errorf("UpsertUser: %v", err)
+	}
+	return created, nil
+}
+
+func (s *GormStore) UpsertCoupon(ctx context.Context, coupon models.CouponObject) (bool, error) {
+	created, err := s.upsert(ctx, &models.CouponObject{}, "code = ?", coupon.Code, &coupon,
+		"Discount", "OrderFrequency", "SingleUse", "ExpiresAt")
+	if err != nil {
+		return false, fmt.Errorf("UpsertCoupon: %v", err)
+	}
+	return created, nil
+}
+
+// upsert creates record unless a row of the same model matches key, in which
+// case only columns are updated from it.
+func (s *GormStore) upsert(ctx context.Context, model interface{}, key string, value string, record interface{}, columns ...string) (bool, error) {
+	var id uint
+	err := s.db.WithContext(ctx).Model(model).Select("id").Where(key, value).Limit(1).Scan(&id).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if id == 0 {
+		return true, s.db.WithContext(ctx).Create(record).Error
+	}
+	return false, s.db.WithContext(ctx).Model(model).Where("id = ?", id).Select(columns).Updates(record).Error
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *GormStore) AddWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	if err := s.db.WithContext(ctx).Create(&sub).Error; err != nil {
+		return sub, fmt.Errorf("AddWebhookSubscription: %v", err)
+	}
+	return sub, nil
+}
+
+func (s *GormStore) GetWebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subs []models.WebhookSubscription
+	if err := s.db.WithContext(ctx).Order("id").Find(&subs).Error; err != nil {
+		return nil, fmt.Errorf("GetWebhookSubscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+func (s *GormStore) GetWebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&sub).Error; err != nil {
+		return sub, fmt.Errorf("GetWebhookSubscription: %w", translate(err))
+	}
+	return sub, nil
+}
+
+func (s *GormStore) SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	if err := s.db.WithContext(ctx).Save(&sub).Error; err != nil {
+		return fmt.Errorf("SaveWebhookSubscription: %v", err)
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription deletes the subscription but keeps its delivery
+// log. Deliveries still queued for it are given up on when they come due.
+func (s *GormStore) DeleteWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	if err := s.db.WithContext(ctx).Delete(&sub).Error; err != nil {
+		return fmt.Errorf("DeleteWebhookSubscription: %v", err)
+	}
+	return nil
+}
+
+func (s *GormStore) EnqueueWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := s.db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("EnqueueWebhookDeliveries: %v", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries claims each due delivery with an update that only
+// matches while it's still due, so a delivery read by two dispatchers at once
+// is claimed by just one of them.
+func (s *GormStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	err := s.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).
+		Find(&due).Error
+	if err != nil {
+		return nil, fmt.Errorf("ClaimWebhookDeliveries: %v", err)
+	}
+
+	claimed := due[:0]
+	until := now.Add(lease)
+	for _, delivery := range due {
+		result := s.db.WithContext(ctx).Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, models.WebhookDeliveryPending, now).
+			Update("next_attempt_at", until)
+		if result.Error != nil {
+			return claimed, fmt.Errorf("ClaimWebhookDeliveries: %v", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			delivery.NextAttemptAt = until
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *GormStore) RecordWebhookAttempt(ctx context.Context, delivery models.WebhookDelivery, attempt models.WebhookAttempt) (models.WebhookDelivery, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&delivery).Error; err != nil {
+			return err
+		}
+		attempt.DeliveryID = delivery.ID
+		return tx.Create(&attempt).Error
+	})
+	if err != nil {
+		return delivery, fmt.Errorf("RecordWebhookAttempt: %v", err)
+	}
+	return delivery, nil
+}
+
+func (s *GormStore) SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	if err := s.db.WithContext(ctx).Omit(clause.Associations).Save(&delivery).Error; err != nil {
+		return fmt.Errorf("SaveWebhookDelivery: %v", err)
+	}
+	return nil
+}
+
+func (s *GormStore) GetWebhookDeliveries(ctx context.Context, subscriptionID string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Order("id desc").Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("GetWebhookDeliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+func (s *GormStore) GetWebhookDelivery(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := s.db.WithContext(ctx).
+		Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ?", id).First(&delivery).Error
+	if err != nil {
+		return delivery, fmt.Errorf("GetWebhookDelivery: %w", translate(err))
+	}
+	return delivery, nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/cache"
+	"github.com/Rohanrevanth/e-store-go/catalog"
+	"github.com/Rohanrevanth/e-store-go/config"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/seed"
+	"github.com/Rohanrevanth/e-store-go/webhooks"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage: e-store [flags] [command]
+
+Without a command the server is started. Settings are read from the -config
+file, then environment variables, then flags.
+
+commands:
+  config                   print the settings in effect, with secrets hidden
+  migrate up [N]           apply all pending migrations, or the next N
+  migrate down [N]         revert the last migration, or the last N
+  migrate status           list migrations and whether they have been applied
+  migrate create NAME      write empty up/down SQL files for a new migration
+  migrate force VERSION    mark a migration applied once a dirty schema is repaired
+  seed [-dir DIR]          load the fixtures in DIR (default mock-data), updating existing records
+  seed fake [flags]        generate a fake catalog, users and orders for load testing
+  import [-dry-run] FILE   upsert products by SKU from a .csv or .jsonl file
+  export [-format F] KIND  write products, categories, orders or customers to stdout`
+
+// runCommand runs one of the maintenance commands instead of the server
+func runCommand(cfg config.Config, command string, args []string) error {
+	switch command {
+	case "config":
+		return yaml.NewEncoder(os.Stdout).Encode(cfg.Redacted())
+	case "migrate":
+		return runMigrate(cfg.Database.Config(), args)
+	case "seed":
+		return runSeed(cfg, args)
+	case "import":
+		return runImport(cfg, args)
+	case "export":
+		return runExport(cfg, args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func runMigrate(dbConfig database.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "../database/migrations", "where migrate create writes new migrations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return fmt.Errorf("migrate needs a subcommand")
+	}
+
+	db, err := database.ConnectDatabase(dbConfig)
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+
+	count := 0
+	if len(args) > 1 && args[0] != "create" {
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("migrate %s: %q isn't a number", args[0], args[1])
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(db, count)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("nothing to apply")
+		}
+		return err
+	case "down":
+		reverted, err := database.MigrateDown(db, count)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("nothing to revert")
+		}
+		return err
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.Dirty {
+				status = "DIRTY"
+			} else if state.Applied {
+				status = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", state.Version, state.Name, status)
+		}
+		return nil
+	case "create":
+		if len(args) < 2 {
+			return fmt.Errorf("migrate create needs a name")
+		}
+		paths, err := database.CreateMigration(db, *dir, args[1])
+		for _, path := range paths {
+			fmt.Println("created", path)
+		}
+		return err
+	case "force":
+		if count == 0 {
+			return fmt.Errorf("migrate force needs a version")
+		}
+		return database.ForceMigration(db, int64(count))
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return fmt.Errorf("unknown migrate subcommand %q", args[0])
+	}
+}
+
+func runSeed(cfg config.Config, args []string) error {
+	if len(args) > 0 && args[0] == "fake" {
+		return runSeedFake(cfg, args[1:])
+	}
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	dir := flags.String("dir", "mock-data", "directory holding the fixture files")
+	stock := flags.Int("stock", 100, "stock given to new products without one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fixtures, err := seed.LoadFixtures(*dir)
+	if err != nil {
+		return err
+	}
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	report, err := seed.Seed(context.Background(), store, fixtures, seed.Options{DefaultStock: *stock})
+	printReport(report)
+	return err
+}
+
+func runSeedFake(cfg config.Config, args []string) error {
+	opts := seed.DefaultGenerateOptions()
+	flags := flag.NewFlagSet("seed fake", flag.ContinueOnError)
+	flags.IntVar(&opts.Categories, "categories", opts.Categories, "number of categories")
+	flags.IntVar(&opts.Products, "products", opts.Products, "number of products")
+	flags.IntVar(&opts.Users, "users", opts.Users, "number of users, all with password "+seed.FakePassword)
+	flags.IntVar(&opts.OrdersPerUser, "orders", opts.OrdersPerUser, "orders placed by each user")
+	flags.IntVar(&opts.MaxOrderItems, "items", opts.MaxOrderItems, "most products in one order")
+	flags.Uint64Var(&opts.Seed, "seed", opts.Seed, "random seed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	report, err := seed.Generate(context.Background(), store, opts)
+	printReport(report.Report)
+	fmt.Printf("orders:     %d placed\n", report.Orders)
+	return err
+}
+
+// withEvents returns store, dispatching the events of its changes on bus as
+// they're made
+func withEvents(store database.Store, bus *events.Bus, logger *slog.Logger) database.Store {
+	dispatcher := events.NewDispatcher(store, bus)
+	dispatcher.Logger = logger
+	return events.NewStore(store, dispatcher)
+}
+
+// openStore connects to the database and brings its schema up to date. The
+// changes made through it run the subscribers the application relies on and
+// queue webhooks, and with Redis configured invalidate what the servers have
+// cached; nothing is sent to customers. Events that can't be dispatched as
+// the changes are made are left for the server.
+func openStore(cfg config.Config) (database.Store, func(), error) {
+	db, err := database.ConnectDatabase(cfg.Database.Config())
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := database.MigrateUp(db, 0); err != nil {
+		database.Close(db)
+		return nil, nil, err
+	}
+	store := database.NewGormStore(db)
+	bus := events.NewBus()
+	if cfg.Redis.URL != "" {
+		redisCache, err := cache.ConnectRedis(cfg.Redis.URL)
+		if err != nil {
+			database.Close(db)
+			return nil, nil, err
+		}
+		cache.Subscribe(bus, cache.NewStore(store, redisCache, time.Duration(cfg.Cache.TTL)))
+	}
+	events.SubscribeDefaults(bus, store, nil)
+	webhooks.Subscribe(bus, store)
+	return withEvents(store, bus, slog.Default()), func() { database.Close(db) }, nil
+}
+
+func printReport(report seed.Report) {
+	fmt.Printf("categories: %s\n", report.Categories)
+	fmt.Printf("products:   %s\n", report.Products)
+	fmt.Printf("users:      %s\n", report.Users)
+	fmt.Printf("coupons:    %s\n", report.Coupons)
+}
+
+func runImport(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing it")
+	formatName := flags.String("format", "", "csv or jsonl, by default from the file extension")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import needs a file")
+	}
+	path := flags.Arg(0)
+
+	format, err := catalog.FormatOf("", path)
+	if *formatName != "" {
+		format, err = catalog.ParseFormat(*formatName)
+	}
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	report, err := catalog.Import(context.Background(), store, file, format, catalog.ImportOptions{DryRun: *dryRun})
+	for _, rowErr := range report.Errors {
+		fmt.Printf("row %d %s: %s\n", rowErr.Row, rowErr.SKU, rowErr.Error)
+	}
+	if report.Failed > len(report.Errors) {
+		fmt.Printf("... and %d more failed rows\n", report.Failed-len(report.Errors))
+	}
+	fmt.Printf("%d rows: %d created, %d updated, %d failed\n", report.Rows, report.Created, report.Updated, report.Failed)
+	if *dryRun {
+		fmt.Println("dry run, nothing was changed")
+	}
+	return err
+}
+
+func runExport(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "csv", "csv or jsonl")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("export needs one of %s", strings.Join(catalog.ExportKinds, ", "))
+	}
+	format, err := catalog.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	return catalog.NewExporter(store).Export(context.Background(), flags.Arg(0), format, os.Stdout)
+}
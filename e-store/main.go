@@ -1,12 +1,271 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/cache"
+	"github.com/Rohanrevanth/e-store-go/config"
+	"github.com/Rohanrevanth/e-store-go/controllers"
 	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/grpc"
+	"github.com/Rohanrevanth/e-store-go/health"
 	"github.com/Rohanrevanth/e-store-go/http"
+	"github.com/Rohanrevanth/e-store-go/jobs"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/Rohanrevanth/e-store-go/notify"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/Rohanrevanth/e-store-go/tracing"
+	"github.com/Rohanrevanth/e-store-go/webhooks"
 )
 
 func main() {
-	database.ConnectDatabase()
-	// database.InitializeRedis()
-	http.StartServer()
+	flags := flag.NewFlagSet("e-store", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "%s\n\nflags:\n", usage)
+		flags.PrintDefaults()
+	}
+	cfg, err := config.Load(flags, os.Args[1:])
+	if err != nil {
+		fatal(err)
+	}
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal(err)
+	}
+	// Everything logs through it, including what's written with the log package
+	slog.SetDefault(logger)
+	auth.SetJWTKey([]byte(cfg.Auth.JWTKey))
+
+	if args := flags.Args(); len(args) > 0 {
+		if err := runCommand(cfg, args[0], args[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if err := runServer(cfg, logger); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// runServer serves the API until SIGINT or SIGTERM, then lets the requests
+// in flight finish and closes the database and Redis connections.
+func runServer(cfg config.Config, logger *slog.Logger) error {
+	if cfg.Auth.JWTKey == config.DevJWTKey {
+		logger.Warn("Signing tokens with the development JWT key; set ESTORE_JWT_KEY or ESTORE_JWT_KEY_FILE")
+	}
+	if cfg.Payments.WebhookSecret == config.DevPaymentWebhookSecret {
+		logger.Warn("Verifying payment webhooks with the development secret; set ESTORE_PAYMENT_WEBHOOK_SECRET or ESTORE_PAYMENT_WEBHOOK_SECRET_FILE")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:       cfg.Tracing.Exporter,
+		Endpoint:       cfg.Tracing.Endpoint,
+		ServiceVersion: health.Build().Version,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Send the spans still buffered, including the shutdown's
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Error flushing traces", "error", err)
+		}
+	}()
+
+	db, err := database.ConnectDatabase(cfg.Database.Config())
+	if err != nil {
+		return err
+	}
+	defer database.Close(db)
+	if err := tracing.InstrumentDB(db); err != nil {
+		return err
+	}
+	// Bring the schema up to date, refusing to start on a dirty one
+	if applied, err := database.MigrateUp(db, 0); err != nil {
+		return err
+	} else if len(applied) > 0 {
+		logger.Info("Applied migrations", "migrations", len(applied))
+	}
+	cacheBackend, err := newCache(cfg.Redis.URL)
+	if err != nil {
+		return err
+	}
+	if closer, ok := cacheBackend.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if redisCache, ok := cacheBackend.(*cache.RedisCache); ok {
+		redisCache.AddHook(tracing.RedisHook{})
+	}
+	// Cart reminders and order confirmations are written to a file until a
+	// real mail sender is plugged in
+	notifier := notify.NewFileNotifier("notifications.log")
+	// The side effects of changes are dispatched from the outbox: emptying the
+	// cart an order was placed from, invalidating what the changes make stale
+	// in the cache, queueing webhooks and streaming orders over gRPC
+	gormStore := database.NewGormStore(db)
+	cached := cache.NewStore(gormStore, cacheBackend, time.Duration(cfg.Cache.TTL))
+	orderEvents := grpc.NewOrderEvents()
+	bus := events.NewBus()
+	cache.Subscribe(bus, cached)
+	events.SubscribeDefaults(bus, gormStore, notifier)
+	webhooks.Subscribe(bus, gormStore)
+	orderEvents.Listen(bus, gormStore)
+	outbox := eventDispatcher(gormStore, bus, cfg.Events, logger)
+	store := events.NewStore(cached, outbox)
+
+	jobDone := make(chan struct{})
+	go func() {
+		defer close(jobDone)
+		abandonedCartJob(store, notifier, cfg.AbandonedCarts, logger).Run(ctx)
+	}()
+	defer func() { <-jobDone }()
+
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		outbox.Run(ctx)
+	}()
+	defer func() { <-outboxDone }()
+
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		webhookDispatcher(store, cfg.Webhooks, logger).Run(ctx)
+	}()
+	defer func() { <-dispatcherDone }()
+
+	// Payments go through the fake gateway until a real provider is configured.
+	// It picks up the payments made before the last restart from the store.
+	provider := payments.NewFakeProvider(payments.FakeConfig{WebhookSecret: cfg.Payments.WebhookSecret})
+	stored, err := store.GetProviderPayments(ctx, provider.Name())
+	if err != nil {
+		return err
+	}
+	provider.Load(stored)
+	handler := controllers.NewHandler(store, provider)
+	handler.CartMergeRule = cfg.Carts.MergeRule
+	handler.CartTokens = auth.CartTokens{
+		Lifetime: time.Duration(cfg.Carts.GuestTokenLifetime),
+		Secure:   httpConfig(cfg.Server, logger).TLS(),
+	}
+	handler.Metrics.Token = cfg.Metrics.Token
+	handler.GraphQL.MaxComplexity = cfg.GraphQL.MaxComplexity
+	handler.GraphQL.MaxDepth = cfg.GraphQL.MaxDepth
+	if err := handler.Metrics.InstrumentDB(db); err != nil {
+		return err
+	}
+	handler.Health.Add("database", func(ctx context.Context) error { return database.Ping(ctx, db) })
+	handler.Health.Add("migrations", func(ctx context.Context) error { return database.CheckSchema(db.WithContext(ctx)) })
+	if redisCache, ok := cacheBackend.(*cache.RedisCache); ok {
+		handler.Health.Add("redis", redisCache.Ping)
+	}
+
+	// Either server failing stops the other
+	grpcDone := make(chan error, 1)
+	if cfg.GRPC.Addr != "" {
+		go func() {
+			err := grpc.StartServer(ctx, store, orderEvents, grpcConfig(cfg, logger))
+			if err != nil {
+				stop()
+			}
+			grpcDone <- err
+		}()
+	} else {
+		grpcDone <- nil
+	}
+	err = http.StartServer(ctx, handler, httpConfig(cfg.Server, logger))
+	stop()
+	if grpcErr := <-grpcDone; err == nil {
+		err = grpcErr
+	}
+	if err == nil {
+		logger.Info("Server stopped")
+	}
+	return err
+}
+
+func httpConfig(server config.Server, logger *slog.Logger) http.Config {
+	return http.Config{
+		Addr:              server.Addr,
+		CORSOrigins:       server.CORSOrigins,
+		ReadTimeout:       time.Duration(server.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(server.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(server.WriteTimeout),
+		IdleTimeout:       time.Duration(server.IdleTimeout),
+		ShutdownDelay:     time.Duration(server.ShutdownDelay),
+		ShutdownTimeout:   time.Duration(server.ShutdownTimeout),
+		TLSCertFile:       server.TLS.CertFile,
+		TLSKeyFile:        server.TLS.KeyFile,
+		SelfSignedTLS:     server.TLS.SelfSigned,
+		H2C:               server.H2C,
+		Logger:            logger,
+	}
+}
+
+func grpcConfig(cfg config.Config, logger *slog.Logger) grpc.Config {
+	return grpc.Config{
+		Addr:            cfg.GRPC.Addr,
+		TLSCertFile:     cfg.Server.TLS.CertFile,
+		TLSKeyFile:      cfg.Server.TLS.KeyFile,
+		ShutdownTimeout: time.Duration(cfg.Server.ShutdownTimeout),
+		Logger:          logger,
+	}
+}
+
+func webhookDispatcher(store database.WebhookStore, cfg config.Webhooks, logger *slog.Logger) *webhooks.Dispatcher {
+	dispatcher := webhooks.NewDispatcher(store)
+	dispatcher.Interval = time.Duration(cfg.Interval)
+	dispatcher.Client.Timeout = time.Duration(cfg.Timeout)
+	dispatcher.MaxAttempts = cfg.MaxAttempts
+	dispatcher.AllowPrivate = cfg.AllowPrivateNetworks
+	dispatcher.Logger = logger
+	return dispatcher
+}
+
+func eventDispatcher(store database.OutboxStore, bus *events.Bus, cfg config.Events, logger *slog.Logger) *events.Dispatcher {
+	dispatcher := events.NewDispatcher(store, bus)
+	dispatcher.Interval = time.Duration(cfg.Interval)
+	dispatcher.MaxAttempts = cfg.MaxAttempts
+	dispatcher.Retention = time.Duration(cfg.Retention)
+	dispatcher.Logger = logger
+	return dispatcher
+}
+
+func abandonedCartJob(store database.Store, notifier notify.Notifier, cfg config.AbandonedCarts, logger *slog.Logger) *jobs.AbandonedCartJob {
+	job := jobs.NewAbandonedCartJob(store, notifier)
+	job.IdleAfter = time.Duration(cfg.IdleAfter)
+	job.Interval = time.Duration(cfg.Interval)
+	job.CouponDiscount = cfg.CouponDiscount
+	job.CouponValidFor = time.Duration(cfg.CouponValidFor)
+	job.Logger = logger
+	return job
+}
+
+// newCache returns a Redis cache if url is set, so that every server shares
+// it, and an in-process one otherwise.
+func newCache(url string) (cache.Cache, error) {
+	if url == "" {
+		return cache.NewLRUCache(10000), nil
+	}
+	return cache.ConnectRedis(url)
 }
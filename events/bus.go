@@ -0,0 +1,80 @@
+// Package events runs the side effects of changes to the store after they're
+// committed. The store records a domain event, such as models.OrderPlaced, in
+// its outbox in the same transaction as the change; a Dispatcher then claims
+// each event and runs the handlers subscribed to it on a Bus, retrying the
+// ones that fail. A handler runs at least once per event, and may run again
+// if its dispatcher stops before recording that it succeeded, so it should
+// cope with seeing an event twice.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Bus holds the handlers subscribed to each event
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]handler
+}
+
+// handler is a subscriber's handler, taking the event as recorded
+type handler struct {
+	name   string
+	handle func(ctx context.Context, payload []byte) error
+}
+
+// NewBus returns a bus without any subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]handler)}
+}
+
+// Subscribe has handle called with every event of type T. The name identifies
+// the subscriber in the outbox, which records the subscribers that have
+// handled an event, so it has to be unique among T's subscribers and stay the
+// same across releases.
+func Subscribe[T models.DomainEvent](bus *Bus, name string, handle func(ctx context.Context, event T) error) {
+	var zero T
+	eventName := zero.EventName()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for _, existing := range bus.handlers[eventName] {
+		if existing.name == name {
+			panic(fmt.Sprintf("events: %s is already subscribed to %s", name, eventName))
+		}
+	}
+	bus.handlers[eventName] = append(bus.handlers[eventName], handler{
+		name: name,
+		handle: func(ctx context.Context, payload []byte) error {
+			var event T
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return fmt.Errorf("malformed %s: %v", eventName, err)
+			}
+			return handle(ctx, event)
+		},
+	})
+}
+
+// subscribers returns the handlers of the named event, in the order they
+// subscribed
+func (b *Bus) subscribers(eventName string) []handler {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.handlers[eventName]
+}
+
+// call runs the handler, turning a panic into an error so that one bad event
+// can't stop the dispatcher
+func (h handler) call(ctx context.Context, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.handle(ctx, payload)
+}
@@ -0,0 +1,206 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"go.opentelemetry.io/otel"
+)
+
+// Defaults for a Dispatcher
+const (
+	DefaultInterval    = time.Second
+	DefaultMaxAttempts = 10
+	DefaultRetention   = 7 * 24 * time.Hour
+)
+
+// pruneInterval is how often Run deletes the events that have been
+// dispatched for longer than Retention
+const pruneInterval = time.Hour
+
+// Dispatcher hands the events in the outbox to their subscribers, oldest
+// first. An event any of whose handlers fail is tried again after BaseDelay,
+// doubling with each attempt up to MaxDelay, running only the handlers that
+// haven't succeeded yet; after MaxAttempts it's marked failed and left in the
+// outbox. Dispatched events are deleted once they're older than Retention.
+// Several dispatchers can share a database, as each event is claimed by one
+// of them at a time.
+type Dispatcher struct {
+	Outbox      database.OutboxStore
+	Bus         *Bus
+	Interval    time.Duration // How often to look for due events
+	BatchSize   int           // How many events to claim at once
+	MaxAttempts int           // Attempts before an event is given up on
+	BaseDelay   time.Duration // Wait before the first retry
+	MaxDelay    time.Duration // Longest wait between retries
+	// Lease is how long a claimed event is held for its dispatcher, after
+	// which another may take it over, in case the first stopped partway
+	Lease time.Duration
+	// Retention is how long dispatched events are kept, to look into what
+	// happened, zero keeping them for good
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+// NewDispatcher returns a dispatcher of the events in store to the subscribers
+// on bus, checking every second, retrying from 10 seconds up to an hour apart,
+// 10 times, and keeping dispatched events for a week
+func NewDispatcher(store database.OutboxStore, bus *Bus) *Dispatcher {
+	return &Dispatcher{
+		Outbox:      store,
+		Bus:         bus,
+		Interval:    DefaultInterval,
+		BatchSize:   50,
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   10 * time.Second,
+		MaxDelay:    time.Hour,
+		Lease:       time.Minute,
+		Retention:   DefaultRetention,
+		Logger:      slog.Default(),
+	}
+}
+
+// Run dispatches due events every Interval until ctx is cancelled, going
+// straight on to the next batch while there are more due, and prunes the
+// dispatched events every hour
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		n, err := d.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.Logger.Error("Error dispatching events", "error", err)
+		}
+		if n == d.BatchSize && err == nil {
+			continue
+		}
+		if d.Retention > 0 && time.Since(pruned) >= pruneInterval {
+			d.prune(ctx)
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce dispatches a batch of due events, returning how many it claimed
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	events, err := d.Outbox.ClaimOutboxEvents(ctx, time.Now(), d.Lease, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return d.dispatchAll(ctx, "Dispatcher.RunOnce", events)
+}
+
+// Dispatch dispatches the events with the given IDs, such as those a change
+// just recorded, if they're still due, returning how many it claimed
+func (d *Dispatcher) Dispatch(ctx context.Context, ids []uint) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	events, err := d.Outbox.ClaimOutboxEventsByID(ctx, ids, time.Now(), d.Lease)
+	if err != nil {
+		return 0, err
+	}
+	return d.dispatchAll(ctx, "Dispatcher.Dispatch", events)
+}
+
+// dispatchAll dispatches the claimed events in a span called name. Only
+// batches with events in them are traced, so that idle polls don't fill the
+// traces.
+func (d *Dispatcher) dispatchAll(ctx context.Context, name string, events []models.OutboxEvent) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+	ctx, span := otel.Tracer("github.com/Rohanrevanth/e-store-go/events").Start(ctx, name)
+	defer span.End()
+
+	for i, event := range events {
+		if err := d.dispatch(ctx, event); err != nil {
+			if ctx.Err() != nil {
+				return i, ctx.Err()
+			}
+			d.Logger.Error("Error dispatching event", "event_id", event.ID, "event", event.Name, "error", err)
+		}
+	}
+	return len(events), nil
+}
+
+// prune deletes the events dispatched more than Retention ago
+func (d *Dispatcher) prune(ctx context.Context) {
+	n, err := d.Outbox.PruneOutboxEvents(ctx, time.Now().Add(-d.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.Logger.Error("Error pruning dispatched events", "error", err)
+		}
+		return
+	}
+	if n > 0 {
+		d.Logger.Info("Pruned dispatched events", "events", n)
+	}
+}
+
+// dispatch runs the handlers that haven't yet succeeded for a claimed event
+// and records how they did. An event cut short by ctx isn't recorded; it's
+// dispatched again once its lease is up.
+func (d *Dispatcher) dispatch(ctx context.Context, event models.OutboxEvent) error {
+	var failures []string
+	for _, h := range d.Bus.subscribers(event.Name) {
+		if slices.Contains(event.Handled, h.name) {
+			continue
+		}
+		err := h.call(ctx, []byte(event.Payload))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			failures = append(failures, h.name+": "+err.Error())
+			continue
+		}
+		event.Handled = append(event.Handled, h.name)
+	}
+
+	event.Attempts++
+	now := time.Now()
+	switch {
+	case len(failures) == 0:
+		event.Status = models.OutboxDispatched
+		event.DispatchedAt = &now
+		event.LastError = ""
+	case event.Attempts >= d.MaxAttempts:
+		event.Status = models.OutboxFailed
+		event.LastError = strings.Join(failures, "; ")
+		d.Logger.Warn("Gave up on an event", "event_id", event.ID, "event", event.Name, "attempts", event.Attempts, "error", event.LastError)
+	default:
+		event.NextAttemptAt = now.Add(d.backoff(event.Attempts))
+		event.LastError = strings.Join(failures, "; ")
+	}
+	return d.Outbox.SaveOutboxEvent(ctx, event)
+}
+
+// backoff returns the wait after an event's nth failed attempt: BaseDelay
+// doubled for each earlier attempt, capped at MaxDelay, and shortened by up to
+// a tenth at random so that events that failed together are spread out
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.MaxDelay)
+	if jitter := int64(delay / 10); jitter > 0 {
+		delay -= time.Duration(rand.N(jitter))
+	}
+	return delay
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// newTestDispatcher returns a dispatcher of the events in store to bus that
+// retries failed events straight away
+func newTestDispatcher(store database.OutboxStore, bus *Bus) *Dispatcher {
+	d := NewDispatcher(store, bus)
+	d.BaseDelay, d.MaxDelay = time.Nanosecond, time.Nanosecond
+	d.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return d
+}
+
+// countCalls subscribes a handler of UserRegistered events to bus that fails
+// while fail says so, returning the number of times it's been called
+func countCalls(bus *Bus, name string, fail func(call int) bool) *int {
+	calls := new(int)
+	Subscribe(bus, name, func(ctx context.Context, event models.UserRegistered) error {
+		*calls++
+		if fail(*calls) {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	return calls
+}
+
+func never(int) bool { return false }
+
+// runOnce runs a batch of d, expecting it to claim want events
+func runOnce(t *testing.T, d *Dispatcher, want int) {
+	t.Helper()
+	n, err := d.RunOnce(context.Background())
+	if err != nil || n != want {
+		t.Fatalf("dispatching claimed %d events (%v), want %d", n, err, want)
+	}
+}
+
+func TestDispatcherRetriesOnlyFailedSubscribers(t *testing.T) {
+	store := database.NewMemoryStore()
+	bus := NewBus()
+	ok := countCalls(bus, "ok", never)
+	flaky := countCalls(bus, "flaky", func(call int) bool { return call == 1 })
+	d := newTestDispatcher(store, bus)
+
+	if err := store.AddUser(context.Background(), models.User{Username: "a", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	runOnce(t, d, 1)
+	if *ok != 1 || *flaky != 1 {
+		t.Fatalf("subscribers ran %d and %d times, want once each", *ok, *flaky)
+	}
+	runOnce(t, d, 1)
+	if *ok != 1 || *flaky != 2 {
+		t.Errorf("on retrying, subscribers ran %d and %d times, want only the failed one again", *ok, *flaky)
+	}
+	runOnce(t, d, 0)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	store := database.NewMemoryStore()
+	bus := NewBus()
+	broken := countCalls(bus, "broken", func(int) bool { return true })
+	d := newTestDispatcher(store, bus)
+	d.MaxAttempts = 3
+
+	if err := store.AddUser(context.Background(), models.User{Username: "a", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for range d.MaxAttempts {
+		runOnce(t, d, 1)
+	}
+	runOnce(t, d, 0)
+	if *broken != d.MaxAttempts {
+		t.Errorf("a failing subscriber ran %d times, want %d", *broken, d.MaxAttempts)
+	}
+}
+
+func TestDispatcherSurvivesPanics(t *testing.T) {
+	store := database.NewMemoryStore()
+	bus := NewBus()
+	Subscribe(bus, "panics", func(ctx context.Context, event models.UserRegistered) error {
+		panic("bad event")
+	})
+	after := countCalls(bus, "after", never)
+	d := newTestDispatcher(store, bus)
+
+	if err := store.AddUser(context.Background(), models.User{Username: "a", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	runOnce(t, d, 1)
+	if *after != 1 {
+		t.Errorf("the subscriber after one that panicked ran %d times, want once", *after)
+	}
+	runOnce(t, d, 1) // The one that panicked is retried
+}
+
+func TestStoreDispatchesItsChanges(t *testing.T) {
+	memory := database.NewMemoryStore()
+	bus := NewBus()
+	calls := countCalls(bus, "count", never)
+	d := newTestDispatcher(memory, bus)
+	store := NewStore(memory, d)
+
+	// An event recorded before, such as by a seed, is left to Run
+	if err := memory.AddUser(context.Background(), models.User{Username: "a", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUser(context.Background(), models.User{Username: "b", Email: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 1 {
+		t.Fatalf("adding a user ran the subscriber %d times, want once", *calls)
+	}
+	runOnce(t, d, 1)
+	if *calls != 2 {
+		t.Errorf("the subscriber ran %d times after dispatching the rest, want twice", *calls)
+	}
+}
+
+func TestSubscribeRefusesDuplicateNames(t *testing.T) {
+	bus := NewBus()
+	countCalls(bus, "count", never)
+	defer func() {
+		if recover() == nil {
+			t.Error("subscribing a name twice didn't panic")
+		}
+	}()
+	countCalls(bus, "count", never)
+}
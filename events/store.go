@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Store is a store that dispatches the events its changes raise before
+// returning, so that callers see the side effects, such as the cart emptied
+// once an order's payment is authorized or a changed product's cached lists
+// invalidated, as soon as the change is made. Only the events the change
+// recorded are dispatched, leaving those of other requests to theirs. Events
+// whose handlers fail are left to the Dispatcher's Run to retry, as are those
+// raised by the bulk upserts of seeds and imports.
+type Store struct {
+	database.Store
+	Dispatcher *Dispatcher
+}
+
+var _ database.Store = (*Store)(nil)
+
+// NewStore returns store, dispatching the events of its changes with dispatcher
+func NewStore(store database.Store, dispatcher *Dispatcher) *Store {
+	return &Store{Store: store, Dispatcher: dispatcher}
+}
+
+func (s *Store) AddUser(ctx context.Context, user models.User) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.AddUser(ctx, user)
+	})
+}
+
+func (s *Store) SaveUser(ctx context.Context, user models.User) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.SaveUser(ctx, user)
+	})
+}
+
+func (s *Store) DeleteUser(ctx context.Context, user models.User) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.DeleteUser(ctx, user)
+	})
+}
+
+func (s *Store) AddCategory(ctx context.Context, category models.Category) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.AddCategory(ctx, category)
+	})
+}
+
+func (s *Store) AddProduct(ctx context.Context, product models.Product) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.AddProduct(ctx, product)
+	})
+}
+
+func (s *Store) AdjustStock(ctx context.Context, productID uint, delta int) (models.Product, error) {
+	var product models.Product
+	err := s.dispatch(ctx, func(ctx context.Context) (err error) {
+		product, err = s.Store.AdjustStock(ctx, productID, delta)
+		return err
+	})
+	return product, err
+}
+
+func (s *Store) AddItemToCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.AddItemToCart(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *Store) SetCartItemQuantity(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.SetCartItemQuantity(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *Store) RemoveItemFromCart(ctx context.Context, userID string, productID uint, quantity int) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.RemoveItemFromCart(ctx, userID, productID, quantity)
+	})
+}
+
+func (s *Store) MergeCarts(ctx context.Context, fromOwner string, toOwner string, rule string) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.MergeCarts(ctx, fromOwner, toOwner, rule)
+	})
+}
+
+func (s *Store) PlaceOrder(ctx context.Context, details models.Order) (models.Order, error) {
+	var order models.Order
+	err := s.dispatch(ctx, func(ctx context.Context) (err error) {
+		order, err = s.Store.PlaceOrder(ctx, details)
+		return err
+	})
+	return order, err
+}
+
+func (s *Store) UpdateOrderStatus(ctx context.Context, id string, status string) error {
+	return s.dispatch(ctx, func(ctx context.Context) error {
+		return s.Store.UpdateOrderStatus(ctx, id, status)
+	})
+}
+
+func (s *Store) CompleteReturn(ctx context.Context, request models.ReturnRequest, payment models.Payment, refund models.Transaction, restock bool) (models.ReturnRequest, error) {
+	err := s.dispatch(ctx, func(ctx context.Context) (err error) {
+		request, err = s.Store.CompleteReturn(ctx, request, payment, refund, restock)
+		return err
+	})
+	return request, err
+}
+
+func (s *Store) RecordPaymentTransaction(ctx context.Context, payment models.Payment, txn models.Transaction) (models.Payment, error) {
+	err := s.dispatch(ctx, func(ctx context.Context) (err error) {
+		payment, err = s.Store.RecordPaymentTransaction(ctx, payment, txn)
+		return err
+	})
+	return payment, err
+}
+
+// dispatch makes the change and, if it succeeded, dispatches the events it
+// recorded, passing its error on. The change is committed by then, so failing
+// to dispatch is logged rather than returned.
+func (s *Store) dispatch(ctx context.Context, change func(ctx context.Context) error) error {
+	recordingCtx, recorded := database.WithRecordedEvents(ctx)
+	if err := change(recordingCtx); err != nil {
+		return err
+	}
+	if _, err := s.Dispatcher.Dispatch(ctx, recorded.IDs()); err != nil {
+		logging.FromContext(ctx).Warn("Failed to dispatch events", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/notify"
+)
+
+// SubscribeDefaults subscribes the side effects the application relies on to
+// bus: placing an order empties the lines it was made from out of the cart and
+// counts it against the user. Given a notifier, customers are also sent a
+// confirmation of each order and new users a welcome. An order is counted and
+// each email sent once, however many times its event is delivered.
+func SubscribeDefaults(bus *Bus, store database.Store, notifier notify.Notifier) {
+	Subscribe(bus, "clear-cart", func(ctx context.Context, event models.OrderPlaced) error {
+		return store.RemoveCartItems(ctx, event.UserID, event.CartItemIDs)
+	})
+	Subscribe(bus, "count-order", func(ctx context.Context, event models.OrderPlaced) error {
+		if models.IsGuestOwner(event.UserID) {
+			return nil
+		}
+		err := store.IncrementOrdersCount(ctx, event.UserID, event.OrderID)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil // Deleted since
+		}
+		return err
+	})
+	if notifier == nil {
+		return
+	}
+
+	Subscribe(bus, "order-confirmation", func(ctx context.Context, event models.OrderPlaced) error {
+		orderID := strconv.FormatUint(uint64(event.OrderID), 10)
+		return once(ctx, store, "order-confirmation", orderID, func() error {
+			order, err := store.GetOrder(ctx, orderID)
+			if err != nil {
+				return err
+			}
+			to := order.Email
+			if to == "" && !models.IsGuestOwner(order.UserID) {
+				if user, err := store.GetUserByID(ctx, order.UserID); err == nil {
+					to = user.Email
+				}
+			}
+			if to == "" {
+				return nil // No one to confirm it to
+			}
+			return notifier.Notify(ctx, notify.Message{
+				To:      to,
+				Subject: fmt.Sprintf("Your order #%d", order.ID),
+				Body:    confirmationBody(order),
+			})
+		})
+	})
+	Subscribe(bus, "welcome", func(ctx context.Context, event models.UserRegistered) error {
+		return once(ctx, store, "welcome", strconv.FormatUint(uint64(event.UserID), 10), func() error {
+			return notifier.Notify(ctx, notify.Message{
+				To:      event.Email,
+				Subject: "Welcome to the e-store",
+				Body:    fmt.Sprintf("Hi %s, thanks for signing up.\n", event.Username),
+			})
+		})
+	})
+}
+
+// once runs handle for the subscriber's event with key unless it's been run
+// for it before, for side effects the store can't roll back, such as emails.
+// The event is marked processed before handle runs, and unmarked if it fails
+// so that a retry runs it again; a server stopping in between loses the side
+// effect rather than repeating it.
+func once(ctx context.Context, store database.OutboxStore, subscriber string, key string, handle func() error) error {
+	first, err := store.MarkProcessed(ctx, subscriber, key)
+	if err != nil || !first {
+		return err
+	}
+	if err := handle(); err != nil {
+		if unmarkErr := store.UnmarkProcessed(ctx, subscriber, key); unmarkErr != nil {
+			return errors.Join(err, unmarkErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func confirmationBody(order models.Order) string {
+	var body strings.Builder
+	body.WriteString("Thanks for your order:\n")
+	for _, item := range order.OrderItems {
+		fmt.Fprintf(&body, "  %d x %s  %.2f\n", item.Quantity, item.Product.Name, float64(item.Quantity)*item.Price)
+	}
+	if order.Discount > 0 {
+		fmt.Fprintf(&body, "Discount: -%.2f\n", order.Discount)
+	}
+	fmt.Fprintf(&body, "Total: %.2f\n", order.TotalPrice)
+	return body.String()
+}
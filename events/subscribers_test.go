@@ -0,0 +1,156 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/notify"
+)
+
+// recordingNotifier keeps the messages it's given, failing the first fail of
+// them
+type recordingNotifier struct {
+	mu   sync.Mutex
+	fail int
+	sent []notify.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail > 0 {
+		n.fail--
+		return errors.New("mail server unavailable")
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+// deliver hands event to each of its subscribers on bus, as a dispatcher
+// would, returning the errors of those that failed
+func deliver(t *testing.T, bus *Bus, event models.DomainEvent) []error {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	for _, h := range bus.subscribers(event.EventName()) {
+		if err := h.call(context.Background(), payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// placeOrder has a new user order a mug, returning the user and the event of
+// the order being placed
+func placeOrder(t *testing.T, store *database.MemoryStore) (models.User, models.OrderPlaced) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.AddUser(ctx, models.User{Username: "customer", Email: "customer@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUserByEmail(ctx, "customer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddProduct(ctx, models.Product{Name: "Mug", Price: 10}); err != nil {
+		t.Fatal(err)
+	}
+	products, err := store.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+	if err := store.AddItemToCart(ctx, userID, products[0].ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	cart, err := store.GetUserCart(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := store.PlaceOrder(ctx, models.Order{UserID: userID, PaymentMethod: "card"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, models.OrderPlaced{OrderID: order.ID, UserID: userID, CartItemIDs: []uint{cart.Items[0].ID}}
+}
+
+func TestOrderPlacedHandledOnce(t *testing.T) {
+	store := database.NewMemoryStore()
+	notifier := &recordingNotifier{}
+	bus := NewBus()
+	SubscribeDefaults(bus, store, notifier)
+	user, placed := placeOrder(t, store)
+
+	for range 3 {
+		if errs := deliver(t, bus, placed); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+	if user, err := store.GetUserByID(context.Background(), strconv.FormatUint(uint64(user.ID), 10)); err != nil || user.OrdersCount != 1 {
+		t.Errorf("user has %d orders (%v) after the event came 3 times, want 1", user.OrdersCount, err)
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].To != user.Email {
+		t.Errorf("sent %v after the event came 3 times, want one confirmation to %s", notifier.sent, user.Email)
+	}
+	if cart, err := store.GetUserCart(context.Background(), strconv.FormatUint(uint64(user.ID), 10)); err != nil || len(cart.Items) != 0 {
+		t.Errorf("cart holds %v (%v), want it emptied", cart.Items, err)
+	}
+}
+
+func TestOrderConfirmationRetriedAfterFailing(t *testing.T) {
+	store := database.NewMemoryStore()
+	notifier := &recordingNotifier{fail: 1}
+	bus := NewBus()
+	SubscribeDefaults(bus, store, notifier)
+	user, placed := placeOrder(t, store)
+
+	if errs := deliver(t, bus, placed); len(errs) != 1 {
+		t.Fatalf("got errors %v, want the confirmation's", errs)
+	}
+	if errs := deliver(t, bus, placed); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(notifier.sent) != 1 {
+		t.Errorf("sent %d confirmations after one failed, want 1", len(notifier.sent))
+	}
+	if user, err := store.GetUserByID(context.Background(), strconv.FormatUint(uint64(user.ID), 10)); err != nil || user.OrdersCount != 1 {
+		t.Errorf("user has %d orders (%v), want 1", user.OrdersCount, err)
+	}
+}
+
+func TestWelcomeSentOnce(t *testing.T) {
+	store := database.NewMemoryStore()
+	notifier := &recordingNotifier{}
+	bus := NewBus()
+	SubscribeDefaults(bus, store, notifier)
+
+	registered := models.UserRegistered{UserID: 1, Username: "customer", Email: "customer@example.com"}
+	for range 2 {
+		if errs := deliver(t, bus, registered); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+	if len(notifier.sent) != 1 || notifier.sent[0].To != registered.Email {
+		t.Errorf("sent %v after the event came twice, want one welcome", notifier.sent)
+	}
+}
+
+func TestGuestOrdersNotCounted(t *testing.T) {
+	store := database.NewMemoryStore()
+	bus := NewBus()
+	SubscribeDefaults(bus, store, nil)
+
+	placed := models.OrderPlaced{OrderID: 1, UserID: models.GuestOwner("abc")}
+	if errs := deliver(t, bus, placed); len(errs) != 0 {
+		t.Errorf("a guest's order gave %v", errs)
+	}
+}
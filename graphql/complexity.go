@@ -0,0 +1,133 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listFactor is how many records a list is assumed to hold when costing what
+// is selected on them. The stores don't page, so a list may hold many more;
+// the factor makes nesting lists in lists costly, which is what makes a
+// query expensive.
+const listFactor = 10
+
+// checkLimits rejects a document with an operation nested deeper than
+// MaxDepth fields or costing more than MaxComplexity. Each field costs 1
+// plus what's selected on it, counted listFactor times if it's a list.
+// Introspection fields cost 1 whatever they select, since the schema they
+// describe is small and fixed. The document must be valid.
+func (s *Server) checkLimits(doc *ast.Document) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		root := s.schema.QueryType()
+		if operation.Operation == ast.OperationTypeMutation {
+			root = s.schema.MutationType()
+		}
+		l := limits{schema: s.schema, fragments: fragments, maxDepth: s.MaxDepth}
+		cost, err := l.cost(operation.SelectionSet, root, 1)
+		if err != nil {
+			return err
+		}
+		if cost > s.MaxComplexity {
+			return newError(apierror.CodeValidationFailed,
+				fmt.Sprintf("The operation costs %d, more than the %d allowed; select fewer fields in lists", cost, s.MaxComplexity))
+		}
+	}
+	return nil
+}
+
+// limits costs the selections of one operation
+type limits struct {
+	schema    gql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	maxDepth  int
+}
+
+// cost returns the cost of selecting set on a value of type parent, at depth
+func (l limits) cost(set *ast.SelectionSet, parent gql.Type, depth int) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+	total := 0
+	for _, selection := range set.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			name := selection.Name.Value
+			if strings.HasPrefix(name, "__") {
+				total++
+				continue
+			}
+			if depth > l.maxDepth {
+				return 0, newError(apierror.CodeValidationFailed,
+					fmt.Sprintf("The operation is nested more than the %d fields deep allowed", l.maxDepth))
+			}
+			object, ok := parent.(*gql.Object)
+			if !ok {
+				return 0, fmt.Errorf("cost: %s isn't an object", parent)
+			}
+			field := object.Fields()[name]
+			children, err := l.cost(selection.SelectionSet, named(field.Type), depth+1)
+			if err != nil {
+				return 0, err
+			}
+			if isList(field.Type) {
+				children *= listFactor
+			}
+			total += 1 + children
+		case *ast.InlineFragment:
+			on := parent
+			if selection.TypeCondition != nil {
+				on = l.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			cost, err := l.cost(selection.SelectionSet, on, depth)
+			if err != nil {
+				return 0, err
+			}
+			total += cost
+		case *ast.FragmentSpread:
+			fragment := l.fragments[selection.Name.Value]
+			cost, err := l.cost(fragment.SelectionSet, l.schema.Type(fragment.TypeCondition.Name.Value), depth)
+			if err != nil {
+				return 0, err
+			}
+			total += cost
+		}
+	}
+	return total, nil
+}
+
+// isList reports whether t is a list, null or not
+func isList(t gql.Type) bool {
+	if nonNull, ok := t.(*gql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	_, ok := t.(*gql.List)
+	return ok
+}
+
+// named returns the type t is a list of, or t if it isn't a list
+func named(t gql.Type) gql.Type {
+	for {
+		switch wrapper := t.(type) {
+		case *gql.NonNull:
+			t = wrapper.OfType
+		case *gql.List:
+			t = wrapper.OfType
+		default:
+			return t
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/logging"
+)
+
+// storeErrors maps the errors the stores wrap to the codes they're reported
+// with, as the REST handlers do
+var storeErrors = []struct {
+	err  error
+	code apierror.Code
+}{
+	{database.ErrNotFound, apierror.CodeNotFound},
+	{database.ErrConflict, apierror.CodeConflict},
+	{database.ErrInvalidCartItem, apierror.CodeInvalidCartItem},
+	{database.ErrEmptyCart, apierror.CodeEmptyCart},
+	{database.ErrInsufficientStock, apierror.CodeInsufficientStock},
+	{database.ErrInvalidReturn, apierror.CodeInvalidReturn},
+	{database.ErrInvalidTransition, apierror.CodeInvalidTransition},
+}
+
+// Error is an error in a GraphQL result, whose code is one of the catalogue's
+type Error struct {
+	Code    apierror.Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Extensions adds the code to the error in the result
+func (e *Error) Extensions() map[string]any {
+	return map[string]any{"code": e.Code}
+}
+
+// newError returns an error with code, described by message
+func newError(code apierror.Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// failed reports err from a store. An error wrapping one of storeErrors
+// gets its code, and is described by the detail the store gave with it, such
+// as "quantity must be positive", or by message if it gave none. Any other
+// error is logged and reported as an internal error described by message.
+func failed(ctx context.Context, err error, message string) error {
+	for _, known := range storeErrors {
+		if errors.Is(err, known.err) {
+			var detailErr *database.DetailError
+			if errors.As(err, &detailErr) && detailErr.Detail != "" {
+				message = detailErr.Detail
+			}
+			return newError(known.code, message)
+		}
+	}
+	logging.FromContext(ctx).Error(message, "error", err)
+	return newError(apierror.CodeInternal, message)
+}
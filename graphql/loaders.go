@@ -0,0 +1,123 @@
+package graphql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+// batchWait is how long a loader waits for more keys before fetching. Every
+// field at one level of a query asks for its key before any is needed, so
+// this only has to cover the time resolving that level takes.
+const batchWait = 5 * time.Millisecond
+
+// loaders fetch the records many others refer to in batches, one fetch for
+// every order's user rather than one per order, and remember them for the
+// rest of the request
+type loaders struct {
+	users              *dataloader.Loader[string, *models.User]
+	ordersByUser       *dataloader.Loader[string, []models.Order]
+	categories         *dataloader.Loader[string, *models.Category]
+	products           *dataloader.Loader[uint, *models.Product]
+	productsByCategory *dataloader.Loader[string, []models.Product]
+}
+
+func (s *Server) newLoaders() *loaders {
+	return &loaders{
+		users:              newLoader(s.loadUsers),
+		ordersByUser:       newLoader(s.loadOrdersByUser),
+		categories:         newLoader(s.loadCategories),
+		products:           newLoader(s.loadProducts),
+		productsByCategory: newLoader(s.loadProductsByCategory),
+	}
+}
+
+func newLoader[K comparable, V any](batch dataloader.BatchFunc[K, V]) *dataloader.Loader[K, V] {
+	return dataloader.NewBatchedLoader(batch, dataloader.WithWait[K, V](batchWait))
+}
+
+type loadersKey struct{}
+
+// withLoaders returns ctx carrying l, so that resolvers share its batches
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func (s *Server) loadUsers(ctx context.Context, ids []string) []*dataloader.Result[*models.User] {
+	users, err := s.Users.GetUsersByIDs(ctx, ids)
+	byID := map[string]*models.User{}
+	for i := range users {
+		byID[idString(users[i].ID)] = &users[i]
+	}
+	return results(ids, byID, err)
+}
+
+func (s *Server) loadOrdersByUser(ctx context.Context, userIDs []string) []*dataloader.Result[[]models.Order] {
+	orders, err := s.Orders.GetOrdersByUserIDs(ctx, userIDs)
+	byUser := map[string][]models.Order{}
+	for _, order := range orders {
+		byUser[order.UserID] = append(byUser[order.UserID], order)
+	}
+	return results(userIDs, byUser, err)
+}
+
+// loadCategories finds categories by name. There are few enough to fetch
+// them all.
+func (s *Server) loadCategories(ctx context.Context, names []string) []*dataloader.Result[*models.Category] {
+	categories, err := s.Products.GetAllCategories(ctx)
+	byName := map[string]*models.Category{}
+	for i := range categories {
+		byName[categories[i].Name] = &categories[i]
+	}
+	return results(names, byName, err)
+}
+
+// loadProducts finds products by ID in the whole catalog, which the cache
+// keeps
+func (s *Server) loadProducts(ctx context.Context, ids []uint) []*dataloader.Result[*models.Product] {
+	products, err := s.Products.GetAllProducts(ctx)
+	byID := map[uint]*models.Product{}
+	for i := range products {
+		byID[products[i].ID] = &products[i]
+	}
+	return results(ids, byID, err)
+}
+
+// loadProductsByCategory fetches one category's products by themselves, and
+// the whole catalog for several
+func (s *Server) loadProductsByCategory(ctx context.Context, names []string) []*dataloader.Result[[]models.Product] {
+	var products []models.Product
+	var err error
+	if len(names) == 1 {
+		products, err = s.Products.GetProducts(ctx, names[0])
+	} else {
+		products, err = s.Products.GetAllProducts(ctx)
+	}
+	byCategory := map[string][]models.Product{}
+	for _, product := range products {
+		byCategory[product.Category] = append(byCategory[product.Category], product)
+	}
+	return results(names, byCategory, err)
+}
+
+// results returns what was found for each of keys, in order; a key that
+// wasn't found gets the zero value. If the fetch failed, every key gets err.
+func results[K comparable, V any](keys []K, found map[K]V, err error) []*dataloader.Result[V] {
+	out := make([]*dataloader.Result[V], len(keys))
+	for i, key := range keys {
+		out[i] = &dataloader.Result[V]{Data: found[key], Error: err}
+	}
+	return out
+}
+
+// idString formats a record's ID as the stores take it
+func idString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
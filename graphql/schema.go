@@ -0,0 +1,465 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/metrics"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/graph-gophers/dataloader/v7"
+	gql "github.com/graphql-go/graphql"
+)
+
+// newSchema builds the schema. Objects resolve from model values, not
+// pointers; fields named differently from the models' JSON are read by hand.
+func (s *Server) newSchema() (gql.Schema, error) {
+	var product, category, user, order *gql.Object
+
+	category = gql.NewObject(gql.ObjectConfig{
+		Name: "Category",
+		Fields: gql.FieldsThunk(func() gql.Fields {
+			return gql.Fields{
+				"id":          get(nonNull(gql.ID), func(c models.Category) any { return idString(c.ID) }),
+				"name":        get(nonNull(gql.String), func(c models.Category) any { return c.Name }),
+				"description": get(nonNull(gql.String), func(c models.Category) any { return c.Description }),
+				"image":       get(nonNull(gql.String), func(c models.Category) any { return c.Image }),
+				"products": {
+					Type: listOf(product),
+					Resolve: func(p gql.ResolveParams) (any, error) {
+						thunk := loadersFrom(p.Context).productsByCategory.Load(p.Context, p.Source.(models.Category).Name)
+						return many(p.Context, thunk, "Failed to retrieve products")
+					},
+				},
+			}
+		}),
+	})
+
+	product = gql.NewObject(gql.ObjectConfig{
+		Name: "Product",
+		Fields: gql.FieldsThunk(func() gql.Fields {
+			return gql.Fields{
+				"id":           get(nonNull(gql.ID), func(p models.Product) any { return idString(p.ID) }),
+				"sku":          get(gql.String, func(p models.Product) any { return optional(p.SKU) }),
+				"name":         get(nonNull(gql.String), func(p models.Product) any { return p.Name }),
+				"description":  get(nonNull(gql.String), func(p models.Product) any { return p.Description }),
+				"details":      get(nonNull(gql.String), func(p models.Product) any { return p.Details }),
+				"image":        get(nonNull(gql.String), func(p models.Product) any { return p.Image }),
+				"price":        get(nonNull(gql.Float), func(p models.Product) any { return p.Price }),
+				"isBestseller": get(nonNull(gql.Boolean), func(p models.Product) any { return p.Isbestseller }),
+				"stock":        get(nonNull(gql.Int), func(p models.Product) any { return p.Stock }),
+				"disabled":     get(nonNull(gql.Boolean), func(p models.Product) any { return p.Disabled }),
+				"categoryName": get(nonNull(gql.String), func(p models.Product) any { return p.Category }),
+				"category": {
+					Type:        category,
+					Description: "Null if the product's category isn't one of the categories",
+					Resolve: func(p gql.ResolveParams) (any, error) {
+						thunk := loadersFrom(p.Context).categories.Load(p.Context, p.Source.(models.Product).Category)
+						return one(p.Context, thunk, "Failed to retrieve categories")
+					},
+				},
+			}
+		}),
+	})
+
+	cartLine := gql.NewObject(gql.ObjectConfig{
+		Name: "CartLine",
+		Fields: gql.Fields{
+			"product":   get(nonNull(product), func(l models.CartLine) any { return l.Product }),
+			"quantity":  get(nonNull(gql.Int), func(l models.CartLine) any { return l.Quantity }),
+			"unitPrice": get(nonNull(gql.Float), func(l models.CartLine) any { return l.UnitPrice }),
+			"lineTotal": get(nonNull(gql.Float), func(l models.CartLine) any { return l.LineTotal }),
+			"warnings":  get(listOf(gql.String), func(l models.CartLine) any { return l.Warnings }),
+		},
+	})
+
+	cart := gql.NewObject(gql.ObjectConfig{
+		Name: "Cart",
+		Fields: gql.Fields{
+			"id": {
+				Type:        gql.ID,
+				Description: "Null until something is added",
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					if id := p.Source.(models.CartSummary).ID; id != 0 {
+						return idString(id), nil
+					}
+					return nil, nil
+				},
+			},
+			"userId":     get(nonNull(gql.ID), func(c models.CartSummary) any { return c.UserID }),
+			"items":      get(listOf(cartLine), func(c models.CartSummary) any { return c.Items }),
+			"subtotal":   get(nonNull(gql.Float), func(c models.CartSummary) any { return c.Subtotal }),
+			"discount":   get(nonNull(gql.Float), func(c models.CartSummary) any { return c.Discount }),
+			"total":      get(nonNull(gql.Float), func(c models.CartSummary) any { return c.Total }),
+			"couponCode": get(gql.String, func(c models.CartSummary) any { return optional(c.CouponCode) }),
+			"warnings":   get(listOf(gql.String), func(c models.CartSummary) any { return c.Warnings }),
+		},
+	})
+
+	orderItem := gql.NewObject(gql.ObjectConfig{
+		Name: "OrderItem",
+		Fields: gql.Fields{
+			"id":       get(nonNull(gql.ID), func(i models.OrderItem) any { return idString(i.ID) }),
+			"product":  get(nonNull(product), func(i models.OrderItem) any { return i.Product }),
+			"quantity": get(nonNull(gql.Int), func(i models.OrderItem) any { return i.Quantity }),
+			"price":    get(nonNull(gql.Float), func(i models.OrderItem) any { return i.Price }),
+			"returned": get(nonNull(gql.Int), func(i models.OrderItem) any { return i.Returned }),
+		},
+	})
+
+	order = gql.NewObject(gql.ObjectConfig{
+		Name: "Order",
+		Fields: gql.FieldsThunk(func() gql.Fields {
+			return gql.Fields{
+				"id":              get(nonNull(gql.ID), func(o models.Order) any { return idString(o.ID) }),
+				"userId":          get(nonNull(gql.ID), func(o models.Order) any { return o.UserID }),
+				"status":          get(nonNull(gql.String), func(o models.Order) any { return o.Status }),
+				"paymentMethod":   get(gql.String, func(o models.Order) any { return optional(o.PaymentMethod) }),
+				"items":           get(listOf(orderItem), func(o models.Order) any { return o.OrderItems }),
+				"totalPrice":      get(nonNull(gql.Float), func(o models.Order) any { return o.TotalPrice }),
+				"discount":        get(nonNull(gql.Float), func(o models.Order) any { return o.Discount }),
+				"couponCode":      get(gql.String, func(o models.Order) any { return optional(o.CouponCode) }),
+				"shippingDetails": get(gql.String, func(o models.Order) any { return optional(o.ShippingDetails) }),
+				"email":           get(gql.String, func(o models.Order) any { return optional(o.Email) }),
+				"createdAt":       get(nonNull(gql.DateTime), func(o models.Order) any { return o.CreatedAt }),
+				"user": {
+					Type:        user,
+					Description: "Null for a guest's order",
+					Resolve: func(p gql.ResolveParams) (any, error) {
+						owner := p.Source.(models.Order).UserID
+						if models.IsGuestOwner(owner) {
+							return nil, nil
+						}
+						return one(p.Context, loadersFrom(p.Context).users.Load(p.Context, owner), "Failed to retrieve users")
+					},
+				},
+			}
+		}),
+	})
+
+	user = gql.NewObject(gql.ObjectConfig{
+		Name: "User",
+		Fields: gql.FieldsThunk(func() gql.Fields {
+			return gql.Fields{
+				"id":           get(nonNull(gql.ID), func(u models.User) any { return idString(u.ID) }),
+				"username":     get(nonNull(gql.String), func(u models.User) any { return u.Username }),
+				"email":        get(nonNull(gql.String), func(u models.User) any { return u.Email }),
+				"type":         get(nonNull(gql.String), func(u models.User) any { return u.Type }),
+				"ordersCount":  get(nonNull(gql.Int), func(u models.User) any { return u.OrdersCount }),
+				"savedAddress": get(listOf(gql.String), func(u models.User) any { return []string(u.SavedAddress) }),
+				"createdAt":    get(nonNull(gql.DateTime), func(u models.User) any { return u.CreatedAt }),
+				"orders": {
+					Type: listOf(order),
+					Resolve: func(p gql.ResolveParams) (any, error) {
+						thunk := loadersFrom(p.Context).ordersByUser.Load(p.Context, idString(p.Source.(models.User).ID))
+						return many(p.Context, thunk, "Failed to retrieve orders")
+					},
+				},
+			}
+		}),
+	})
+
+	coupon := gql.NewObject(gql.ObjectConfig{
+		Name: "Coupon",
+		Fields: gql.Fields{
+			"code":           get(nonNull(gql.String), func(c models.CouponObject) any { return c.Code }),
+			"discount":       get(nonNull(gql.Float), func(c models.CouponObject) any { return c.Discount }),
+			"orderFrequency": get(nonNull(gql.Int), func(c models.CouponObject) any { return c.OrderFrequency }),
+			"singleUse":      get(nonNull(gql.Boolean), func(c models.CouponObject) any { return c.SingleUse }),
+			"expiresAt":      get(gql.DateTime, func(c models.CouponObject) any { return optionalTime(c.ExpiresAt) }),
+			"redeemedAt":     get(gql.DateTime, func(c models.CouponObject) any { return optionalTime(c.RedeemedAt) }),
+		},
+	})
+
+	query := gql.NewObject(gql.ObjectConfig{
+		Name: "Query",
+		Fields: gql.Fields{
+			"user": {
+				Type: user,
+				Args: gql.FieldConfigArgument{"id": {Type: nonNull(gql.ID)}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return one(p.Context, loadersFrom(p.Context).users.Load(p.Context, p.Args["id"].(string)), "Failed to retrieve the user")
+				},
+			},
+			"users": {
+				Type: listOf(user),
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return fetch(p.Context, s.Users.GetAllUsers, "Failed to retrieve users")
+				},
+			},
+			"categories": {
+				Type: listOf(category),
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return fetch(p.Context, s.Products.GetAllCategories, "Failed to retrieve categories")
+				},
+			},
+			"products": {
+				Type:        listOf(product),
+				Description: "The whole catalog, or one category's products",
+				Args:        gql.FieldConfigArgument{"category": {Type: gql.String}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					if name, ok := p.Args["category"].(string); ok {
+						return many(p.Context, loadersFrom(p.Context).productsByCategory.Load(p.Context, name), "Failed to retrieve products")
+					}
+					return fetch(p.Context, s.Products.GetAllProducts, "Failed to retrieve products")
+				},
+			},
+			"product": {
+				Type: product,
+				Args: gql.FieldConfigArgument{"id": {Type: nonNull(gql.ID)}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					id, err := recordID(p.Args["id"].(string))
+					if err != nil {
+						return nil, nil // No product has an ID that isn't a number
+					}
+					return one(p.Context, loadersFrom(p.Context).products.Load(p.Context, id), "Failed to retrieve the product")
+				},
+			},
+			"bestSellers": {
+				Type: listOf(product),
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return fetch(p.Context, s.Products.GetBestSellers, "Failed to retrieve best sellers")
+				},
+			},
+			"cart": {
+				Type:        nonNull(cart),
+				Description: "A user's cart, priced with the coupon if it's given and valid",
+				Args: gql.FieldConfigArgument{
+					"userId": {Type: nonNull(gql.ID)},
+					"coupon": {Type: gql.String},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					couponCode, _ := p.Args["coupon"].(string)
+					return s.cart(p.Context, p.Args["userId"].(string), couponCode)
+				},
+			},
+			"order": {
+				Type: order,
+				Args: gql.FieldConfigArgument{"id": {Type: nonNull(gql.ID)}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					found, err := s.Orders.GetOrder(p.Context, p.Args["id"].(string))
+					if errors.Is(err, database.ErrNotFound) {
+						return nil, nil
+					} else if err != nil {
+						return nil, failed(p.Context, err, "Failed to retrieve the order")
+					}
+					return found, nil
+				},
+			},
+			"orders": {
+				Type:        listOf(order),
+				Description: "Every order, or one user's",
+				Args:        gql.FieldConfigArgument{"userId": {Type: gql.ID}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					if userID, ok := p.Args["userId"].(string); ok {
+						return many(p.Context, loadersFrom(p.Context).ordersByUser.Load(p.Context, userID), "Failed to retrieve orders")
+					}
+					return fetch(p.Context, s.Orders.GetAllOrders, "Failed to retrieve orders")
+				},
+			},
+			"coupons": {
+				Type: listOf(coupon),
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					return fetch(p.Context, s.Coupons.GetAllCoupons, "Failed to retrieve coupons")
+				},
+			},
+			"coupon": {
+				Type: coupon,
+				Args: gql.FieldConfigArgument{"code": {Type: nonNull(gql.String)}},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					found, err := s.Coupons.GetCoupon(p.Context, p.Args["code"].(string))
+					if errors.Is(err, database.ErrNotFound) {
+						return nil, nil
+					} else if err != nil {
+						return nil, failed(p.Context, err, "Failed to retrieve the coupon")
+					}
+					return found, nil
+				},
+			},
+		},
+	})
+
+	cartChange := gql.FieldConfigArgument{
+		"userId":    {Type: nonNull(gql.ID)},
+		"productId": {Type: nonNull(gql.ID)},
+		"quantity":  {Type: nonNull(gql.Int)},
+	}
+	mutation := gql.NewObject(gql.ObjectConfig{
+		Name: "Mutation",
+		Fields: gql.Fields{
+			"addToCart": {
+				Type:        nonNull(cart),
+				Description: "Add quantity of a product to a user's cart, returning the cart",
+				Args:        cartChange,
+				Resolve: s.changeCart(func(ctx context.Context, userID string, productID uint, quantity int) error {
+					if err := s.Carts.AddItemToCart(ctx, userID, productID, quantity); err != nil {
+						return err
+					}
+					s.Metrics.CartAdd(customer(userID))
+					return nil
+				}),
+			},
+			"setCartItemQuantity": {
+				Type:        nonNull(cart),
+				Description: "Set the quantity of a product in a user's cart, zero removing it",
+				Args:        cartChange,
+				Resolve:     s.changeCart(s.Carts.SetCartItemQuantity),
+			},
+			"removeFromCart": {
+				Type:        nonNull(cart),
+				Description: "Remove quantity of a product from a user's cart, or all of it without a quantity",
+				Args: gql.FieldConfigArgument{
+					"userId":    {Type: nonNull(gql.ID)},
+					"productId": {Type: nonNull(gql.ID)},
+					"quantity":  {Type: gql.Int},
+				},
+				Resolve: s.changeCart(func(ctx context.Context, userID string, productID uint, quantity int) error {
+					if quantity == 0 {
+						return s.Carts.SetCartItemQuantity(ctx, userID, productID, 0)
+					}
+					return s.Carts.RemoveItemFromCart(ctx, userID, productID, quantity)
+				}),
+			},
+			"saveAddress": {
+				Type:        nonNull(user),
+				Description: "Replace a user's saved addresses",
+				Args: gql.FieldConfigArgument{
+					"userId":  {Type: nonNull(gql.ID)},
+					"address": {Type: listOf(gql.String)},
+				},
+				Resolve: func(p gql.ResolveParams) (any, error) {
+					found, err := s.Users.GetUserByID(p.Context, p.Args["userId"].(string))
+					if err != nil {
+						return nil, failed(p.Context, err, "User not found")
+					}
+					found.SavedAddress = models.Addresses{}
+					for _, address := range p.Args["address"].([]any) {
+						found.SavedAddress = append(found.SavedAddress, address.(string))
+					}
+					if err := s.Users.SaveUser(p.Context, found); err != nil {
+						return nil, failed(p.Context, err, "Failed to save the address")
+					}
+					return found, nil
+				},
+			},
+		},
+	})
+
+	return gql.NewSchema(gql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// cart returns a user's cart, empty if they haven't added anything
+func (s *Server) cart(ctx context.Context, userID, couponCode string) (models.CartSummary, error) {
+	found, err := s.Carts.GetUserCart(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		found = models.Cart{UserID: userID}
+	} else if err != nil {
+		return models.CartSummary{}, failed(ctx, err, "Failed to retrieve cart")
+	}
+	return found.Summary(couponCode, s.Coupons.CouponDiscountRate(ctx, couponCode)), nil
+}
+
+// changeCart resolves a mutation making change to a cart, to the cart as
+// it is afterwards
+func (s *Server) changeCart(change func(ctx context.Context, userID string, productID uint, quantity int) error) gql.FieldResolveFn {
+	return func(p gql.ResolveParams) (any, error) {
+		userID := p.Args["userId"].(string)
+		productID, err := recordID(p.Args["productId"].(string))
+		if err != nil {
+			return nil, newError(apierror.CodeValidationFailed, "productId must be a product ID")
+		}
+		quantity, _ := p.Args["quantity"].(int)
+		if err := change(p.Context, userID, productID, quantity); err != nil {
+			return nil, failed(p.Context, err, "Failed to update cart")
+		}
+		return s.cart(p.Context, userID, "")
+	}
+}
+
+// customer returns how the owner of a cart is labelled in metrics
+func customer(ownerID string) string {
+	if models.IsGuestOwner(ownerID) {
+		return metrics.CustomerGuest
+	}
+	return metrics.CustomerUser
+}
+
+// get returns a field of type t read from a source of type T
+func get[T any](t gql.Output, read func(T) any) *gql.Field {
+	return &gql.Field{Type: t, Resolve: func(p gql.ResolveParams) (any, error) {
+		return read(p.Source.(T)), nil
+	}}
+}
+
+// fetch resolves a field to everything list returns
+func fetch[T any](ctx context.Context, list func(context.Context) ([]T, error), message string) (any, error) {
+	records, err := list(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, message)
+	}
+	return records, nil
+}
+
+// one resolves a field to the record a loader finds once it has fetched its
+// batch, or null if it finds none
+func one[T any](ctx context.Context, thunk dataloader.Thunk[*T], message string) (any, error) {
+	return func() (any, error) {
+		record, err := thunk()
+		if err != nil {
+			return nil, failed(ctx, err, message)
+		}
+		if record == nil {
+			return nil, nil
+		}
+		return *record, nil
+	}, nil
+}
+
+// many resolves a field to the records a loader finds once it has fetched
+// its batch
+func many[T any](ctx context.Context, thunk dataloader.Thunk[[]T], message string) (any, error) {
+	return func() (any, error) {
+		records, err := thunk()
+		if err != nil {
+			return nil, failed(ctx, err, message)
+		}
+		if records == nil {
+			return []T{}, nil
+		}
+		return records, nil
+	}, nil
+}
+
+// recordID parses the ID of a record
+func recordID(id string) (uint, error) {
+	n, err := strconv.ParseUint(id, 10, 0)
+	return uint(n), err
+}
+
+// optional returns nil for an empty string, which the models use for none
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func optionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+func nonNull(t gql.Output) gql.Output {
+	return gql.NewNonNull(t)
+}
+
+// listOf is a list of t that's never null and holds no nulls, which is
+// what every list in the schema is
+func listOf(t gql.Output) gql.Output {
+	return gql.NewNonNull(gql.NewList(gql.NewNonNull(t)))
+}
@@ -0,0 +1,111 @@
+// Package graphql serves the storefront's reads, and changes to carts and
+// saved addresses, over GraphQL, so a page can fetch products, categories, a
+// cart and orders in one round trip. Resolvers go through the same stores as
+// the REST handlers, records related to many others are fetched in batches
+// per request, and operations are limited in depth and complexity before
+// they run.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/metrics"
+	"github.com/gin-gonic/gin"
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Limits used unless the server is configured otherwise
+const (
+	DefaultMaxComplexity = 1000
+	DefaultMaxDepth      = 10
+)
+
+// Server answers GraphQL operations from the stores it's given
+type Server struct {
+	Users    database.UserStore
+	Products database.ProductStore
+	Carts    database.CartStore
+	Orders   database.OrderStore
+	Coupons  database.CouponStore
+
+	// Metrics counts the cart changes made through mutations
+	Metrics *metrics.Metrics
+
+	// MaxComplexity and MaxDepth bound the operations the server runs, as
+	// counted by checkLimits
+	MaxComplexity int
+	MaxDepth      int
+
+	schema gql.Schema
+}
+
+// NewServer returns a server resolving operations from store, counting cart
+// changes in m
+func NewServer(store database.Store, m *metrics.Metrics) *Server {
+	s := &Server{
+		Users:         store,
+		Products:      store,
+		Carts:         store,
+		Orders:        store,
+		Coupons:       store,
+		Metrics:       m,
+		MaxComplexity: DefaultMaxComplexity,
+		MaxDepth:      DefaultMaxDepth,
+	}
+	schema, err := s.newSchema()
+	if err != nil {
+		panic(fmt.Sprintf("graphql: %v", err))
+	}
+	s.schema = schema
+	return s
+}
+
+// request is an operation POSTed as JSON
+type request struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Serve runs the operation in the request body. Errors running it are reported in the result's
+// errors member, with the code the REST routes would use, and don't change
+// the status.
+func (s *Server) Serve(c *gin.Context) {
+	var req request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.FromBinding(err))
+		return
+	}
+	c.JSON(http.StatusOK, s.do(withLoaders(c.Request.Context(), s.newLoaders()), req))
+}
+
+// do parses, validates and runs an operation, if it's within the limits
+func (s *Server) do(ctx context.Context, req request) *gql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &gql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if validation := gql.ValidateDocument(&s.schema, doc, nil); !validation.IsValid {
+		return &gql.Result{Errors: validation.Errors}
+	}
+	if err := s.checkLimits(doc); err != nil {
+		return &gql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	return gql.Execute(gql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+}
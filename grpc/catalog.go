@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/grpc/estorepb"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// catalogService serves estorepb.CatalogService from the product store.
+// Disabled products are listed too, flagged as such.
+type catalogService struct {
+	estorepb.UnimplementedCatalogServiceServer
+	products database.ProductStore
+}
+
+func (s *catalogService) ListCategories(ctx context.Context, req *estorepb.ListCategoriesRequest) (*estorepb.ListCategoriesResponse, error) {
+	categories, err := s.products.GetAllCategories(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve categories")
+	}
+	resp := &estorepb.ListCategoriesResponse{}
+	for _, category := range categories {
+		resp.Categories = append(resp.Categories, toCategory(category))
+	}
+	return resp, nil
+}
+
+func (s *catalogService) ListProducts(ctx context.Context, req *estorepb.ListProductsRequest) (*estorepb.ListProductsResponse, error) {
+	var products []models.Product
+	var err error
+	if req.GetCategory() != "" {
+		products, err = s.products.GetProducts(ctx, req.GetCategory())
+	} else {
+		products, err = s.products.GetAllProducts(ctx)
+	}
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve products")
+	}
+	return &estorepb.ListProductsResponse{Products: toProducts(products)}, nil
+}
+
+func (s *catalogService) ListBestSellers(ctx context.Context, req *estorepb.ListBestSellersRequest) (*estorepb.ListBestSellersResponse, error) {
+	products, err := s.products.GetBestSellers(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve best sellers")
+	}
+	return &estorepb.ListBestSellersResponse{Products: toProducts(products)}, nil
+}
+
+// GetProduct finds the product in the whole catalog, which the cache keeps
+func (s *catalogService) GetProduct(ctx context.Context, req *estorepb.GetProductRequest) (*estorepb.Product, error) {
+	products, err := s.products.GetAllProducts(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve the product")
+	}
+	for _, product := range products {
+		if uint64(product.ID) == req.GetId() {
+			return toProduct(product), nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, fmt.Sprintf("no product found for ID %d", req.GetId()))
+}
+
+func toCategory(c models.Category) *estorepb.Category {
+	return &estorepb.Category{
+		Id:          uint64(c.ID),
+		Name:        c.Name,
+		Description: c.Description,
+		Image:       c.Image,
+	}
+}
+
+func toProduct(p models.Product) *estorepb.Product {
+	return &estorepb.Product{
+		Id:          uint64(p.ID),
+		Sku:         p.SKU,
+		Name:        p.Name,
+		Description: p.Description,
+		Details:     p.Details,
+		Image:       p.Image,
+		Category:    p.Category,
+		Price:       p.Price,
+		Bestseller:  p.Isbestseller,
+		Stock:       int64(p.Stock),
+		Disabled:    p.Disabled,
+		CreatedAt:   timestamppb.New(p.CreatedAt),
+		UpdatedAt:   timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func toProducts(products []models.Product) []*estorepb.Product {
+	out := make([]*estorepb.Product, len(products))
+	for i, product := range products {
+		out[i] = toProduct(product)
+	}
+	return out
+}
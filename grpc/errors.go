@@ -0,0 +1,41 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// storeErrors maps the errors the stores wrap to the status codes they're
+// reported with
+var storeErrors = []struct {
+	err  error
+	code codes.Code
+}{
+	{database.ErrNotFound, codes.NotFound},
+	{database.ErrConflict, codes.AlreadyExists},
+	{database.ErrInvalidTransition, codes.FailedPrecondition},
+	{database.ErrInsufficientStock, codes.FailedPrecondition},
+}
+
+// failed reports err from a store. An error wrapping one of storeErrors
+// gets its code, and is described by the detail the store gave with it, such
+// as "product 3 has 2 in stock", or by message if it gave none. Any other
+// error is logged and reported as an internal error described by message.
+func failed(ctx context.Context, err error, message string) error {
+	for _, known := range storeErrors {
+		if errors.Is(err, known.err) {
+			var detailErr *database.DetailError
+			if errors.As(err, &detailErr) && detailErr.Detail != "" {
+				message = detailErr.Detail
+			}
+			return status.Error(known.code, message)
+		}
+	}
+	logging.FromContext(ctx).Error(message, "error", err)
+	return status.Error(codes.Internal, message)
+}
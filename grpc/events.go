@@ -0,0 +1,161 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Kinds of order event
+const (
+	OrderPlaced        = "placed"
+	OrderStatusChanged = "status_changed"
+)
+
+// DefaultEventBuffer is how many events a subscriber may fall behind by
+// unless OrderEvents is configured otherwise
+const DefaultEventBuffer = 256
+
+// OrderEvent is an order being placed or changing status
+type OrderEvent struct {
+	Type           string
+	Order          models.Order // As it was after the event
+	PreviousStatus string       // For OrderStatusChanged
+	OccurredAt     time.Time
+}
+
+// OrderEvents tells its subscribers about the orders placed and changed,
+// including by payments, as Listen hears of them from the outbox. Changes
+// made through any server sharing the database are seen by the server that
+// dispatches their events.
+type OrderEvents struct {
+	// Buffer is how many events a subscriber may fall behind by before it's
+	// dropped, so that a slow one can't hold up the outbox
+	Buffer int
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewOrderEvents returns order events without any subscribers
+func NewOrderEvents() *OrderEvents {
+	return &OrderEvents{Buffer: DefaultEventBuffer, subscribers: map[*Subscription]struct{}{}}
+}
+
+// Listen subscribes e to the order events on bus, publishing each order as
+// orders reads it
+func (e *OrderEvents) Listen(bus *events.Bus, orders database.OrderStore) {
+	events.Subscribe(bus, "order-stream", func(ctx context.Context, event models.OrderPlaced) error {
+		return e.publishOrder(ctx, orders, event.OrderID, func(order models.Order) OrderEvent {
+			return OrderEvent{Type: OrderPlaced, Order: order, OccurredAt: time.Now()}
+		})
+	})
+	events.Subscribe(bus, "order-stream", func(ctx context.Context, event models.OrderStatusChanged) error {
+		return e.publishOrder(ctx, orders, event.OrderID, func(order models.Order) OrderEvent {
+			order.Status = event.Status // As it was changed to, should it have moved on since
+			return OrderEvent{Type: OrderStatusChanged, Order: order, PreviousStatus: event.PreviousStatus, OccurredAt: time.Now()}
+		})
+	})
+}
+
+// Subscription receives order events until it's cancelled, falls behind or
+// the events are closed, when C is closed
+type Subscription struct {
+	C <-chan OrderEvent
+
+	c      chan OrderEvent
+	lagged bool
+	events *OrderEvents
+}
+
+// Subscribe returns a subscription to the events from now on
+func (e *OrderEvents) Subscribe() *Subscription {
+	c := make(chan OrderEvent, e.Buffer)
+	s := &Subscription{C: c, c: c, events: e}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		close(c)
+	} else {
+		e.subscribers[s] = struct{}{}
+	}
+	return s
+}
+
+// Cancel stops the subscription
+func (s *Subscription) Cancel() {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	s.events.drop(s)
+}
+
+// Lagged reports whether the subscription was dropped for falling behind
+func (s *Subscription) Lagged() bool {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	return s.lagged
+}
+
+// Close ends every subscription, and stops new ones, so that streams end
+// when the server stops
+func (e *OrderEvents) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for s := range e.subscribers {
+		e.drop(s)
+	}
+}
+
+// drop ends s, if it hasn't ended. e.mu must be held.
+func (e *OrderEvents) drop(s *Subscription) {
+	if _, ok := e.subscribers[s]; ok {
+		delete(e.subscribers, s)
+		close(s.c)
+	}
+}
+
+// watched reports whether anyone is subscribed, so that changes nobody is
+// told about don't cost extra queries
+func (e *OrderEvents) watched() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subscribers) > 0
+}
+
+func (e *OrderEvents) publish(event OrderEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for s := range e.subscribers {
+		select {
+		case s.c <- event:
+		default:
+			s.lagged = true
+			e.drop(s)
+		}
+	}
+}
+
+// publishOrder reads the order and publishes the event made of it, unless
+// nobody is subscribed or it's been deleted since
+func (e *OrderEvents) publishOrder(ctx context.Context, orders database.OrderStore, orderID uint, event func(models.Order) OrderEvent) error {
+	if !e.watched() {
+		return nil
+	}
+	order, err := orders.GetOrder(ctx, strconv.FormatUint(uint64(orderID), 10))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.publish(event(order))
+	return nil
+}
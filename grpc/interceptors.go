@@ -0,0 +1,138 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying a call's request ID, like the
+// X-Request-ID header over HTTP
+const requestIDKey = "x-request-id"
+
+// logUnary gives each call a logger tagged with its request ID, which
+// handlers get with logging.FromContext, and logs the call once it's served.
+// Calls failing with a server error are logged as errors.
+func logUnary(logger *slog.Logger) grpcgo.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpcgo.UnaryServerInfo, handler grpcgo.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx, callLogger := withCallLogger(ctx, logger)
+		resp, err := handler(ctx, req)
+		logCall(ctx, callLogger, info.FullMethod, err, start)
+		return resp, err
+	}
+}
+
+// logStream is logUnary for streams, which are logged once they end
+func logStream(logger *slog.Logger) grpcgo.StreamServerInterceptor {
+	return func(srv any, stream grpcgo.ServerStream, info *grpcgo.StreamServerInfo, handler grpcgo.StreamHandler) error {
+		start := time.Now()
+		ctx, callLogger := withCallLogger(stream.Context(), logger)
+		err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+		logCall(ctx, callLogger, info.FullMethod, err, start)
+		return err
+	}
+}
+
+// withCallLogger returns ctx carrying a logger tagged with the call's
+// request ID, keeping one the client sent and making one up otherwise
+func withCallLogger(ctx context.Context, logger *slog.Logger) (context.Context, *slog.Logger) {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDKey); len(values) > 0 {
+		id = values[0]
+	}
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	callLogger := logger.With("request_id", id)
+	return logging.WithLogger(ctx, callLogger), callLogger
+}
+
+func logCall(ctx context.Context, logger *slog.Logger, method string, err error, start time.Time) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	}
+	logger.LogAttrs(ctx, level, "RPC",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+// recoverUnary turns a panic in a handler into an Internal error, logging it
+// with the stack, rather than letting it take the server down
+func recoverUnary(ctx context.Context, req any, info *grpcgo.UnaryServerInfo, handler grpcgo.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream is recoverUnary for streams
+func recoverStream(srv any, stream grpcgo.ServerStream, info *grpcgo.StreamServerInfo, handler grpcgo.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(stream.Context(), p)
+		}
+	}()
+	return handler(srv, stream)
+}
+
+func recovered(ctx context.Context, p any) error {
+	logging.FromContext(ctx).Error("Panic serving RPC", "panic", p, "stack", string(debug.Stack()))
+	return status.Error(codes.Internal, "")
+}
+
+// authUnary lets through calls with a valid JWT in their authorization
+// metadata, sent as "Bearer <token>" like the Authorization header
+func authUnary(ctx context.Context, req any, info *grpcgo.UnaryServerInfo, handler grpcgo.UnaryHandler) (any, error) {
+	if err := authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream is authUnary for streams
+func authStream(srv any, stream grpcgo.ServerStream, info *grpcgo.StreamServerInfo, handler grpcgo.StreamHandler) error {
+	if err := authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func authenticate(ctx context.Context) error {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 || values[0] == "" {
+		return status.Error(codes.Unauthenticated, "authorization metadata is required")
+	}
+	claims, err := auth.ValidateJWT(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil || claims == nil {
+		return status.Error(codes.Unauthenticated, "Invalid token")
+	}
+	return nil
+}
+
+// contextStream is a stream whose context is replaced, for interceptors to
+// pass values on to handlers
+type contextStream struct {
+	grpcgo.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/grpc/estorepb"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// inventoryService serves estorepb.InventoryService from the product store
+type inventoryService struct {
+	estorepb.UnimplementedInventoryServiceServer
+	products database.ProductStore
+}
+
+func (s *inventoryService) GetStock(ctx context.Context, req *estorepb.GetStockRequest) (*estorepb.GetStockResponse, error) {
+	products, err := s.products.GetAllProducts(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve stock")
+	}
+	resp := &estorepb.GetStockResponse{}
+	if len(req.GetProductIds()) == 0 {
+		for _, product := range products {
+			resp.Levels = append(resp.Levels, toStockLevel(product))
+		}
+		return resp, nil
+	}
+
+	byID := map[uint64]models.Product{}
+	for _, product := range products {
+		byID[uint64(product.ID)] = product
+	}
+	for _, id := range req.GetProductIds() {
+		product, ok := byID[id]
+		if !ok {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("no product found for ID %d", id))
+		}
+		resp.Levels = append(resp.Levels, toStockLevel(product))
+	}
+	return resp, nil
+}
+
+func (s *inventoryService) ListLowStock(ctx context.Context, req *estorepb.ListLowStockRequest) (*estorepb.ListLowStockResponse, error) {
+	products, err := s.products.GetAllProducts(ctx)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve stock")
+	}
+	resp := &estorepb.ListLowStockResponse{}
+	for _, product := range products {
+		if product.StockTracked && int64(product.Stock) <= req.GetThreshold() { // Untracked stock never runs low
+			resp.Levels = append(resp.Levels, toStockLevel(product))
+		}
+	}
+	slices.SortStableFunc(resp.Levels, func(a, b *estorepb.StockLevel) int {
+		return cmp.Compare(a.Stock, b.Stock)
+	})
+	return resp, nil
+}
+
+func (s *inventoryService) AdjustStock(ctx context.Context, req *estorepb.AdjustStockRequest) (*estorepb.StockLevel, error) {
+	if req.GetDelta() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "delta must not be zero")
+	}
+	product, err := s.products.AdjustStock(ctx, uint(req.GetProductId()), int(req.GetDelta()))
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to adjust stock")
+	}
+	return toStockLevel(product), nil
+}
+
+func toStockLevel(p models.Product) *estorepb.StockLevel {
+	return &estorepb.StockLevel{
+		ProductId: uint64(p.ID),
+		Sku:       p.SKU,
+		Name:      p.Name,
+		Stock:     int64(p.Stock),
+		Disabled:  p.Disabled,
+	}
+}
@@ -0,0 +1,128 @@
+package grpc
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/grpc/estorepb"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// orderService serves estorepb.OrderService from the order store, streaming
+// the events published by events
+type orderService struct {
+	estorepb.UnimplementedOrderServiceServer
+	orders database.OrderStore
+	events *OrderEvents
+}
+
+func (s *orderService) GetOrder(ctx context.Context, req *estorepb.GetOrderRequest) (*estorepb.Order, error) {
+	order, err := s.orders.GetOrder(ctx, strconv.FormatUint(req.GetId(), 10))
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve the order")
+	}
+	return toOrder(order), nil
+}
+
+func (s *orderService) ListOrders(ctx context.Context, req *estorepb.ListOrdersRequest) (*estorepb.ListOrdersResponse, error) {
+	var orders []models.Order
+	var err error
+	if req.GetUserId() != "" {
+		orders, err = s.orders.GetUserOrders(ctx, req.GetUserId())
+	} else {
+		orders, err = s.orders.GetAllOrders(ctx)
+	}
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve orders")
+	}
+	resp := &estorepb.ListOrdersResponse{}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, toOrder(order))
+	}
+	return resp, nil
+}
+
+func (s *orderService) UpdateOrderStatus(ctx context.Context, req *estorepb.UpdateOrderStatusRequest) (*estorepb.Order, error) {
+	if req.GetStatus() == "" {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+	id := strconv.FormatUint(req.GetId(), 10)
+	if err := s.orders.UpdateOrderStatus(ctx, id, req.GetStatus()); err != nil {
+		return nil, failed(ctx, err, "Failed to update the order status")
+	}
+	order, err := s.orders.GetOrder(ctx, id)
+	if err != nil {
+		return nil, failed(ctx, err, "Failed to retrieve the order")
+	}
+	return toOrder(order), nil
+}
+
+func (s *orderService) WatchOrderEvents(req *estorepb.WatchOrderEventsRequest, stream estorepb.OrderService_WatchOrderEventsServer) error {
+	subscription := s.events.Subscribe()
+	defer subscription.Cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-subscription.C:
+			if !ok {
+				if subscription.Lagged() {
+					return status.Error(codes.ResourceExhausted, "the stream fell too far behind the events; reconnect and catch up with ListOrders")
+				}
+				return status.Error(codes.Unavailable, "the server is shutting down")
+			}
+			if req.GetUserId() != "" && event.Order.UserID != req.GetUserId() {
+				continue
+			}
+			if err := stream.Send(toOrderEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// orderEventTypes are the messages' names for the kinds of order event
+var orderEventTypes = map[string]estorepb.OrderEventType{
+	OrderPlaced:        estorepb.OrderEventType_ORDER_EVENT_TYPE_PLACED,
+	OrderStatusChanged: estorepb.OrderEventType_ORDER_EVENT_TYPE_STATUS_CHANGED,
+}
+
+func toOrderEvent(e OrderEvent) *estorepb.OrderEvent {
+	return &estorepb.OrderEvent{
+		Type:           orderEventTypes[e.Type],
+		Order:          toOrder(e.Order),
+		PreviousStatus: e.PreviousStatus,
+		OccurredAt:     timestamppb.New(e.OccurredAt),
+	}
+}
+
+func toOrder(o models.Order) *estorepb.Order {
+	order := &estorepb.Order{
+		Id:              uint64(o.ID),
+		UserId:          o.UserID,
+		Status:          o.Status,
+		PaymentMethod:   o.PaymentMethod,
+		TotalPrice:      o.TotalPrice,
+		Discount:        o.Discount,
+		CouponCode:      o.CouponCode,
+		ShippingDetails: o.ShippingDetails,
+		Email:           o.Email,
+		CreatedAt:       timestamppb.New(o.CreatedAt),
+		UpdatedAt:       timestamppb.New(o.UpdatedAt),
+	}
+	for _, item := range o.OrderItems {
+		order.Items = append(order.Items, &estorepb.OrderItem{
+			Id:        uint64(item.ID),
+			ProductId: uint64(item.ProductID),
+			Product:   toProduct(item.Product),
+			Quantity:  int64(item.Quantity),
+			Price:     item.Price,
+			Returned:  int64(item.Returned),
+		})
+	}
+	return order
+}
@@ -0,0 +1,119 @@
+// Package grpc serves the catalog, orders and inventory over gRPC for
+// internal consumers, such as the warehouse and analytics services, from the
+// same stores as the HTTP API. Calls are authenticated with the JWTs the API
+// issues, and orders placed and changed are streamed to watchers as their
+// events are dispatched from the outbox.
+//
+// The services are defined in proto/estore/v1; the code in estorepb is
+// generated from them with protoc-gen-go and protoc-gen-go-grpc.
+package grpc
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=github.com/Rohanrevanth/e-store-go/grpc --go-grpc_out=. --go-grpc_opt=module=github.com/Rohanrevanth/e-store-go/grpc estore/v1/catalog.proto estore/v1/orders.proto estore/v1/inventory.proto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/grpc/estorepb"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+)
+
+// Config says where the server listens and how
+type Config struct {
+	Addr string // Address to listen on, such as localhost:9090
+
+	// TLSCertFile and TLSKeyFile serve over TLS; without them the server is
+	// plaintext, for a private network
+	TLSCertFile string
+	TLSKeyFile  string
+	// ShutdownTimeout is how long calls in flight get to finish once the
+	// server is told to stop, zero meaning as long as they take
+	ShutdownTimeout time.Duration
+
+	Logger *slog.Logger // Logs calls and the server starting and stopping
+}
+
+func (c Config) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+// NewServer returns a server for the catalog, order and inventory services,
+// reading and writing through store and streaming order events from events,
+// set up as cfg says. The server describes its services through reflection,
+// for tools such as grpcurl.
+func NewServer(store database.Store, events *OrderEvents, cfg Config) (*grpcgo.Server, error) {
+	logger := cfg.logger()
+	opts := []grpcgo.ServerOption{
+		grpcgo.ChainUnaryInterceptor(logUnary(logger), recoverUnary, authUnary),
+		grpcgo.ChainStreamInterceptor(logStream(logger), recoverStream, authStream),
+	}
+	if cfg.TLSCertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("NewServer: %v", err)
+		}
+		opts = append(opts, grpcgo.Creds(creds))
+	}
+
+	server := grpcgo.NewServer(opts...)
+	estorepb.RegisterCatalogServiceServer(server, &catalogService{products: store})
+	estorepb.RegisterOrderServiceServer(server, &orderService{orders: store, events: events})
+	estorepb.RegisterInventoryServiceServer(server, &inventoryService{products: store})
+	reflection.Register(server)
+	return server, nil
+}
+
+// StartServer serves until ctx is done. It then ends the order event
+// streams, which would otherwise run forever, stops accepting calls and
+// waits up to cfg.ShutdownTimeout for the calls in flight to finish.
+func StartServer(ctx context.Context, store database.Store, events *OrderEvents, cfg Config) error {
+	server, err := NewServer(store, events, cfg)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the gRPC server: %v", err)
+	}
+
+	logger := cfg.logger()
+	logger.Info("Listening for gRPC", "addr", listener.Addr().String(), "tls", cfg.TLSCertFile != "")
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("failed to start the gRPC server: %v", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down gRPC, waiting for calls in flight")
+	events.Close()
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	if cfg.ShutdownTimeout > 0 {
+		select {
+		case <-stopped:
+		case <-time.After(cfg.ShutdownTimeout):
+			server.Stop()
+			<-stopped
+			return fmt.Errorf("gRPC calls were cut off by the shutdown")
+		}
+	}
+	<-stopped
+	return <-served
+}
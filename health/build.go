@@ -0,0 +1,45 @@
+package health
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build details, set at build time with
+//
+//	go build -ldflags "-X github.com/Rohanrevanth/e-store-go/health.Version=v1.2.0
+//	  -X github.com/Rohanrevanth/e-store-go/health.Commit=$(git rev-parse HEAD)
+//	  -X github.com/Rohanrevanth/e-store-go/health.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the commit is taken from the version control details the go
+// command records when it builds from a checkout.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// BuildInfo says which build of the server is running
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a checkout with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+// Build returns the details of the running build
+func Build() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,3 @@
+module github.com/Rohanrevanth/e-store-go/health
+
+go 1.23.1
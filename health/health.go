@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checker decides whether the server is ready for traffic: it must be
+// serving, and every check added to it must pass. Checks are added while the
+// server is being set up, before it starts.
+type Checker struct {
+	Timeout time.Duration // Longest a check may take
+	Logger  *slog.Logger  // Where failed checks are logged
+
+	serving atomic.Bool
+	checks  []check
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Report is the outcome of a readiness check
+type Report struct {
+	Ready   bool              `json:"ready"`
+	Serving bool              `json:"serving"` // False while starting and shutting down
+	Checks  map[string]string `json:"checks"`  // "ok" or "failed", by check
+}
+
+// NewChecker returns a checker without checks, not yet serving
+func NewChecker() *Checker {
+	return &Checker{Timeout: 2 * time.Second, Logger: slog.Default()}
+}
+
+// Add adds a check, which reports a problem by returning an error
+func (c *Checker) Add(name string, run func(ctx context.Context) error) {
+	c.checks = append(c.checks, check{name, run})
+}
+
+// SetServing notes whether the server is accepting requests. It's set once
+// the server is listening, and cleared when it starts shutting down so that
+// load balancers stop sending it requests.
+func (c *Checker) SetServing(serving bool) {
+	c.serving.Store(serving)
+}
+
+// Check runs every check at once and reports whether the server is ready.
+// Why a check failed is logged rather than reported, since the report is
+// public.
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{Serving: c.serving.Load(), Checks: make(map[string]string, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+			result := "ok"
+			if err := check.run(ctx); err != nil {
+				c.Logger.Error("Readiness check failed", "check", check.name, "error", err)
+				result = "failed"
+			}
+			mu.Lock()
+			report.Checks[check.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	report.Ready = report.Serving
+	for _, result := range report.Checks {
+		if result != "ok" {
+			report.Ready = false
+		}
+	}
+	return report
+}
@@ -0,0 +1,39 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestCheckHidesWhyChecksFail(t *testing.T) {
+	var logs bytes.Buffer
+	c := NewChecker()
+	c.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("redis", func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.7:6379: connection refused") })
+	c.SetServing(true)
+
+	report := c.Check(context.Background())
+	if report.Ready || report.Checks["database"] != "ok" || report.Checks["redis"] != "failed" {
+		t.Errorf("got %+v, want not ready with redis failed", report)
+	}
+	if !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("logged %q, want why redis failed", logs.String())
+	}
+}
+
+func TestCheckNotReadyUntilServing(t *testing.T) {
+	c := NewChecker()
+	c.Add("database", func(ctx context.Context) error { return nil })
+	if report := c.Check(context.Background()); report.Ready {
+		t.Error("ready before serving")
+	}
+	c.SetServing(true)
+	if report := c.Check(context.Background()); !report.Ready {
+		t.Errorf("got %+v once serving, want ready", report)
+	}
+}
@@ -1,39 +1,158 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	stdhttp "net/http"
 	"time"
 
+	"github.com/Rohanrevanth/e-store-go/controllers"
 	"github.com/Rohanrevanth/e-store-go/routes"
+	"github.com/Rohanrevanth/e-store-go/tracing"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-// InitRouter initializes the Gin router and registers routes.
-func InitRouter() *gin.Engine {
-	router := gin.Default()
+// Config says where the server listens, who may call it and how
+type Config struct {
+	Addr        string   // Address to listen on, such as localhost:8080
+	CORSOrigins []string // Frontend origins browsers may call the API from
+
+	// Timeouts of the http.Server, zero meaning none
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownDelay is how long the server keeps serving, while reporting it
+	// isn't ready, once it's told to stop, so that load balancers can notice
+	// first. ShutdownTimeout is how long requests in flight then get to finish.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile serve HTTPS, which brings HTTP/2 with it.
+	// SelfSignedTLS serves HTTPS with a certificate made at startup instead.
+	TLSCertFile   string
+	TLSKeyFile    string
+	SelfSignedTLS bool
+	H2C           bool // Serve HTTP/2 without TLS, for behind a proxy
+
+	Logger *slog.Logger // Logs requests and the server starting and stopping
+}
+
+func (c Config) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
+}
+
+// TLS reports whether the server serves HTTPS
+func (c Config) TLS() bool {
+	return c.TLSCertFile != "" || c.SelfSignedTLS
+}
+
+// InitRouter initializes the Gin router and registers the routes served by h.
+func InitRouter(h *controllers.Handler, cfg Config) *gin.Engine {
+	router := gin.New()
+	router.HandleMethodNotAllowed = true // Answered with a problem, like unknown paths
+	router.Use(tracing.Middleware(), RequestLogger(cfg.logger()), h.Metrics.Middleware(), Recovery())
 
 	// CORS middleware configuration
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:4200"}, // Frontend URL
+		AllowOrigins:     cfg.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Requested-With", "X-Cart-Token", RequestIDHeader, "traceparent", "tracestate", "baggage"},
+		ExposeHeaders:    []string{"Content-Length", "Authorization", "X-Cart-Token", "ETag", "Last-Modified", RequestIDHeader, "Deprecation", "Sunset", "Link"},
 		AllowCredentials: true,           // Allow cookies or authentication headers
 		MaxAge:           24 * time.Hour, // Cache preflight request for 24 hours
 	}))
 
 	// Register application routes
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, h)
 
 	return router
 }
 
-// StartServer starts the HTTP server on the specified address.
-func StartServer() {
-	router := InitRouter()
+// NewServer returns a server for the routes served by h, set up as cfg says
+func NewServer(h *controllers.Handler, cfg Config) (*stdhttp.Server, error) {
+	router := InitRouter(h, cfg)
+	router.UseH2C = cfg.H2C
 
-	// Start the server on localhost:8080
-	if err := router.Run("localhost:8080"); err != nil {
-		panic("Failed to start the server: " + err.Error())
+	server := &stdhttp.Server{
+		Addr:              cfg.Addr,
+		Handler:           router.Handler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.SelfSignedTLS {
+		cert, err := selfSignedCertificate(cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("NewServer: %v", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		cfg.logger().Warn("Serving HTTPS with a self-signed certificate, for development only")
+	}
+	return server, nil
+}
+
+// StartServer serves the routes served by h until ctx is done. It reports
+// the server ready once it's listening, and not ready once ctx is done. After
+// cfg.ShutdownDelay it stops accepting connections and waits up to
+// cfg.ShutdownTimeout for the requests in flight to finish.
+func StartServer(ctx context.Context, h *controllers.Handler, cfg Config) error {
+	server, err := NewServer(h, cfg)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the server: %v", err)
+	}
+
+	logger := cfg.logger()
+	served := make(chan error, 1)
+	go func() {
+		if cfg.TLS() {
+			logger.Info("Listening", "url", "https://"+listener.Addr().String())
+			served <- server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			logger.Info("Listening", "url", "http://"+listener.Addr().String())
+			served <- server.Serve(listener)
+		}
+	}()
+	h.Health.SetServing(true)
+
+	select {
+	case err := <-served:
+		h.Health.SetServing(false)
+		return fmt.Errorf("failed to start the server: %v", err)
+	case <-ctx.Done():
+	}
+
+	h.Health.SetServing(false)
+	if cfg.ShutdownDelay > 0 {
+		logger.Info("Shutting down after a delay", "delay", cfg.ShutdownDelay)
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	logger.Info("Shutting down, waiting for requests in flight")
+	shutdownCtx := context.Background()
+	if cfg.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("requests were cut off by the shutdown: %v", err)
+	}
+	if err := <-served; !errors.Is(err, stdhttp.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
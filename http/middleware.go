@@ -0,0 +1,63 @@
+package http
+
+import (
+	"io"
+	"log/slog"
+	stdhttp "net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/logging"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID that ties a request to its log entries. An
+// ID given by the client or a proxy in front is kept, so entries can be
+// matched up across services; otherwise one is made up. Either way it's sent
+// back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogger gives each request a logger tagged with its ID, and its trace
+// and span IDs when it's traced, which handlers get with logging.FromContext,
+// and logs the request once it's served. Server errors are logged as errors.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		requestLogger := logger.With("request_id", id)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			requestLogger = requestLogger.With("trace_id", span.TraceID().String(), "span_id", span.SpanID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= stdhttp.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger.LogAttrs(c.Request.Context(), level, "Request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path), // Not the query, which may hold tokens
+			slog.String("route", c.FullPath()),
+			slog.Int("status", c.Writer.Status()),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500, logging it with the stack
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logging.FromContext(c.Request.Context()).Error("Panic serving request", "panic", err, "stack", string(debug.Stack()))
+		apierror.Abort(c, apierror.New(apierror.CodeInternal, ""))
+	})
+}
@@ -0,0 +1,125 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControl sets the Cache-Control header of every response
+func CacheControl(value string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", value)
+		c.Next()
+	}
+}
+
+// Conditional serves GET requests with validators so clients can revalidate
+// them. The response is held back until the handler is done; if it's a 200,
+// it gets an ETag from a hash of the body and a Last-Modified from the latest
+// UpdatedAt in it (the field every gorm.Model has). A request whose
+// If-None-Match or If-Modified-Since shows it already has the response gets
+// a 304 with no body. Removing a record doesn't move Last-Modified on, which
+// is why If-None-Match wins when a client sends both. cacheControl is sent as
+// the Cache-Control header.
+func Conditional(cacheControl string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", cacheControl)
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() != http.StatusOK {
+			c.Writer.WriteHeaderNow()
+			c.Writer.Write(writer.body.Bytes())
+			return
+		}
+		body := writer.body.Bytes()
+		sum := sha256.Sum256(body)
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+		c.Header("ETag", etag)
+		lastModified := latestUpdate(body)
+		if !lastModified.IsZero() {
+			c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		if notModified(c.Request, etag, lastModified) {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Length")
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		c.Writer.Write(body)
+	}
+}
+
+// notModified reports whether the client's copy, going by the request's
+// conditional headers, is still current. If-None-Match wins over
+// If-Modified-Since when both are sent.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// Last-Modified only has whole seconds
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// latestUpdate returns the latest UpdatedAt anywhere in a JSON body, or zero
+// if it has none
+func latestUpdate(body []byte) time.Time {
+	var latest time.Time
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	afterKey := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return latest
+		}
+		value, isString := token.(string)
+		if afterKey && isString {
+			if updated, err := time.Parse(time.RFC3339Nano, value); err == nil && updated.After(latest) {
+				latest = updated
+			}
+		}
+		// Object keys and values both come through as strings, so this only
+		// needs to know a key was just seen
+		afterKey = isString && value == "UpdatedAt" && decoder.More()
+	}
+}
+
+// bufferedWriter holds the body of a response back from the client
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
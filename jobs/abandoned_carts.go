@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/notify"
+	"go.opentelemetry.io/otel"
+)
+
+// AbandonedCartJob periodically looks for carts that were left idle, records
+// them and reminds their owners, optionally with a one-time coupon.
+type AbandonedCartJob struct {
+	Carts          database.CartStore
+	Users          database.UserStore
+	Coupons        database.CouponStore
+	IdleAfter      time.Duration // How long a cart must go untouched to count as abandoned
+	Interval       time.Duration // How often to check
+	Notifier       notify.Notifier
+	CouponDiscount float64       // Percentage off for the reminder coupon; zero sends no coupon
+	CouponValidFor time.Duration // How long the reminder coupon can be used
+	Logger         *slog.Logger
+}
+
+// Defaults of the abandoned cart job: carts idle for a day, checked hourly,
+// with a 10% coupon valid for a week.
+const (
+	DefaultIdleAfter      = 24 * time.Hour
+	DefaultInterval       = time.Hour
+	DefaultCouponDiscount = 10
+	DefaultCouponValidFor = 7 * 24 * time.Hour
+)
+
+// NewAbandonedCartJob returns a job over store with the default settings
+func NewAbandonedCartJob(store database.Store, notifier notify.Notifier) *AbandonedCartJob {
+	return &AbandonedCartJob{
+		Carts:          store,
+		Users:          store,
+		Coupons:        store,
+		IdleAfter:      DefaultIdleAfter,
+		Interval:       DefaultInterval,
+		Notifier:       notifier,
+		CouponDiscount: DefaultCouponDiscount,
+		CouponValidFor: DefaultCouponValidFor,
+		Logger:         slog.Default(),
+	}
+}
+
+// Run checks for abandoned carts every Interval until ctx is cancelled
+func (j *AbandonedCartJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := j.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			j.Logger.Error("Error checking abandoned carts", "error", err)
+		} else if n > 0 {
+			j.Logger.Info("Recorded abandoned carts", "carts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce records every newly abandoned cart and sends its reminder,
+// returning the number of carts recorded.
+func (j *AbandonedCartJob) RunOnce(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer("github.com/Rohanrevanth/e-store-go/jobs").Start(ctx, "AbandonedCartJob.RunOnce")
+	defer span.End()
+
+	carts, err := j.Carts.FindAbandonedCarts(ctx, j.IdleAfter)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, cart := range carts {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := j.handle(ctx, cart); err != nil {
+			j.Logger.Error("Error handling abandoned cart", "cart_id", cart.ID, "error", err)
+		}
+	}
+	return len(carts), nil
+}
+
+func (j *AbandonedCartJob) handle(ctx context.Context, cart models.Cart) error {
+	summary := cart.Summary("", 0)
+	event := models.CartAbandonment{
+		CartID:       cart.ID,
+		UserID:       cart.UserID,
+		ItemCount:    len(cart.Items),
+		Subtotal:     summary.Subtotal,
+		LastActivity: cart.UpdatedAt,
+	}
+	if !models.IsGuestOwner(cart.UserID) {
+		if user, err := j.Users.GetUserByID(ctx, cart.UserID); err == nil {
+			event.Email = user.Email
+		}
+	}
+
+	event, err := j.Carts.AddCartAbandonment(ctx, event)
+	if err != nil {
+		return err
+	}
+	if event.Email == "" || j.Notifier == nil {
+		// Recorded, but there's no one we can remind
+		return nil
+	}
+
+	if j.CouponDiscount > 0 {
+		coupon, err := j.Coupons.GenerateCoupon(ctx, j.CouponDiscount, j.CouponValidFor)
+		if err != nil {
+			return err
+		}
+		event.CouponCode = coupon.Code
+	}
+
+	err = j.Notifier.Notify(ctx, notify.Message{
+		To:      event.Email,
+		Subject: "You left something in your cart",
+		Body:    reminderBody(summary, event.CouponCode, j.CouponDiscount),
+	})
+	if err != nil {
+		return fmt.Errorf("sending reminder: %v", err)
+	}
+
+	now := time.Now()
+	event.ReminderSentAt = &now
+	return j.Carts.SaveCartAbandonment(ctx, event)
+}
+
+func reminderBody(summary models.CartSummary, couponCode string, percent float64) string {
+	var body strings.Builder
+	body.WriteString("Your cart is waiting for you:\n")
+	for _, line := range summary.Items {
+		fmt.Fprintf(&body, "  %d x %s  %.2f\n", line.Quantity, line.Product.Name, line.LineTotal)
+	}
+	fmt.Fprintf(&body, "Subtotal: %.2f\n", summary.Subtotal)
+	if couponCode != "" {
+		fmt.Fprintf(&body, "Use code %s at checkout for %.0f%% off.\n", couponCode, percent)
+	}
+	return body.String()
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// Redacted replaces the values of attributes that must not be logged
+const Redacted = "[REDACTED]"
+
+// secretKeys are parts of attribute names whose values are never logged
+var secretKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "jwt", "hash", "card"}
+
+// personalKeys are parts of attribute names holding details about customers
+var personalKeys = []string{"address", "phone"}
+
+// Redact hides the values of sensitive attributes, going by their names:
+// secrets such as passwords and tokens, customers' postal addresses and
+// phone numbers, the local part of email addresses and the host part of
+// client IP addresses. It's the ReplaceAttr of the loggers New returns.
+// Values that are structs should implement slog.LogValuer to leave their
+// sensitive fields out.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case containsAny(key, secretKeys):
+		return slog.String(a.Key, Redacted)
+	case strings.Contains(key, "email"):
+		return slog.String(a.Key, maskEmail(a.Value.String()))
+	case containsAny(key, personalKeys):
+		return slog.String(a.Key, Redacted)
+	case key == "client_ip" || key == "ip":
+		return slog.String(a.Key, maskIP(a.Value.String()))
+	}
+	return a
+}
+
+func containsAny(key string, parts []string) bool {
+	for _, part := range parts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskEmail keeps the first letter and the domain: a***@example.com
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return Redacted
+	}
+	return local[:1] + "***@" + domain
+}
+
+// maskIP zeroes the host part of an address, keeping the network: the last
+// byte of an IPv4 address, or all but the first 48 bits of an IPv6 one
+func maskIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Redacted
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
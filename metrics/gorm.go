@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// InstrumentDB records the duration and failures of db's statements, and
+// the stats of its connection pool
+func (m *Metrics) InstrumentDB(db *gorm.DB) error {
+	if err := db.Use(gormPlugin{m}); err != nil {
+		return fmt.Errorf("InstrumentDB: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("InstrumentDB: %v", err)
+	}
+	// Exported as go_sql_* with db_name="e-store"
+	if err := m.Registry.Register(collectors.NewDBStatsCollector(sqlDB, "e-store")); err != nil {
+		return fmt.Errorf("InstrumentDB: %v", err)
+	}
+	return nil
+}
+
+// gormPlugin times each statement with callbacks around GORM's own
+type gormPlugin struct {
+	m *Metrics
+}
+
+func (gormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", before),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", p.after("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", before),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", p.after("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", before),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", p.after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", p.after("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", before),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", p.after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", p.after("raw")),
+	)
+}
+
+func before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+// after records a statement of operation. Raw SQL has no table.
+func (p gormPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		table := db.Statement.Table
+		p.m.queryDuration.WithLabelValues(operation, table).Observe(time.Since(start.(time.Time)).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) && !errors.Is(db.Error, context.Canceled) {
+			p.m.queryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests no route matched, so that scanners trying
+// random paths don't each get their own series
+const unmatchedRoute = "unmatched"
+
+// Middleware records the duration and sizes of every request, labelled with
+// the route template it matched (such as /user/:id) rather than its path.
+// It goes before the recovery middleware, so that panics count as 500s.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+		m.requestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+		m.requestSize.WithLabelValues(method, route).Observe(float64(max(c.Request.ContentLength, 0)))
+		m.responseSize.WithLabelValues(method, route).Observe(float64(max(c.Writer.Size(), 0)))
+	}
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "estore"
+
+// Customers, as business metrics are labelled
+const (
+	CustomerUser  = "user"
+	CustomerGuest = "guest"
+)
+
+// Reasons a login fails
+const (
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+)
+
+// Metrics collects the server's metrics in its own registry, to be scraped by
+// Prometheus from Handler: HTTP requests by route, database queries through
+// the GORM plugin, the connection pool, business events, and the Go runtime.
+type Metrics struct {
+	Registry *prometheus.Registry
+	// Token, if set, must be sent as a bearer token to scrape the metrics,
+	// which include the shop's revenue
+	Token string
+
+	requestDuration *prometheus.HistogramVec
+	requestSize     *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+
+	ordersPlaced      *prometheus.CounterVec
+	revenue           *prometheus.CounterVec
+	cartAdds          *prometheus.CounterVec
+	couponRedemptions prometheus.Counter
+	loginFailures     *prometheus.CounterVec
+}
+
+// New returns metrics registered in a new registry, along with the Go runtime
+// and process metrics
+func New() *Metrics {
+	sizeBuckets := prometheus.ExponentialBuckets(100, 10, 6) // 100B to 10MB
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_size_bytes",
+			Help:      "Size of HTTP request bodies, by route template.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "route"}),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP response bodies, by route template.",
+			Buckets:   sizeBuckets,
+		}, []string{"method", "route"}),
+
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time taken by database statements, by operation and table.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation", "table"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_query_errors_total",
+			Help:      "Database statements that failed, by operation and table. Records not found and statements cancelled with their request aren't counted.",
+		}, []string{"operation", "table"}),
+
+		ordersPlaced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_placed_total",
+			Help:      "Orders placed whose payment was authorized, by customer (user or guest).",
+		}, []string{"customer"}),
+		revenue: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revenue_total",
+			Help:      "Total price of the orders whose payment was authorized, after discounts, by customer.",
+		}, []string{"customer"}),
+		cartAdds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cart_adds_total",
+			Help:      "Products added to carts, by customer.",
+		}, []string{"customer"}),
+		couponRedemptions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "coupon_redemptions_total",
+			Help:      "Orders placed with a coupon that took money off.",
+		}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Failed logins, by reason (unknown_user or wrong_password).",
+		}, []string{"reason"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration, m.requestSize, m.responseSize,
+		m.queryDuration, m.queryErrors,
+		m.ordersPlaced, m.revenue, m.cartAdds, m.couponRedemptions, m.loginFailures,
+	)
+	// Start the labelled counters at zero, so rates work from the first order
+	for _, customer := range []string{CustomerUser, CustomerGuest} {
+		m.ordersPlaced.WithLabelValues(customer)
+		m.revenue.WithLabelValues(customer)
+		m.cartAdds.WithLabelValues(customer)
+	}
+	m.loginFailures.WithLabelValues(LoginUnknownUser)
+	m.loginFailures.WithLabelValues(LoginWrongPassword)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	handler := promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.Token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(m.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// OrderPlaced counts an order placed by customer, and the coupon it redeemed
+// if it had a discount
+func (m *Metrics) OrderPlaced(customer string, discounted bool) {
+	m.ordersPlaced.WithLabelValues(customer).Inc()
+	if discounted {
+		m.couponRedemptions.Inc()
+	}
+}
+
+// PaymentAuthorized adds the total of an order whose payment went through to
+// the revenue
+func (m *Metrics) PaymentAuthorized(customer string, total float64) {
+	if total > 0 {
+		m.revenue.WithLabelValues(customer).Add(total)
+	}
+}
+
+// CartAdd counts a product added to a cart by customer
+func (m *Metrics) CartAdd(customer string) {
+	m.cartAdds.WithLabelValues(customer).Inc()
+}
+
+// LoginFailed counts a failed login, for one of the Login* reasons
+func (m *Metrics) LoginFailed(reason string) {
+	m.loginFailures.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxCartItemQuantity is the most of a single product one cart line can hold
+const MaxCartItemQuantity = 20
+
+// Rules for combining a guest cart line with the same product already in the
+// user's cart when the guest logs in
+const (
+	CartMergeSum       = "sum"        // Add the quantities together
+	CartMergeMax       = "max"        // Keep the larger quantity
+	CartMergeKeepUser  = "keep_user"  // Keep the user's line as it was
+	CartMergeKeepGuest = "keep_guest" // Replace it with the guest's line
+)
+
+// guestPrefix marks cart and order owners that are anonymous visitors
+const guestPrefix = "guest:"
+
+// GuestOwner returns the owner ID used for the carts and orders of a guest
+// identified by a cart token.
+func GuestOwner(cartID string) string {
+	return guestPrefix + cartID
+}
+
+// IsGuestOwner reports whether an owner ID belongs to a guest
+func IsGuestOwner(ownerID string) bool {
+	return strings.HasPrefix(ownerID, guestPrefix)
+}
+
+// Warnings attached to cart lines
+const (
+	CartWarningPriceChanged      = "price_changed"
+	CartWarningOutOfStock        = "out_of_stock"
+	CartWarningInsufficientStock = "insufficient_stock"
+	CartWarningUnavailable       = "unavailable"
+)
+
+// CartLine is a cart item with its computed total and anything the customer
+// should be told about it before checking out
+type CartLine struct {
+	CartItem
+	LineTotal float64  `json:"line_total"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// CartSummary is the cart as returned to clients
+type CartSummary struct {
+	ID         uint       `json:"id"`
+	UserID     string     `json:"user_id"`
+	Items      []CartLine `json:"items"`
+	Subtotal   float64    `json:"subtotal"`
+	Discount   float64    `json:"discount"`
+	Total      float64    `json:"total"`
+	CouponCode string     `json:"coupon_code,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"` // Every warning present on any line
+}
+
+// Summary prices the cart at current product prices. discountRate is the
+// fraction taken off the subtotal by the coupon, if any.
+func (c Cart) Summary(couponCode string, discountRate float64) CartSummary {
+	summary := CartSummary{ID: c.ID, UserID: c.UserID, Items: []CartLine{}, CouponCode: couponCode}
+	seen := make(map[string]bool)
+
+	for _, item := range c.Items {
+		line := CartLine{CartItem: item}
+		product := item.Product
+		switch {
+		case product.ID == 0 || product.Disabled:
+			line.Warnings = append(line.Warnings, CartWarningUnavailable)
+		case product.StockTracked && product.Stock <= 0:
+			line.Warnings = append(line.Warnings, CartWarningOutOfStock)
+		case product.StockTracked && product.Stock < item.Quantity:
+			line.Warnings = append(line.Warnings, CartWarningInsufficientStock)
+		}
+		if product.ID != 0 && item.UnitPrice != 0 && item.UnitPrice != product.Price {
+			line.Warnings = append(line.Warnings, CartWarningPriceChanged)
+		}
+
+		line.LineTotal = roundCents(float64(item.Quantity) * product.Price)
+		summary.Subtotal += line.LineTotal
+		for _, warning := range line.Warnings {
+			if !seen[warning] {
+				seen[warning] = true
+				summary.Warnings = append(summary.Warnings, warning)
+			}
+		}
+		summary.Items = append(summary.Items, line)
+	}
+
+	summary.Subtotal = roundCents(summary.Subtotal)
+	summary.Discount = roundCents(summary.Subtotal * discountRate)
+	summary.Total = summary.Subtotal - summary.Discount
+	return summary
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// CartAbandonment records a cart that was left without checking out
+type CartAbandonment struct {
+	gorm.Model
+	CartID         uint       `json:"cart_id" gorm:"not null;index"`
+	UserID         string     `json:"user_id"`
+	Email          string     `json:"email,omitempty"`
+	ItemCount      int        `json:"item_count"`
+	Subtotal       float64    `json:"subtotal"`
+	LastActivity   time.Time  `json:"last_activity"` // Cart's UpdatedAt when it was found idle
+	ReminderSentAt *time.Time `json:"reminder_sent_at,omitempty"`
+	CouponCode     string     `json:"coupon_code,omitempty"`
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DomainEvent is something that happened in the store. Events are recorded in
+// the outbox in the same transaction as the change that raised them, and
+// handed to their subscribers once it's committed.
+type DomainEvent interface {
+	EventName() string
+}
+
+// Names of the domain events
+const (
+	EventOrderPlaced        = "order_placed"
+	EventOrderStatusChanged = "order_status_changed"
+	EventCartUpdated        = "cart_updated"
+	EventUserRegistered     = "user_registered"
+	EventUserChanged        = "user_changed"
+	EventCategoryChanged    = "category_changed"
+	EventProductChanged     = "product_changed"
+	EventStockChanged       = "stock_changed"
+)
+
+// OrderPlaced is raised when an order's payment is authorized. The lines of
+// the cart it was made from are left for the subscribers to clear.
+type OrderPlaced struct {
+	OrderID     uint   `json:"order_id"`
+	UserID      string `json:"user_id"` // The owner of the order and cart, a user or a guest
+	CartItemIDs []uint `json:"cart_item_ids"`
+}
+
+func (OrderPlaced) EventName() string { return EventOrderPlaced }
+
+// OrderStatusChanged is raised when an order moves to a new status, by its
+// payment, its fulfilment or a refund
+type OrderStatusChanged struct {
+	OrderID        uint   `json:"order_id"`
+	UserID         string `json:"user_id"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+func (OrderStatusChanged) EventName() string { return EventOrderStatusChanged }
+
+// CartUpdated is raised when lines are added to, changed in or removed from a
+// cart
+type CartUpdated struct {
+	OwnerID string `json:"owner_id"`
+	CartID  uint   `json:"cart_id"`
+}
+
+func (CartUpdated) EventName() string { return EventCartUpdated }
+
+// UserRegistered is raised when a user signs up. Users loaded by seeds and
+// imports haven't, so they don't raise it.
+type UserRegistered struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func (UserRegistered) EventName() string { return EventUserRegistered }
+
+// UserChanged is raised when a user is saved, updated by an import or
+// deleted, or has an order counted against them
+type UserChanged struct {
+	UserID uint `json:"user_id"`
+}
+
+func (UserChanged) EventName() string { return EventUserChanged }
+
+// CategoryChanged is raised when a category is added, or edited by an import
+type CategoryChanged struct {
+	Name string `json:"name"`
+}
+
+func (CategoryChanged) EventName() string { return EventCategoryChanged }
+
+// ProductChanged is raised when a product is added or edited, or its stock is
+// adjusted
+type ProductChanged struct {
+	ProductID uint `json:"product_id"`
+	Created   bool `json:"created"`
+}
+
+func (ProductChanged) EventName() string { return EventProductChanged }
+
+// StockChanged is raised when orders and returns take products out of stock
+// or put them back. Stock adjusted by hand raises ProductChanged instead.
+type StockChanged struct {
+	ProductIDs []uint `json:"product_ids"`
+}
+
+func (StockChanged) EventName() string { return EventStockChanged }
+
+// Outbox event statuses
+const (
+	OutboxPending    = "pending" // Waiting for its subscribers, or some of them to succeed
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed" // Given up on after too many attempts
+)
+
+// OutboxEvent is a domain event waiting for, or handed to, its subscribers
+type OutboxEvent struct {
+	gorm.Model
+	Name          string `gorm:"not null"`
+	Payload       string `gorm:"not null"` // The event as JSON
+	Status        string `gorm:"default:pending;index"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	LastError     string
+	// Handled lists the subscribers that have succeeded, which aren't run
+	// again when the event is retried for the others
+	Handled      Names `gorm:"type:json"`
+	DispatchedAt *time.Time
+}
+
+// ProcessedEvent records that a subscriber has handled the event with a key,
+// such as the ID of the order it's about, so that it doesn't handle it again
+// when the event is delivered twice
+type ProcessedEvent struct {
+	Subscriber string    `gorm:"primaryKey;size:64"`
+	EventKey   string    `gorm:"primaryKey;size:64"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+// Names is a list of names, stored as JSON
+type Names []string
+
+func (n Names) Value() (driver.Value, error) {
+	return json.Marshal(n)
+}
+
+func (n *Names) Scan(value interface{}) error {
+	var byteValue []byte
+	switch v := value.(type) {
+	case string:
+		byteValue = []byte(v)
+	case []byte:
+		byteValue = v
+	default:
+		return errors.New("unsupported data type for Names")
+	}
+	return json.Unmarshal(byteValue, n)
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Order statuses. An order starts out Pending and is moved along by the
+// results of its payment. It's placed, emptying the cart it was made from,
+// once its payment is authorized; until then its stock and coupon are only
+// held, and they're given back if the payment fails or the order is cancelled.
+const (
+	OrderStatusPending         = "Pending"
+	OrderStatusAwaitingPayment = "Awaiting Payment" // 3DS or similar customer action outstanding
+	OrderStatusAuthorized      = "Authorized"
+	OrderStatusPaid            = "Paid"
+	OrderStatusPaymentFailed   = "Payment Failed"
+	OrderStatusCancelled       = "Cancelled"
+	OrderStatusShipped         = "Shipped"
+	OrderStatusDelivered       = "Delivered"
+	OrderStatusPartlyRefunded  = "Partially Refunded"
+	OrderStatusRefunded        = "Refunded"
+)
+
+// Payment statuses as reported by a payment provider.
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusDeclined   = "declined"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusFailed     = "failed"
+)
+
+// Transaction types recorded against a payment.
+const (
+	TransactionAuthorize = "authorize"
+	TransactionCapture   = "capture"
+	TransactionVoid      = "void"
+	TransactionRefund    = "refund"
+	TransactionWebhook   = "webhook"
+)
+
+// Payment is the payment taken (or attempted) for an order
+type Payment struct {
+	gorm.Model
+	OrderID        uint          `json:"order_id" gorm:"not null;index"`
+	Provider       string        `json:"provider"`
+	ProviderRef    string        `json:"provider_ref" gorm:"index"` // Reference assigned by the provider
+	Method         string        `json:"method"`
+	Amount         float64       `json:"amount"`
+	CapturedAmount float64       `json:"captured_amount"`
+	RefundedAmount float64       `json:"refunded_amount"`
+	Currency       string        `json:"currency"`
+	Status         string        `json:"status"`
+	NextActionURL  string        `json:"next_action_url,omitempty"` // Where the customer completes 3DS
+	Transactions   []Transaction `json:"transactions,omitempty" gorm:"foreignKey:PaymentID"`
+}
+
+// Transaction is a single call made to the payment provider
+type Transaction struct {
+	gorm.Model
+	PaymentID   uint    `json:"payment_id" gorm:"not null;index"`
+	Type        string  `json:"type"`
+	Amount      float64 `json:"amount"`
+	Status      string  `json:"status"`
+	ProviderRef string  `json:"provider_ref"`
+	Message     string  `json:"message,omitempty"`
+}
+
+// paymentOrderStatus maps a payment status onto the order status it leads to
+var paymentOrderStatus = map[string]string{
+	PaymentStatusPending:    OrderStatusAwaitingPayment,
+	PaymentStatusAuthorized: OrderStatusAuthorized,
+	PaymentStatusCaptured:   OrderStatusPaid,
+	PaymentStatusDeclined:   OrderStatusPaymentFailed,
+	PaymentStatusFailed:     OrderStatusPaymentFailed,
+	PaymentStatusVoided:     OrderStatusCancelled,
+	PaymentStatusRefunded:   OrderStatusRefunded,
+}
+
+// orderTransitions lists the order statuses reachable from each status
+var orderTransitions = map[string][]string{
+	OrderStatusPending:         {OrderStatusAwaitingPayment, OrderStatusAuthorized, OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCancelled},
+	OrderStatusAwaitingPayment: {OrderStatusAuthorized, OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCancelled},
+	OrderStatusAuthorized:      {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:            {OrderStatusShipped, OrderStatusPartlyRefunded, OrderStatusRefunded},
+	OrderStatusShipped:         {OrderStatusDelivered},
+	OrderStatusDelivered:       {OrderStatusPartlyRefunded, OrderStatusRefunded},
+	OrderStatusPartlyRefunded:  {OrderStatusRefunded},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PlacesOrder reports whether an order moving from one status to another has
+// just had its payment authorized
+func PlacesOrder(from, to string) bool {
+	unpaid := from == OrderStatusPending || from == OrderStatusAwaitingPayment
+	return unpaid && (to == OrderStatusAuthorized || to == OrderStatusPaid)
+}
+
+// ReleasesOrder reports whether an order moving to status gives back the
+// stock and coupon it held
+func ReleasesOrder(from, to string) bool {
+	return from != to && (to == OrderStatusPaymentFailed || to == OrderStatusCancelled)
+}
+
+// OrderStatusForPayment returns the order status a payment status drives the
+// order to, or false if the payment status doesn't affect the order.
+func OrderStatusForPayment(paymentStatus string) (string, bool) {
+	status, ok := paymentOrderStatus[paymentStatus]
+	return status, ok
+}
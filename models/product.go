@@ -13,6 +13,7 @@ type Category struct {
 
 type Product struct {
 	gorm.Model
+	SKU          string  `json:"sku,omitempty" gorm:"size:64;index"` // Stock keeping unit, the key for catalog imports
 	Name         string  `json:"name"`
 	Description  string  `json:"description"`
 	Details      string  `json:"details"`
@@ -20,4 +21,14 @@ type Product struct {
 	Category     string  `json:"category"`
 	Price        float64 `json:"price"`
 	Isbestseller bool    `json:"isbestseller"`
+	Stock        int     `json:"stock"`
+	StockTracked bool    `json:"stock_tracked" gorm:"not null;default:false"` // Untracked products, such as those from before stock was counted, never run out
+	Disabled     bool    `json:"disabled"`                                    // Hidden from sale without deleting it
+}
+
+// TrackNewStock marks a product being created with a stock level as tracked
+func (p *Product) TrackNewStock() {
+	if p.Stock > 0 {
+		p.StockTracked = true
+	}
 }
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Return request statuses
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved" // Approved but the refund hasn't gone through yet
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusRefunded  = "refunded"
+)
+
+// ReturnRequest is a customer's request to send back items from an order
+type ReturnRequest struct {
+	gorm.Model
+	OrderID      uint         `json:"order_id" gorm:"not null;index"`
+	UserID       string       `json:"user_id" gorm:"not null;index"`
+	Status       string       `json:"status" gorm:"default:requested"`
+	Reason       string       `json:"reason"`
+	AdminNote    string       `json:"admin_note,omitempty"`
+	RefundAmount float64      `json:"refund_amount,omitempty"`
+	RefundRef    string       `json:"refund_ref,omitempty"` // Payment provider's reference for the refund, once issued
+	Items        []ReturnItem `json:"items" gorm:"foreignKey:ReturnRequestID"`
+}
+
+// ReturnItem is a quantity of one order item being returned
+type ReturnItem struct {
+	gorm.Model
+	ReturnRequestID uint    `json:"return_request_id" gorm:"not null;index"`
+	OrderItemID     uint    `json:"order_item_id" gorm:"not null"`
+	ProductID       uint    `json:"product_id"`
+	Quantity        int     `json:"quantity"`
+	Price           float64 `json:"price"` // Unit price paid, copied from the order item
+	Reason          string  `json:"reason"`
+}
+
+// CreditNote records money given back to the customer against an order
+type CreditNote struct {
+	gorm.Model
+	OrderID         uint    `json:"order_id" gorm:"not null;index"`
+	ReturnRequestID uint    `json:"return_request_id,omitempty"`
+	Amount          float64 `json:"amount"`
+	Reason          string  `json:"reason"`
+	ProviderRef     string  `json:"provider_ref,omitempty"` // Refund reference from the payment provider
+}
+
+// ReturnDecision is the admin's input when approving or rejecting a return
+type ReturnDecision struct {
+	RefundAmount float64 `json:"refund_amount"` // Overrides the calculated refund when set
+	Restock      *bool   `json:"restock"`       // Defaults to true
+	Note         string  `json:"note"`
+}
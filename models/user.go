@@ -4,6 +4,8 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"log/slog"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -20,6 +22,18 @@ type User struct {
 	Type         string    `json:"type,omitempty"`
 }
 
+// LogValue logs a user by ID and type, leaving out their password hash and
+// contact details
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(slog.Uint64("id", uint64(u.ID)), slog.String("type", u.Type))
+}
+
+// User types
+const (
+	UserTypeCustomer = ""
+	UserTypeAdmin    = "admin"
+)
+
 type Addresses []string
 
 type AddressStringObj struct {
@@ -32,14 +46,17 @@ type CouponCodeObj struct {
 
 type CouponObject struct {
 	gorm.Model
-	Code           string  `json:"code"`
-	Discount       float64 `json:"discount"`
-	OrderFrequency int64   `json:"order_frequency"`
+	Code           string     `json:"code"`
+	Discount       float64    `json:"discount"` // Percentage off the order
+	OrderFrequency int64      `json:"order_frequency"`
+	SingleUse      bool       `json:"single_use,omitempty"` // Generated one-time coupon
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RedeemedAt     *time.Time `json:"redeemed_at,omitempty"`
 }
 
 type Cart struct {
 	gorm.Model
-	UserID string     `json:"user_id" gorm:"unique"`          // Each cart belongs to a specific user
+	UserID string     `json:"user_id" gorm:"unique"`          // Each cart belongs to a specific user, or a guest (see GuestOwner)
 	User   User       `json:"user" gorm:"foreignKey:UserID"`  // Foreign key for User
 	Items  []CartItem `json:"items" gorm:"foreignKey:CartID"` // Establishes a relationship with CartItem
 }
@@ -50,18 +67,42 @@ type CartItem struct {
 	ProductID uint    `json:"product_id"`                          // Foreign key to associate with Product
 	Product   Product `json:"product" gorm:"foreignKey:ProductID"` // Reference to the Product
 	Quantity  int     `json:"quantity"`                            // Quantity of the product in the cart
+	UnitPrice float64 `json:"unit_price"`                          // Product price when the line was last changed
 }
 
 type Order struct {
 	gorm.Model
-	UserID          string      `json:"user_id" gorm:"not null"`
-	PaymentMethod   string      `json:"payment_method,omitempty"`
-	Status          string      `json:"status,omitempty" gorm:"default:Pending"`
-	OrderItems      []OrderItem `json:"order_items,omitempty" gorm:"foreignKey:OrderID"`
-	TotalPrice      float64     `json:"total_price,omitempty"`
-	Discount        float64     `json:"discount,omitempty"`
-	CouponCode      string      `json:"coupon_code,omitempty"`
-	ShippingDetails string      `json:"shipping_details,omitempty"`
+	UserID          string       `json:"user_id" gorm:"not null"`
+	PaymentMethod   string       `json:"payment_method,omitempty"`
+	Status          string       `json:"status,omitempty" gorm:"default:Pending"`
+	OrderItems      []OrderItem  `json:"order_items,omitempty" gorm:"foreignKey:OrderID"`
+	TotalPrice      float64      `json:"total_price,omitempty"`
+	Discount        float64      `json:"discount,omitempty"`
+	CouponCode      string       `json:"coupon_code,omitempty"`
+	ShippingDetails string       `json:"shipping_details,omitempty"`
+	Email           string       `json:"email,omitempty"` // Contact address for guest orders
+	CreditNotes     []CreditNote `json:"credit_notes,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// HasProduct reports whether any of the order's items is of the product
+func (o Order) HasProduct(productID uint) bool {
+	for _, item := range o.OrderItems {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// LogValue logs an order without the customer's contact and shipping details
+func (o Order) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("id", uint64(o.ID)),
+		slog.String("user_id", o.UserID),
+		slog.String("status", o.Status),
+		slog.Int("items", len(o.OrderItems)),
+		slog.Float64("total_price", o.TotalPrice),
+	)
 }
 
 type OrderItem struct {
@@ -71,6 +112,7 @@ type OrderItem struct {
 	Product   Product `json:"product" gorm:"foreignKey:ProductID"` // Product reference
 	Quantity  int     `json:"quantity" gorm:"not null"`
 	Price     float64 `json:"price" gorm:"not null"`
+	Returned  int     `json:"returned,omitempty"` // Quantity refunded through returns
 }
 
 // type ShippingDetails struct {
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Events a webhook subscription can receive
+const (
+	WebhookOrderPlaced        = "order.placed"
+	WebhookOrderStatusChanged = "order.status_changed"
+	WebhookProductCreated     = "product.created"
+	WebhookProductUpdated     = "product.updated"
+)
+
+// WebhookEvents are all the events a subscription can receive
+var WebhookEvents = []string{
+	WebhookOrderPlaced,
+	WebhookOrderStatusChanged,
+	WebhookProductCreated,
+	WebhookProductUpdated,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending" // Waiting for its first or next attempt
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead" // Given up on after too many failed attempts
+)
+
+// WebhookSubscription sends the events it lists to a partner's URL
+type WebhookSubscription struct {
+	gorm.Model
+	URL         string     `json:"url" gorm:"not null"`
+	Secret      string     `json:"secret,omitempty" gorm:"not null"` // Signs the payloads; only shown when the subscription is created
+	Events      EventTypes `json:"events" gorm:"type:json"`
+	Description string     `json:"description,omitempty"`
+	Disabled    bool       `json:"disabled"` // Disabled subscriptions get no new deliveries
+}
+
+// Receives reports whether the subscription wants events of the given type
+func (s WebhookSubscription) Receives(eventType string) bool {
+	return !s.Disabled && slices.Contains(s.Events, eventType)
+}
+
+// EventTypes is a list of webhook events, stored as JSON
+type EventTypes []string
+
+func (e EventTypes) Value() (driver.Value, error) {
+	return json.Marshal(e)
+}
+
+func (e *EventTypes) Scan(value interface{}) error {
+	var byteValue []byte
+	switch v := value.(type) {
+	case string:
+		byteValue = []byte(v)
+	case []byte:
+		byteValue = v
+	default:
+		return errors.New("unsupported data type for EventTypes")
+	}
+	return json.Unmarshal(byteValue, e)
+}
+
+// WebhookDelivery is one event queued for one subscription, retried until the
+// partner accepts it or it's given up on
+type WebhookDelivery struct {
+	gorm.Model
+	SubscriptionID uint       `json:"subscription_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"not null;index"` // The same for every subscription's delivery of an event
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"not null"` // The JSON body sent
+	Status         string     `json:"status" gorm:"default:pending;index"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+
+	AttemptLog []WebhookAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:DeliveryID"`
+}
+
+// WebhookAttempt records one try at sending a delivery
+type WebhookAttempt struct {
+	gorm.Model
+	DeliveryID uint   `json:"delivery_id" gorm:"not null;index"`
+	StatusCode int    `json:"status_code,omitempty"` // Zero when no response came back
+	Error      string `json:"error,omitempty"`
+	Response   string `json:"response,omitempty"` // The start of the response body
+	DurationMS int64  `json:"duration_ms"`
+}
@@ -0,0 +1,882 @@
+package openapi_test
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/controllers"
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	apihttp "github.com/Rohanrevanth/e-store-go/http"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/openapi"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/Rohanrevanth/e-store-go/webhooks"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	// Exports and imports in JSON Lines are checked as text, like CSV ones
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.PlainBodyDecoder)
+}
+
+// TestContract checks the API keeps to the document it serves: every route
+// under /api must be documented and every documented operation routed, and a
+// walk through every operation, as customers, visitors and admins would make
+// it, must send only requests the document allows and get only responses it
+// describes. The API is served from an empty in-memory store, since the walk
+// relies on the IDs of the records it creates, with payments going through
+// the fake provider and webhooks to a local receiver.
+func TestContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	memory := database.NewMemoryStore()
+	bus := events.NewBus()
+	events.SubscribeDefaults(bus, memory, nil)
+	webhooks.Subscribe(bus, memory)
+	outbox := events.NewDispatcher(memory, bus)
+	outbox.Logger = discard
+	store := events.NewStore(memory, outbox)
+	handler := controllers.NewHandler(store, payments.NewFakeProvider(payments.FakeConfig{WebhookSecret: "contract-secret"}))
+	router := apihttp.InitRouter(handler, apihttp.Config{CORSOrigins: []string{"http://localhost:4200"}, Logger: discard})
+
+	// Webhooks are retried right away, and given up on after a second try
+	dispatcher := webhooks.NewDispatcher(store)
+	dispatcher.AllowPrivate = true
+	dispatcher.Interval = 10 * time.Millisecond
+	dispatcher.BaseDelay = 10 * time.Millisecond
+	dispatcher.MaxAttempts = 2
+	dispatcher.Logger = discard
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		dispatcher.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-dispatched
+	}()
+
+	steps := []struct {
+		name string
+		run  func(*contract) error
+	}{
+		{"document", checkDocument},
+		{"routes", checkRoutes},
+		{"operations", checkOperations},
+		{"auth", checkAuth},
+		{"users", checkUsers},
+		{"catalog", checkCatalog},
+		{"imports", checkImports},
+		{"coupons", checkCoupons},
+		{"cart", checkCart},
+		{"orders", checkOrders},
+		{"payments", checkPayments},
+		{"returns", checkReturns},
+		{"guest", checkGuest},
+		{"graphql", checkGraphQL},
+		{"webhooks", checkWebhooks},
+		{"deletes", checkDeletes},
+		{"coverage", checkCoverage},
+	}
+	c := &contract{ctx: ctx, engine: router, users: store, called: map[string]bool{}}
+	for _, step := range steps {
+		if err := step.run(c); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+}
+
+// contract sends requests through the router, checking each against the
+// document, and carries the records created by one step into the next
+type contract struct {
+	ctx    context.Context
+	engine *gin.Engine
+	users  database.UserStore // To add the admin, who can't sign up
+	doc    *openapi3.T
+	router routers.Router
+	called map[string]bool // Operation IDs
+
+	token     string      // Sent as the bearer token, the admin's unless changed
+	customer  string      // The customer's token
+	cartToken string      // Sent as the guest cart token
+	invalid   bool        // Whether the request is meant to break the document
+	header    http.Header // Of the last response
+
+	customerID string
+	mugID      uint
+	lampID     uint
+	orderID    string
+	itemID     uint
+	pendingID  string
+}
+
+// data is the envelope of a successful response
+type data[T any] struct {
+	Data T `json:"data"`
+}
+
+var validation = &openapi3filter.Options{
+	AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+	IncludeResponseStatus: true,
+	MultiError:            false,
+}
+
+// send sends req and checks both it and the response against the document.
+// It fails unless the response has status want, or any documented status if
+// want is 0, and decodes the response's JSON body into out if it's given.
+func (c *contract) send(req *http.Request, want int, out any) error {
+	name := req.Method + " " + req.URL.RequestURI()
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.cartToken != "" {
+		req.Header.Set("X-Cart-Token", c.cartToken)
+	}
+	route, pathParams, err := c.router.FindRoute(req)
+	if err != nil {
+		return fmt.Errorf("%s isn't documented: %v", name, err)
+	}
+	c.called[route.Operation.OperationID] = true
+
+	// Validating reads the body, so it's kept to send afterwards
+	var body []byte
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	input := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route, Options: validation}
+	err = openapi3filter.ValidateRequest(c.ctx, input)
+	switch {
+	case err != nil && !c.invalid:
+		return fmt.Errorf("%s: the request doesn't match the document: %v", name, err)
+	case err == nil && c.invalid:
+		return fmt.Errorf("%s: the request should break the document", name)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorder := httptest.NewRecorder()
+	c.engine.ServeHTTP(recorder, req)
+	c.header = recorder.Header()
+	response := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.Code,
+		Header:                 recorder.Header(),
+		Options:                validation,
+	}
+	response.SetBodyBytes(recorder.Body.Bytes())
+	if err := openapi3filter.ValidateResponse(c.ctx, response); err != nil {
+		return fmt.Errorf("%s: the %d response doesn't match the document: %v", name, recorder.Code, err)
+	}
+	if want != 0 && recorder.Code != want {
+		return fmt.Errorf("%s: got %d, not %d: %s", name, recorder.Code, want, recorder.Body.Bytes())
+	}
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// call sends a request with body, if it isn't nil, as JSON
+func (c *contract) call(method, path string, body any, want int, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req := httptest.NewRequestWithContext(c.ctx, method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.send(req, want, out)
+}
+
+// calls makes calls one after the other, stopping at the first that fails
+func (c *contract) calls(calls ...func() error) error {
+	for _, call := range calls {
+		if err := call(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *contract) get(path string, want int) func() error {
+	return func() error { return c.call(http.MethodGet, path, nil, want, nil) }
+}
+
+func (c *contract) with(method, path string, body any, want int) func() error {
+	return func() error { return c.call(method, path, body, want, nil) }
+}
+
+// breaking sends a request the document doesn't allow, to check the
+// handler's answer to it is still documented
+func (c *contract) breaking(method, path string, body any, want int) func() error {
+	return func() error {
+		c.invalid = true
+		defer func() { c.invalid = false }()
+		return c.call(method, path, body, want, nil)
+	}
+}
+
+// as makes calls with token, the customer's or none, rather than the
+// admin's
+func (c *contract) as(token string, calls ...func() error) func() error {
+	return func() error {
+		admin := c.token
+		c.token = token
+		defer func() { c.token = admin }()
+		return c.calls(calls...)
+	}
+}
+
+// checkDocument loads the document the router serves and checks it's valid
+// OpenAPI
+func checkDocument(c *contract) error {
+	recorder := httptest.NewRecorder()
+	c.engine.ServeHTTP(recorder, httptest.NewRequestWithContext(c.ctx, http.MethodGet, openapi.SpecPath, nil))
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("GET %s: got %d", openapi.SpecPath, recorder.Code)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(recorder.Body.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := doc.Validate(c.ctx); err != nil {
+		return err
+	}
+	c.doc = doc
+	c.router, err = gorillamux.NewRouter(doc)
+	return err
+}
+
+// checkRoutes compares the routes under /api with the documented operations
+func checkRoutes(c *contract) error {
+	documented := map[string]bool{}
+	for path, item := range c.doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	var undocumented []string
+	for _, route := range c.engine.Routes() {
+		path, _ := openapi.TemplatePath(route.Path)
+		key := route.Method + " " + path
+		if documented[key] {
+			delete(documented, key)
+		} else if strings.HasPrefix(route.Path, "/api/") {
+			undocumented = append(undocumented, key)
+		}
+	}
+	if len(undocumented) > 0 {
+		slices.Sort(undocumented)
+		return fmt.Errorf("routes missing from the document: %s", strings.Join(undocumented, ", "))
+	}
+	if len(documented) > 0 {
+		var missing []string
+		for key := range documented {
+			missing = append(missing, key)
+		}
+		slices.Sort(missing)
+		return fmt.Errorf("documented operations that aren't routed: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkOperations(c *contract) error {
+	return c.calls(
+		c.get("/healthz", http.StatusOK),
+		c.get("/readyz", 0), // Depends on whether the router is serving
+		c.get("/version", http.StatusOK),
+		c.get("/metrics", 0), // Depends on whether it needs a token
+		c.get("/errors", http.StatusOK),
+		c.get("/errors/not_found", http.StatusOK),
+		c.get("/errors/no_such_code", http.StatusNotFound),
+		c.get(openapi.SpecPath, http.StatusOK),
+	)
+}
+
+// checkAuth registers a customer, and checks they can't register as an
+// admin, then logs in as them and as an admin
+func checkAuth(c *contract) error {
+	var registered data[[]struct {
+		ID    uint   `json:"ID"`
+		Email string `json:"email"`
+		Type  string `json:"type"`
+	}]
+	users := []map[string]string{
+		{"username": "contract-customer", "email": "customer@contract.test", "password": "customer-password"},
+		{"username": "contract-pretender", "email": "pretender@contract.test", "password": "pretender-password", "type": "admin"},
+	}
+	if err := c.call(http.MethodPost, "/api/v1/auth/register", users, http.StatusOK, &registered); err != nil {
+		return err
+	}
+	for _, user := range registered.Data {
+		if user.Type != models.UserTypeCustomer {
+			return fmt.Errorf("%s registered as %s", user.Email, user.Type)
+		}
+		if user.Email == "customer@contract.test" {
+			c.customerID = strconv.FormatUint(uint64(user.ID), 10)
+		}
+	}
+	if c.customerID == "" {
+		return fmt.Errorf("the customer wasn't registered: %+v", registered.Data)
+	}
+
+	admin := models.User{Username: "contract-admin", Email: "admin@contract.test", Type: models.UserTypeAdmin}
+	if err := admin.HashPassword("admin-password"); err != nil {
+		return err
+	}
+	if err := c.users.AddUser(c.ctx, admin); err != nil {
+		return err
+	}
+
+	wrong := map[string]string{"email": "admin@contract.test", "password": "wrong"}
+	if err := c.call(http.MethodPost, "/api/v1/auth/login", wrong, http.StatusUnauthorized, nil); err != nil {
+		return err
+	}
+	login := func(email, password string) (string, error) {
+		var session struct {
+			Token string `json:"token"`
+		}
+		credentials := map[string]string{"email": email, "password": password}
+		err := c.call(http.MethodPost, "/api/v1/auth/login", credentials, http.StatusOK, &session)
+		return session.Token, err
+	}
+	var err error
+	if c.customer, err = login("customer@contract.test", "customer-password"); err != nil {
+		return err
+	}
+	c.token, err = login("admin@contract.test", "admin-password")
+	return err
+}
+
+func checkUsers(c *contract) error {
+	user := "/api/v1/users/" + c.customerID
+	return c.calls(
+		c.get("/api/v1/users", http.StatusOK),
+		c.get(user, http.StatusOK),
+		c.get("/api/v1/users/999999", http.StatusNotFound),
+		c.with(http.MethodPut, user+"/address", map[string]any{"address": []string{"1 Main St"}}, http.StatusOK),
+	)
+}
+
+func checkCatalog(c *contract) error {
+	categories := []map[string]any{{"name": "Mugs"}, {"name": "Lamps"}}
+	products := []map[string]any{
+		{"sku": "CONTRACT-MUG", "name": "Mug", "category": "Mugs", "price": 12.5, "stock": 10, "isbestseller": true},
+		{"sku": "CONTRACT-LAMP", "name": "Lamp", "category": "Lamps", "price": 40, "stock": 5},
+	}
+	err := c.calls(
+		c.with(http.MethodPost, "/api/v1/categories", categories, http.StatusOK),
+		c.get("/api/v1/categories", http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/products", products, http.StatusOK),
+		c.get("/api/v1/products?category=Mugs", http.StatusOK),
+		c.get("/api/v1/products/best-sellers", http.StatusOK),
+	)
+	if err != nil {
+		return err
+	}
+
+	var listed data[[]struct {
+		ID  uint   `json:"ID"`
+		SKU string `json:"sku"`
+	}]
+	if err := c.call(http.MethodGet, "/api/v1/products", nil, http.StatusOK, &listed); err != nil {
+		return err
+	}
+	for _, product := range listed.Data {
+		switch product.SKU {
+		case "CONTRACT-MUG":
+			c.mugID = product.ID
+		case "CONTRACT-LAMP":
+			c.lampID = product.ID
+		}
+	}
+	if c.mugID == 0 || c.lampID == 0 {
+		return fmt.Errorf("the products weren't added: %+v", listed.Data)
+	}
+	return nil
+}
+
+func checkImports(c *contract) error {
+	upload := func(query string, want int, out any) error {
+		req := httptest.NewRequestWithContext(c.ctx, http.MethodPost, "/api/v1/products/import?"+query,
+			strings.NewReader("sku,name,price\nCONTRACT-PEN,Pen,2\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		return c.send(req, want, out)
+	}
+	if err := upload("dry_run=true", http.StatusOK, nil); err != nil {
+		return err
+	}
+	var job data[struct {
+		ID string `json:"id"`
+	}]
+	if err := upload("dry_run=true&async=true", http.StatusAccepted, &job); err != nil {
+		return err
+	}
+	return c.calls(
+		c.get("/api/v1/import-jobs", http.StatusOK),
+		c.get("/api/v1/import-jobs/"+job.Data.ID, http.StatusOK),
+		c.get("/api/v1/import-jobs/no-such-job", http.StatusNotFound),
+		c.as(c.customer, c.get("/api/v1/import-jobs", http.StatusForbidden)),
+		c.as(c.customer, c.get("/api/v1/exports/customers", http.StatusForbidden)),
+		c.get("/api/v1/exports/products", http.StatusOK),
+		c.get("/api/v1/exports/customers?format=jsonl", http.StatusOK),
+		c.breaking(http.MethodGet, "/api/v1/exports/no-such-kind", nil, http.StatusNotFound),
+	)
+}
+
+func checkCoupons(c *contract) error {
+	coupon := map[string]any{"code": "CONTRACT5", "discount": 5, "order_frequency": 1}
+	return c.calls(
+		c.with(http.MethodPost, "/api/v1/coupons", coupon, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/coupons", coupon, http.StatusConflict),
+		c.get("/api/v1/coupons", http.StatusOK),
+		c.with(http.MethodPut, "/api/v1/coupons/CONTRACT5", map[string]any{"discount": 10, "order_frequency": 1}, http.StatusOK),
+		c.with(http.MethodPut, "/api/v1/coupons/NO-SUCH-COUPON", map[string]any{"discount": 10}, http.StatusNotFound),
+		c.get("/api/v1/users/"+c.customerID+"/coupons/CONTRACT5", http.StatusOK),
+		c.with(http.MethodDelete, "/api/v1/coupons/CONTRACT5", nil, http.StatusOK),
+		c.with(http.MethodDelete, "/api/v1/coupons/CONTRACT5", nil, http.StatusNotFound),
+	)
+}
+
+func checkCart(c *contract) error {
+	items := "/api/v1/users/" + c.customerID + "/cart/items"
+	mug := fmt.Sprintf("%s/%d", items, c.mugID)
+	return c.calls(
+		c.with(http.MethodPost, items, map[string]any{"product_id": c.mugID, "quantity": 2}, http.StatusOK),
+		c.with(http.MethodPost, items, map[string]any{"product_id": 999999, "quantity": 1}, http.StatusUnprocessableEntity),
+		c.with(http.MethodPut, mug, map[string]any{"quantity": 3}, http.StatusOK),
+		c.with(http.MethodDelete, mug+"?quantity=1", nil, http.StatusOK),
+		c.with(http.MethodPost, items, map[string]any{"product_id": c.lampID, "quantity": 1}, http.StatusOK),
+		c.with(http.MethodDelete, fmt.Sprintf("%s/%d", items, c.lampID), nil, http.StatusOK),
+		c.get("/api/v1/users/"+c.customerID+"/cart", http.StatusOK),
+		c.get("/api/v1/carts/abandoned", http.StatusOK),
+	)
+}
+
+// checkOrders orders the two mugs in the cart, then tries an empty cart, a
+// declined payment, which leaves the cart as it was, and one waiting on 3DS
+func checkOrders(c *contract) error {
+	order := func(method string) map[string]any {
+		return map[string]any{"user_id": c.customerID, "payment_method": method, "shipping_details": "1 Main St"}
+	}
+	var placed data[struct {
+		OrderID uint `json:"order_id"`
+	}]
+	if err := c.call(http.MethodPost, "/api/v1/orders", order("fake_success"), http.StatusOK, &placed); err != nil {
+		return err
+	}
+	c.orderID = strconv.FormatUint(uint64(placed.Data.OrderID), 10)
+
+	items := "/api/v1/users/" + c.customerID + "/cart/items"
+	mug := map[string]any{"product_id": c.mugID, "quantity": 1}
+	err := c.calls(
+		c.with(http.MethodPost, "/api/v1/orders", order("fake_success"), http.StatusUnprocessableEntity),
+		c.with(http.MethodPost, items, mug, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/orders", order("fake_declined"), http.StatusPaymentRequired),
+	)
+	if err != nil {
+		return err
+	}
+	var cart data[struct {
+		Items []struct {
+			Quantity int `json:"quantity"`
+		} `json:"items"`
+	}]
+	if err := c.call(http.MethodGet, "/api/v1/users/"+c.customerID+"/cart", nil, http.StatusOK, &cart); err != nil {
+		return err
+	}
+	if len(cart.Data.Items) != 1 || cart.Data.Items[0].Quantity != 1 {
+		return fmt.Errorf("cart after a declined payment holds %+v, want the mug", cart.Data.Items)
+	}
+	if err := c.call(http.MethodPost, "/api/v1/orders", order("fake_3ds"), http.StatusAccepted, &placed); err != nil {
+		return err
+	}
+	c.pendingID = strconv.FormatUint(uint64(placed.Data.OrderID), 10)
+
+	if err := c.call(http.MethodGet, "/api/v1/orders", nil, http.StatusOK, nil); err != nil {
+		return err
+	}
+	var orders data[[]struct {
+		ID    uint `json:"ID"`
+		Items []struct {
+			ID uint `json:"ID"`
+		} `json:"order_items"`
+	}]
+	if err := c.call(http.MethodGet, "/api/v1/users/"+c.customerID+"/orders", nil, http.StatusOK, &orders); err != nil {
+		return err
+	}
+	for _, order := range orders.Data {
+		if strconv.FormatUint(uint64(order.ID), 10) == c.orderID && len(order.Items) > 0 {
+			c.itemID = order.Items[0].ID
+		}
+	}
+	if c.itemID == 0 {
+		return fmt.Errorf("order %s isn't among the user's orders: %+v", c.orderID, orders.Data)
+	}
+	return nil
+}
+
+// checkPayments captures the first order's payment and delivers it, and
+// voids the one waiting on 3DS
+func checkPayments(c *contract) error {
+	payment := "/api/v1/orders/" + c.orderID + "/payment"
+	status := "/api/v1/orders/" + c.orderID + "/status"
+	err := c.calls(
+		c.get(payment, http.StatusOK),
+		c.as(c.customer,
+			c.get(payment, http.StatusOK),
+			c.with(http.MethodPost, payment+"/capture", nil, http.StatusForbidden),
+		),
+		c.get("/api/v1/orders/999999/payment", http.StatusNotFound),
+		c.with(http.MethodPost, payment+"/capture", nil, http.StatusOK),
+		c.with(http.MethodPost, payment+"/capture", nil, http.StatusConflict),
+		c.with(http.MethodPost, "/api/v1/orders/"+c.pendingID+"/payment/void", nil, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/orders/"+c.pendingID+"/payment/void", nil, http.StatusConflict),
+		c.with(http.MethodPut, status, map[string]any{"status": "Shipped"}, http.StatusOK),
+		c.with(http.MethodPut, status, map[string]any{"status": "Delivered"}, http.StatusOK),
+		c.with(http.MethodPut, status, map[string]any{"status": "Shipped"}, http.StatusConflict),
+		c.with(http.MethodPut, status, map[string]any{"status": "Paid"}, http.StatusUnprocessableEntity),
+	)
+	if err != nil {
+		return err
+	}
+
+	event := map[string]any{"id": "evt_contract", "type": "payment.captured", "provider_ref": "unknown", "status": "captured", "amount": 1}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req := httptest.NewRequestWithContext(c.ctx, http.MethodPost, "/api/v1/payments/webhook", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Payment-Signature", "not-the-signature")
+	return c.send(req, http.StatusUnauthorized, nil)
+}
+
+// checkReturns returns one of the delivered mugs, then asks to return the
+// other and is turned down, and finally refunds a little more by hand
+func checkReturns(c *contract) error {
+	orderID, err := strconv.ParseUint(c.orderID, 10, 0)
+	if err != nil {
+		return err
+	}
+	request := func(quantity int) map[string]any {
+		return map[string]any{"order_id": orderID, "reason": "Chipped",
+			"items": []map[string]any{{"order_item_id": c.itemID, "quantity": quantity}}}
+	}
+	returnID := func(out data[struct {
+		ID uint `json:"ID"`
+	}]) string {
+		return strconv.FormatUint(uint64(out.Data.ID), 10)
+	}
+
+	var requested data[struct {
+		ID uint `json:"ID"`
+	}]
+	err = c.as(c.customer,
+		c.with(http.MethodPost, "/api/v1/returns", request(5), http.StatusUnprocessableEntity),
+		func() error { return c.call(http.MethodPost, "/api/v1/returns", request(1), http.StatusOK, &requested) },
+	)()
+	if err != nil {
+		return err
+	}
+	approve := "/api/v1/returns/" + returnID(requested) + "/approve"
+	err = c.calls(
+		c.with(http.MethodPost, "/api/v1/returns", request(1), http.StatusUnprocessableEntity), // Not the admin's order
+		c.as(c.customer, c.with(http.MethodPost, approve, map[string]any{}, http.StatusForbidden)),
+		c.get("/api/v1/returns", http.StatusOK),
+		c.get("/api/v1/users/"+c.customerID+"/returns", http.StatusOK),
+		c.with(http.MethodPost, approve, map[string]any{}, http.StatusOK),
+		c.with(http.MethodPost, approve, map[string]any{}, http.StatusConflict),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = c.as(c.customer, func() error {
+		return c.call(http.MethodPost, "/api/v1/returns", request(1), http.StatusOK, &requested)
+	})()
+	if err != nil {
+		return err
+	}
+	return c.calls(
+		c.with(http.MethodPost, "/api/v1/returns/"+returnID(requested)+"/reject", map[string]any{"note": "Not chipped"}, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/orders/"+c.orderID+"/payment/refund", map[string]any{"amount": 1}, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/orders/"+c.orderID+"/payment/refund", nil, http.StatusOK), // The rest
+		c.with(http.MethodPost, "/api/v1/orders/"+c.orderID+"/payment/refund", nil, http.StatusUnprocessableEntity),
+	)
+}
+
+// checkGuest shops as a visitor, with the cart token they're issued
+func checkGuest(c *contract) error {
+	token := c.token
+	c.token = ""
+	defer func() { c.token, c.cartToken = token, "" }()
+
+	if err := c.call(http.MethodGet, "/api/v1/guest/cart", nil, http.StatusOK, nil); err != nil {
+		return err
+	}
+	c.cartToken = c.header.Get("X-Cart-Token")
+	if c.cartToken == "" {
+		return fmt.Errorf("no cart token was issued")
+	}
+	mug := fmt.Sprintf("/api/v1/guest/cart/items/%d", c.mugID)
+	order := map[string]any{"email": "guest@contract.test", "shipping_details": "2 Side St", "payment_method": "fake_success"}
+	return c.calls(
+		c.with(http.MethodPost, "/api/v1/guest/cart/items", map[string]any{"product_id": c.mugID, "quantity": 1}, http.StatusOK),
+		c.with(http.MethodPut, mug, map[string]any{"quantity": 3}, http.StatusOK),
+		c.with(http.MethodDelete, mug+"?quantity=1", nil, http.StatusOK),
+		c.get("/api/v1/guest/cart", http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/guest/orders", map[string]any{"email": "not an address"}, http.StatusUnprocessableEntity),
+		c.with(http.MethodPost, "/api/v1/guest/orders", order, http.StatusOK),
+	)
+}
+
+// checkGraphQL runs a storefront query, a mutation, and operations that fail
+// to run, whose errors are in the result
+func checkGraphQL(c *contract) error {
+	type result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	run := func(query string, variables map[string]any, wantErrors bool) error {
+		var out result
+		body := map[string]any{"query": query, "variables": variables}
+		if err := c.call(http.MethodPost, "/api/v1/graphql", body, http.StatusOK, &out); err != nil {
+			return err
+		}
+		if wantErrors != (len(out.Errors) > 0) {
+			return fmt.Errorf("%q gave errors %+v", query, out.Errors)
+		}
+		return nil
+	}
+	return c.calls(
+		func() error {
+			return run(`query($user: ID!) { user(id: $user) { id orders { id items { product { name category { name } } } } }
+				categories { name products { id price } } bestSellers { name } }`, map[string]any{"user": c.customerID}, false)
+		},
+		func() error {
+			return run(`mutation($user: ID!, $product: ID!) { addToCart(userId: $user, productId: $product, quantity: 1) { total items { quantity } } }`,
+				map[string]any{"user": c.customerID, "product": c.mugID}, false)
+		},
+		func() error { return run(`query { noSuchField }`, nil, true) },
+		func() error {
+			return run(`query { users { orders { items { product { category { products { category { products { name } } } } } } } } }`, nil, true)
+		},
+		c.breaking(http.MethodPost, "/api/v1/graphql", map[string]any{"query": 1}, http.StatusUnprocessableEntity),
+	)
+}
+
+// checkWebhooks subscribes a local receiver to new products and adds one,
+// checking the delivery is given up on while the receiver fails, and arrives
+// signed once it's retried
+func checkWebhooks(c *contract) error {
+	receiver := newReceiver()
+	defer receiver.Close()
+
+	subscription := map[string]any{"url": receiver.URL, "events": []string{models.WebhookProductCreated}}
+	var added data[struct {
+		ID     uint   `json:"ID"`
+		Secret string `json:"secret"`
+	}]
+	if err := c.call(http.MethodPost, "/api/v1/webhooks", subscription, http.StatusOK, &added); err != nil {
+		return err
+	}
+	receiver.setSecret(added.Data.Secret)
+	hook := fmt.Sprintf("/api/v1/webhooks/%d", added.Data.ID)
+	subscription["description"] = "Contract receiver"
+	err := c.calls(
+		c.get("/api/v1/webhooks", http.StatusOK),
+		c.get("/api/v1/webhooks/events", http.StatusOK),
+		c.get(hook, http.StatusOK),
+		c.get("/api/v1/webhooks/999999", http.StatusNotFound),
+		c.as(c.customer, c.get("/api/v1/webhooks", http.StatusForbidden)),
+		c.as(c.customer, c.with(http.MethodPost, "/api/v1/webhooks", subscription, http.StatusForbidden)),
+		c.with(http.MethodPut, hook, subscription, http.StatusOK),
+		c.with(http.MethodPost, "/api/v1/webhooks", map[string]any{"url": "ftp://example.com", "events": []string{"no.such.event"}}, http.StatusUnprocessableEntity),
+		c.with(http.MethodPost, "/api/v1/products", []map[string]any{{"sku": "CONTRACT-HOOK", "name": "Hook", "category": "Mugs", "price": 3, "stock": 1}}, http.StatusOK),
+	)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := c.awaitDelivery(hook, models.WebhookDeliveryDead)
+	if err != nil {
+		return err
+	}
+	delivery := fmt.Sprintf("%s/deliveries/%d", hook, deliveryID)
+	receiver.accept()
+	err = c.calls(
+		c.get(delivery, http.StatusOK),
+		c.get(hook+"/deliveries/999999", http.StatusNotFound),
+		c.with(http.MethodPost, delivery+"/retry", nil, http.StatusOK),
+		c.with(http.MethodPost, delivery+"/retry", nil, http.StatusConflict),
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := c.awaitDelivery(hook, models.WebhookDeliveryDelivered); err != nil {
+		return err
+	}
+	if err := receiver.check(models.WebhookProductCreated, "CONTRACT-HOOK"); err != nil {
+		return err
+	}
+	return c.calls(
+		c.with(http.MethodDelete, hook, nil, http.StatusOK),
+		c.with(http.MethodDelete, hook, nil, http.StatusNotFound),
+	)
+}
+
+// awaitDelivery waits for the subscription's latest delivery to reach
+// status, returning its ID
+func (c *contract) awaitDelivery(hook string, status string) (uint, error) {
+	var deliveries data[[]struct {
+		ID     uint   `json:"ID"`
+		Status string `json:"status"`
+	}]
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := c.call(http.MethodGet, hook+"/deliveries", nil, http.StatusOK, &deliveries); err != nil {
+			return 0, err
+		}
+		if len(deliveries.Data) > 0 && deliveries.Data[0].Status == status {
+			return deliveries.Data[0].ID, nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("no delivery became %s: %+v", status, deliveries.Data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receiver is a partner's webhook endpoint, failing every delivery until
+// it's told to accept them
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	secret   string
+	accepts  bool
+	failures int
+	events   []webhooks.Event
+	err      error // The first signature that didn't verify
+}
+
+func newReceiver() *receiver {
+	r := &receiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.accepts {
+		r.failures++
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := webhooks.Verify(r.secret, req.Header, body, webhooks.DefaultTolerance); err != nil {
+		r.err = cmp.Or(r.err, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event webhooks.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.err = cmp.Or(r.err, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.events = append(r.events, event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) setSecret(secret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secret = secret
+}
+
+func (r *receiver) accept() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accepts = true
+}
+
+// check fails unless the receiver was retried after failing, and then got
+// one verified event of the given type, for the product with sku
+func (r *receiver) check(eventType, sku string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return fmt.Errorf("the receiver refused a delivery: %v", r.err)
+	}
+	if r.failures < 2 {
+		return fmt.Errorf("the delivery was given up on after %d attempt, without a retry", r.failures)
+	}
+	if len(r.events) != 1 || r.events[0].Type != eventType {
+		return fmt.Errorf("the receiver got %+v", r.events)
+	}
+	data, _ := r.events[0].Data.(map[string]any)
+	product, _ := data["product"].(map[string]any)
+	if product["sku"] != sku {
+		return fmt.Errorf("the event's data is %+v", r.events[0].Data)
+	}
+	return nil
+}
+
+func checkDeletes(c *contract) error {
+	user := "/api/v1/users/" + c.customerID
+	return c.calls(
+		c.with(http.MethodDelete, user, nil, http.StatusOK),
+		c.with(http.MethodDelete, user, nil, http.StatusNotFound),
+	)
+}
+
+// checkCoverage fails if an operation wasn't called, so a route can't be
+// added without the walk trying it
+func checkCoverage(c *contract) error {
+	var uncalled []string
+	for path, item := range c.doc.Paths.Map() {
+		for method, operation := range item.Operations() {
+			if !c.called[operation.OperationID] {
+				uncalled = append(uncalled, method+" "+path)
+			}
+		}
+	}
+	if len(uncalled) > 0 {
+		slices.Sort(uncalled)
+		return fmt.Errorf("operations the check doesn't call: %s", strings.Join(uncalled, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+package openapi
+
+// TemplatePath lets the contract test match gin's routes to the document's
+// paths
+var TemplatePath = templatePath
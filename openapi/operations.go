@@ -0,0 +1,436 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/catalog"
+	"github.com/Rohanrevanth/e-store-go/health"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/Rohanrevanth/e-store-go/payments"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Errors of operations that read a JSON body
+const (
+	badBody = apierror.CodeInvalidRequest
+	invalid = apierror.CodeValidationFailed
+)
+
+// operations are every route of the API besides the deprecated ones. A route
+// added to the router must be added here too, or the contract check fails.
+var operations = []operation{
+	{method: http.MethodGet, path: "/healthz", id: "healthz", tag: "Operations",
+		summary: "Report the process is up",
+		replies: []reply{{status: http.StatusOK, description: "The process is up"}}},
+	{method: http.MethodGet, path: "/readyz", id: "readyz", tag: "Operations",
+		summary:  "Report whether the server can take traffic",
+		replies:  []reply{{status: http.StatusOK, description: "Every check passed", data: health.Report{}}},
+		problems: []apierror.Code{apierror.CodeUnavailable}},
+	{method: http.MethodGet, path: "/version", id: "version", tag: "Operations",
+		summary: "Describe the running build",
+		replies: []reply{{status: http.StatusOK, description: "The build", data: health.BuildInfo{}}}},
+	{method: http.MethodGet, path: "/metrics", id: "metrics", tag: "Operations",
+		summary: "Prometheus metrics, behind a bearer token if metrics.token is set",
+		replies: []reply{
+			{status: http.StatusOK, description: "Metrics in the Prometheus text format", mediaTypes: []string{"text/plain"}},
+			{status: http.StatusUnauthorized, description: "The metrics token is missing or wrong", mediaTypes: []string{"text/plain"}},
+		}},
+	{method: http.MethodGet, path: "/errors", id: "listErrors", tag: "Operations",
+		summary: "List the error codes problems are sent with",
+		replies: []reply{{status: http.StatusOK, description: "Every error code", data: []apierror.Entry{}}}},
+	{method: http.MethodGet, path: "/errors/:code", id: "getError", tag: "Operations",
+		summary:  "Describe an error code; problem types link here",
+		replies:  []reply{{status: http.StatusOK, description: "The error code", data: apierror.Entry{}}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodGet, path: "/openapi.json", id: "openAPI", tag: "Operations",
+		summary: "This document",
+		replies: []reply{{status: http.StatusOK, description: "The OpenAPI document", raw: map[string]any{}}}},
+
+	{method: http.MethodPost, path: "/api/v1/auth/register", id: "register", tag: "Auth",
+		summary:  "Register users; ones that can't be registered, such as existing emails, are skipped",
+		body:     []models.User{},
+		replies:  []reply{{status: http.StatusOK, description: "The users registered", data: []models.User{}}},
+		problems: []apierror.Code{badBody, invalid}},
+	{method: http.MethodPost, path: "/api/v1/auth/login", id: "login", tag: "Auth",
+		summary:  "Log in for a JWT, merging the visitor's guest cart into the user's",
+		body:     credentials{},
+		replies:  []reply{{status: http.StatusOK, description: "The token and user", raw: session{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeInvalidCredentials}},
+
+	{method: http.MethodGet, path: "/api/v1/users", id: "listUsers", tag: "Users", access: bearer,
+		summary: "List users",
+		replies: []reply{{status: http.StatusOK, description: "Every user", data: []models.User{}}}},
+	{method: http.MethodGet, path: "/api/v1/users/:id", id: "getUser", tag: "Users", access: bearer,
+		summary:  "Get a user",
+		replies:  []reply{{status: http.StatusOK, description: "The user", data: models.User{}}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/users/:id", id: "deleteUser", tag: "Users", access: admin,
+		summary:  "Delete a user",
+		replies:  []reply{{status: http.StatusOK, description: "The user was deleted"}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodPut, path: "/api/v1/users/:id/address", id: "saveAddress", tag: "Users", access: bearer,
+		summary:  "Replace a user's saved addresses",
+		body:     models.AddressStringObj{},
+		replies:  []reply{{status: http.StatusOK, description: "The updated user", data: models.User{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound}},
+
+	{method: http.MethodGet, path: "/api/v1/categories", id: "listCategories", tag: "Catalog", access: bearer,
+		summary: "List categories",
+		replies: []reply{{status: http.StatusOK, description: "Every category", data: []models.Category{}}}},
+	{method: http.MethodPost, path: "/api/v1/categories", id: "addCategories", tag: "Catalog", access: bearer,
+		summary:  "Add categories",
+		body:     []models.Category{},
+		replies:  []reply{{status: http.StatusOK, description: "The categories were added"}},
+		problems: []apierror.Code{badBody, invalid}},
+	{method: http.MethodGet, path: "/api/v1/products", id: "listProducts", tag: "Catalog", access: bearer,
+		summary: "List products, or those in a category",
+		params:  []*openapi3.Parameter{query("category", openapi3.NewStringSchema(), "Only list products in this category")},
+		replies: []reply{{status: http.StatusOK, description: "The products", data: []models.Product{}}}},
+	{method: http.MethodPost, path: "/api/v1/products", id: "addProducts", tag: "Catalog", access: bearer,
+		summary:  "Add products; ones that can't be added are reported and skipped",
+		body:     []models.Product{},
+		replies:  []reply{{status: http.StatusOK, description: "How many were added, and why the rest weren't", data: addedProducts{}}},
+		problems: []apierror.Code{badBody, invalid}},
+	{method: http.MethodGet, path: "/api/v1/products/best-sellers", id: "listBestSellers", tag: "Catalog", access: bearer,
+		summary: "List the best sellers",
+		replies: []reply{{status: http.StatusOK, description: "The best sellers", data: []models.Product{}}}},
+
+	{method: http.MethodPost, path: "/api/v1/products/import", id: "importProducts", tag: "Imports", access: admin,
+		summary: "Upsert products by SKU from a CSV or JSON Lines file",
+		params: []*openapi3.Parameter{
+			query("format", formatSchema(), "The file's format, by default from its content type or name"),
+			query("dry_run", openapi3.NewBoolSchema(), "Only report what would change"),
+			query("async", openapi3.NewBoolSchema(), "Import in the background, as files over 8 MB always are"),
+		},
+		request: importBody(),
+		replies: []reply{
+			{status: http.StatusOK, description: "What was imported", data: catalog.ImportReport{}},
+			{status: http.StatusAccepted, description: "The import job started, to poll", data: catalog.Job{}},
+		},
+		problems: []apierror.Code{badBody, apierror.CodePayloadTooLarge}},
+	{method: http.MethodGet, path: "/api/v1/import-jobs", id: "listImportJobs", tag: "Imports", access: admin,
+		summary: "List background imports since the server started",
+		replies: []reply{{status: http.StatusOK, description: "Every import job", data: []catalog.Job{}}}},
+	{method: http.MethodGet, path: "/api/v1/import-jobs/:id", id: "getImportJob", tag: "Imports", access: admin,
+		summary:  "Get a background import",
+		params:   []*openapi3.Parameter{openapi3.NewPathParameter("id").WithSchema(openapi3.NewStringSchema())},
+		replies:  []reply{{status: http.StatusOK, description: "The import job", data: catalog.Job{}}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodGet, path: "/api/v1/exports/:kind", id: "export", tag: "Imports", access: admin,
+		summary: "Download every record of a kind; product exports can be imported again",
+		params: []*openapi3.Parameter{
+			openapi3.NewPathParameter("kind").WithSchema(enum(catalog.ExportKinds...)),
+			query("format", formatSchema(), "csv by default"),
+		},
+		replies: []reply{{status: http.StatusOK, description: "The records, as a file download",
+			mediaTypes: []string{"text/csv", "application/x-ndjson"}}},
+		problems: []apierror.Code{badBody, apierror.CodeNotFound}},
+
+	{method: http.MethodGet, path: "/api/v1/coupons", id: "listCoupons", tag: "Coupons", access: bearer,
+		summary: "List coupons",
+		replies: []reply{{status: http.StatusOK, description: "Every coupon", data: []models.CouponObject{}}}},
+	{method: http.MethodPost, path: "/api/v1/coupons", id: "addCoupon", tag: "Coupons", access: bearer,
+		summary:  "Add a coupon",
+		body:     models.CouponObject{},
+		replies:  []reply{{status: http.StatusOK, description: "The coupon was added"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeConflict}},
+	{method: http.MethodPut, path: "/api/v1/coupons/:code", id: "updateCoupon", tag: "Coupons", access: bearer,
+		summary:  "Replace a coupon, keeping whether it was redeemed",
+		body:     models.CouponObject{},
+		replies:  []reply{{status: http.StatusOK, description: "The saved coupon", data: models.CouponObject{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/coupons/:code", id: "deleteCoupon", tag: "Coupons", access: bearer,
+		summary:  "Delete a coupon",
+		replies:  []reply{{status: http.StatusOK, description: "The coupon was deleted"}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodGet, path: "/api/v1/users/:id/coupons/:code", id: "checkCoupon", tag: "Coupons", access: bearer,
+		summary: "Check whether a user can use a coupon on their next order",
+		replies: []reply{{status: http.StatusOK, description: "The coupon if it applies, otherwise null",
+			data: (*models.CouponObject)(nil)}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+
+	{method: http.MethodGet, path: "/api/v1/webhooks", id: "listWebhooks", tag: "Webhooks", access: admin,
+		summary: "List webhook subscriptions, without their secrets",
+		replies: []reply{{status: http.StatusOK, description: "Every subscription", data: []models.WebhookSubscription{}}}},
+	{method: http.MethodPost, path: "/api/v1/webhooks", id: "addWebhook", tag: "Webhooks", access: admin,
+		summary:  "Subscribe a URL to events; the response is the only time the secret is shown",
+		body:     newWebhook{},
+		replies:  []reply{{status: http.StatusOK, description: "The subscription with its secret", data: models.WebhookSubscription{}}},
+		problems: []apierror.Code{badBody, invalid}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/events", id: "listWebhookEvents", tag: "Webhooks", access: admin,
+		summary: "List the events a subscription can receive",
+		replies: []reply{{status: http.StatusOK, description: "Every event", data: []string{}}}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/:id", id: "getWebhook", tag: "Webhooks", access: admin,
+		summary:  "Get a webhook subscription, without its secret",
+		replies:  []reply{{status: http.StatusOK, description: "The subscription", data: models.WebhookSubscription{}}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodPut, path: "/api/v1/webhooks/:id", id: "updateWebhook", tag: "Webhooks", access: admin,
+		summary:  "Replace a webhook subscription, keeping its secret unless a new one is given",
+		body:     newWebhook{},
+		replies:  []reply{{status: http.StatusOK, description: "The saved subscription", data: models.WebhookSubscription{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/webhooks/:id", id: "deleteWebhook", tag: "Webhooks", access: admin,
+		summary:  "Delete a webhook subscription, keeping its delivery log",
+		replies:  []reply{{status: http.StatusOK, description: "The subscription was deleted"}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/:id/deliveries", id: "listWebhookDeliveries", tag: "Webhooks", access: admin,
+		summary: "List a subscription's deliveries, newest first",
+		replies: []reply{{status: http.StatusOK, description: "The deliveries", data: []models.WebhookDelivery{}}}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/:id/deliveries/:delivery_id", id: "getWebhookDelivery", tag: "Webhooks", access: admin,
+		summary:  "Get a delivery with the log of its attempts",
+		replies:  []reply{{status: http.StatusOK, description: "The delivery", data: models.WebhookDelivery{}}},
+		problems: []apierror.Code{apierror.CodeNotFound}},
+	{method: http.MethodPost, path: "/api/v1/webhooks/:id/deliveries/:delivery_id/retry", id: "retryWebhookDelivery", tag: "Webhooks", access: admin,
+		summary:  "Queue a dead delivery again, with a fresh set of attempts",
+		replies:  []reply{{status: http.StatusOK, description: "The queued delivery", data: models.WebhookDelivery{}}},
+		problems: []apierror.Code{apierror.CodeNotFound, apierror.CodeConflict}},
+
+	{method: http.MethodGet, path: "/api/v1/users/:id/cart", id: "getCart", tag: "Cart", access: bearer,
+		summary: "Get a user's cart with its totals",
+		params:  []*openapi3.Parameter{query("coupon", openapi3.NewStringSchema(), "Coupon to work the discount out with")},
+		replies: []reply{{status: http.StatusOK, description: "The cart", data: models.CartSummary{}}}},
+	{method: http.MethodPost, path: "/api/v1/users/:id/cart/items", id: "addCartItem", tag: "Cart", access: bearer,
+		summary:  "Add a product to a user's cart",
+		body:     newCartItem{},
+		replies:  []reply{{status: http.StatusOK, description: "The product was added"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeInvalidCartItem}},
+	{method: http.MethodPut, path: "/api/v1/users/:id/cart/items/:product_id", id: "setCartItem", tag: "Cart", access: bearer,
+		summary:  "Set the quantity of a product in a user's cart; zero removes it",
+		body:     quantity{},
+		replies:  []reply{{status: http.StatusOK, description: "The cart was updated"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeInvalidCartItem, apierror.CodeNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/users/:id/cart/items/:product_id", id: "removeCartItem", tag: "Cart", access: bearer,
+		summary:  "Remove a product from a user's cart, or some of it",
+		params:   []*openapi3.Parameter{query("quantity", openapi3.NewIntegerSchema(), "How many to remove, by default all")},
+		replies:  []reply{{status: http.StatusOK, description: "The product was removed"}},
+		problems: []apierror.Code{invalid, apierror.CodeInvalidCartItem, apierror.CodeNotFound}},
+	{method: http.MethodGet, path: "/api/v1/carts/abandoned", id: "listAbandonedCarts", tag: "Cart", access: bearer,
+		summary: "List carts found abandoned",
+		replies: []reply{{status: http.StatusOK, description: "Every abandoned cart", data: []models.CartAbandonment{}}}},
+
+	{method: http.MethodGet, path: "/api/v1/guest/cart", id: "getGuestCart", tag: "Guest", access: guest,
+		summary: "Get the visitor's cart with its totals",
+		params:  []*openapi3.Parameter{query("coupon", openapi3.NewStringSchema(), "Coupon to work the discount out with")},
+		replies: []reply{{status: http.StatusOK, description: "The cart", data: models.CartSummary{}}}},
+	{method: http.MethodPost, path: "/api/v1/guest/cart/items", id: "addGuestCartItem", tag: "Guest", access: guest,
+		summary:  "Add a product to the visitor's cart",
+		body:     newCartItem{},
+		replies:  []reply{{status: http.StatusOK, description: "The product was added"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeInvalidCartItem}},
+	{method: http.MethodPut, path: "/api/v1/guest/cart/items/:product_id", id: "setGuestCartItem", tag: "Guest", access: guest,
+		summary:  "Set the quantity of a product in the visitor's cart; zero removes it",
+		body:     quantity{},
+		replies:  []reply{{status: http.StatusOK, description: "The cart was updated"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeInvalidCartItem, apierror.CodeNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/guest/cart/items/:product_id", id: "removeGuestCartItem", tag: "Guest", access: guest,
+		summary:  "Remove a product from the visitor's cart, or some of it",
+		params:   []*openapi3.Parameter{query("quantity", openapi3.NewIntegerSchema(), "How many to remove, by default all")},
+		replies:  []reply{{status: http.StatusOK, description: "The product was removed"}},
+		problems: []apierror.Code{invalid, apierror.CodeInvalidCartItem, apierror.CodeNotFound}},
+	{method: http.MethodPost, path: "/api/v1/guest/orders", id: "guestCheckout", tag: "Guest", access: guest,
+		summary:  "Order the visitor's cart",
+		body:     guestOrder{},
+		replies:  orderReplies,
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeEmptyCart, apierror.CodeInvalidCartItem, apierror.CodeInsufficientStock, apierror.CodePaymentDeclined}},
+
+	{method: http.MethodGet, path: "/api/v1/orders", id: "listOrders", tag: "Orders", access: bearer,
+		summary: "List orders",
+		replies: []reply{{status: http.StatusOK, description: "Every order", data: []models.Order{}}}},
+	{method: http.MethodPost, path: "/api/v1/orders", id: "placeOrder", tag: "Orders", access: bearer,
+		summary:  "Order a user's cart",
+		body:     newOrder{},
+		replies:  orderReplies,
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeEmptyCart, apierror.CodeInvalidCartItem, apierror.CodeInsufficientStock, apierror.CodePaymentDeclined}},
+	{method: http.MethodGet, path: "/api/v1/users/:id/orders", id: "listUserOrders", tag: "Orders", access: bearer,
+		summary: "List a user's orders",
+		replies: []reply{{status: http.StatusOK, description: "The user's orders", data: []models.Order{}}}},
+	{method: http.MethodPut, path: "/api/v1/orders/:id/status", id: "setOrderStatus", tag: "Orders", access: admin,
+		summary:  "Mark an order shipped or delivered",
+		body:     statusChange{},
+		replies:  []reply{{status: http.StatusOK, description: "The order was updated"}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeInvalidTransition}},
+
+	{method: http.MethodGet, path: "/api/v1/orders/:id/payment", id: "getPayment", tag: "Payments", access: bearer,
+		summary:  "Get the payment of one of the user's orders, or any order's for an admin, with its transactions",
+		replies:  []reply{{status: http.StatusOK, description: "The payment", data: models.Payment{}}},
+		problems: []apierror.Code{apierror.CodeNotFound, apierror.CodeForbidden}},
+	{method: http.MethodPost, path: "/api/v1/orders/:id/payment/capture", id: "capturePayment", tag: "Payments", access: admin,
+		summary:  "Capture an authorized payment",
+		replies:  []reply{{status: http.StatusOK, description: "The payment", data: models.Payment{}}},
+		problems: []apierror.Code{apierror.CodeNotFound, apierror.CodeConflict, apierror.CodeUpstreamFailed}},
+	{method: http.MethodPost, path: "/api/v1/orders/:id/payment/void", id: "voidPayment", tag: "Payments", access: admin,
+		summary:  "Void a payment that hasn't been captured",
+		replies:  []reply{{status: http.StatusOK, description: "The payment", data: models.Payment{}}},
+		problems: []apierror.Code{apierror.CodeNotFound, apierror.CodeConflict, apierror.CodeUpstreamFailed}},
+	{method: http.MethodPost, path: "/api/v1/orders/:id/payment/refund", id: "refundPayment", tag: "Payments", access: admin,
+		summary:  "Refund a captured payment, in full without an amount",
+		body:     refund{},
+		optional: true,
+		replies:  []reply{{status: http.StatusOK, description: "The payment", data: models.Payment{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeConflict, apierror.CodeUpstreamFailed}},
+	{method: http.MethodPost, path: "/api/v1/payments/webhook", id: "paymentWebhook", tag: "Payments",
+		summary: "Receive a payment update from the provider",
+		params: []*openapi3.Parameter{openapi3.NewHeaderParameter("X-Payment-Signature").WithRequired(true).
+			WithSchema(openapi3.NewStringSchema()).WithDescription("Hex HMAC-SHA256 of the body")},
+		body:     payments.WebhookEvent{},
+		replies:  []reply{{status: http.StatusOK, description: "The event was applied, or had been already"}},
+		problems: []apierror.Code{apierror.CodeInvalidSignature, apierror.CodeNotFound}},
+
+	{method: http.MethodGet, path: "/api/v1/returns", id: "listReturns", tag: "Returns", access: bearer,
+		summary: "List returns",
+		replies: []reply{{status: http.StatusOK, description: "Every return", data: []models.ReturnRequest{}}}},
+	{method: http.MethodPost, path: "/api/v1/returns", id: "requestReturn", tag: "Returns", access: bearer,
+		summary:  "Ask to return items of one of the user's delivered orders",
+		body:     newReturn{},
+		replies:  []reply{{status: http.StatusOK, description: "The return requested", data: models.ReturnRequest{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeInvalidReturn}},
+	{method: http.MethodGet, path: "/api/v1/users/:id/returns", id: "listUserReturns", tag: "Returns", access: bearer,
+		summary:  "List a user's returns",
+		replies:  []reply{{status: http.StatusOK, description: "The user's returns", data: []models.ReturnRequest{}}},
+		problems: []apierror.Code{apierror.CodeForbidden}},
+	{method: http.MethodPost, path: "/api/v1/returns/:id/approve", id: "approveReturn", tag: "Returns", access: admin,
+		summary:  "Approve a return, refunding it and by default restocking its items",
+		body:     models.ReturnDecision{},
+		replies:  []reply{{status: http.StatusOK, description: "The refunded return", data: models.ReturnRequest{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeConflict, apierror.CodeUpstreamFailed}},
+	{method: http.MethodPost, path: "/api/v1/returns/:id/reject", id: "rejectReturn", tag: "Returns", access: admin,
+		summary:  "Reject a return",
+		body:     models.ReturnDecision{},
+		replies:  []reply{{status: http.StatusOK, description: "The rejected return", data: models.ReturnRequest{}}},
+		problems: []apierror.Code{badBody, invalid, apierror.CodeNotFound, apierror.CodeConflict}},
+
+	{method: http.MethodPost, path: "/api/v1/graphql", id: "graphql", tag: "GraphQL", access: bearer,
+		summary:  "Run a GraphQL query or mutation; errors running it are in the result, whose status is still 200",
+		body:     graphqlRequest{},
+		replies:  []reply{{status: http.StatusOK, description: "The result", raw: graphqlResult{}}},
+		problems: []apierror.Code{badBody, invalid}},
+}
+
+// orderReplies are the responses of an order whose payment didn't fail
+var orderReplies = []reply{
+	{status: http.StatusOK, description: "The order was placed and its payment authorized", data: placedOrder{}},
+	{status: http.StatusAccepted, description: "The order was placed and its payment awaits the customer, at payment.next_action_url",
+		data: placedOrder{}},
+}
+
+// The bodies handlers build with gin.H or read into a bigger model, as the
+// client sends and sees them
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type session struct {
+	Token string      `json:"token"`
+	User  models.User `json:"user"`
+}
+
+type addedProducts struct {
+	Added  int                `json:"added"`
+	Errors []catalog.RowError `json:"errors"`
+}
+
+type newCartItem struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+type quantity struct {
+	Quantity int `json:"quantity"`
+}
+
+type newOrder struct {
+	UserID          string `json:"user_id"`
+	PaymentMethod   string `json:"payment_method"`
+	ShippingDetails string `json:"shipping_details"`
+	CouponCode      string `json:"coupon_code"`
+}
+
+type guestOrder struct {
+	Email           string `json:"email"`
+	PaymentMethod   string `json:"payment_method"`
+	ShippingDetails string `json:"shipping_details"`
+	CouponCode      string `json:"coupon_code"`
+}
+
+type placedOrder struct {
+	OrderID uint           `json:"order_id"`
+	Payment models.Payment `json:"payment"`
+}
+
+type statusChange struct {
+	Status string `json:"status"`
+}
+
+type refund struct {
+	Amount float64 `json:"amount"` // Left out for the whole balance
+}
+
+type newReturn struct {
+	OrderID uint           `json:"order_id"`
+	Reason  string         `json:"reason"`
+	Items   []returnedItem `json:"items"`
+}
+
+type returnedItem struct {
+	OrderItemID uint   `json:"order_item_id"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+type newWebhook struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Disabled    bool     `json:"disabled"`
+	Secret      string   `json:"secret"` // At least 16 characters; made up when a new subscription leaves it out
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphqlResult struct {
+	Data   any            `json:"data"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+type graphqlError struct {
+	Message   string `json:"message"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"` // code is one of the catalogue's
+}
+
+func query(name string, schema *openapi3.Schema, description string) *openapi3.Parameter {
+	return openapi3.NewQueryParameter(name).WithSchema(schema).WithDescription(description)
+}
+
+func enum(values ...string) *openapi3.Schema {
+	var anys []any
+	for _, value := range values {
+		anys = append(anys, value)
+	}
+	return openapi3.NewStringSchema().WithEnum(anys...)
+}
+
+func formatSchema() *openapi3.Schema {
+	return enum(string(catalog.FormatCSV), string(catalog.FormatJSONL))
+}
+
+// importBody describes an import file, sent as the body or as the file field
+// of a form
+func importBody() *openapi3.RequestBody {
+	content := openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/csv", "application/x-ndjson"})
+	form := openapi3.NewObjectSchema().WithProperty("file", openapi3.NewStringSchema().WithFormat("binary"))
+	form.Required = []string{"file"}
+	content["multipart/form-data"] = openapi3.NewMediaType().WithSchema(form)
+	return openapi3.NewRequestBody().WithRequired(true).WithContent(content)
+}
@@ -0,0 +1,157 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gorm.io/gorm"
+)
+
+var (
+	timeType      = reflect.TypeFor[time.Time]()
+	deletedAtType = reflect.TypeFor[gorm.DeletedAt]()
+	rawType       = reflect.TypeFor[json.RawMessage]()
+	packagePath   = reflect.TypeFor[schemas]().PkgPath()
+)
+
+// schemas generates the schemas of Go types as encoding/json marshals them.
+// Named structs become components, which operations refer to.
+type schemas struct {
+	components openapi3.Schemas
+	// input generates schemas for request bodies, which may leave fields out
+	// and whose unknown fields are ignored. The components of models are
+	// named with an Input suffix.
+	input bool
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: openapi3.Schemas{}}
+}
+
+// inputs returns a generator for request bodies sharing s's components
+func (s *schemas) inputs() *schemas {
+	return &schemas{components: s.components, input: true}
+}
+
+// of returns the schema of v's type
+func (s *schemas) of(v any) *openapi3.SchemaRef {
+	return s.schemaOf(reflect.TypeOf(v))
+}
+
+func (s *schemas) schemaOf(t reflect.Type) *openapi3.SchemaRef {
+	switch t {
+	case timeType:
+		return openapi3.NewDateTimeSchema().NewRef()
+	case deletedAtType: // Marshals as null until the record is soft deleted
+		return openapi3.NewDateTimeSchema().WithNullable().NewRef()
+	case rawType:
+		return openapi3.NewSchema().NewRef()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(s.schemaOf(t.Elem()))
+	case reflect.Bool:
+		return openapi3.NewBoolSchema().NewRef()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openapi3.NewIntegerSchema().NewRef()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi3.NewIntegerSchema().WithMin(0).NewRef()
+	case reflect.Float32, reflect.Float64:
+		return openapi3.NewFloat64Schema().NewRef()
+	case reflect.String:
+		return openapi3.NewStringSchema().NewRef()
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openapi3.NewBytesSchema().NewRef()
+		}
+		// A nil slice marshals as null
+		array := openapi3.NewArraySchema().WithNullable()
+		array.Items = s.schemaOf(t.Elem())
+		return array.NewRef()
+	case reflect.Array:
+		array := openapi3.NewArraySchema().WithMinItems(int64(t.Len())).WithMaxItems(int64(t.Len()))
+		array.Items = s.schemaOf(t.Elem())
+		return array.NewRef()
+	case reflect.Map:
+		values := s.schemaOf(t.Elem())
+		object := openapi3.NewObjectSchema().WithNullable()
+		object.AdditionalProperties = openapi3.AdditionalProperties{Schema: values}
+		return object.NewRef()
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t).NewRef()
+		}
+		return s.component(t)
+	}
+	return openapi3.NewSchema().WithNullable().NewRef() // Interfaces can hold anything, or be nil
+}
+
+// component returns a reference to the named struct t, adding its schema to
+// the components the first time
+func (s *schemas) component(t reflect.Type) *openapi3.SchemaRef {
+	name := componentName(t.Name())
+	if s.input && t.PkgPath() != packagePath {
+		name += "Input" // Models are read from requests more loosely than they're written
+	}
+	if _, ok := s.components[name]; !ok {
+		s.components[name] = nil // Lets a type refer to itself
+		s.components[name] = s.object(t).NewRef()
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+}
+
+// object returns the schema of the struct t. A response has every field not
+// marked omitempty and nothing else; a request may have any of them.
+func (s *schemas) object(t reflect.Type) *openapi3.Schema {
+	object := openapi3.NewObjectSchema()
+	if !s.input {
+		object = object.WithoutAdditionalProperties()
+	}
+	s.addFields(object, t)
+	return object
+}
+
+func (s *schemas) addFields(object *openapi3.Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(object, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		object.WithPropertyRef(name, s.schemaOf(field.Type))
+		if !s.input && !strings.Contains(options, "omitempty") {
+			object.Required = append(object.Required, name)
+		}
+	}
+}
+
+// nullable allows null besides what ref allows
+func nullable(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref.Ref != "" {
+		schema := openapi3.NewSchema().WithNullable()
+		schema.AllOf = openapi3.SchemaRefs{ref}
+		return schema.NewRef()
+	}
+	ref.Value.Nullable = true
+	return ref
+}
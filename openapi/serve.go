@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// SpecPath is where the document is served
+const SpecPath = "/openapi.json"
+
+// specJSON is the document as served, built on first use
+var specJSON = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(Spec())
+})
+
+// ServeSpec serves the document as JSON
+func ServeSpec(c *gin.Context) {
+	spec, err := specJSON()
+	if err != nil {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInternal, err, "Failed to build the OpenAPI document"))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// uiInitializer replaces the one Swagger UI ships with, which loads the
+// petstore example, to load the document instead. It's found relative to the
+// UI, which is served at /docs/.
+var uiInitializer = []byte(`window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "..` + SpecPath + `",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    persistAuthorization: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`)
+
+// ServeUI serves Swagger UI for the document from the files built in, for a
+// route ending in the *filepath parameter
+func ServeUI(c *gin.Context) {
+	path := c.Param("filepath")
+	if path == "/swagger-initializer.js" {
+		c.Data(http.StatusOK, "text/javascript; charset=utf-8", uiInitializer)
+		return
+	}
+	c.FileFromFS(path, http.FS(swaggerFiles.FS))
+}
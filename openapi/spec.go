@@ -0,0 +1,266 @@
+// Package openapi describes the API as an OpenAPI 3 document, built from the
+// operations table and the Go types handlers read and write, and checks the
+// handlers keep to it.
+package openapi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/Rohanrevanth/e-store-go/apierror"
+	"github.com/Rohanrevanth/e-store-go/health"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Version is the OpenAPI version of the document
+const Version = "3.0.3"
+
+// Security schemes operations may need
+const (
+	bearerAuth = "bearerAuth" // JWT from the login route
+	cartToken  = "cartToken"  // Guest cart token, issued on first use
+)
+
+// access says what an operation needs to be called
+type access int
+
+const (
+	public access = iota
+	bearer
+	admin // A JWT of an admin
+	guest // A cart token if the visitor has one; without one, one is issued
+)
+
+// operation describes a route and what it takes and answers
+type operation struct {
+	method, path string // As routed, such as /api/v1/users/:id
+	id           string
+	tag          string
+	summary      string
+	access       access
+
+	params []*openapi3.Parameter // Query, header and retyped path parameters
+	body   any                   // A value of the JSON body's type
+	// optional says body may be left out, for one whose fields all are
+	optional bool
+	request  *openapi3.RequestBody // A body that isn't JSON
+
+	replies  []reply
+	problems []apierror.Code // Besides internal, unauthorized with bearer, and forbidden with admin
+}
+
+// reply is a response an operation succeeds with
+type reply struct {
+	status      int
+	description string
+	// data is a value of the type of the envelope's data member, nil for an
+	// envelope with a message only
+	data any
+	// raw is a value of the type of a JSON body that isn't an envelope
+	raw any
+	// mediaTypes are the types of a body that isn't JSON, which is described
+	// as a string
+	mediaTypes []string
+}
+
+// Spec returns the document describing the API
+func Spec() *openapi3.T {
+	s := newSchemas()
+	doc := &openapi3.T{
+		OpenAPI: Version,
+		Info: &openapi3.Info{
+			Title:   "E-Store API",
+			Version: health.Build().Version,
+			Description: "Successful responses are a `{status, data, message}` envelope. " +
+				"Errors are RFC 7807 problems; each `code` is described at `/errors/{code}`.",
+		},
+		Servers: openapi3.Servers{{URL: "/"}},
+		Paths:   openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: s.components,
+			SecuritySchemes: openapi3.SecuritySchemes{
+				bearerAuth: &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+				cartToken: &openapi3.SecuritySchemeRef{Value: openapi3.NewSecurityScheme().
+					WithType("apiKey").WithIn("header").WithName("X-Cart-Token").
+					WithDescription("Guest cart token, also accepted as the cart_token cookie")},
+			},
+		},
+	}
+	s.components["Problem"] = problemSchema(s).NewRef()
+
+	for _, op := range operations {
+		path, pathParams := templatePath(op.path)
+		doc.AddOperation(path, op.method, op.build(s, pathParams))
+	}
+	for _, tag := range tags {
+		doc.Tags = append(doc.Tags, &openapi3.Tag{Name: tag})
+	}
+	return doc
+}
+
+// tags are the groups operations are listed in, in order
+var tags = []string{"Auth", "Users", "Catalog", "Imports", "Coupons", "Webhooks", "Cart", "Guest", "Orders", "Payments", "Returns", "GraphQL", "Operations"}
+
+// pathParams are the types of the path parameters, unless an operation says
+// otherwise
+var pathParams = map[string]*openapi3.Schema{
+	"id":          openapi3.NewIntegerSchema().WithMin(1),
+	"product_id":  openapi3.NewIntegerSchema().WithMin(1),
+	"delivery_id": openapi3.NewIntegerSchema().WithMin(1),
+	"code":        openapi3.NewStringSchema(),
+	"kind":        openapi3.NewStringSchema(),
+}
+
+// templatePath turns a gin path into an OpenAPI one, returning the names of
+// its parameters
+func templatePath(path string) (string, []string) {
+	var names []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			names = append(names, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
+
+func (op operation) build(s *schemas, pathNames []string) *openapi3.Operation {
+	operation := openapi3.NewOperation()
+	operation.OperationID = op.id
+	operation.Summary = op.summary
+	operation.Tags = []string{op.tag}
+
+	for _, name := range pathNames {
+		if slices.ContainsFunc(op.params, func(p *openapi3.Parameter) bool { return p.In == "path" && p.Name == name }) {
+			continue
+		}
+		operation.AddParameter(openapi3.NewPathParameter(name).WithSchema(pathParams[name]))
+	}
+	for _, param := range op.params {
+		operation.AddParameter(param)
+	}
+
+	switch {
+	case op.body != nil:
+		operation.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+			WithRequired(!op.optional).WithJSONSchemaRef(s.inputs().of(op.body))}
+	case op.request != nil:
+		operation.RequestBody = &openapi3.RequestBodyRef{Value: op.request}
+	}
+
+	switch op.access {
+	case bearer, admin:
+		operation.Security = openapi3.NewSecurityRequirements().
+			With(openapi3.NewSecurityRequirement().Authenticate(bearerAuth))
+	case guest:
+		operation.Security = openapi3.NewSecurityRequirements().
+			With(openapi3.NewSecurityRequirement().Authenticate(cartToken)).
+			With(openapi3.NewSecurityRequirement())
+	}
+
+	operation.Responses = openapi3.NewResponses()
+	for _, reply := range op.replies {
+		operation.AddResponse(reply.status, reply.build(s, op.access))
+	}
+	problems := slices.Clone(op.problems)
+	switch op.access {
+	case bearer:
+		problems = append(problems, apierror.CodeUnauthorized)
+	case admin:
+		problems = append(problems, apierror.CodeUnauthorized, apierror.CodeForbidden)
+		operation.Description = "Admins only."
+	}
+	problems = append(problems, apierror.CodeInternal)
+	for status, codes := range problemsByStatus(problems) {
+		operation.AddResponse(status, problemResponse(codes))
+	}
+	return operation
+}
+
+func (r reply) build(s *schemas, access access) *openapi3.Response {
+	response := openapi3.NewResponse().WithDescription(r.description)
+	switch {
+	case len(r.mediaTypes) > 0:
+		response.Content = openapi3.NewContentWithSchema(openapi3.NewStringSchema(), r.mediaTypes)
+	case r.raw != nil:
+		response.Content = openapi3.NewContentWithJSONSchemaRef(s.of(r.raw))
+	default:
+		response.Content = openapi3.NewContentWithJSONSchema(envelope(s, r.data))
+	}
+	if access == guest {
+		response.Headers = openapi3.Headers{"X-Cart-Token": &openapi3.HeaderRef{Value: &openapi3.Header{Parameter: openapi3.Parameter{
+			Description: "The cart token issued to a visitor who didn't send a valid one, or renewing one past half its lifetime",
+			Schema:      openapi3.NewStringSchema().NewRef(),
+		}}}}
+	}
+	return response
+}
+
+// envelope returns the schema of a successful response whose data member is
+// a value like data, or which has no data if it's nil
+func envelope(s *schemas, data any) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema().WithoutAdditionalProperties().
+		WithProperty("status", openapi3.NewStringSchema().WithEnum("success")).
+		WithProperty("message", openapi3.NewStringSchema())
+	schema.Required = []string{"status"}
+	if data != nil {
+		schema.WithPropertyRef("data", s.of(data))
+		schema.Required = append(schema.Required, "data")
+	}
+	return schema
+}
+
+// problemsByStatus groups codes by the status they're sent with
+func problemsByStatus(codes []apierror.Code) map[int][]apierror.Code {
+	byStatus := map[int][]apierror.Code{}
+	for _, code := range codes {
+		entry, ok := apierror.Lookup(code)
+		if !ok {
+			panic(fmt.Sprintf("openapi: unknown error code %s", code))
+		}
+		if !slices.Contains(byStatus[entry.Status], code) {
+			byStatus[entry.Status] = append(byStatus[entry.Status], code)
+		}
+	}
+	return byStatus
+}
+
+// problemResponse describes a problem with one of codes
+func problemResponse(codes []apierror.Code) *openapi3.Response {
+	var lines []string
+	for _, code := range codes {
+		entry, _ := apierror.Lookup(code)
+		lines = append(lines, fmt.Sprintf("`%s`: %s", code, entry.Description))
+	}
+	content := openapi3.NewContentWithSchemaRef(openapi3.NewSchemaRef("#/components/schemas/Problem", nil), []string{apierror.ContentType})
+	return openapi3.NewResponse().WithDescription(strings.Join(lines, "\n\n")).WithContent(content)
+}
+
+// problemSchema describes an RFC 7807 problem. Codes may add members of
+// their own, such as the order_id of a declined payment.
+func problemSchema(s *schemas) *openapi3.Schema {
+	var codes []any
+	for _, entry := range apierror.Catalogue() {
+		codes = append(codes, string(entry.Code))
+	}
+	schema := openapi3.NewObjectSchema().
+		WithProperty("type", openapi3.NewStringSchema()).
+		WithProperty("title", openapi3.NewStringSchema()).
+		WithProperty("status", openapi3.NewIntegerSchema()).
+		WithProperty("code", openapi3.NewStringSchema().WithEnum(codes...)).
+		WithProperty("detail", openapi3.NewStringSchema()).
+		WithProperty("instance", openapi3.NewStringSchema()).
+		WithPropertyRef("errors", s.of([]apierror.FieldError{}))
+	schema.Required = []string{"type", "title", "status", "code"}
+	return schema
+}
+
+// componentName is the name of the component for a type called name
+func componentName(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,248 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Outcome decides how the fake gateway answers an authorization
+type Outcome string
+
+const (
+	OutcomeSuccess    Outcome = "success"
+	OutcomeDecline    Outcome = "decline"
+	Outcome3DSPending Outcome = "3ds"
+)
+
+// FakeConfig configures the behaviour of FakeProvider
+type FakeConfig struct {
+	// DefaultOutcome is used when the payment method has no entry in Outcomes
+	DefaultOutcome Outcome
+	// Outcomes maps payment methods (e.g. "card_declined") to an outcome
+	Outcomes map[string]Outcome
+	// WebhookSecret signs and verifies webhook payloads. Without one every
+	// webhook is refused.
+	WebhookSecret string
+}
+
+// DefaultFakeOutcomes are the test payment methods understood out of the box
+var DefaultFakeOutcomes = map[string]Outcome{
+	"fake_success":  OutcomeSuccess,
+	"fake_declined": OutcomeDecline,
+	"fake_3ds":      Outcome3DSPending,
+}
+
+type fakePayment struct {
+	status     string
+	authorized float64
+	captured   float64
+	refunded   float64
+}
+
+// FakeProvider is a deterministic in-memory gateway for local development.
+// References are numbered sequentially so runs are reproducible. Its payments
+// are lost on a restart unless they're loaded back with Load.
+type FakeProvider struct {
+	config   FakeConfig
+	mu       sync.Mutex
+	seq      int
+	payments map[string]*fakePayment
+}
+
+// NewFakeProvider creates a fake gateway. Unset outcome fields fall back to
+// approving every payment and recognising DefaultFakeOutcomes.
+func NewFakeProvider(config FakeConfig) *FakeProvider {
+	if config.DefaultOutcome == "" {
+		config.DefaultOutcome = OutcomeSuccess
+	}
+	if config.Outcomes == nil {
+		config.Outcomes = DefaultFakeOutcomes
+	}
+	return &FakeProvider{config: config, payments: make(map[string]*fakePayment)}
+}
+
+// Load rebuilds the gateway's payments from those stored, so that payments
+// made before a restart can still be captured, voided and refunded. New
+// references carry on from the highest one loaded.
+func (f *FakeProvider) Load(payments []models.Payment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, payment := range payments {
+		if payment.Provider != f.Name() || payment.ProviderRef == "" {
+			continue
+		}
+		f.payments[payment.ProviderRef] = &fakePayment{
+			status:     payment.Status,
+			authorized: payment.Amount,
+			captured:   payment.CapturedAmount,
+			refunded:   payment.RefundedAmount,
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(payment.ProviderRef, "fake_pay_")); err == nil && n > f.seq {
+			f.seq = n
+		}
+	}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (Result, error) {
+	if req.Amount <= 0 {
+		return Result{}, fmt.Errorf("Authorize: amount must be positive")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	ref := fmt.Sprintf("fake_pay_%d", f.seq)
+	payment := &fakePayment{authorized: req.Amount}
+	f.payments[ref] = payment
+
+	outcome, ok := f.config.Outcomes[strings.ToLower(req.Method)]
+	if !ok {
+		outcome = f.config.DefaultOutcome
+	}
+
+	result := Result{ProviderRef: ref, Amount: req.Amount}
+	switch outcome {
+	case OutcomeDecline:
+		payment.status = models.PaymentStatusDeclined
+		result.Message = "card declined"
+	case Outcome3DSPending:
+		payment.status = models.PaymentStatusPending
+		result.NextActionURL = "https://fake-gateway.local/3ds/" + ref
+		result.Message = "customer authentication required"
+	default:
+		payment.status = models.PaymentStatusAuthorized
+	}
+	result.Status = payment.status
+	return result, nil
+}
+
+func (f *FakeProvider) Capture(ctx context.Context, providerRef string, amount float64) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, err := f.lookup(providerRef)
+	if err != nil {
+		return Result{}, fmt.Errorf("Capture: %v", err)
+	}
+	if payment.status != models.PaymentStatusAuthorized {
+		return Result{}, fmt.Errorf("Capture: payment %s is %s", providerRef, payment.status)
+	}
+	if amount <= 0 || amount > payment.authorized {
+		amount = payment.authorized
+	}
+	payment.captured = amount
+	payment.status = models.PaymentStatusCaptured
+	return Result{Status: payment.status, ProviderRef: providerRef, Amount: amount}, nil
+}
+
+func (f *FakeProvider) Void(ctx context.Context, providerRef string) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, err := f.lookup(providerRef)
+	if err != nil {
+		return Result{}, fmt.Errorf("Void: %v", err)
+	}
+	if payment.status != models.PaymentStatusAuthorized && payment.status != models.PaymentStatusPending {
+		return Result{}, fmt.Errorf("Void: payment %s is %s", providerRef, payment.status)
+	}
+	payment.status = models.PaymentStatusVoided
+	return Result{Status: payment.status, ProviderRef: providerRef, Amount: payment.authorized}, nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, providerRef string, amount float64) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, err := f.lookup(providerRef)
+	if err != nil {
+		return Result{}, fmt.Errorf("Refund: %v", err)
+	}
+	if payment.status != models.PaymentStatusCaptured && payment.status != models.PaymentStatusRefunded {
+		return Result{}, fmt.Errorf("Refund: payment %s is %s", providerRef, payment.status)
+	}
+	remaining := payment.captured - payment.refunded
+	if amount <= 0 || amount > remaining {
+		return Result{}, fmt.Errorf("Refund: amount %.2f exceeds refundable %.2f", amount, remaining)
+	}
+	payment.refunded += amount
+	status := models.PaymentStatusCaptured
+	if payment.refunded >= payment.captured {
+		status = models.PaymentStatusRefunded
+	}
+	payment.status = status
+	return Result{Status: status, ProviderRef: providerRef, Amount: amount}, nil
+}
+
+func (f *FakeProvider) VerifyWebhook(payload []byte, signature string) (WebhookEvent, error) {
+	var event WebhookEvent
+	if f.config.WebhookSecret == "" || !hmac.Equal([]byte(f.sign(payload)), []byte(signature)) {
+		return event, ErrInvalidSignature
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return event, fmt.Errorf("VerifyWebhook: %v", err)
+	}
+	return event, nil
+}
+
+// CompleteAction resolves a payment waiting on 3DS, as the customer would by
+// finishing the challenge. It returns the signed webhook the real gateway
+// would send so it can be posted to the webhook endpoint.
+func (f *FakeProvider) CompleteAction(providerRef string, approve bool) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, err := f.lookup(providerRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("CompleteAction: %v", err)
+	}
+	if payment.status != models.PaymentStatusPending {
+		return nil, "", fmt.Errorf("CompleteAction: payment %s is %s", providerRef, payment.status)
+	}
+	payment.status = models.PaymentStatusDeclined
+	if approve {
+		payment.status = models.PaymentStatusAuthorized
+	}
+
+	f.seq++
+	payload, err := json.Marshal(WebhookEvent{
+		ID:          fmt.Sprintf("fake_evt_%d", f.seq),
+		Type:        "payment." + payment.status,
+		ProviderRef: providerRef,
+		Status:      payment.status,
+		Amount:      payment.authorized,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("CompleteAction: %v", err)
+	}
+	return payload, f.sign(payload), nil
+}
+
+func (f *FakeProvider) lookup(providerRef string) (*fakePayment, error) {
+	payment, ok := f.payments[providerRef]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %s", providerRef)
+	}
+	return payment, nil
+}
+
+func (f *FakeProvider) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.config.WebhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package payments
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// authorize has f authorize amount by method, expecting the payment to be
+// left with status
+func authorize(t *testing.T, f *FakeProvider, method string, amount float64, status string) string {
+	t.Helper()
+	result, err := f.Authorize(context.Background(), AuthorizeRequest{Amount: amount, Method: method})
+	if err != nil || result.Status != status {
+		t.Fatalf("authorizing by %s gave %s (%v), want %s", method, result.Status, err, status)
+	}
+	return result.ProviderRef
+}
+
+func TestFakeProviderTransitions(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider(FakeConfig{})
+
+	ref := authorize(t, f, "fake_success", 30, models.PaymentStatusAuthorized)
+	if _, err := f.Refund(ctx, ref, 10); err == nil {
+		t.Error("refunded a payment that wasn't captured")
+	}
+	if result, err := f.Capture(ctx, ref, 0); err != nil || result.Amount != 30 {
+		t.Fatalf("capturing gave %v (%v), want all 30", result.Amount, err)
+	}
+	if _, err := f.Void(ctx, ref); err == nil {
+		t.Error("voided a captured payment")
+	}
+	if result, err := f.Refund(ctx, ref, 10); err != nil || result.Status != models.PaymentStatusCaptured {
+		t.Errorf("partly refunding gave %s (%v), want it still captured", result.Status, err)
+	}
+	if _, err := f.Refund(ctx, ref, 25); err == nil {
+		t.Error("refunded more than was left")
+	}
+	if result, err := f.Refund(ctx, ref, 20); err != nil || result.Status != models.PaymentStatusRefunded {
+		t.Errorf("refunding the rest gave %s (%v), want it refunded", result.Status, err)
+	}
+
+	declined := authorize(t, f, "fake_declined", 30, models.PaymentStatusDeclined)
+	if _, err := f.Capture(ctx, declined, 0); err == nil {
+		t.Error("captured a declined payment")
+	}
+	pending := authorize(t, f, "fake_3ds", 30, models.PaymentStatusPending)
+	if result, err := f.Void(ctx, pending); err != nil || result.Status != models.PaymentStatusVoided {
+		t.Errorf("voiding a pending payment gave %s (%v)", result.Status, err)
+	}
+	if _, err := f.Capture(ctx, "fake_pay_404", 0); err == nil {
+		t.Error("captured an unknown payment")
+	}
+}
+
+func TestFakeProviderCompleteAction(t *testing.T) {
+	f := NewFakeProvider(FakeConfig{WebhookSecret: "secret"})
+	ref := authorize(t, f, "fake_3ds", 30, models.PaymentStatusPending)
+
+	payload, signature, err := f.CompleteAction(ref, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := f.VerifyWebhook(payload, signature)
+	if err != nil || event.ProviderRef != ref || event.Status != models.PaymentStatusAuthorized {
+		t.Fatalf("webhook is %+v (%v), want the payment authorized", event, err)
+	}
+	if _, err := f.VerifyWebhook(payload, "forged"); err != ErrInvalidSignature {
+		t.Errorf("verifying a forged signature gave %v", err)
+	}
+	if _, _, err := f.CompleteAction(ref, true); err == nil {
+		t.Error("completed an action twice")
+	}
+	if _, err := f.Capture(context.Background(), ref, 0); err != nil {
+		t.Errorf("capturing the authorized payment: %v", err)
+	}
+}
+
+func TestFakeProviderLoad(t *testing.T) {
+	ctx := context.Background()
+	before := NewFakeProvider(FakeConfig{})
+	captured := authorize(t, before, "fake_success", 30, models.PaymentStatusAuthorized)
+	authorized := authorize(t, before, "fake_success", 20, models.PaymentStatusAuthorized)
+	if _, err := before.Capture(ctx, captured, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFakeProvider(FakeConfig{})
+	f.Load([]models.Payment{
+		{Provider: "fake", ProviderRef: captured, Amount: 30, CapturedAmount: 30, RefundedAmount: 10, Status: models.PaymentStatusCaptured},
+		{Provider: "fake", ProviderRef: authorized, Amount: 20, Status: models.PaymentStatusAuthorized},
+		{Provider: "other", ProviderRef: "fake_pay_9", Amount: 5, Status: models.PaymentStatusAuthorized},
+	})
+	if _, err := f.Refund(ctx, captured, 25); err == nil {
+		t.Error("refunded more than was left after loading")
+	}
+	if _, err := f.Refund(ctx, captured, 20); err != nil {
+		t.Errorf("refunding the rest of a loaded payment: %v", err)
+	}
+	if _, err := f.Capture(ctx, authorized, 0); err != nil {
+		t.Errorf("capturing a loaded payment: %v", err)
+	}
+	if _, err := f.Capture(ctx, "fake_pay_9", 0); err == nil {
+		t.Error("loaded another provider's payment")
+	}
+	if ref := authorize(t, f, "fake_success", 10, models.PaymentStatusAuthorized); ref != "fake_pay_3" {
+		t.Errorf("new payment is %s, want it numbered after those loaded", ref)
+	}
+}
@@ -0,0 +1,15 @@
+module github.com/Rohanrevanth/e-store-go/payments
+
+go 1.23.1
+
+require github.com/Rohanrevanth/e-store-go/models v0.0.0-00010101000000-000000000000
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
+	gorm.io/gorm v1.25.12 // indirect
+)
+
+replace github.com/Rohanrevanth/e-store-go/models => ../models
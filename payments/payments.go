@@ -0,0 +1,51 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidSignature is returned when a webhook payload fails verification
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// AuthorizeRequest describes a payment to be authorized
+type AuthorizeRequest struct {
+	OrderID  uint
+	Amount   float64
+	Currency string
+	Method   string // Payment method or token supplied by the client
+}
+
+// Result is the outcome of a call to the payment provider
+type Result struct {
+	Status        string // One of the models.PaymentStatus* values
+	ProviderRef   string
+	Amount        float64
+	NextActionURL string // Set when the customer must complete an extra step (3DS)
+	Message       string
+}
+
+// WebhookEvent is a verified notification sent by the payment provider
+type WebhookEvent struct {
+	ID          string  `json:"id"`
+	Type        string  `json:"type"`
+	ProviderRef string  `json:"provider_ref"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+}
+
+// PaymentProvider is implemented by every payment gateway the store can use
+type PaymentProvider interface {
+	// Name identifies the provider on stored payments
+	Name() string
+	// Authorize reserves the amount on the customer's payment method
+	Authorize(ctx context.Context, req AuthorizeRequest) (Result, error)
+	// Capture collects a previously authorized amount
+	Capture(ctx context.Context, providerRef string, amount float64) (Result, error)
+	// Void releases an authorization that hasn't been captured
+	Void(ctx context.Context, providerRef string) (Result, error)
+	// Refund returns some or all of a captured amount
+	Refund(ctx context.Context, providerRef string, amount float64) (Result, error)
+	// VerifyWebhook checks the signature on a webhook payload and decodes it
+	VerifyWebhook(payload []byte, signature string) (WebhookEvent, error)
+}
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/auth"
+	"github.com/Rohanrevanth/e-store-go/controllers"
+	"github.com/Rohanrevanth/e-store-go/httpcache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The routes from before /api/v1 were deprecated on legacyDeprecation and
+// are removed at legacySunset
+var (
+	legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset      = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// registerLegacy adds the routes from before /api/v1, which still work but
+// say they're deprecated and which route replaces them
+func registerLegacy(router *gin.Engine, h *controllers.Handler) {
+	alias := func(routes gin.IRoutes, method, path, successor string, handler gin.HandlerFunc) {
+		routes.Handle(method, path, deprecated(successor), handler)
+	}
+
+	alias(router, http.MethodPost, "/login", "/api/v1/auth/login", h.Login)
+	alias(router, http.MethodPost, "/register", "/api/v1/auth/register", h.RegisterUsers)
+	alias(router, http.MethodPost, "/payments/webhook", "/api/v1/payments/webhook", h.PaymentWebhook)
+
+	guest := router.Group("/guest").Use(httpcache.CacheControl(noStoreCacheControl), auth.CartTokenMiddleware(h.CartTokens))
+	{
+		alias(guest, http.MethodGet, "/cart", "/api/v1/guest/cart", h.GetGuestCart)
+		alias(guest, http.MethodPost, "/add-to-cart", "/api/v1/guest/cart/items", h.AddProductToGuestCart)
+		alias(guest, http.MethodPut, "/cart-item", "/api/v1/guest/cart/items/:product_id", h.UpdateGuestCartItem)
+		alias(guest, http.MethodPost, "/delete-from-cart", "/api/v1/guest/cart/items/:product_id", h.RemoveItemFromGuestCart)
+		alias(guest, http.MethodPost, "/checkout", "/api/v1/guest/orders", h.GuestCheckout)
+	}
+
+	catalog := router.Group("/").Use(auth.JWTAuthMiddleware(), httpcache.Conditional(catalogCacheControl))
+	{
+		alias(catalog, http.MethodGet, "/categories", "/api/v1/categories", h.GetAllCategories)
+		alias(catalog, http.MethodGet, "/best-sellers", "/api/v1/products/best-sellers", h.GetBestSellers)
+		alias(catalog, http.MethodGet, "/all-products", "/api/v1/products", h.GetAllProducts)
+	}
+
+	protected := router.Group("/").Use(auth.JWTAuthMiddleware(), httpcache.CacheControl(privateCacheControl))
+	{
+		alias(protected, http.MethodGet, "/users", "/api/v1/users", h.GetAllUsers)
+		alias(protected, http.MethodGet, "/user/:id", "/api/v1/users/:id", h.GetUserByID)
+
+		alias(protected, http.MethodPost, "/categories", "/api/v1/categories", h.AddCategories)
+		alias(protected, http.MethodPost, "/add-products", "/api/v1/products", h.AddProducts)
+		alias(protected, http.MethodPost, "/get-products", "/api/v1/products", h.GetProducts)
+
+		alias(protected, http.MethodGet, "/get-coupons", "/api/v1/coupons", h.GetCoupons)
+		alias(protected, http.MethodPost, "/add-coupon", "/api/v1/coupons", h.AddCoupon)
+		alias(protected, http.MethodPost, "/update-coupon", "/api/v1/coupons/:code", h.SaveCoupon)
+		alias(protected, http.MethodPost, "/delete-coupon", "/api/v1/coupons/:code", h.DeleteCoupon)
+		alias(protected, http.MethodPost, "/apply-coupon/:id", "/api/v1/users/:id/coupons/:code", h.ApplyCoupon)
+
+		alias(protected, http.MethodGet, "/get-cart/:id", "/api/v1/users/:id/cart", h.GetUserCart)
+		alias(protected, http.MethodPost, "/add-to-cart/:id", "/api/v1/users/:id/cart/items", h.AddProductToCart)
+		alias(protected, http.MethodPut, "/cart-item/:id", "/api/v1/users/:id/cart/items/:product_id", h.UpdateCartItem)
+		alias(protected, http.MethodPost, "/delete-from-cart/:id", "/api/v1/users/:id/cart/items/:product_id", h.RemoveItemFromCart)
+		alias(protected, http.MethodPost, "/save-address/:id", "/api/v1/users/:id/address", h.SaveAddress)
+		alias(protected, http.MethodGet, "/get-orders/:id", "/api/v1/users/:id/orders", h.GetUserOders)
+		alias(protected, http.MethodGet, "/get-orders", "/api/v1/orders", h.GetAllOders)
+		alias(protected, http.MethodPost, "/place-order", "/api/v1/orders", h.PlaceOrder)
+		alias(protected, http.MethodGet, "/abandoned-carts", "/api/v1/carts/abandoned", h.GetAbandonedCarts)
+
+		alias(protected, http.MethodGet, "/get-payment/:id", "/api/v1/orders/:id/payment", h.GetOrderPayment)
+
+		alias(protected, http.MethodPost, "/request-return", "/api/v1/returns", h.RequestReturn)
+		alias(protected, http.MethodGet, "/get-returns/:id", "/api/v1/users/:id/returns", h.GetUserReturns)
+		alias(protected, http.MethodGet, "/get-returns", "/api/v1/returns", h.GetAllReturns)
+	}
+
+	admin := router.Group("/").Use(auth.JWTAuthMiddleware(), h.RequireAdmin(), httpcache.CacheControl(privateCacheControl))
+	{
+		alias(admin, http.MethodPost, "/delete", "/api/v1/users/:id", h.DeleteUser)
+
+		alias(admin, http.MethodPost, "/capture-payment/:id", "/api/v1/orders/:id/payment/capture", h.CapturePayment)
+		alias(admin, http.MethodPost, "/void-payment/:id", "/api/v1/orders/:id/payment/void", h.VoidPayment)
+		alias(admin, http.MethodPost, "/refund-payment/:id", "/api/v1/orders/:id/payment/refund", h.RefundPayment)
+		alias(admin, http.MethodPost, "/update-order-status/:id", "/api/v1/orders/:id/status", h.UpdateOrderStatus)
+
+		alias(admin, http.MethodPost, "/approve-return/:id", "/api/v1/returns/:id/approve", h.ApproveReturn)
+		alias(admin, http.MethodPost, "/reject-return/:id", "/api/v1/returns/:id/reject", h.RejectReturn)
+
+		alias(admin, http.MethodPost, "/import-products", "/api/v1/products/import", h.ImportProducts)
+		alias(admin, http.MethodGet, "/import-jobs", "/api/v1/import-jobs", h.GetImportJobs)
+		alias(admin, http.MethodGet, "/import-jobs/:id", "/api/v1/import-jobs/:id", h.GetImportJob)
+		alias(admin, http.MethodGet, "/export/:kind", "/api/v1/exports/:kind", h.Export)
+	}
+}
+
+// deprecated marks the responses of a route that's going away with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers, and links to
+// successor, the path of the route replacing it. The successor's parameters
+// are filled in from the request's; one that needs a parameter the request
+// doesn't have, such as an ID the old route took in the body, isn't linked.
+func deprecated(successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecation.Unix())
+	sunset := legacySunset.Format(http.TimeFormat)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunset)
+		if link, ok := fillParams(successor, c.Params); ok {
+			c.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, link))
+		}
+		c.Next()
+	}
+}
+
+// fillParams replaces the :name segments of path with the values in params,
+// reporting whether they were all there
+func fillParams(path string, params gin.Params) (string, bool) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		value, found := params.Get(name)
+		if !found {
+			return "", false
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/"), true
+}
@@ -3,45 +3,139 @@ package routes
 import (
 	"github.com/Rohanrevanth/e-store-go/auth"
 	"github.com/Rohanrevanth/e-store-go/controllers"
+	"github.com/Rohanrevanth/e-store-go/httpcache"
+	"github.com/Rohanrevanth/e-store-go/openapi"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(router *gin.Engine) {
+// Cache-Control for each group of routes. The catalog is the same for every
+// user, so browsers and CDNs may keep it for a minute and then revalidate it;
+// responses about a user must not be shared, and ones about a guest cart or
+// the server's health must not be stored at all.
+const (
+	catalogCacheControl = "public, max-age=60"
+	privateCacheControl = "private, no-cache"
+	noStoreCacheControl = "no-store"
+)
+
+// RegisterRoutes adds the API routes, served by h, to router: the /api/v1
+// routes, the legacy routes they replace, and the unversioned probes, error
+// catalogue and API document.
+func RegisterRoutes(router *gin.Engine, h *controllers.Handler) {
+	router.NoRoute(h.NoRoute)
+	router.NoMethod(h.NoMethod)
+
+	probes := router.Group("/").Use(httpcache.CacheControl(noStoreCacheControl))
+	{
+		probes.GET("/healthz", h.Healthz)
+		probes.GET("/readyz", h.Readyz)
+		probes.GET("/version", h.Version)
+		probes.GET("/metrics", gin.WrapH(h.Metrics.Handler()))
+	}
+
+	// The error catalogue, which problem types link to
+	errorCodes := router.Group("/errors").Use(httpcache.CacheControl(catalogCacheControl))
+	{
+		errorCodes.GET("", h.GetErrors)
+		errorCodes.GET("/:code", h.GetError)
+	}
+
+	// The OpenAPI document, and Swagger UI to browse it
+	docs := router.Group("/").Use(httpcache.CacheControl(catalogCacheControl))
+	{
+		docs.GET(openapi.SpecPath, openapi.ServeSpec)
+		docs.GET("/docs/*filepath", openapi.ServeUI)
+	}
+
+	registerV1(router.Group("/api/v1"), h)
+	registerLegacy(router, h)
+}
+
+// registerV1 adds the v1 routes to api. Resources are named by nouns and
+// changed with the matching verb; handlers are shared with the legacy routes.
+func registerV1(api *gin.RouterGroup, h *controllers.Handler) {
+	api.POST("/auth/register", h.RegisterUsers)
+	api.POST("/auth/login", h.Login)
+	api.POST("/payments/webhook", h.PaymentWebhook)
+
+	guest := api.Group("/guest").Use(httpcache.CacheControl(noStoreCacheControl), auth.CartTokenMiddleware(h.CartTokens))
+	{
+		guest.GET("/cart", h.GetGuestCart)
+		guest.POST("/cart/items", h.AddProductToGuestCart)
+		guest.PUT("/cart/items/:product_id", h.UpdateGuestCartItem)
+		guest.DELETE("/cart/items/:product_id", h.DeleteGuestCartItem)
+		guest.POST("/orders", h.GuestCheckout)
+	}
+
+	catalog := api.Group("").Use(auth.JWTAuthMiddleware(), httpcache.Conditional(catalogCacheControl))
+	{
+		catalog.GET("/categories", h.GetAllCategories)
+		catalog.GET("/products", h.GetAllProducts)
+		catalog.GET("/products/best-sellers", h.GetBestSellers)
+	}
+
+	protected := api.Group("").Use(auth.JWTAuthMiddleware(), httpcache.CacheControl(privateCacheControl))
+	{
+		protected.GET("/users", h.GetAllUsers)
+		protected.GET("/users/:id", h.GetUserByID)
+		protected.PUT("/users/:id/address", h.SaveAddress)
+
+		protected.POST("/categories", h.AddCategories)
+		protected.POST("/products", h.AddProducts)
+
+		protected.GET("/coupons", h.GetCoupons)
+		protected.POST("/coupons", h.AddCoupon)
+		protected.PUT("/coupons/:code", h.UpdateCoupon)
+		protected.DELETE("/coupons/:code", h.DeleteCouponByCode)
+		protected.GET("/users/:id/coupons/:code", h.GetUserCoupon)
 
-	router.POST("/login", controllers.Login)
-	router.POST("/register", controllers.RegisterUsers)
+		protected.GET("/users/:id/cart", h.GetUserCart)
+		protected.POST("/users/:id/cart/items", h.AddProductToCart)
+		protected.PUT("/users/:id/cart/items/:product_id", h.UpdateCartItem)
+		protected.DELETE("/users/:id/cart/items/:product_id", h.DeleteCartItem)
+		protected.GET("/carts/abandoned", h.GetAbandonedCarts)
 
-	protected := router.Group("/").Use(auth.JWTAuthMiddleware())
+		protected.GET("/orders", h.GetAllOders)
+		protected.POST("/orders", h.PlaceOrder)
+		protected.GET("/users/:id/orders", h.GetUserOders)
+
+		protected.GET("/orders/:id/payment", h.GetOrderPayment)
+
+		protected.GET("/returns", h.GetAllReturns)
+		protected.POST("/returns", h.RequestReturn)
+		protected.GET("/users/:id/returns", h.GetUserReturns)
+
+		protected.POST("/graphql", h.GraphQL.Serve)
+	}
+
+	// Routes that act on other users' accounts, orders and money, or move the
+	// store's data in and out, for admins only
+	admin := api.Group("").Use(auth.JWTAuthMiddleware(), h.RequireAdmin(), httpcache.CacheControl(privateCacheControl))
 	{
+		admin.DELETE("/users/:id", h.DeleteUserByID)
+
+		admin.PUT("/orders/:id/status", h.UpdateOrderStatus)
+		admin.POST("/orders/:id/payment/capture", h.CapturePayment)
+		admin.POST("/orders/:id/payment/void", h.VoidPayment)
+		admin.POST("/orders/:id/payment/refund", h.RefundPayment)
+
+		admin.POST("/returns/:id/approve", h.ApproveReturn)
+		admin.POST("/returns/:id/reject", h.RejectReturn)
+
+		admin.POST("/products/import", h.ImportProducts)
+		admin.GET("/import-jobs", h.GetImportJobs)
+		admin.GET("/import-jobs/:id", h.GetImportJob)
+		admin.GET("/exports/:kind", h.Export)
 
-		//User routes
-		protected.GET("/users", controllers.GetAllUsers)
-		protected.GET("/user/:id", controllers.GetUserByID)
-		protected.POST("/delete", controllers.DeleteUser)
-
-		//Product routes
-		protected.GET("/categories", controllers.GetAllCategories)
-		protected.POST("/categories", controllers.AddCategories)
-		protected.GET("/best-sellers", controllers.GetBestSellers)
-		protected.GET("/all-products", controllers.GetAllProducts)
-		protected.POST("/add-products", controllers.AddProducts)
-		protected.POST("/get-products", controllers.GetProducts)
-
-		//Coupon routes
-		protected.GET("/get-coupons", controllers.GetCoupons)
-		protected.POST("/add-coupon", controllers.AddCoupon)
-		protected.POST("/update-coupon", controllers.SaveCoupon)
-		protected.POST("/delete-coupon", controllers.DeleteCoupon)
-		protected.POST("/apply-coupon/:id", controllers.ApplyCoupon)
-
-		//Order routes
-		protected.GET("/get-cart/:id", controllers.GetUserCart)
-		protected.POST("/add-to-cart/:id", controllers.AddProductToCart)
-		protected.POST("/delete-from-cart/:id", controllers.RemoveItemFromCart)
-		protected.POST("/save-address/:id", controllers.SaveAddress)
-		protected.GET("/get-orders/:id", controllers.GetUserOders)
-		protected.GET("/get-orders", controllers.GetAllOders)
-		protected.POST("/place-order", controllers.PlaceOrder)
+		admin.GET("/webhooks", h.GetWebhooks)
+		admin.POST("/webhooks", h.AddWebhook)
+		admin.GET("/webhooks/events", h.GetWebhookEvents)
+		admin.GET("/webhooks/:id", h.GetWebhook)
+		admin.PUT("/webhooks/:id", h.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", h.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", h.GetWebhookDeliveries)
+		admin.GET("/webhooks/:id/deliveries/:delivery_id", h.GetWebhookDelivery)
+		admin.POST("/webhooks/:id/deliveries/:delivery_id/retry", h.RetryWebhookDelivery)
 	}
 }
@@ -0,0 +1,171 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// FakePassword is the password of every generated user
+const FakePassword = "password"
+
+// GenerateOptions size a synthetic data set
+type GenerateOptions struct {
+	Categories    int
+	Products      int
+	Users         int
+	OrdersPerUser int
+	MaxOrderItems int    // Most distinct products in one order
+	Seed          uint64 // The same seed generates the same catalog and users
+}
+
+// DefaultGenerateOptions returns a data set big enough to notice slow queries
+func DefaultGenerateOptions() GenerateOptions {
+	return GenerateOptions{
+		Categories:    20,
+		Products:      5000,
+		Users:         200,
+		OrdersPerUser: 5,
+		MaxOrderItems: 4,
+		Seed:          1,
+	}
+}
+
+// GenerateReport counts what Generate did
+type GenerateReport struct {
+	Report
+	Orders int `json:"orders"`
+}
+
+// Generate fills store with a fake catalog, users and their order histories
+// for load testing. Categories, products and users are upserted, so running
+// it again with the same seed reuses them; orders are added every time.
+func Generate(ctx context.Context, store database.Store, opts GenerateOptions) (GenerateReport, error) {
+	var report GenerateReport
+	faker := gofakeit.New(opts.Seed)
+
+	fixtures := Fixtures{}
+	seen := make(map[string]bool)
+	for i := 0; i < opts.Categories; i++ {
+		name := faker.ProductCategory()
+		if seen[name] {
+			name = fmt.Sprintf("%s %d", name, i+1)
+		}
+		seen[name] = true
+		fixtures.Categories = append(fixtures.Categories, models.Category{
+			Name:        name,
+			Description: faker.Sentence(8),
+			Image:       fmt.Sprintf("https://picsum.photos/seed/category-%d/400/300", i+1),
+		})
+	}
+
+	for i := 0; i < opts.Products; i++ {
+		product := models.Product{
+			Name:         fmt.Sprintf("%s %d", faker.ProductName(), i+1),
+			Description:  faker.ProductDescription(),
+			Image:        fmt.Sprintf("https://picsum.photos/seed/product-%d/400/400", i+1),
+			Price:        math.Round(faker.Price(1, 500)*100) / 100,
+			Isbestseller: faker.IntN(10) == 0,
+			Stock:        faker.IntRange(opts.OrdersPerUser*opts.Users, opts.OrdersPerUser*opts.Users*3+10),
+		}
+		if len(fixtures.Categories) > 0 {
+			product.Category = fixtures.Categories[faker.IntN(len(fixtures.Categories))].Name
+		}
+		fixtures.Products = append(fixtures.Products, product)
+	}
+
+	var err error
+	if report.Report, err = Seed(ctx, store, fixtures, Options{}); err != nil {
+		return report, fmt.Errorf("Generate: %v", err)
+	}
+
+	// Hashing is slow, so every user shares one hash
+	var hashed models.User
+	if err := hashed.HashPassword(FakePassword); err != nil {
+		return report, fmt.Errorf("Generate: %v", err)
+	}
+	for i := 0; i < opts.Users; i++ {
+		user := models.User{
+			Username: fmt.Sprintf("%s%d", faker.Username(), i+1),
+			Email:    fmt.Sprintf("loadtest%d@example.com", i+1),
+			Password: hashed.Password,
+		}
+		created, err := store.UpsertUser(ctx, user)
+		if err != nil {
+			return report, fmt.Errorf("Generate: user %s: %v", user.Email, err)
+		}
+		report.Users.add(created)
+	}
+
+	if report.Orders, err = generateOrders(ctx, store, faker, opts); err != nil {
+		return report, fmt.Errorf("Generate: %v", err)
+	}
+	return report, nil
+}
+
+// generateOrders places OrdersPerUser orders for every generated user by
+// filling their cart with random products, checking out and authorizing the
+// payment.
+func generateOrders(ctx context.Context, store database.Store, faker *gofakeit.Faker, opts GenerateOptions) (int, error) {
+	if opts.OrdersPerUser <= 0 || opts.MaxOrderItems <= 0 {
+		return 0, nil
+	}
+	all, err := store.GetAllProducts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var products []models.Product
+	for _, product := range all {
+		if !product.Disabled {
+			products = append(products, product)
+		}
+	}
+	if len(products) == 0 {
+		return 0, nil
+	}
+
+	orders := 0
+	for i := 0; i < opts.Users; i++ {
+		user, err := store.GetUserByEmail(ctx, fmt.Sprintf("loadtest%d@example.com", i+1))
+		if err != nil {
+			return orders, err
+		}
+		userID := strconv.FormatUint(uint64(user.ID), 10)
+
+		for j := 0; j < opts.OrdersPerUser; j++ {
+			for k := faker.IntRange(1, opts.MaxOrderItems); k > 0; k-- {
+				product := products[faker.IntN(len(products))]
+				if err := store.AddItemToCart(ctx, userID, product.ID, faker.IntRange(1, 3)); err != nil {
+					return orders, err
+				}
+			}
+			order, err := store.PlaceOrder(ctx, models.Order{UserID: userID, PaymentMethod: "card", ShippingDetails: faker.Address().Address})
+			if err != nil {
+				return orders, err
+			}
+			if err := authorize(ctx, store, order); err != nil {
+				return orders, err
+			}
+			orders++
+		}
+	}
+	return orders, nil
+}
+
+// authorize records a payment authorized for the whole of order, which
+// places it and empties the cart for the next one
+func authorize(ctx context.Context, store database.Store, order models.Order) error {
+	payment, err := store.AddPayment(ctx, models.Payment{OrderID: order.ID, Provider: "seed", Method: order.PaymentMethod,
+		Amount: order.TotalPrice, Currency: "USD", Status: models.PaymentStatusPending})
+	if err != nil {
+		return err
+	}
+	_, err = store.RecordPaymentTransaction(ctx, payment, models.Transaction{Type: models.TransactionAuthorize,
+		Amount: order.TotalPrice, Status: models.PaymentStatusAuthorized})
+	return err
+}
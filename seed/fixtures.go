@@ -0,0 +1,100 @@
+package seed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Rohanrevanth/e-store-go/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures is the data loaded by Seed
+type Fixtures struct {
+	Categories []models.Category
+	Products   []models.Product
+	Users      []UserFixture
+	Coupons    []models.CouponObject
+}
+
+// UserFixture is a demo account. The password is given in plain text and
+// hashed when the user is stored.
+type UserFixture struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Type     string `json:"type,omitempty"` // models.UserTypeAdmin for an admin
+}
+
+// fixtureExtensions are tried in order for each kind of fixture
+var fixtureExtensions = []string{".json", ".yaml", ".yml"}
+
+// LoadFixtures reads categories, products, users and coupons from dir. Each
+// is looked for as <kind>.json, <kind>.yaml or <kind>.yml holding a list, and
+// any that are missing are left empty. YAML files use the same field names as
+// the JSON ones.
+func LoadFixtures(dir string) (Fixtures, error) {
+	var fixtures Fixtures
+	files := []struct {
+		kind string
+		into interface{}
+	}{
+		{"categories", &fixtures.Categories},
+		{"products", &fixtures.Products},
+		{"users", &fixtures.Users},
+		{"coupons", &fixtures.Coupons},
+	}
+
+	found := 0
+	for _, file := range files {
+		ok, err := loadFixture(dir, file.kind, file.into)
+		if err != nil {
+			return fixtures, err
+		}
+		if ok {
+			found++
+		}
+	}
+	if found == 0 {
+		return fixtures, fmt.Errorf("no fixtures found in %s", dir)
+	}
+	return fixtures, nil
+}
+
+// loadFixture decodes the first file found for kind into into, reporting
+// whether there was one.
+func loadFixture(dir, kind string, into interface{}) (bool, error) {
+	for _, ext := range fixtureExtensions {
+		path := filepath.Join(dir, kind+ext)
+		contents, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := decodeFixture(contents, ext, into); err != nil {
+			return false, fmt.Errorf("%s: %v", path, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func decodeFixture(contents []byte, ext string, into interface{}) error {
+	if strings.HasPrefix(ext, ".y") {
+		// Go through JSON so the models' json tags apply to YAML too
+		var data interface{}
+		if err := yaml.Unmarshal(contents, &data); err != nil {
+			return err
+		}
+		var err error
+		if contents, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(contents, into)
+}
@@ -0,0 +1,103 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// Options control how fixtures are stored
+type Options struct {
+	// DefaultStock is given to new products whose fixture doesn't set a stock
+	DefaultStock int
+}
+
+// Count is how many records of one kind were created and updated
+type Count struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+func (c *Count) add(created bool) {
+	if created {
+		c.Created++
+	} else {
+		c.Updated++
+	}
+}
+
+func (c Count) String() string {
+	return fmt.Sprintf("%d created, %d updated", c.Created, c.Updated)
+}
+
+// Report counts what Seed did
+type Report struct {
+	Categories Count `json:"categories"`
+	Products   Count `json:"products"`
+	Users      Count `json:"users"`
+	Coupons    Count `json:"coupons"`
+}
+
+// Seed upserts the fixtures into store. Records are matched on category and
+// product name, user email and coupon code, so seeding again only brings
+// existing records back in line with the fixtures.
+func Seed(ctx context.Context, store database.Store, fixtures Fixtures, opts Options) (Report, error) {
+	var report Report
+
+	for _, category := range fixtures.Categories {
+		created, err := store.UpsertCategory(ctx, category)
+		if err != nil {
+			return report, fmt.Errorf("Seed: category %s: %v", category.Name, err)
+		}
+		report.Categories.add(created)
+	}
+
+	for _, product := range fixtures.Products {
+		if product.Stock == 0 {
+			product.Stock = opts.DefaultStock
+		}
+		created, err := store.UpsertProduct(ctx, product)
+		if err != nil {
+			return report, fmt.Errorf("Seed: product %s: %v", product.Name, err)
+		}
+		report.Products.add(created)
+	}
+
+	for _, fixture := range fixtures.Users {
+		user, err := fixtureUser(ctx, store, fixture)
+		if err != nil {
+			return report, fmt.Errorf("Seed: user %s: %v", fixture.Email, err)
+		}
+		created, err := store.UpsertUser(ctx, user)
+		if err != nil {
+			return report, fmt.Errorf("Seed: user %s: %v", fixture.Email, err)
+		}
+		report.Users.add(created)
+	}
+
+	for _, coupon := range fixtures.Coupons {
+		created, err := store.UpsertCoupon(ctx, coupon)
+		if err != nil {
+			return report, fmt.Errorf("Seed: coupon %s: %v", coupon.Code, err)
+		}
+		report.Coupons.add(created)
+	}
+	return report, nil
+}
+
+// fixtureUser returns the user to store for a fixture, keeping the existing
+// password hash when the password hasn't changed so seeding again doesn't
+// rewrite it.
+func fixtureUser(ctx context.Context, store database.Store, fixture UserFixture) (models.User, error) {
+	user := models.User{Username: fixture.Username, Email: fixture.Email, Type: fixture.Type}
+	if existing, err := store.GetUserByEmail(ctx, fixture.Email); err == nil && existing.CheckPassword(fixture.Password) == nil {
+		user.Password = existing.Password
+		return user, nil
+	}
+	if err := user.HashPassword(fixture.Password); err != nil {
+		return user, err
+	}
+	return user, nil
+}
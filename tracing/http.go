@@ -0,0 +1,27 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// untracedPaths are polled by orchestrators and Prometheus, and would bury
+// the traces worth reading
+var untracedPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// Middleware starts a span for every request, named after the route template
+// it matched and continuing the trace in its traceparent header, if any.
+// Probes and metrics scrapes aren't traced.
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		for _, path := range untracedPaths {
+			if strings.TrimSuffix(r.URL.Path, "/") == path {
+				return false
+			}
+		}
+		return true
+	}))
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook gives each Redis command, or pipeline, a span as a child of the
+// span in its context. Commands outside a trace aren't traced, and keys and
+// values aren't recorded.
+type RedisHook struct{}
+
+var _ redis.Hook = RedisHook{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = startRedis(ctx, cmd.Name())
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedis(ctx, cmd.Err())
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	ctx, span := startRedis(ctx, "pipeline")
+	if span != nil {
+		span.SetAttributes(semconv.DBQueryText(strings.Join(names, " ")))
+	}
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			break
+		}
+	}
+	endRedis(ctx, err)
+	return nil
+}
+
+// redisSpanKey holds the span started for a command, so that it's told apart
+// from the caller's span when the command is done
+type redisSpanKey struct{}
+
+// startRedis starts the span of a command, if it's part of a trace
+func startRedis(ctx context.Context, operation string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil
+	}
+	ctx, span := tracer().Start(ctx, "redis "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationName(operation)),
+	)
+	return context.WithValue(ctx, redisSpanKey{}, span), span
+}
+
+// endRedis finishes the span started for a command. A missing key isn't a
+// failure.
+func endRedis(ctx context.Context, err error) {
+	span, ok := ctx.Value(redisSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		recordError(span, err)
+	}
+	span.End()
+}
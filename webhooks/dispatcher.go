@@ -0,0 +1,216 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+	"go.opentelemetry.io/otel"
+)
+
+// Defaults for a Dispatcher
+const (
+	DefaultInterval    = 5 * time.Second
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxAttempts = 10
+)
+
+// maxResponse is how much of a receiver's response body is kept in the
+// delivery log
+const maxResponse = 512
+
+// Dispatcher sends the queued webhook deliveries. A delivery the receiver
+// doesn't answer with a 2xx status is retried after BaseDelay, doubling with
+// each attempt up to MaxDelay, and is dead after MaxAttempts; dead deliveries
+// stay in the log and can be queued again. Several dispatchers can share a
+// database, as each delivery is claimed by one of them at a time.
+type Dispatcher struct {
+	Webhooks    database.WebhookStore
+	Client      *http.Client  // Sends the deliveries; redirects aren't followed
+	Interval    time.Duration // How often to look for due deliveries
+	BatchSize   int           // How many deliveries to send at once
+	MaxAttempts int           // Attempts before a delivery is given up on
+	BaseDelay   time.Duration // Wait before the first retry
+	MaxDelay    time.Duration // Longest wait between retries
+	// Lease is how long a claimed delivery is held for its dispatcher, after
+	// which another may send it, in case the first stopped partway
+	Lease time.Duration
+	// AllowPrivate lets deliveries go to loopback and private addresses, for
+	// receivers on the server's own network; otherwise they're refused
+	AllowPrivate bool
+	Logger       *slog.Logger
+}
+
+// NewDispatcher returns a dispatcher for the deliveries in store, checking
+// every 5 seconds and retrying from 30 seconds up to 6 hours apart, 10 times,
+// which gives a receiver about 4 hours to come back. Deliveries only go to
+// addresses on the public internet unless AllowPrivate is set.
+func NewDispatcher(store database.WebhookStore) *Dispatcher {
+	d := &Dispatcher{
+		Webhooks:    store,
+		Interval:    DefaultInterval,
+		BatchSize:   20,
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    6 * time.Hour,
+		Lease:       time.Minute,
+		Logger:      slog.Default(),
+	}
+	d.Client = newClient(func() bool { return d.AllowPrivate })
+	return d
+}
+
+// Run sends due deliveries every Interval until ctx is cancelled, going
+// straight on to the next batch while there are more due
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := d.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.Logger.Error("Error sending webhooks", "error", err)
+		}
+		if n == d.BatchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends a batch of due deliveries, returning how many it attempted
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	deliveries, err := d.Webhooks.ClaimWebhookDeliveries(ctx, time.Now(), d.Lease, d.BatchSize)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+	// Only batches with deliveries in them are traced, so that idle polls
+	// don't fill the traces
+	ctx, span := otel.Tracer("github.com/Rohanrevanth/e-store-go/webhooks").Start(ctx, "Dispatcher.RunOnce")
+	defer span.End()
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.deliver(ctx, delivery); err != nil && ctx.Err() == nil {
+				d.Logger.Error("Error sending webhook", "delivery_id", delivery.ID, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt at a claimed delivery and records it. A delivery
+// cut short by ctx isn't recorded; it's sent again once its lease is up.
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) error {
+	sub, err := d.Webhooks.GetWebhookSubscription(ctx, strconv.FormatUint(uint64(delivery.SubscriptionID), 10))
+	if errors.Is(err, database.ErrNotFound) {
+		return d.giveUp(ctx, delivery, "the subscription was deleted")
+	} else if err != nil {
+		return err
+	}
+	if sub.Disabled {
+		return d.giveUp(ctx, delivery, "the subscription is disabled")
+	}
+
+	attempt := d.send(ctx, sub, delivery)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	delivery.Attempts++
+	now := time.Now()
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = attempt.Error
+		d.Logger.Warn("Gave up on a webhook", "delivery_id", delivery.ID, "subscription_id", sub.ID, "attempts", delivery.Attempts, "error", attempt.Error)
+	default:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = attempt.Error
+	}
+	_, err = d.Webhooks.RecordWebhookAttempt(ctx, delivery, attempt)
+	return err
+}
+
+// send POSTs the delivery's payload, signed with the subscription's secret
+func (d *Dispatcher) send(ctx context.Context, sub models.WebhookSubscription, delivery models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	var attempt models.WebhookAttempt
+	defer func() {
+		attempt.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "e-store-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(response)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("the receiver responded %s", resp.Status)
+	}
+	return attempt
+}
+
+// giveUp marks a delivery dead without attempting it
+func (d *Dispatcher) giveUp(ctx context.Context, delivery models.WebhookDelivery, reason string) error {
+	delivery.Status = models.WebhookDeliveryDead
+	delivery.LastError = reason
+	return d.Webhooks.SaveWebhookDelivery(ctx, delivery)
+}
+
+// backoff returns the wait after a delivery's nth failed attempt: BaseDelay
+// doubled for each attempt before it, up to MaxDelay, less up to a tenth so
+// that deliveries that failed together don't all retry together
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.MaxDelay)
+	if jitter := int64(delay / 10); jitter > 0 {
+		delay -= time.Duration(rand.N(jitter))
+	}
+	return delay
+}
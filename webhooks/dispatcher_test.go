@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// queueDelivery subscribes url to order.placed and queues a delivery of one,
+// returning the delivery's ID
+func queueDelivery(t *testing.T, store *database.MemoryStore, url string) string {
+	t.Helper()
+	ctx := context.Background()
+	sub, err := store.AddWebhookSubscription(ctx, models.WebhookSubscription{URL: url, Secret: "whsec_test", Events: models.EventTypes{"order.placed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueue(ctx, store, []models.WebhookSubscription{sub}, "order.placed", map[string]any{"order_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := store.GetWebhookDeliveries(ctx, strconv.FormatUint(uint64(sub.ID), 10))
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("got deliveries %v (%v), want the one queued", deliveries, err)
+	}
+	return strconv.FormatUint(uint64(deliveries[0].ID), 10)
+}
+
+// newTestDispatcher returns a dispatcher of the deliveries in store that
+// doesn't log
+func newTestDispatcher(store database.WebhookStore) *Dispatcher {
+	d := NewDispatcher(store)
+	d.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return d
+}
+
+func TestDispatcherSignsDeliveries(t *testing.T) {
+	verified := make(chan error, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = Verify("whsec_test", r.Header, body, DefaultTolerance)
+		}
+		verified <- err
+	}))
+	defer receiver.Close()
+
+	store := database.NewMemoryStore()
+	id := queueDelivery(t, store, receiver.URL)
+	d := newTestDispatcher(store)
+	d.AllowPrivate = true // The receiver is on loopback
+	if n, err := d.RunOnce(context.Background()); n != 1 || err != nil {
+		t.Fatalf("sent %d deliveries (%v), want 1", n, err)
+	}
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Fatalf("receiver couldn't verify the delivery: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the receiver got nothing")
+	}
+
+	delivery, err := store.GetWebhookDelivery(context.Background(), id)
+	if err != nil || delivery.Status != models.WebhookDeliveryDelivered || len(delivery.AttemptLog) != 1 {
+		t.Errorf("delivery is %s after %d attempts (%v), want delivered at once", delivery.Status, len(delivery.AttemptLog), err)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	var called atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer receiver.Close()
+
+	store := database.NewMemoryStore()
+	id := queueDelivery(t, store, receiver.URL)
+	d := newTestDispatcher(store)
+	d.MaxAttempts = 1
+	if n, err := d.RunOnce(context.Background()); n != 1 || err != nil {
+		t.Fatalf("sent %d deliveries (%v), want 1", n, err)
+	}
+	if called.Load() {
+		t.Error("the delivery reached a receiver on loopback")
+	}
+	delivery, err := store.GetWebhookDelivery(context.Background(), id)
+	if err != nil || delivery.Status != models.WebhookDeliveryDead || !strings.Contains(delivery.LastError, ErrPrivateAddress.Error()) {
+		t.Errorf("delivery is %s with error %q (%v), want refused", delivery.Status, delivery.LastError, err)
+	}
+}
@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is why a delivery to an address that isn't on the public
+// internet fails
+var ErrPrivateAddress = errors.New("webhooks: refusing to connect to a private address")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in all
+// but name
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// newClient returns the client deliveries are sent with. It connects straight
+// to the receiver, without a proxy, so that allowPrivate is asked about the
+// receiver's own address; if it says no, loopback, private, link-local and
+// other addresses that aren't on the public internet are refused. The check
+// is made on the address dialled, after the name is resolved, so a public
+// name pointing at the server's own network is refused too.
+func newClient(allowPrivate func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate() {
+				return nil
+			}
+			return checkPublic(address)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   DefaultTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkPublic returns ErrPrivateAddress unless address, a host:port with the
+// host resolved, is on the public internet
+func checkPublic(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
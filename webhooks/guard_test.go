@@ -0,0 +1,34 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPublic(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::248]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false}, // Cloud metadata
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	} {
+		err := checkPublic(tc.address)
+		if tc.public && err != nil {
+			t.Errorf("refused %s: %v", tc.address, err)
+		} else if !tc.public && !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("checking %s gave %v, want ErrPrivateAddress", tc.address, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Rohanrevanth/e-store-go/database"
+	"github.com/Rohanrevanth/e-store-go/events"
+	"github.com/Rohanrevanth/e-store-go/models"
+)
+
+// OrderChange is the data of an order.status_changed event
+type OrderChange struct {
+	Order          models.Order `json:"order"`
+	PreviousStatus string       `json:"previous_status"`
+}
+
+// Subscribe has a delivery queued to every interested subscription as the
+// store's events are dispatched: when orders are placed or change status,
+// including by payments, and when products are added or changed. A delivery
+// that can't be queued fails the handler, so the outbox tries it again.
+func Subscribe(bus *events.Bus, store database.Store) {
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, event models.OrderPlaced) error {
+		return queue(ctx, store, models.WebhookOrderPlaced, func() (any, error) {
+			order, err := store.GetOrder(ctx, strconv.FormatUint(uint64(event.OrderID), 10))
+			return map[string]any{"order": order}, err
+		})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, event models.OrderStatusChanged) error {
+		return queue(ctx, store, models.WebhookOrderStatusChanged, func() (any, error) {
+			order, err := store.GetOrder(ctx, strconv.FormatUint(uint64(event.OrderID), 10))
+			order.Status = event.Status // As it was changed to, should it have moved on since
+			return OrderChange{Order: order, PreviousStatus: event.PreviousStatus}, err
+		})
+	})
+	events.Subscribe(bus, "webhooks", func(ctx context.Context, event models.ProductChanged) error {
+		eventType := models.WebhookProductUpdated
+		if event.Created {
+			eventType = models.WebhookProductCreated
+		}
+		return queue(ctx, store, eventType, func() (any, error) {
+			product, err := store.GetProduct(ctx, event.ProductID)
+			return map[string]any{"product": product}, err
+		})
+	})
+}
+
+// queue queues a delivery of an event to each subscription that receives
+// eventType, reading the event's data only if there are any. Data that's
+// been deleted since isn't sent.
+func queue(ctx context.Context, store database.Store, eventType string, data func() (any, error)) error {
+	subs, err := store.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("read subscriptions: %v", err)
+	}
+	var receiving []models.WebhookSubscription
+	for _, sub := range subs {
+		if sub.Receives(eventType) {
+			receiving = append(receiving, sub)
+		}
+	}
+	if len(receiving) == 0 {
+		return nil
+	}
+	value, err := data()
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return enqueue(ctx, store, receiving, eventType, value)
+}
+
+// enqueue queues a delivery of the event to each of subs, due now
+func enqueue(ctx context.Context, store database.Store, subs []models.WebhookSubscription, eventType string, data any) error {
+	id, err := newEventID()
+	if err != nil {
+		return fmt.Errorf("new event ID: %v", err)
+	}
+	now := time.Now()
+	payload, err := json.Marshal(Event{ID: id, Type: eventType, OccurredAt: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("encode %s: %v", eventType, err)
+	}
+
+	deliveries := make([]models.WebhookDelivery, len(subs))
+	for i, sub := range subs {
+		deliveries[i] = models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        id,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+		}
+	}
+	return store.EnqueueWebhookDeliveries(ctx, deliveries)
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedHeader returns the headers of a delivery of body signed with secret
+// at timestamp
+func signedHeader(secret string, timestamp time.Time, body []byte) http.Header {
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set(HeaderSignature, Sign(secret, timestamp.Unix(), body))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"order.placed"}`)
+	if err := Verify("secret", signedHeader("secret", time.Now(), body), body, DefaultTolerance); err != nil {
+		t.Fatalf("refused a signed delivery: %v", err)
+	}
+
+	forged := signedHeader("secret", time.Now(), body)
+	forged.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+	for name, tc := range map[string]struct {
+		header http.Header
+		body   []byte
+	}{
+		"another secret's":        {signedHeader("other", time.Now(), body), body},
+		"changed body's":          {signedHeader("secret", time.Now(), body), []byte(`{"type":"order.refunded"}`)},
+		"changed timestamp's":     {forged, body},
+		"replayed delivery's":     {signedHeader("secret", time.Now().Add(-time.Hour), body), body},
+		"future delivery's":       {signedHeader("secret", time.Now().Add(time.Hour), body), body},
+		"missing":                 {http.Header{}, body},
+		"timestamp-less header's": {http.Header{HeaderSignature: {Sign("secret", 0, body)}}, body},
+	} {
+		if err := Verify("secret", tc.header, tc.body, DefaultTolerance); err == nil {
+			t.Errorf("accepted a %s signature", name)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Receivers recompute this in their own languages, so it mustn't change
+	got := Sign("whsec_test", 1700000000, []byte(`{}`))
+	if want := "sha256=35495024f4ef3f94e5a93e22221544c4b75e9a42300cd965ab81cb85cd994e91"; got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+}